@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"context"
+	"database/sql"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// After hook that creates the player on the first device login.
+func AfterAuthenticateDevice(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, out *api.Session, in *api.AuthenticateDeviceRequest) error {
+	return InitPlayerOnAuthenticate(ctx, logger, nk)
+}
+
+// After hook that creates the player on the first custom id login.
+func AfterAuthenticateCustom(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, out *api.Session, in *api.AuthenticateCustomRequest) error {
+	return InitPlayerOnAuthenticate(ctx, logger, nk)
+}
+
+// This function creates and saves the player for the authenticated user if it doesn't exist yet.
+func InitPlayerOnAuthenticate(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) error {
+	//Get the user id from the runtime.
+	userID, err := UtilGetUserId(ctx)
+	if err != nil {
+		logger.Error("Unable to extract user id from context due to error: %v", err)
+		return err
+	}
+
+	//Returning players already have their data.
+	rObj, err := nk.StorageRead(ctx, []*runtime.StorageRead{
+		{
+			Collection: playerDataStorageCollection,
+			Key: PlayerDataStorageKey,
+			UserID: userID,
+		},
+	})
+	if err != nil {
+		logger.Error("Unable to read player data: %v", err)
+		return err
+	}
+	if len(rObj) > 0 {
+		return nil
+	}
+
+	//Create and save the player.
+	player, err := CreatePlayer(ctx, logger, nk, userID)
+	if err != nil {
+		return err
+	}
+	err = player.SavePlayerData(nk)
+	if err != nil {
+		logger.Error("Unable to save player data: %v", err)
+		return err
+	}
+	logger.Info("Created player %s (%s) on first login.", userID, player.DisplayName)
+	return nil
+}
+
+// This function builds a new player for the account, setting the account display name from the username if it is empty.
+func CreatePlayer(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID string) (*Player, error) {
+	//Get the users account data to get a display name.
+	account, err := nk.AccountGetId(ctx, userID)
+	if err != nil {
+		//More robust logging to get more info.
+		logger.WithFields(map[string]interface{}{
+			"userID": userID,
+		}).Error("Unable to lookup account due to error: %v.", err)
+		return nil, err
+	}
+	if account.GetUser() == nil {
+		return nil, NewGameError(CodeNotFound, ReasonAccountNotFound, fmt.Sprintf("Account not found: %s", userID))
+	}
+	//Set the display name from the users account data.
+	displayName := account.User.DisplayName
+	if displayName == "" {  //This is often empty as it requies a separate call to set.
+		displayName = account.User.Username
+		if err := nk.AccountUpdateId(ctx, userID, "", nil, displayName, "", "", "", ""); err != nil {
+			//Not fatal, the player still gets the username as the display name.
+			logger.WithFields(map[string]interface{}{
+				"userID": userID,
+			}).Warn("Unable to set account display name: %v.", err)
+		}
+	}
+	//Create new player object.
+	player := NewPlayer(userID, displayName)
+	player.version = "*" //Only write if no one else created it first.
+	return player, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+func TestInitPlayerOnAuthenticate(t *testing.T) {
+	nk := newTestNakama()
+	InitAttackRegistry()
+	userID := UtilMakeUUID()
+	ctx := testUserContext(userID)
+	read := []*runtime.StorageRead{{Collection: playerDataStorageCollection, Key: PlayerDataStorageKey, UserID: userID}}
+
+	//The first login creates the player, naming them after the username.
+	if err := InitPlayerOnAuthenticate(ctx, &testLogger{}, nk); err != nil {
+		t.Fatalf("first login: %v", err)
+	}
+	objects, _ := nk.StorageRead(ctx, read)
+	if len(objects) != 1 {
+		t.Fatal("expected the player saved on the first login")
+	}
+	player, err := LoadPlayerData(ctx, &testLogger{}, nk, userID)
+	if err != nil || player.DisplayName != "user_" + userID || nk.displayNames[userID] != "user_" + userID {
+		t.Fatalf("expected the username as the display name, got %q account %q: %v", player.DisplayName, nk.displayNames[userID], err)
+	}
+
+	//Returning players are left alone.
+	player.AddCurrency(Gold, 500)
+	if err := player.SavePlayerData(nk); err != nil {
+		t.Fatalf("SavePlayerData: %v", err)
+	}
+	objects, _ = nk.StorageRead(ctx, read)
+	version := objects[0].Version
+	if err := InitPlayerOnAuthenticate(ctx, &testLogger{}, nk); err != nil {
+		t.Fatalf("second login: %v", err)
+	}
+	objects, _ = nk.StorageRead(ctx, read)
+	if objects[0].Version != version {
+		t.Fatal("an existing player shouldn't be saved again on login")
+	}
+	player, err = LoadPlayerData(ctx, &testLogger{}, nk, userID)
+	if err != nil || player.GetCurrency(Gold) != StarterGold + 500 {
+		t.Fatalf("expected the existing player kept, got gold %d: %v", player.GetCurrency(Gold), err)
+	}
+
+	//No user in the context, nothing to create.
+	if err := InitPlayerOnAuthenticate(context.Background(), &testLogger{}, nk); err == nil {
+		t.Fatal("expected an error without a user id")
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"context"
+	"encoding/json"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+var achievementDataStorageKey = "achievements" //Definitions in the config collection.
+var AchievementStorageKey = "achievements" //Progress in the player data collection.
+
+const AchievementNotificationCode = 106
+const AchievementSaveRetries = 3
+
+// Information on a single achievement definition.
+type AchievementInfo struct {
+	ID string `json:"id"`
+	Name string `json:"name"`
+	Description string `json:"description"`
+	Condition EventCondition `json:"condition"` //What has to happen for it to unlock.
+	Rewards []RewardInfo `json:"rewards"` //Granted when unlocked.
+}
+
+// Registry to hold all of the definitions.  Using a mutex here since the data could be live-ops driven meaning it could change after nakama init.
+// **NOTE: If the plan is to not update this information after nakama init then this paradigm can be change to a simple read-only map instead.
+var AchievementRegistry = struct {
+	sync.RWMutex //Read/write mutex to help with concurrent access allowing mulitple readers or a single writer.
+	Achievements map[string]AchievementInfo
+}{
+	Achievements: make(map[string]AchievementInfo),
+}
+
+// A player's achievement progress.
+type PlayerAchievements struct {
+	Progress map[string]int `json:"progress"` //Progress towards the condition by achievement id.
+	Unlocked map[string]int64 `json:"unlocked"` //Unlock timestamp by achievement id.
+	version string //Storage version hash from the last read.
+}
+
+// Achievement with the player's progress, sent to the client.
+type AchievementView struct {
+	AchievementInfo
+	Progress int `json:"progress"`
+	UnlockedAt int64 `json:"unlocked_at,omitempty"`
+}
+
+// This function will initialize the Achievement Registry.
+func InitAchievementRegistry(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) error {
+	//Read from the storage engine.
+	rObj, err := nk.StorageRead(ctx, []*runtime.StorageRead{
+		{
+			Collection: configDataStorageCollection,
+			Key: achievementDataStorageKey,
+		},
+	})
+	if err != nil {
+		logger.Error("Error getting achievement configuration data: %v", err)
+		return err
+	}
+	//Load defaults if nothing was found in storage and save them into storage.
+	if len(rObj) == 0 {
+		AchievementRegistry.Lock()  //Call lock on the mutex in preparation for writing.
+		AchievementRegistry.Achievements["zombie_slayer"] = AchievementInfo{
+			ID: "zombie_slayer",
+			Name: "Zombie Slayer",
+			Description: "Kill 100 zombies.",
+			Condition: EventCondition{
+				Event: EventKill,
+				Target: string(Zombie),
+				Count: 100,
+			},
+			Rewards: []RewardInfo{
+				{Type: Gold, Amount: 500},
+				{Type: Gems, Amount: 10},
+			},
+		}
+		AchievementRegistry.Achievements["sharp_eye"] = AchievementInfo{
+			ID: "sharp_eye",
+			Name: "Sharp Eye",
+			Description: "Land 10 critical hits.",
+			Condition: EventCondition{
+				Event: EventCrit,
+				Count: 10,
+			},
+			Rewards: []RewardInfo{
+				{Type: Gold, Amount: 200},
+			},
+		}
+		AchievementRegistry.Achievements["flawless_victory"] = AchievementInfo{
+			ID: "flawless_victory",
+			Name: "Flawless Victory",
+			Description: "Win a battle without taking any damage.",
+			Condition: EventCondition{
+				Event: EventFlawlessVictory,
+				Count: 1,
+			},
+			Rewards: []RewardInfo{
+				{Type: Gems, Amount: 5},
+			},
+		}
+		AchievementRegistry.Achievements["blood_letter"] = AchievementInfo{
+			ID: "blood_letter",
+			Name: "Blood Letter",
+			Description: "Have 3 bleed stacks on an enemy at once.",
+			Condition: EventCondition{
+				Event: EventStatusEffectApplied,
+				StatusEffect: Bleed,
+				MinValue: 3,
+				Count: 1,
+			},
+			Rewards: []RewardInfo{
+				{Type: Gold, Amount: 150},
+				{Type: ItemReward, Amount: 2, ItemID: Bandage},
+			},
+		}
+		AchievementRegistry.Unlock() //Don't forget to release the mutex lock.
+		return SaveAchievementRegistry(nk)
+	}
+
+	var achievements map[string]AchievementInfo
+	if err := json.Unmarshal([]byte(rObj[0].Value), &achievements); err != nil {
+		logger.Error("Failed to unmarshal achievement data: %v", err)
+		return err
+	}
+	AchievementRegistry.Lock()  //Call lock on the mutex in preparation for writing.
+	AchievementRegistry.Achievements = achievements
+	AchievementRegistry.Unlock() //Don't forget to release the mutex lock.
+
+	return nil
+}
+
+// This function will save the Achievement Registry to storage.
+func SaveAchievementRegistry(nk runtime.NakamaModule) error {
+	AchievementRegistry.RLock() //Read lock.
+	//Json-ify the achievement registry in prepartion for storage.
+	data, err := json.Marshal(AchievementRegistry.Achievements)
+	AchievementRegistry.RUnlock() //Don't forget to release the lock.
+	if err != nil {
+		return err
+	}
+	wObj := []*runtime.StorageWrite{
+		{
+			Collection: configDataStorageCollection,
+			Key: achievementDataStorageKey,
+			Value: string(data),
+			PermissionRead: 1, // Owner and runtime can read.
+			PermissionWrite: 0, // No one can write save the runtime.
+		},
+	}
+	//Write to the storage engine.
+	if _, err := nk.StorageWrite(context.Background(), wObj); err != nil {
+		return fmt.Errorf("failed to write achievement data to storage: %v", err)
+	}
+	return nil
+}
+
+// This function gets the player's achievement progress from nakama storage.
+func LoadPlayerAchievements(ctx context.Context, nk runtime.NakamaModule, userID string) (*PlayerAchievements, error) {
+	//Read from the storage engine.
+	rObj, err := nk.StorageRead(ctx, []*runtime.StorageRead{
+		{
+			Collection: playerDataStorageCollection,
+			Key: AchievementStorageKey,
+			UserID: userID,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	achievements := &PlayerAchievements{}
+	if len(rObj) == 0 {
+		achievements.version = "*" //Only write if no one else created it first.
+	} else {
+		//Unmarshal json data to achievements object.
+		if err = json.Unmarshal([]byte(rObj[0].Value), achievements); err != nil {
+			return nil, err
+		}
+		achievements.version = rObj[0].Version
+	}
+	if achievements.Progress == nil {
+		achievements.Progress = make(map[string]int)
+	}
+	if achievements.Unlocked == nil {
+		achievements.Unlocked = make(map[string]int64)
+	}
+	return achievements, nil
+}
+
+// This function builds the storage write for the achievement progress so it can be batched with the player data.
+func (a *PlayerAchievements) AchievementStorageWrite(userID string) (*runtime.StorageWrite, error) {
+	//Json-ify the achievements struct in prepartion for storage.
+	data, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	return &runtime.StorageWrite{
+		Collection: playerDataStorageCollection,
+		Key: AchievementStorageKey,
+		UserID: userID,
+		Value: string(data),
+		Version: a.version,
+		PermissionRead: 1, // Owner and runtime can read.
+		PermissionWrite: 0, // No one can write save the runtime.
+	}, nil
+}
+
+// This function counts the events towards every achievement not yet unlocked and returns the ones that unlocked, in id
+// order.
+func (a *PlayerAchievements) Track(events []BattleEvent, now int64) []AchievementInfo {
+	AchievementRegistry.RLock() //Read lock.
+	defer AchievementRegistry.RUnlock() //Don't forget to release the lock.
+	unlocked := []AchievementInfo{}
+	for id, achievement := range AchievementRegistry.Achievements {
+		if _, done := a.Unlocked[id]; done {
+			continue
+		}
+		for _, event := range events {
+			a.Progress[id] += achievement.Condition.Progress(event)
+		}
+		if a.Progress[id] >= achievement.Condition.Count && a.Progress[id] > 0 {
+			a.Progress[id] = achievement.Condition.Count
+			a.Unlocked[id] = now
+			unlocked = append(unlocked, achievement)
+		}
+	}
+	sort.Slice(unlocked, func(i, j int) bool {
+		return unlocked[i].ID < unlocked[j].ID
+	})
+	return unlocked
+}
+
+// This function checks if any achievement cares about the events, so players aren't read from storage for nothing.
+func AchievementEvents(events []BattleEvent) bool {
+	AchievementRegistry.RLock() //Read lock.
+	defer AchievementRegistry.RUnlock() //Don't forget to release the lock.
+	for _, achievement := range AchievementRegistry.Achievements {
+		for _, event := range events {
+			if achievement.Condition.Matches(event) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// This function lists the achievements with the player's progress.
+func (a *PlayerAchievements) View() []AchievementView {
+	AchievementRegistry.RLock() //Read lock.
+	defer AchievementRegistry.RUnlock() //Don't forget to release the lock.
+	views := []AchievementView{}
+	for id, achievement := range AchievementRegistry.Achievements {
+		views = append(views, AchievementView{
+			AchievementInfo: achievement,
+			Progress: a.Progress[id],
+			UnlockedAt: a.Unlocked[id],
+		})
+	}
+	sort.Slice(views, func(i, j int) bool {
+		return views[i].ID < views[j].ID
+	})
+	return views
+}
+
+// This function tracks achievement progress from events and grants the rewards of any that unlock.  It runs after the
+// player was saved, so the rewards are saved together with the progress and a conflict reloads the player and tries
+// again.  Failures are logged and not returned since the request already succeeded.
+func EvaluateAchievements(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, p *Player, events []BattleEvent) {
+	if !AchievementEvents(events) {
+		return
+	}
+	for attempt := 0; attempt < AchievementSaveRetries; attempt++ {
+		if attempt > 0 {
+			//Someone else saved the player, pick up their changes.
+			fresh, err := LoadPlayerData(ctx, logger, nk, p.ID)
+			if err != nil {
+				logger.Error("Unable to reload player for achievements: %v", err)
+				return
+			}
+			*p = *fresh
+		}
+		achievements, err := LoadPlayerAchievements(ctx, nk, p.ID)
+		if err != nil {
+			logger.Error("Unable to load achievements: %v", err)
+			return
+		}
+		unlocked := achievements.Track(events, p.Now().Unix())
+		for _, achievement := range unlocked {
+			logger.Debug("Achievement unlocked: %s", achievement.ID)
+			p.GrantRewards(logger, achievement.Rewards)
+		}
+
+		//Save progress, with the player when rewards were granted.
+		wObj, err := achievements.AchievementStorageWrite(p.ID)
+		if err != nil {
+			logger.Error("Unable to save achievements: %v", err)
+			return
+		}
+		wObjs := []*runtime.StorageWrite{wObj}
+		if len(unlocked) > 0 {
+			playerWrite, err := p.PlayerStorageWrite()
+			if err != nil {
+				logger.Error("Unable to save player data: %v", err)
+				return
+			}
+			wObjs = append(wObjs, playerWrite)
+		}
+		acks, err := nk.StorageWrite(ctx, wObjs)
+		if err != nil {
+			logger.Debug("Achievement save conflict, attempt %d: %v", attempt + 1, err)
+			continue
+		}
+		p.SetStorageVersion(acks)
+
+		for _, achievement := range unlocked {
+			NotifyAchievement(ctx, logger, nk, p.ID, achievement)
+		}
+		//Rewards can level the player up, handle those events too.
+		ProcessBattleEvents(ctx, logger, nk, p)
+		return
+	}
+	logger.Error("Achievement progress was not saved for user %s.", p.ID)
+}
+
+// This function tells the player about an unlocked achievement.
+func NotifyAchievement(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID string, achievement AchievementInfo) {
+	content := map[string]interface{}{
+		"achievement_id": achievement.ID,
+		"name": achievement.Name,
+		"rewards": achievement.Rewards,
+	}
+	if err := nk.NotificationSend(ctx, userID, "Achievement unlocked", content, AchievementNotificationCode, "", true); err != nil {
+		logger.Error("Unable to send achievement notification: %v", err)
+	}
+}
+
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAchievementConditionMatches(t *testing.T) {
+	condition := EventCondition{Event: EventStatusEffectApplied, StatusEffect: Bleed, MinValue: 3, Count: 1}
+	cases := []struct {
+		event BattleEvent
+		matches bool
+	}{
+		{BattleEvent{Event: EventStatusEffectApplied, StatusEffect: Bleed, Value: 3}, true},
+		{BattleEvent{Event: EventStatusEffectApplied, StatusEffect: Bleed, Value: 2}, false},
+		{BattleEvent{Event: EventStatusEffectApplied, StatusEffect: Poison, Value: 3}, false},
+		{BattleEvent{Event: EventKill, StatusEffect: Bleed, Value: 3}, false},
+	}
+	for _, c := range cases {
+		if condition.Matches(c.event) != c.matches {
+			t.Errorf("%+v should match: %t", c.event, c.matches)
+		}
+	}
+	kills := EventCondition{Event: EventKill, Target: string(Zombie), Count: 100}
+	if !kills.Matches(BattleEvent{Event: EventKill, Target: string(Zombie)}) || kills.Matches(BattleEvent{Event: EventKill, Target: string(Beast)}) {
+		t.Error("kill condition should only match zombies")
+	}
+}
+
+func TestAchievementTrackUnlocksOnce(t *testing.T) {
+	if err := InitAchievementRegistry(context.Background(), &testLogger{}, newTestNakama()); err != nil {
+		t.Fatalf("InitAchievementRegistry: %v", err)
+	}
+	achievements := &PlayerAchievements{Progress: map[string]int{"sharp_eye": 8}, Unlocked: map[string]int64{}}
+	crits := []BattleEvent{{Event: EventCrit}, {Event: EventCrit}, {Event: EventCrit}}
+	unlocked := achievements.Track(crits, 100)
+	if len(unlocked) != 1 || unlocked[0].ID != "sharp_eye" {
+		t.Fatalf("sharp_eye should unlock: %+v", unlocked)
+	}
+	if achievements.Progress["sharp_eye"] != 10 || achievements.Unlocked["sharp_eye"] != 100 {
+		t.Errorf("progress should stop at the goal: %+v", achievements)
+	}
+	if unlocked := achievements.Track(crits, 200); len(unlocked) != 0 || achievements.Unlocked["sharp_eye"] != 100 {
+		t.Errorf("achievements only unlock once: %+v %+v", unlocked, achievements)
+	}
+}
+
+func TestFlawlessVictoryUnlocksAchievement(t *testing.T) {
+	ctx := context.Background()
+	logger := &testLogger{}
+	nk := newTestNakama()
+	if err := InitAchievementRegistry(ctx, logger, nk); err != nil {
+		t.Fatalf("InitAchievementRegistry: %v", err)
+	}
+	attackType := testSureHitAttack(t, 30)
+	player := NewPlayer(UtilMakeUUID(), "tester")
+	player.Loadout = []AttackType{attackType}
+	targetID := UtilMakeUUID()
+	player.BattleState.Enemies = map[string]*Enemy{
+		targetID: {Type: Zombie, Health: 30, MaxHealth: 30},
+	}
+	gems := player.GetCurrency(Gems)
+	if _, err := player.PlayerAttack(logger, targetID, attackType); err != nil {
+		t.Fatalf("PlayerAttack: %v", err)
+	}
+	if _, err := CommitRequest(ctx, logger, nk, nil, player, struct{}{}); err != nil {
+		t.Fatalf("CommitRequest: %v", err)
+	}
+
+	if player.GetCurrency(Gems) != gems + 5 {
+		t.Errorf("gems are %d, want %d", player.GetCurrency(Gems), gems + 5)
+	}
+	stored, err := LoadPlayerData(ctx, logger, nk, player.ID)
+	if err != nil || stored.GetCurrency(Gems) != gems + 5 {
+		t.Errorf("rewards weren't saved: %v", err)
+	}
+	achievements, err := LoadPlayerAchievements(ctx, nk, player.ID)
+	if err != nil {
+		t.Fatalf("LoadPlayerAchievements: %v", err)
+	}
+	if achievements.Unlocked["flawless_victory"] == 0 || achievements.Progress["zombie_slayer"] != 1 {
+		t.Errorf("progress: %+v", achievements)
+	}
+	if len(nk.notifications) != 1 || nk.notifications[0].Code != AchievementNotificationCode || nk.notifications[0].UserID != player.ID {
+		t.Errorf("notifications: %+v", nk.notifications)
+	}
+}
+
+func TestDamageTakenBlocksFlawlessVictory(t *testing.T) {
+	player := NewPlayer(UtilMakeUUID(), "tester")
+	targetID := UtilMakeUUID()
+	player.BattleState.Enemies = map[string]*Enemy{
+		targetID: {Type: Zombie, Health: 0, MaxHealth: 30},
+	}
+	player.Health -= 5
+	player.RecordDamageTaken(player.Health + 5)
+	player.CleanUpSuccessfulBattle(&testLogger{}, targetID)
+	for _, event := range player.TakeBattleEvents() {
+		if event.Event == EventFlawlessVictory {
+			t.Fatal("battle with damage taken isn't flawless")
+		}
+	}
+}
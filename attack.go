@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/heroiclabs/nakama-common/runtime"
@@ -17,8 +18,24 @@ const ( //Building it this way avoids using string values on maps but allows the
 	HeadButt AttackType = "headbutt"
 	Bite AttackType = "bite"
 	Scratch AttackType = "scratch"
+	Slash AttackType = "slash"
 )
 
+// Who can use an attack.
+type AttackOwner string
+const (
+	OwnerPlayer AttackOwner = "player"
+	OwnerEnemy AttackOwner = "enemy"
+	OwnerBoth AttackOwner = "both"
+)
+
+// Requirements a player must meet before an attack can be put in their loadout.  Empty values are ignored.
+type UnlockRequirement struct {
+	Level int `json:"level"` //Minimum player level.
+	Item ItemType `json:"item,omitempty"` //Item the player must own, either in the inventory or equipped.
+	Quest string `json:"quest,omitempty"` //Quest the player must have completed.
+}
+
 // Information on single attack action.
 // @JWK TODO: Change Damange to a range like min, max to use in RNG Fx instead of static damage.
 type AttackInfo struct {
@@ -26,6 +43,54 @@ type AttackInfo struct {
 	Damage int `json:"damage"` //Damage potential that could end up being less or none if say it were a glancing blow or parried.
 	BaseHitChance float64 `json:"base_hit_chance"` //Hit chance on whether the attack connects or not to deal damage, or not.
 	ApplicableStatusEffect []StatusEffectFromAttacks `json:"applicable_status_effects` //Effects that can be applied through attack actions.
+	EquipmentOnly bool `json:"equipment_only"` //Only usable when granted by equipped gear.
+	Owner AttackOwner `json:"owner"` //Whether players, enemies or both can use the attack.
+	Unlock UnlockRequirement `json:"unlock"` //What a player needs before using the attack.
+	CritChance float64 `json:"crit_chance"` //Chance a hit is critical and deals CritMultiplier times the damage.
+}
+
+const CritMultiplier = 2
+
+// Outcome of a single player attack.
+type AttackResult struct {
+	TargetID string `json:"target_id"`
+	Attack AttackType `json:"attack"`
+	Hit bool `json:"hit"`
+	Damage int `json:"damage"` //Damage dealt by the attack itself, status effect ticks aren't included.
+	Crit bool `json:"crit"`
+	EnemyHealth int `json:"enemy_health"`
+	EnemyKilled bool `json:"enemy_killed"`
+	PlayerHealth int `json:"player_health"`
+	PlayerDead bool `json:"player_dead"`
+	Rewards []RewardInfo `json:"rewards,omitempty"` //Granted when the enemy was killed.
+	StatusEffectDamage map[string]int `json:"-"` //Status effect damage dealt to the target by the user id that applied it, empty for untracked effects.
+}
+
+// Why an attack sequence stopped before running every action.
+type SequenceStopReason string
+const (
+	SequenceCompleted SequenceStopReason = "" //Every action ran.
+	SequencePlayerDead SequenceStopReason = "player_dead"
+	SequenceBattleOver SequenceStopReason = "battle_over" //No enemies left to attack.
+	SequenceInvalidAction SequenceStopReason = "invalid_action" //See the error on the last result.
+)
+
+// Outcome of one action in an attack sequence.
+type AttackSequenceResult struct {
+	Index int `json:"index"`
+	Result *AttackResult `json:"result,omitempty"`
+	Code int `json:"code,omitempty"` //gRPC code when the action couldn't run.
+	Error *GameError `json:"error,omitempty"`
+}
+
+// Outcome of a single enemy attack.
+type EnemyAttackResult struct {
+	EnemyID string `json:"enemy_id"`
+	Attack AttackType `json:"attack"`
+	Hit bool `json:"hit"`
+	Damage int `json:"damage"` //Damage taken after defense.
+	PlayerHealth int `json:"player_health"`
+	PlayerDead bool `json:"player_dead"`
 }
 
 type StatusEffectFromAttacks struct {
@@ -49,8 +114,11 @@ func InitAttackRegistry() {
 	defer AttackRegistry.Unlock() //Don't forget to release the mutex lock.
 	AttackRegistry.Attacks[Jab] = AttackInfo{
 		Type: Jab,
+		Owner: OwnerPlayer,
+		Unlock: UnlockRequirement{Level: 1},
 		Damage: 2,
 		BaseHitChance: 0.95,
+		CritChance: 0.05,
 		ApplicableStatusEffect: []StatusEffectFromAttacks{
 			{
 				Type: Dazed,
@@ -60,8 +128,11 @@ func InitAttackRegistry() {
 	}
 	AttackRegistry.Attacks[Punch] = AttackInfo{
 		Type: Punch,
+		Owner: OwnerPlayer,
+		Unlock: UnlockRequirement{Level: 1},
 		Damage: 4,
 		BaseHitChance: 0.9,
+		CritChance: 0.05,
 		ApplicableStatusEffect: []StatusEffectFromAttacks{
 			{
 				Type: Dazed,
@@ -75,8 +146,11 @@ func InitAttackRegistry() {
 	}
 	AttackRegistry.Attacks[Kick] = AttackInfo{
 		Type: Kick,
+		Owner: OwnerPlayer,
+		Unlock: UnlockRequirement{Level: 2},
 		Damage: 7,
 		BaseHitChance: 0.75,
+		CritChance: 0.1,
 		ApplicableStatusEffect: []StatusEffectFromAttacks{
 			{
 				Type: Poison, //Dirty feet/shoes applying poison???
@@ -86,14 +160,20 @@ func InitAttackRegistry() {
 	}
 	AttackRegistry.Attacks[UpperCut] = AttackInfo{
 		Type: UpperCut,
+		Owner: OwnerPlayer,
+		Unlock: UnlockRequirement{Level: 3},
 		Damage: 10,
 		BaseHitChance: 0.5,
+		CritChance: 0.25,
 		ApplicableStatusEffect: []StatusEffectFromAttacks{},
 	}
 	AttackRegistry.Attacks[HeadButt] = AttackInfo{
 		Type: HeadButt,
+		Owner: OwnerBoth,
+		Unlock: UnlockRequirement{Level: 5},
 		Damage: 12,
 		BaseHitChance: 0.35,
+		CritChance: 0.15,
 		ApplicableStatusEffect: []StatusEffectFromAttacks{
 			{
 				Type: Dazed,
@@ -107,6 +187,8 @@ func InitAttackRegistry() {
 	}
 	AttackRegistry.Attacks[Bite] = AttackInfo{
 		Type: Bite,
+		Owner: OwnerEnemy,
+		Unlock: UnlockRequirement{Level: 1},
 		Damage: 5,
 		BaseHitChance: 0.9,
 		ApplicableStatusEffect: []StatusEffectFromAttacks{
@@ -118,6 +200,8 @@ func InitAttackRegistry() {
 	}
 	AttackRegistry.Attacks[Scratch] = AttackInfo{
 		Type: Scratch,
+		Owner: OwnerEnemy,
+		Unlock: UnlockRequirement{Level: 1},
 		Damage: 4,
 		BaseHitChance: 0.95,
 		ApplicableStatusEffect: []StatusEffectFromAttacks{
@@ -127,88 +211,207 @@ func InitAttackRegistry() {
 			},
 		},
 	}
+	AttackRegistry.Attacks[Slash] = AttackInfo{
+		Type: Slash,
+		Owner: OwnerPlayer,
+		Unlock: UnlockRequirement{Level: 1},
+		Damage: 9,
+		BaseHitChance: 0.8,
+		CritChance: 0.1,
+		ApplicableStatusEffect: []StatusEffectFromAttacks{
+			{
+				Type: Bleed,
+				Chance: 0.5,
+			},
+		},
+		EquipmentOnly: true,
+	}
 }
 
-//
-func (p *Player) PlayerAttack(logger runtime.Logger, targetID string, attackRequest AttackType) error {
+// This function gets the damage the user dealt, the attack's own plus their status effect ticks.  Untracked effects count
+// for the user too.
+func (r *AttackResult) DamageBy(userID string) int {
+	return r.Damage + r.StatusEffectDamage[userID] + r.StatusEffectDamage[""]
+}
+
+// This function performs a player attack on an enemy in the battle state and reports what happened.
+func (p *Player) PlayerAttack(logger runtime.Logger, targetID string, attackRequest AttackType) (*AttackResult, error) {
 	//Look for the target
 	targetEnemy := p.GetEnemy(targetID)
-	if targetEnemy.Type == "" {
-		return runtime.NewError(fmt.Sprintf("Enemy not found by supplied ID: %s", targetID), 5) //Not found
+	if targetEnemy == nil || targetEnemy.Type == "" {
+		return nil, NewGameError(CodeNotFound, ReasonEnemyNotFound, fmt.Sprintf("Enemy not found by supplied ID: %s", targetID))
 	}
 	logger.Debug("Target found: %+v", targetEnemy)
 
+	health := p.Health
+	result, err := p.AttackCombatant(logger, targetID, targetEnemy, attackRequest, p.Now().Unix()) //Solo battles run on the player's clock.
+	if err != nil {
+		return nil, err
+	}
+	p.BattleState.Damage += result.DamageBy(p.ID)
+	p.RecordDamageTaken(health) //Status effects ticking on the player.
+
+	//Check if anyone died after attack action / status effects.
+	if p.IsPlayerDead() == true {
+		//@JWK TODO: Handle this (Game is over?  Clear stats?  New character and fresh start?).
+	}
+	if result.EnemyKilled == true {
+		//Update battle stats.
+		logger.Debug("Enemy died, running clean up.")
+		result.Rewards = targetEnemy.Rewards
+		p.CleanUpSuccessfulBattle(logger, targetID)
+	}
+
+	//@JWK TODO: Implement battle log.
+
+	return result, nil
+}
+
+// This function performs a player attack on any combatant and ticks status effects on both at the given time.  Clean up
+// is left to the caller so battles, raids and duels can each handle a kill their own way.
+func (p *Player) AttackCombatant(logger runtime.Logger, targetID string, target Combatant, attackRequest AttackType, timestamp int64) (*AttackResult, error) {
 	//Check attack.
 	AttackRegistry.RLock() //Read lock.
 	attackAction := AttackRegistry.Attacks[attackRequest]
 	AttackRegistry.RUnlock() //Release read lock.
 	//Did we find the attack?
 	if attackAction.Type == "" {
-		return runtime.NewError(fmt.Sprintf("Attack action not found: %s", attackRequest), 5) //Not found
+		return nil, NewGameError(CodeNotFound, ReasonAttackNotFound, fmt.Sprintf("Attack action not found: %s", attackRequest))
+	}
+	//Make sure the player is allowed to use it.
+	if !p.InLoadout(attackAction.Type) {
+		return nil, NewGameError(CodeFailedPrecondition, ReasonAttackNotInLoadout, fmt.Sprintf("Attack action not in loadout: %s", attackRequest))
+	}
+	if err := p.CanUseAttack(attackAction); err != nil {
+		return nil, err
 	}
 	logger.Debug("Attack action found: %+v", attackAction)
 
 	//Check if anyone was dead befor attack action / status effects.
 	if p.IsPlayerDead() == true {
-		return runtime.NewError("Player is deceased.", 5) //Not found
+		return nil, NewGameError(CodeFailedPrecondition, ReasonPlayerDead, "Player is deceased.")
 	}
-	if targetEnemy.IsEnemyDead() == true {
-		return runtime.NewError("Enemy is deceased.", 5) //Not found
+	if target.GetHealth() <= 0 {
+		return nil, NewGameError(CodeFailedPrecondition, ReasonEnemyDead, "Enemy is deceased.")
 	}
 
+	//Effective stats from equipped gear.
+	gearStats := p.GetEquipmentStats()
+	logger.Debug("gearStats: %+v", gearStats)
+
 	//Check for status effects that affect combat for the player.
-	var hitChance float64 = attackAction.BaseHitChance
-	logger.Debug("hitChance: %f", hitChance)
-	for _, effect := range p.StatusEffects {
-		//@JWK TODO: Make sure the effects aren't expired.
-		if effect.Type == Dazed || effect.Type == Blind { //Status effects that affect hit chance.
-			hitChance -= effect.Modifier
-			logger.Debug("hitChance: %f", hitChance)
-		}
+	var hitChance float64 = StatusEffectHitChance(logger, attackAction.BaseHitChance + gearStats.HitChance, p.StatusEffects)
+
+	result := &AttackResult{
+		TargetID: targetID,
+		Attack: attackAction.Type,
 	}
+	p.SetBattleEvent(BattleEvent{
+		Event: EventAttackUsed,
+		Target: targetID,
+		Attack: attackAction.Type,
+	})
 
 	//Perform attack.
 	//@JWK TODO: Handle this!
 	if ActionSuceeded(logger, hitChance) == true {
 		logger.Debug("Performing attack: %+v", attackAction)
 		// @JWK TODO: Change Damange to a range like min, max to use in RNG Fx instead of static damage.
-		dmg := (attackAction.Damage) * -1 //Damage subtracts from pool, flip the sign.
+		dmg := (attackAction.Damage + gearStats.Damage) * -1 //Damage subtracts from pool, flip the sign.
+		if ActionSuceeded(logger, attackAction.CritChance) == true {
+			logger.Debug("Critical hit.")
+			dmg *= CritMultiplier
+			result.Crit = true
+		}
 		logger.Debug("Dmg: %d", dmg)
 		//Adjust health.
-		targetEnemy.EnemyHealth(dmg)
-		logger.Debug("targetEnemy: %+v", targetEnemy)
+		health := target.GetHealth()
+		target.TakeDamage(-dmg)
+		result.Hit = true
+		result.Damage = health - target.GetHealth()
+		p.SetBattleEvent(BattleEvent{
+			Event: EventAttackHit,
+			Target: targetID,
+			Attack: attackAction.Type,
+			Damage: result.Damage,
+		})
+		if result.Crit {
+			p.SetBattleEvent(BattleEvent{
+				Event: EventCrit,
+				Target: targetID,
+				Attack: attackAction.Type,
+				Damage: result.Damage,
+			})
+		}
+		logger.Debug("target: %+v", target)
 		//Apply status effects if the attack lands.
 		for _, effect := range attackAction.ApplicableStatusEffect {
 			logger.Debug("Status effect: %+v", effect)
-			if ActionSuceeded(logger, effect.Chance) == true {
+			if ActionSuceeded(logger, effect.Chance + gearStats.StatusEffectChance) == true {
 				logger.Debug("Apply status effect: %+v", effect)
 				//Add status effect.
-				AddStatusEffect(logger, effect.Type, targetEnemy)
+				if added := AddStatusEffect(logger, effect.Type, target, timestamp); added != nil {
+					added.AppliedBy = p.ID
+				}
+				p.SetBattleEvent(BattleEvent{
+					Event: EventStatusEffectApplied,
+					Target: targetID,
+					StatusEffect: effect.Type,
+					Value: CountStatusEffects(target, effect.Type),
+				})
 			}
 		}
+	} else {
+		p.SetBattleEvent(BattleEvent{
+			Event: EventAttackMissed,
+			Target: targetID,
+			Attack: attackAction.Type,
+		})
 	}
 	
-	//Tick status effects.
-	TickStatusEffect(logger, targetEnemy)
-	TickStatusEffect(logger, p)
-
-	//Check if anyone died after attack action / status effects.
-	if p.IsPlayerDead() == true {
-		//@JWK TODO: Handle this (Game is over?  Clear stats?  New character and fresh start?).
-	}
-	if targetEnemy.IsEnemyDead() == true {
-		//@JWK TODO: Handle this (Get rewards, update stats, get new enemies, etc).
-		//Update battle stats.
-		logger.Debug("Enemy died, running clean up.")
-		p.CleanUpSuccessfulBattle(logger, targetID)
+	//Tick status effects, only the player's own effects are recorded as their battle events.
+	result.StatusEffectDamage = make(map[string]int)
+	for source, dealt := range TickStatusEffectSources(logger, target, timestamp) {
+		for _, damage := range dealt {
+			result.StatusEffectDamage[source] += damage
+		}
+		if source == "" || source == p.ID {
+			p.RecordStatusEffectDamage(targetID, dealt)
+		}
 	}
+	p.TickPlayerStatusEffects(logger, timestamp)
 
-	//@JWK TODO: Once the player has done an attack, the enemy gets a turn to attack.
-
-	//@JWK TODO: Implement battle log.
-
+	result.EnemyHealth = target.GetHealth()
+	result.EnemyKilled = target.GetHealth() <= 0
+	result.PlayerHealth = p.Health
+	result.PlayerDead = p.IsPlayerDead()
+	return result, nil
+}
 
-	return nil
+// This function runs attacks in order against the loaded player, stopping at the first one that leaves the player dead,
+// ends the battle or can't run.  Nothing is saved here so the caller can save the whole sequence once.
+func (p *Player) AttackSequence(logger runtime.Logger, actions []AttackAction) ([]AttackSequenceResult, SequenceStopReason) {
+	results := []AttackSequenceResult{}
+	for i, action := range actions {
+		err := action.Validate()
+		var result *AttackResult
+		if err == nil {
+			result, err = p.PlayerAttack(logger, action.TargetID, action.Attack)
+		}
+		if err != nil {
+			code, body := ErrorBody(err)
+			results = append(results, AttackSequenceResult{Index: i, Code: code, Error: &body})
+			return results, SequenceInvalidAction
+		}
+		results = append(results, AttackSequenceResult{Index: i, Result: result})
+		if result.PlayerDead {
+			return results, SequencePlayerDead
+		}
+		if len(p.BattleState.Enemies) == 0 {
+			return results, SequenceBattleOver
+		}
+	}
+	return results, SequenceCompleted
 }
 
 //
@@ -245,12 +448,101 @@ func (e *Enemy) IsEnemyDead() bool {
 
 // This function will change health of the enemy.
 func (e *Enemy) EnemyHealth(delta int) {
-	e.Health += delta
+	e.SetHealth(e.Health + delta)
+}
+
+// Interface function to take a hit from an attack.
+func (e *Enemy) TakeDamage(damage int) {
+	e.EnemyHealth(-damage)
+}
+
+// Interface function to take a hit from an attack, reduced by the player's defense.
+func (p *Player) TakeDamage(damage int) {
+	p.PlayerHealth(-damage)
+}
+
+// This function will change health of the player.  Incoming hits are reduced by equipment defense but always deal at least 1.
+func (p *Player) PlayerHealth(delta int) {
+	if delta < 0 {
+		delta += p.GetEquipmentStats().Defense
+		if delta > -1 {
+			delta = -1
+		}
+	}
+	p.SetHealth(p.Health + delta)
 }
 
-// This function will perform an attack on the player.
-func (e *Enemy) EnemyAttack() {
-	return
+// This function lowers a hit chance for the attacker's status effects.
+func StatusEffectHitChance(logger runtime.Logger, hitChance float64, statusEffects []*StatusEffect) float64 {
+	logger.Debug("hitChance: %f", hitChance)
+	for _, effect := range statusEffects {
+		//@JWK TODO: Make sure the effects aren't expired.
+		if effect.Type == Dazed || effect.Type == Blind { //Status effects that affect hit chance.
+			hitChance += effect.Modifier //Modifiers are negative, ex: Dazed -0.5.
+			logger.Debug("hitChance: %f", hitChance)
+		}
+	}
+	return hitChance
+}
+
+// This function lists the attacks enemies can use, sorted so picks don't depend on map ordering.
+func EnemyAttacks() []AttackInfo {
+	AttackRegistry.RLock() //Read lock.
+	defer AttackRegistry.RUnlock() //Release read lock.
+	attacks := []AttackInfo{}
+	for _, attack := range AttackRegistry.Attacks {
+		if attack.Owner == OwnerEnemy || attack.Owner == OwnerBoth {
+			attacks = append(attacks, attack)
+		}
+	}
+	sort.Slice(attacks, func(i, j int) bool {
+		return attacks[i].Type < attacks[j].Type
+	})
+	return attacks
+}
+
+// This function will perform an attack on the player with one of the enemy attacks.
+func (e *Enemy) EnemyAttack(logger runtime.Logger, enemyID string, p *Player) *EnemyAttackResult {
+	attacks := EnemyAttacks()
+	if len(attacks) == 0 || e.IsEnemyDead() || p.IsPlayerDead() {
+		return nil
+	}
+	attackAction := attacks[BattleDiceRoll(0, len(attacks) - 1)]
+	logger.Debug("Enemy attack action: %+v", attackAction)
+	result := &EnemyAttackResult{
+		EnemyID: enemyID,
+		Attack: attackAction.Type,
+	}
+
+	hitChance := StatusEffectHitChance(logger, attackAction.BaseHitChance, e.StatusEffects)
+	if ActionSuceeded(logger, hitChance) == true {
+		modifier := e.AttackModifier
+		if modifier <= 0 { //Configurations without a modifier deal the base damage.
+			modifier = 1
+		}
+		health := p.Health
+		p.PlayerHealth(-int(float64(attackAction.Damage) * modifier)) //Damage subtracts from pool.
+		result.Hit = true
+		result.Damage = health - p.Health
+		p.BattleState.DamageTaken += result.Damage
+		p.SetBattleEvent(BattleEvent{
+			Event: EventDamageTaken,
+			Target: enemyID,
+			Attack: attackAction.Type,
+			Damage: result.Damage,
+		})
+		p.RecordPlayerDeath(health, e.Type)
+		//Apply status effects if the attack lands.
+		for _, effect := range attackAction.ApplicableStatusEffect {
+			if ActionSuceeded(logger, effect.Chance) == true {
+				logger.Debug("Apply status effect: %+v", effect)
+				AddStatusEffect(logger, effect.Type, p, p.Now().Unix())
+			}
+		}
+	}
+	result.PlayerHealth = p.Health
+	result.PlayerDead = p.IsPlayerDead()
+	return result
 }
 
 // This function determines if an action succeeds.
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// This function registers an attack that always lands so combat tests don't depend on dice rolls.
+func testSureHitAttack(t *testing.T, damage int) AttackType {
+	t.Helper()
+	InitAttackRegistry()
+	attackType := AttackType("test_sure_hit")
+	AttackRegistry.Lock()
+	AttackRegistry.Attacks[attackType] = AttackInfo{
+		Type: attackType,
+		Owner: OwnerPlayer,
+		Damage: damage,
+		BaseHitChance: 1,
+	}
+	AttackRegistry.Unlock()
+	t.Cleanup(func() {
+		AttackRegistry.Lock()
+		delete(AttackRegistry.Attacks, attackType)
+		AttackRegistry.Unlock()
+	})
+	return attackType
+}
+
+func TestAttackSequenceStops(t *testing.T) {
+	attackType := testSureHitAttack(t, 5)
+	player := NewPlayer(UtilMakeUUID(), "tester")
+	player.Loadout = []AttackType{attackType}
+	first, second := UtilMakeUUID(), UtilMakeUUID()
+	player.BattleState.Enemies = map[string]*Enemy{
+		first: {Type: Zombie, Health: 10, MaxHealth: 10},
+		second: {Type: Zombie, Health: 5, MaxHealth: 5},
+	}
+
+	//A bad action stops the sequence after the actions before it ran.
+	results, stopReason := player.AttackSequence(&testLogger{}, []AttackAction{
+		{TargetID: first, Attack: attackType},
+		{TargetID: "not-a-uuid", Attack: attackType},
+		{TargetID: first, Attack: attackType},
+	})
+	if stopReason != SequenceInvalidAction || len(results) != 2 {
+		t.Fatalf("stop %q after %d results, want invalid_action after 2", stopReason, len(results))
+	}
+	if results[0].Result == nil || results[0].Result.Damage != 5 || results[0].Result.EnemyHealth != 5 {
+		t.Fatalf("first result: %+v", results[0].Result)
+	}
+	if results[1].Code != CodeInvalidArgument || results[1].Error == nil || results[1].Error.Field != "target_id" {
+		t.Fatalf("second result: code %d error %+v", results[1].Code, results[1].Error)
+	}
+
+	//Killing the last enemy ends the battle and the sequence.
+	results, stopReason = player.AttackSequence(&testLogger{}, []AttackAction{
+		{TargetID: first, Attack: attackType},
+		{TargetID: second, Attack: attackType},
+		{TargetID: second, Attack: attackType},
+	})
+	if stopReason != SequenceBattleOver || len(results) != 2 {
+		t.Fatalf("stop %q after %d results, want battle_over after 2", stopReason, len(results))
+	}
+	if !results[0].Result.EnemyKilled || !results[1].Result.EnemyKilled {
+		t.Fatalf("both enemies should be killed: %+v %+v", results[0].Result, results[1].Result)
+	}
+
+	//A dead player can't attack.
+	player.BattleState.Enemies = map[string]*Enemy{first: {Type: Zombie, Health: 10, MaxHealth: 10}}
+	player.Health = 0
+	results, stopReason = player.AttackSequence(&testLogger{}, []AttackAction{{TargetID: first, Attack: attackType}})
+	if stopReason != SequenceInvalidAction || results[0].Error.Reason != ReasonPlayerDead {
+		t.Fatalf("dead player: stop %q results %+v", stopReason, results)
+	}
+}
+
+func TestCriticalHitDoublesDamage(t *testing.T) {
+	attackType := testSureHitAttack(t, 5)
+	AttackRegistry.Lock()
+	attack := AttackRegistry.Attacks[attackType]
+	attack.CritChance = 1
+	AttackRegistry.Attacks[attackType] = attack
+	AttackRegistry.Unlock()
+	player := NewPlayer(UtilMakeUUID(), "tester")
+	player.Loadout = []AttackType{attackType}
+	targetID := UtilMakeUUID()
+	player.BattleState.Enemies = map[string]*Enemy{
+		targetID: {Type: Zombie, Health: 30, MaxHealth: 30},
+	}
+	result, err := player.PlayerAttack(&testLogger{}, targetID, attackType)
+	if err != nil {
+		t.Fatalf("PlayerAttack: %v", err)
+	}
+	if !result.Crit || result.Damage != 5 * CritMultiplier {
+		t.Errorf("expected a critical hit for %d: %+v", 5 * CritMultiplier, result)
+	}
+	crits := 0
+	for _, event := range player.TakeBattleEvents() {
+		if event.Event == EventCrit {
+			crits++
+		}
+	}
+	if crits != 1 {
+		t.Errorf("expected one crit event, got %d", crits)
+	}
+}
+
+func TestStatusEffectHitChanceLowersHitChance(t *testing.T) {
+	effects := []*StatusEffect{
+		{Type: Dazed, Modifier: -0.5},
+		{Type: Bleed, Modifier: -5}, //Damage over time, doesn't touch the hit chance.
+	}
+	if hitChance := StatusEffectHitChance(&testLogger{}, 0.9, effects); hitChance < 0.39 || hitChance > 0.41 {
+		t.Fatalf("expected dazed to lower the hit chance to 0.4, got %f", hitChance)
+	}
+	effects = append(effects, &StatusEffect{Type: Blind, Modifier: -0.95})
+	if hitChance := StatusEffectHitChance(&testLogger{}, 0.9, effects); hitChance >= 0 {
+		t.Fatalf("expected dazed and blind to leave no hit chance, got %f", hitChance)
+	}
+}
+
+func TestBattleDamageIncludesStatusEffects(t *testing.T) {
+	InitStatusEffectsRegistry()
+	start := time.Unix(1700000000, 0)
+	clock := testFixedClock(t, start)
+	attackType := testSureHitAttack(t, 1)
+	player := NewPlayer(UtilMakeUUID(), "tester")
+	player.Loadout = []AttackType{attackType}
+	targetID := UtilMakeUUID()
+	enemy := &Enemy{Type: Zombie, Health: 30, MaxHealth: 30, StatusEffects: []*StatusEffect{}}
+	player.BattleState.Enemies = map[string]*Enemy{targetID: enemy}
+	AddStatusEffect(&testLogger{}, Bleed, enemy, start.Unix()).AppliedBy = player.ID
+
+	//Two bleed intervals pass before the hit.
+	clock.now = start.Add(10 * time.Second)
+	if _, err := player.PlayerAttack(&testLogger{}, targetID, attackType); err != nil {
+		t.Fatalf("PlayerAttack: %v", err)
+	}
+	if player.BattleState.Damage != 5 {
+		t.Fatalf("expected the hit and the bleed in the battle damage, got %d", player.BattleState.Damage)
+	}
+
+	//Bleed finishing the enemy off counts towards the battle won damage.
+	enemy.Health = 2
+	state := &BattleMatchState{UserID: player.ID, Player: player}
+	clock.now = start.Add(15 * time.Second)
+	state.tickStatusEffects(&testLogger{})
+	won := false
+	for _, event := range player.TakeBattleEvents() {
+		if event.Event == EventBattleWon {
+			won = true
+			if event.Damage != 7 {
+				t.Fatalf("expected 7 damage in the won battle, got %d", event.Damage)
+			}
+		}
+	}
+	if !won {
+		t.Fatal("bleed should have won the battle")
+	}
+}
@@ -3,7 +3,7 @@ package main
 import (
 	"math/rand"
 	"time"
-	"fmt"
+	"context"
 
 	"github.com/heroiclabs/nakama-common/runtime"
 )
@@ -13,23 +13,71 @@ type EntityProcessor interface {
 	SetStatusEffects([]*StatusEffect)
 	GetHealth() int
 	SetHealth(int)
+	GetMaxHealth() int
+	SetMaxHealth(int)
 }
 
+// Anything a player can attack: enemies in battles and raids, and other players in duels.
+type Combatant interface {
+	EntityProcessor
+	TakeDamage(int) //Applies an incoming hit, players reduce it with their defense.
+}
+
+// Battle event types
+type BattleEventType string
+const (
+	EventAttackHit BattleEventType = "attack_hit" //Damage is what the attack dealt.
+	EventKill BattleEventType = "kill" //Target is the enemy type.
+	EventBattleWon BattleEventType = "battle_won" //Last enemy of a battle died, Damage is the total the player dealt in it.
+	EventLevelUp BattleEventType = "level_up" //Value is the new level.
+	EventCrit BattleEventType = "crit" //Critical hit, also sent as an attack_hit.
+	EventStatusEffectApplied BattleEventType = "status_effect_applied" //Value is how many of the effect the target now has.
+	EventFlawlessVictory BattleEventType = "flawless_victory" //Battle won without taking any damage.
+	EventAttackUsed BattleEventType = "attack_used" //Sent for every attack, hit or miss.
+	EventStatusEffectDamage BattleEventType = "status_effect_damage" //Damage a status effect dealt to the player's target.
+	EventAttackMissed BattleEventType = "attack_missed"
+	EventDamageTaken BattleEventType = "damage_taken" //Damage the player took, Attack or StatusEffect says from what.
+	EventPlayerDeath BattleEventType = "player_death" //Target is the enemy type when an enemy attack killed the player.
+	EventBattleFled BattleEventType = "battle_fled"
+	EventCodexCompleted BattleEventType = "codex_completed" //Target is the enemy type, or "codex" for every entry.
+)
+
 // Used for capturing battle events to log.
 type BattleEvent struct {
 	Actor string `json:"actor"`
-	Event string `json:"event"` //@JWK TODO: Conver this to a type instead of string.
+	Event BattleEventType `json:"event"`
+	Target string `json:"target,omitempty"`
+	Attack AttackType `json:"attack,omitempty"`
 	Damage int `json:"damage"`
 	StatusEffect StatusEffectType `json:"status_effect"`
+	Value int `json:"value,omitempty"`
 	Timestamp int64 `json:"timestamp"`
 }
 
+// Condition over battle events, used by achievements and quests.  Events have to match every field that is set.
+type EventCondition struct {
+	Event BattleEventType `json:"event"`
+	Target string `json:"target,omitempty"` //Only events on this target, ex: the enemy type for kills.
+	Attack AttackType `json:"attack,omitempty"`
+	StatusEffect StatusEffectType `json:"status_effect,omitempty"`
+	MinValue int `json:"min_value,omitempty"` //Only events with at least this value, ex: stacks applied or level reached.
+	CountDamage bool `json:"count_damage,omitempty"` //Count the damage of matching events instead of the events.
+	Count int `json:"count"` //Amount needed to meet the condition.
+}
+
 // Battle data structure.
 type BattleState struct {
+	SchemaVersion int `json:"schema_version"` //Stored data layout version, see migrations.go.
 	Enemies map[string]*Enemy `json:"enemies"` //Plan for more than one possible target.
+	Damage int `json:"damage"` //Damage the player has dealt in this battle, from attacks and status effects.
+	DamageTaken int `json:"damage_taken"` //Damage the player has taken in this battle, from attacks and status effects.
+	AutoSpawned bool `json:"auto_spawned,omitempty"` //Started by loading the game instead of by the player, see Untouched.
 	//@JWK What else is needed???
 }
 
+var ItemDrops = []ItemType{HealthPotion, Antidote, Bandage} //Common drops, one in four enemies.
+var EquipmentDrops = []ItemType{RustySword, LeatherArmor, LuckyCharm} //Rare drops, one in ten enemies.
+
 const LogLimit = 2000 //@JWK TODO: This will need to be adjusted with some stress testing.
 
 //This function will attempt to get an on-going battle or create one.
@@ -39,52 +87,158 @@ func (p *Player) LoadBattleState() error {
 			return nil
 		}
 	}
-	err := p.CreateBattle()
+	err := p.CreateBattle(p.DefaultSpawn(p.Now().Unix()))
 	if err != nil {
 		return  err
 	}
+	p.BattleState.AutoSpawned = true
 	return nil
 }
 
-// This will setup a battle.
-func (p *Player) CreateBattle() error {
-	enemy, exists := GetEnemy()
-	if !exists {
-		return fmt.Errorf("unable to get an enemy, scope out of bounds possibly.")
+// This function checks if the battle was started by loading the game and nothing has happened in it yet, so starting
+// another battle can replace it without fleeing.
+func (b BattleState) Untouched() bool {
+	if !b.AutoSpawned || b.Damage != 0 || b.DamageTaken != 0 {
+		return false
+	}
+	for _, enemy := range b.Enemies {
+		if enemy.Health < enemy.MaxHealth || len(enemy.StatusEffects) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// This will setup a battle against an enemy picked by the spawn request, see encounter.go.
+func (p *Player) CreateBattle(spawn SpawnRequest) error {
+	enemy, err := spawn.PickEnemy()
+	if err != nil {
+		return err
 	}
+	p.StartBattle(enemy)
+	return nil
+}
+
+// This function starts a new battle against the enemy, replacing any battle in progress.  Returns the enemy's id.
+func (p *Player) StartBattle(enemy Enemy) string {
 	id := UtilMakeUUID()
+	//Enemy configurations without a max health use the starting health.
+	EnsureMaxHealth(&enemy, enemy.Health)
+	enemy.StatusEffects = []*StatusEffect{}
 	enemy.Rewards = CreateRewards()
+	enemy.SpawnedAt = p.Now().UnixMilli()
 	enemies := make(map[string]*Enemy)
 	enemies[id] = &enemy
 	p.BattleState.Enemies = enemies
-	return nil
+	p.BattleState.Damage = 0
+	p.BattleState.DamageTaken = 0
+	p.BattleState.AutoSpawned = false
+	return id
 }
 
 // This function will manage cleaning up successful battle.
 func (p *Player) CleanUpSuccessfulBattle(logger runtime.Logger, targetID string) {
-	//@JWK TODO: Do rewarding.
 	//@JWK TODO: Get more enemies if none??
-	//Record stats.
+	//Record stats and grant rewards.
 	logger.Debug("Record stats as part of clean up.")
 	targetEnemy := p.GetEnemy(targetID)
-	if targetEnemy.Type == "" {
+	if targetEnemy == nil || targetEnemy.Type == "" {
 		logger.Error("Unable to find the enemy when expected.")
 	} else {
-		p.RecordBattleStats(targetEnemy.Type)
+		p.RecordBattleStats(logger, targetEnemy)
+		p.GrantRewards(logger, targetEnemy.Rewards)
 	}
 	//Clear enemy from battle state.
 	logger.Debug("Remove dead enemy from battle state as part of clean up.")
 	delete(p.BattleState.Enemies, targetID)
+	if len(p.BattleState.Enemies) == 0 {
+		p.SetBattleEvent(BattleEvent{
+			Event: EventBattleWon,
+			Damage: p.BattleState.Damage,
+		})
+		if p.BattleState.DamageTaken == 0 {
+			p.SetBattleEvent(BattleEvent{Event: EventFlawlessVictory})
+		}
+	}
+}
+
+// This function adds any health lost since the given health to the damage taken in the battle.
+func (p *Player) RecordDamageTaken(health int) {
+	if p.Health < health {
+		p.BattleState.DamageTaken += health - p.Health
+	}
+}
+
+// This function records an enemy kill.  The stats themselves are updated from the event, see BattleStats.Record.
+func (p *Player) RecordBattleStats(logger runtime.Logger, enemy *Enemy) {
+	event := BattleEvent{
+		Event: EventKill,
+		Target: string(enemy.Type),
+	}
+	if enemy.SpawnedAt > 0 {
+		event.Value = int(p.Now().UnixMilli() - enemy.SpawnedAt) //Time to kill.
+	}
+	p.SetBattleEvent(event)
+	p.GrantCodexRewards(logger)
+}
+
+// This function ends the battle without a win.
+func (p *Player) FleeBattle() error {
+	if len(p.BattleState.Enemies) == 0 {
+		return NewGameError(CodeFailedPrecondition, ReasonNoBattle, "There is no battle to flee from.")
+	}
+	p.BattleState.Enemies = make(map[string]*Enemy)
+	p.SetBattleEvent(BattleEvent{Event: EventBattleFled})
+	return nil
+}
+
+// This function records the player dying, killer is the enemy type when an enemy attack did it.
+func (p *Player) RecordPlayerDeath(health int, killer EnemyType) {
+	if health > 0 && p.IsPlayerDead() {
+		p.SetBattleEvent(BattleEvent{
+			Event: EventPlayerDeath,
+			Target: string(killer),
+		})
+	}
+}
+
+// This function checks if an event counts towards the condition.
+func (c EventCondition) Matches(event BattleEvent) bool {
+	if event.Event != c.Event {
+		return false
+	}
+	if c.Target != "" && event.Target != c.Target {
+		return false
+	}
+	if c.Attack != "" && event.Attack != c.Attack {
+		return false
+	}
+	if c.StatusEffect != "" && event.StatusEffect != c.StatusEffect {
+		return false
+	}
+	return event.Value >= c.MinValue
 }
 
-// This function will manage stats of battles.  For now it'll just increment types of enemies killed.
-// @JWK TODO: Add in deaths, total enemies killed, etc.
-func (p *Player) RecordBattleStats(enemyType EnemyType) {
-	battleStats := p.BattleStats
-	if battleStats == nil {
-		battleStats = make(map[EnemyType]int)
+// This function gives how much an event adds towards the condition.
+func (c EventCondition) Progress(event BattleEvent) int {
+	if !c.Matches(event) {
+		return 0
+	}
+	if c.CountDamage {
+		return event.Damage
+	}
+	return 1
+}
+
+// This function fills in a missing max health so entities saved before it existed get a proper health bar.
+func EnsureMaxHealth(ep EntityProcessor, defaultMax int) {
+	if ep.GetMaxHealth() > 0 {
+		return
+	}
+	if ep.GetHealth() > defaultMax { //Don't let the cap sit below the current health.
+		defaultMax = ep.GetHealth()
 	}
-	battleStats[enemyType]++
+	ep.SetMaxHealth(defaultMax)
 }
 
 // Inclusive RNG dice roll.
@@ -103,6 +257,14 @@ func BattleDiceRoll(min, max int) int {
 	return rand.Intn(max-min+1) + min
 }
 
+// This function gets an enemy type from the registry.
+func GetEnemyType(enemyType EnemyType) (Enemy, bool) {
+	EnemyRegistry.RLock() //Read lock.
+	defer EnemyRegistry.RUnlock() //Don't forget to release the lock.
+	enemy, exists := EnemyRegistry.Enemies[enemyType]
+	return enemy, exists
+}
+
 // This function uses the registry to randomly get an enemy.
 func GetEnemy() (Enemy, bool) {
 	EnemyRegistry.RLock() //Read lock.
@@ -152,12 +314,73 @@ func CreateRewards() []RewardInfo {
 		}
 		rewards = append(rewards, reward)
 	}
+	//Item drops.
+	if BattleDiceRoll(0, 3) == 3 {
+		reward = RewardInfo{
+			Type: ItemReward,
+			Amount: 1,
+			ItemID: ItemDrops[BattleDiceRoll(0, len(ItemDrops)-1)],
+		}
+		rewards = append(rewards, reward)
+	}
+	//Rare equipment drops.
+	if BattleDiceRoll(0, 9) == 9 {
+		reward = RewardInfo{
+			Type: ItemReward,
+			Amount: 1,
+			ItemID: EquipmentDrops[BattleDiceRoll(0, len(EquipmentDrops)-1)],
+		}
+		rewards = append(rewards, reward)
+	}
 	return rewards
 }
 
-//
+// This function lists everything CreateRewards can give with the most of each, used to show loot to the player.
+func LootTable() []RewardInfo {
+	loot := []RewardInfo{
+		{Type: Experience, Amount: 75},
+		{Type: Gold, Amount: 100},
+		{Type: Gems, Amount: 5},
+	}
+	for _, drops := range [][]ItemType{ItemDrops, EquipmentDrops} {
+		for _, item := range drops {
+			loot = append(loot, RewardInfo{Type: ItemReward, Amount: 1, ItemID: item})
+		}
+	}
+	return loot
+}
+
+// This function queues an event for the player, they are handled once the player is saved.
 func (p *Player) SetBattleEvent(event BattleEvent) {
-	//@JWK TODO: Do this!
+	if event.Actor == "" {
+		event.Actor = p.ID
+	}
+	if event.Timestamp == 0 {
+		event.Timestamp = p.Now().Unix()
+	}
+	p.BattleStats.Record(event)
+	p.events = append(p.events, event)
+}
+
+// This function hands back the queued events and clears them so they are only handled once.
+func (p *Player) TakeBattleEvents() []BattleEvent {
+	events := p.events
+	p.events = nil
+	return events
+}
+
+// This function handles the events queued on the player.  Only call it after the player was saved so nothing is counted
+// for changes that were thrown away.
+func ProcessBattleEvents(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, p *Player) {
+	events := p.TakeBattleEvents()
+	if len(events) == 0 {
+		return
+	}
+	logger.Debug("Processing battle events: %+v", events)
+	SubmitLeaderboardScores(ctx, logger, nk, p, events)
+	EvaluateAchievements(ctx, logger, nk, p, events)
+	TrackQuests(ctx, logger, nk, p, events)
+	NotifyCodexRewards(ctx, logger, nk, p, events)
 }
 
 //
@@ -0,0 +1,582 @@
+package main
+
+import (
+	"fmt"
+	"time"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const BattleMatchModule = "battle" //Name the match handler is registered under.
+const BattleMatchSaveRetries = 3 //Attempts at saving when an rpc saved the player during the match.
+const BattleMatchCancelSignal = "cancel" //Signal that stops a match before it saves, see FindOrCreateBattleMatch.
+
+var BattleMatchStorageKey = "battle_match" //Id of the player's running battle match in the player data collection.
+
+// Match timing, all in ticks.
+const (
+	BattleMatchTickRate = 5 //Ticks per second.
+	BattleMatchStatusTicks = 5 //Status effects are processed once a second.
+	BattleMatchEnemyAttackTicks = 15 //Each enemy attacks every 3 seconds.
+	BattleMatchPlayerAttackTicks = 2 //Fastest the player can attack, extra attacks are rejected.
+	BattleMatchSaveTicks = 50 //Unsaved changes are written every 10 seconds.
+	BattleMatchIdleTicks = 300 //The match ends after a minute without the player connected.
+)
+
+// Match op codes.
+const (
+	OpCodeAttack int64 = 1 //Client -> server, an AttackAction.
+	OpCodeState int64 = 2 //Server -> client, the full battle state on join.
+	OpCodeDiff int64 = 3 //Server -> client, what changed since the last state or diff.
+	OpCodeError int64 = 4 //Server -> client, a GameError for a rejected action.
+	OpCodeBattleOver int64 = 5 //Server -> client, the battle ended and the match is closing.
+)
+
+// What the client sees of an enemy in the match.
+type BattleEnemySnapshot struct {
+	Type EnemyType `json:"type"`
+	Health int `json:"health"`
+	MaxHealth int `json:"max_health"`
+	StatusEffects []StatusEffectType `json:"status_effects"`
+}
+
+// What the client sees of the battle in the match.
+type BattleSnapshot struct {
+	PlayerHealth int `json:"player_health"`
+	PlayerMaxHealth int `json:"player_max_health"`
+	PlayerStatusEffects []StatusEffectType `json:"player_status_effects"`
+	Enemies map[string]BattleEnemySnapshot `json:"enemies"`
+}
+
+// Changes broadcast each tick, unchanged values are left out.
+type BattleDiff struct {
+	PlayerHealth *int `json:"player_health,omitempty"`
+	PlayerMaxHealth *int `json:"player_max_health,omitempty"`
+	PlayerStatusEffects *[]StatusEffectType `json:"player_status_effects,omitempty"`
+	Enemies map[string]BattleEnemySnapshot `json:"enemies,omitempty"` //Enemies that were added or changed.
+	RemovedEnemies []string `json:"removed_enemies,omitempty"`
+	Attacks []*AttackResult `json:"attacks,omitempty"` //Player attacks since the last diff.
+	EnemyAttacks []*EnemyAttackResult `json:"enemy_attacks,omitempty"` //Enemy attacks since the last diff.
+}
+
+// Sent with OpCodeBattleOver.
+type BattleOver struct {
+	PlayerDead bool `json:"player_dead"`
+	Victory bool `json:"victory"` //Every enemy was defeated.
+}
+
+// State owned by a battle match.  The match is the only writer of the player's battle while it runs, rpc writes in the
+// meantime make the next match save fail and the match's changes are merged onto them, see merge.
+type BattleMatchState struct {
+	UserID string
+	Presence runtime.Presence //Nil while the player isn't connected.
+	Player *Player
+	Saved *Player //Copy of the player as last loaded or saved, merges add the match's changes since.
+	Cancelled bool //Another match won the race to be the player's, this one ends without saving.
+	Snapshot BattleSnapshot //Last state sent to the client.
+	Attacks []*AttackResult //Waiting to be broadcast.
+	EnemyAttacks []*EnemyAttackResult //Waiting to be broadcast.
+	LastAttackTick int64
+	IdleTicks int64
+	Dirty bool //Changes not yet saved.
+}
+
+// Authoritative real time battle for a single player.
+type BattleMatch struct{}
+
+// This function is registered with RegisterMatch to create the handler for new battle matches.
+func NewBattleMatch(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule) (runtime.Match, error) {
+	return &BattleMatch{}, nil
+}
+
+// This function builds what the client sees of the battle.
+func (p *Player) BattleSnapshot() BattleSnapshot {
+	snapshot := BattleSnapshot{
+		PlayerHealth: p.Health,
+		PlayerMaxHealth: p.MaxHealth,
+		PlayerStatusEffects: statusEffectTypes(p.StatusEffects),
+		Enemies: make(map[string]BattleEnemySnapshot),
+	}
+	for id, enemy := range p.BattleState.Enemies {
+		snapshot.Enemies[id] = BattleEnemySnapshot{
+			Type: enemy.Type,
+			Health: enemy.Health,
+			MaxHealth: enemy.MaxHealth,
+			StatusEffects: statusEffectTypes(enemy.StatusEffects),
+		}
+	}
+	return snapshot
+}
+
+func statusEffectTypes(statusEffects []*StatusEffect) []StatusEffectType {
+	types := []StatusEffectType{}
+	for _, effect := range statusEffects {
+		types = append(types, effect.Type)
+	}
+	return types
+}
+
+func sameStatusEffectTypes(a, b []StatusEffectType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// This function works out what changed between two snapshots.  The second return is false when nothing did.
+func DiffBattleSnapshots(previous, current BattleSnapshot) (BattleDiff, bool) {
+	var diff BattleDiff
+	changed := false
+	if previous.PlayerHealth != current.PlayerHealth {
+		diff.PlayerHealth = &current.PlayerHealth
+		changed = true
+	}
+	if previous.PlayerMaxHealth != current.PlayerMaxHealth {
+		diff.PlayerMaxHealth = &current.PlayerMaxHealth
+		changed = true
+	}
+	if !sameStatusEffectTypes(previous.PlayerStatusEffects, current.PlayerStatusEffects) {
+		diff.PlayerStatusEffects = &current.PlayerStatusEffects
+		changed = true
+	}
+	for id, enemy := range current.Enemies {
+		old, exists := previous.Enemies[id]
+		if exists && old.Type == enemy.Type && old.Health == enemy.Health && old.MaxHealth == enemy.MaxHealth && sameStatusEffectTypes(old.StatusEffects, enemy.StatusEffects) {
+			continue
+		}
+		if diff.Enemies == nil {
+			diff.Enemies = make(map[string]BattleEnemySnapshot)
+		}
+		diff.Enemies[id] = enemy
+		changed = true
+	}
+	for id := range previous.Enemies {
+		if _, exists := current.Enemies[id]; !exists {
+			diff.RemovedEnemies = append(diff.RemovedEnemies, id)
+			changed = true
+		}
+	}
+	return diff, changed
+}
+
+// This function sends a message to the player if they are connected.
+func (s *BattleMatchState) send(logger runtime.Logger, dispatcher runtime.MatchDispatcher, opCode int64, message interface{}) {
+	if s.Presence == nil {
+		return
+	}
+	data, err := json.Marshal(message)
+	if err != nil {
+		logger.Error("Unable to marshal match message: %v", err)
+		return
+	}
+	if err := dispatcher.BroadcastMessage(opCode, data, []runtime.Presence{s.Presence}, nil, true); err != nil {
+		logger.Error("Unable to send match message: %v", err)
+	}
+}
+
+// This function makes a deep copy of the player.
+func (p *Player) clone() *Player {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil
+	}
+	copied := &Player{}
+	if err := json.Unmarshal(data, copied); err != nil {
+		return nil
+	}
+	return copied
+}
+
+// This function writes the player if anything changed.  A failed save means an rpc saved the player during the match,
+// the match's changes are merged onto that save and it is tried again.
+func (s *BattleMatchState) save(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) error {
+	if !s.Dirty || s.Cancelled {
+		return nil
+	}
+	for attempt := 0; attempt < BattleMatchSaveRetries; attempt++ {
+		err := s.Player.SavePlayerData(nk)
+		if err == nil {
+			s.Dirty = false
+			s.Saved = s.Player.clone()
+			ProcessBattleEvents(ctx, logger, nk, s.Player)
+			return nil
+		}
+		logger.Debug("Battle match save conflict, attempt %d: %v", attempt + 1, err)
+		fresh, err := LoadPlayerData(ctx, logger, nk, s.UserID)
+		if err != nil {
+			logger.Error("Unable to reload battle match player data: %v", err)
+			return AsGameError(err)
+		}
+		s.merge(fresh)
+	}
+	logger.Error("Unable to save battle match player data after %d attempts.", BattleMatchSaveRetries)
+	return NewGameError(CodeAborted, ReasonConflict, "Player data changed outside the match.")
+}
+
+// This function carries the match's changes over onto a newer save of the player and makes it the match's player.  The
+// match owns the battle so health, status effects and the battle state come from it.  Currencies, experience and items
+// are added by how much the match changed them since its last save, and stats by replaying the match's events, so
+// purchases and rewards from rpcs in the meantime are kept.
+func (s *BattleMatchState) merge(fresh *Player) {
+	match, saved := s.Player, s.Saved
+	if saved == nil {
+		saved = fresh //Nothing to measure the changes from, keep the newer values.
+	}
+	fresh.StatusEffects = match.StatusEffects
+	fresh.BattleState = match.BattleState
+	fresh.SetHealth(match.Health)
+	for _, currency := range match.Currencies {
+		if delta := currency.Amount - saved.GetCurrency(currency.Type); delta != 0 {
+			fresh.AddCurrency(currency.Type, delta)
+		}
+	}
+	//Level ups were queued as events by the match, they are replayed below instead of checked again.
+	fresh.Experience += match.Experience - saved.Experience
+	if level := int(fresh.Experience / ExperiencePerLevel) + 1; level > fresh.Level {
+		fresh.Level = level
+	}
+	items := make(map[ItemType]bool)
+	for itemType := range match.Inventory {
+		items[itemType] = true
+	}
+	for itemType := range saved.Inventory {
+		items[itemType] = true
+	}
+	for itemType := range items {
+		delta := match.Inventory[itemType] - saved.Inventory[itemType]
+		if delta > 0 {
+			fresh.AddItem(itemType, delta)
+		} else if delta < 0 {
+			fresh.RemoveItem(itemType, delta * -1)
+		}
+	}
+	if fresh.CodexRewards == nil {
+		fresh.CodexRewards = make(map[string]int64)
+	}
+	for key, grantedAt := range match.CodexRewards {
+		if _, granted := fresh.CodexRewards[key]; !granted {
+			fresh.CodexRewards[key] = grantedAt
+		}
+	}
+	for _, event := range match.TakeBattleEvents() {
+		fresh.SetBattleEvent(event)
+	}
+	s.Player = fresh
+}
+
+// This function handles an attack sent by the player.
+func (s *BattleMatchState) handleAttack(logger runtime.Logger, tick int64, data []byte) error {
+	if s.LastAttackTick > 0 && tick - s.LastAttackTick < BattleMatchPlayerAttackTicks {
+		wait := time.Duration(BattleMatchPlayerAttackTicks - (tick - s.LastAttackTick)) * time.Second / BattleMatchTickRate
+		return NewRateLimitError("attack", wait)
+	}
+	var action AttackAction
+	if err := json.Unmarshal(data, &action); err != nil {
+		return NewGameError(CodeInvalidArgument, ReasonInvalidPayload, "Unable to unmarshal attack.")
+	}
+	if err := action.Validate(); err != nil {
+		return err
+	}
+	result, err := s.Player.PlayerAttack(logger, action.TargetID, action.Attack)
+	if err != nil {
+		return err
+	}
+	s.LastAttackTick = tick
+	s.Attacks = append(s.Attacks, result)
+	s.Dirty = true
+	return nil
+}
+
+// This function processes status effects on everyone, cleaning up enemies they kill.  Only a change in health, effects
+// or enemies needs saving.
+func (s *BattleMatchState) tickStatusEffects(logger runtime.Logger) {
+	before := s.Player.BattleSnapshot()
+	events := len(s.Player.events)
+	health := s.Player.Health
+	now := s.Player.Now().Unix() //The player's own battle, so their clock.
+	s.Player.TickPlayerStatusEffects(logger, now)
+	s.Player.RecordDamageTaken(health)
+	for id, enemy := range s.Player.BattleState.Enemies {
+		dealt := TickStatusEffect(logger, enemy, now)
+		s.Player.RecordStatusEffectDamage(id, dealt)
+		for _, damage := range dealt {
+			s.Player.BattleState.Damage += damage
+		}
+		if enemy.IsEnemyDead() {
+			logger.Debug("Enemy died from status effects, running clean up.")
+			s.Player.CleanUpSuccessfulBattle(logger, id) //Deleting during range is safe in Go.
+		}
+	}
+	if _, changed := DiffBattleSnapshots(before, s.Player.BattleSnapshot()); changed || len(s.Player.events) > events {
+		s.Dirty = true
+	}
+}
+
+// This function has every living enemy attack the player.
+func (s *BattleMatchState) enemyAttacks(logger runtime.Logger) {
+	for id, enemy := range s.Player.BattleState.Enemies {
+		if result := enemy.EnemyAttack(logger, id, s.Player); result != nil {
+			s.EnemyAttacks = append(s.EnemyAttacks, result)
+			s.Dirty = true
+		}
+	}
+}
+
+func (m *BattleMatch) MatchInit(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, params map[string]interface{}) (interface{}, int, string) {
+	userID, ok := params["user_id"].(string)
+	if !ok || userID == "" {
+		logger.Error("Battle match created without a user id.")
+		return nil, 0, ""
+	}
+	//Get Player object and the on-going battle or a new one.
+	player, err := LoadPlayerData(ctx, logger, nk, userID)
+	if err != nil {
+		logger.Error("Unable to load player data: %v", err)
+		return nil, 0, ""
+	}
+	if err := player.LoadBattleState(); err != nil {
+		logger.Error("Unable to get battle state: %v", err)
+		return nil, 0, ""
+	}
+	state := &BattleMatchState{
+		UserID: userID,
+		Player: player,
+		Saved: player.clone(),
+		Dirty: true, //A new battle needs saving.
+	}
+	label, _ := json.Marshal(map[string]string{"user_id": userID})
+	return state, BattleMatchTickRate, string(label)
+}
+
+func (m *BattleMatch) MatchJoinAttempt(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, presence runtime.Presence, metadata map[string]string) (interface{}, bool, string) {
+	s := state.(*BattleMatchState)
+	if s.Cancelled {
+		return s, false, "Battle match was replaced."
+	}
+	if presence.GetUserId() != s.UserID {
+		return s, false, "Battle belongs to another player."
+	}
+	if s.Presence != nil {
+		return s, false, "Already connected to this battle."
+	}
+	return s, true, ""
+}
+
+func (m *BattleMatch) MatchJoin(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, presences []runtime.Presence) interface{} {
+	s := state.(*BattleMatchState)
+	for _, presence := range presences {
+		if presence.GetUserId() == s.UserID {
+			s.Presence = presence
+			s.IdleTicks = 0
+		}
+	}
+	//Send the whole battle, diffs are against this.
+	s.Snapshot = s.Player.BattleSnapshot()
+	s.send(logger, dispatcher, OpCodeState, struct {
+		Snapshot BattleSnapshot `json:"snapshot"`
+		PlayerData *Player `json:"player_data"`
+	}{
+		Snapshot: s.Snapshot,
+		PlayerData: s.Player,
+	})
+	return s
+}
+
+func (m *BattleMatch) MatchLeave(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, presences []runtime.Presence) interface{} {
+	s := state.(*BattleMatchState)
+	for _, presence := range presences {
+		if presence.GetUserId() == s.UserID {
+			s.Presence = nil
+		}
+	}
+	if err := s.save(ctx, logger, nk); err != nil {
+		return nil //End the match.
+	}
+	return s
+}
+
+func (m *BattleMatch) MatchLoop(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, messages []runtime.MatchData) interface{} {
+	s := state.(*BattleMatchState)
+	if s.Cancelled {
+		return nil
+	}
+	if s.Presence == nil {
+		s.IdleTicks++
+		if s.IdleTicks >= BattleMatchIdleTicks {
+			logger.Debug("Battle match idle, ending.")
+			s.save(ctx, logger, nk)
+			return nil
+		}
+		return s //Nothing happens in the battle while the player is away.
+	}
+
+	//Player actions.
+	for _, message := range messages {
+		switch message.GetOpCode() {
+		case OpCodeAttack:
+			if err := s.handleAttack(logger, tick, message.GetData()); err != nil {
+				_, body := ErrorBody(err)
+				s.send(logger, dispatcher, OpCodeError, body)
+			}
+		default:
+			s.send(logger, dispatcher, OpCodeError, GameError{Reason: ReasonInvalidPayload, Message: fmt.Sprintf("Unknown op code: %d", message.GetOpCode())})
+		}
+	}
+
+	//Timed actions.
+	if tick % BattleMatchStatusTicks == 0 {
+		s.tickStatusEffects(logger)
+	}
+	if tick % BattleMatchEnemyAttackTicks == 0 {
+		s.enemyAttacks(logger)
+	}
+
+	//Broadcast what changed.
+	snapshot := s.Player.BattleSnapshot()
+	diff, changed := DiffBattleSnapshots(s.Snapshot, snapshot)
+	diff.Attacks = s.Attacks
+	diff.EnemyAttacks = s.EnemyAttacks
+	if changed || len(diff.Attacks) > 0 || len(diff.EnemyAttacks) > 0 {
+		s.send(logger, dispatcher, OpCodeDiff, diff)
+	}
+	s.Snapshot = snapshot
+	s.Attacks = nil
+	s.EnemyAttacks = nil
+
+	//End the match when the battle is decided, the next load_game or match starts a new one.
+	if s.Player.IsPlayerDead() || len(s.Player.BattleState.Enemies) == 0 {
+		s.send(logger, dispatcher, OpCodeBattleOver, BattleOver{
+			PlayerDead: s.Player.IsPlayerDead(),
+			Victory: len(s.Player.BattleState.Enemies) == 0,
+		})
+		if err := s.save(ctx, logger, nk); err != nil {
+			_, body := ErrorBody(err)
+			s.send(logger, dispatcher, OpCodeError, body)
+		}
+		return nil
+	}
+
+	if tick % BattleMatchSaveTicks == 0 {
+		if err := s.save(ctx, logger, nk); err != nil {
+			_, body := ErrorBody(err)
+			s.send(logger, dispatcher, OpCodeError, body)
+			return nil
+		}
+	}
+	return s
+}
+
+func (m *BattleMatch) MatchTerminate(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, graceSeconds int) interface{} {
+	s := state.(*BattleMatchState)
+	s.save(ctx, logger, nk)
+	return s
+}
+
+func (m *BattleMatch) MatchSignal(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, data string) (interface{}, string) {
+	s := state.(*BattleMatchState)
+	if data == BattleMatchCancelSignal {
+		logger.Debug("Battle match cancelled, another match is the player's.")
+		s.Cancelled = true
+	}
+	return s, ""
+}
+
+// Player's running battle match, stored so concurrent calls agree on one.
+type BattleMatchRecord struct {
+	MatchID string `json:"match_id"`
+}
+
+// This function finds the player's running battle match or creates one.  The match id is kept in storage with a
+// versioned write, so when two calls create a match at the same time only one is recorded and the other is cancelled
+// before it saves anything.
+func FindOrCreateBattleMatch(ctx context.Context, nk runtime.NakamaModule, userID string) (string, error) {
+	for attempt := 0; attempt < BattleMatchSaveRetries; attempt++ {
+		running, version, err := RunningBattleMatch(ctx, nk, userID)
+		if err != nil {
+			return "", err
+		}
+		if running != "" {
+			return running, nil
+		}
+
+		matchID, err := nk.MatchCreate(ctx, BattleMatchModule, map[string]interface{}{"user_id": userID})
+		if err != nil {
+			return "", err
+		}
+		data, err := json.Marshal(BattleMatchRecord{MatchID: matchID})
+		if err != nil {
+			return "", err
+		}
+		//Write to the storage engine, the version makes this fail if another call recorded a match first.
+		_, err = nk.StorageWrite(ctx, []*runtime.StorageWrite{
+			{
+				Collection: playerDataStorageCollection,
+				Key: BattleMatchStorageKey,
+				UserID: userID,
+				Value: string(data),
+				Version: version,
+				PermissionRead: 1, // Owner and runtime can read.
+				PermissionWrite: 0, // No one can write save the runtime.
+			},
+		})
+		if err == nil {
+			return matchID, nil
+		}
+		//Lost the race, stop this match and use the recorded one.
+		if _, err := nk.MatchSignal(ctx, matchID, BattleMatchCancelSignal); err != nil {
+			return "", err
+		}
+	}
+	return "", NewGameError(CodeAborted, ReasonConflict, "Battle match was not created, try again.")
+}
+
+// This function gets the player's running battle match id, empty when there isn't one.  The storage version of the
+// record is returned for replacing it, "*" when there is no record.
+func RunningBattleMatch(ctx context.Context, nk runtime.NakamaModule, userID string) (string, string, error) {
+	//Read from the storage engine.
+	rObj, err := nk.StorageRead(ctx, []*runtime.StorageRead{
+		{
+			Collection: playerDataStorageCollection,
+			Key: BattleMatchStorageKey,
+			UserID: userID,
+		},
+	})
+	if err != nil {
+		return "", "", err
+	}
+	if len(rObj) == 0 {
+		return "", "*", nil //Only write if no one else created it first.
+	}
+	var record BattleMatchRecord
+	if err := json.Unmarshal([]byte(rObj[0].Value), &record); err != nil || record.MatchID == "" {
+		return "", rObj[0].Version, nil
+	}
+	match, err := nk.MatchGet(ctx, record.MatchID)
+	if err != nil {
+		return "", "", err
+	}
+	if match == nil {
+		return "", rObj[0].Version, nil //The recorded match is over.
+	}
+	return record.MatchID, rObj[0].Version, nil
+}
+
+// This function rejects changing the battle outside the player's running battle match.  The match owns the battle
+// state, a change saved by an rpc would be written over by the match's next save.
+func CheckNoBattleMatch(ctx context.Context, nk runtime.NakamaModule, userID string) error {
+	matchID, _, err := RunningBattleMatch(ctx, nk, userID)
+	if err != nil {
+		return err
+	}
+	if matchID != "" {
+		return NewGameError(CodeFailedPrecondition, ReasonBattleMatchRunning, fmt.Sprintf("Battle is being fought in match: %s", matchID))
+	}
+	return nil
+}
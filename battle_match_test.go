@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+func TestDiffBattleSnapshots(t *testing.T) {
+	previous := BattleSnapshot{
+		PlayerHealth: 100,
+		PlayerMaxHealth: 100,
+		PlayerStatusEffects: []StatusEffectType{},
+		Enemies: map[string]BattleEnemySnapshot{
+			"a": {Type: Zombie, Health: 50, MaxHealth: 50, StatusEffects: []StatusEffectType{}},
+			"b": {Type: Beast, Health: 30, MaxHealth: 30, StatusEffects: []StatusEffectType{}},
+		},
+	}
+	if _, changed := DiffBattleSnapshots(previous, previous); changed {
+		t.Fatal("same snapshot should have no changes")
+	}
+
+	current := BattleSnapshot{
+		PlayerHealth: 95,
+		PlayerMaxHealth: 100,
+		PlayerStatusEffects: []StatusEffectType{Bleed},
+		Enemies: map[string]BattleEnemySnapshot{
+			"a": {Type: Zombie, Health: 50, MaxHealth: 50, StatusEffects: []StatusEffectType{}},
+			"c": {Type: Mutant, Health: 40, MaxHealth: 40, StatusEffects: []StatusEffectType{}},
+		},
+	}
+	diff, changed := DiffBattleSnapshots(previous, current)
+	if !changed {
+		t.Fatal("expected changes")
+	}
+	if diff.PlayerHealth == nil || *diff.PlayerHealth != 95 || diff.PlayerMaxHealth != nil {
+		t.Fatalf("player health diff: %v %v", diff.PlayerHealth, diff.PlayerMaxHealth)
+	}
+	if diff.PlayerStatusEffects == nil || len(*diff.PlayerStatusEffects) != 1 {
+		t.Fatalf("player status effects diff: %v", diff.PlayerStatusEffects)
+	}
+	if _, exists := diff.Enemies["a"]; exists || len(diff.Enemies) != 1 {
+		t.Fatalf("only the new enemy should be sent: %+v", diff.Enemies)
+	}
+	if len(diff.RemovedEnemies) != 1 || diff.RemovedEnemies[0] != "b" {
+		t.Fatalf("removed enemies: %v", diff.RemovedEnemies)
+	}
+}
+
+func TestBattleMatchAttackRate(t *testing.T) {
+	attackType := testSureHitAttack(t, 1)
+	player := NewPlayer(UtilMakeUUID(), "tester")
+	player.Loadout = []AttackType{attackType}
+	targetID := UtilMakeUUID()
+	player.BattleState.Enemies = map[string]*Enemy{targetID: {Type: Zombie, Health: 10, MaxHealth: 10}}
+	state := &BattleMatchState{UserID: player.ID, Player: player}
+	data := []byte(`{"target_id":"` + targetID + `","attack":"` + string(attackType) + `"}`)
+
+	if err := state.handleAttack(&testLogger{}, 10, data); err != nil {
+		t.Fatalf("first attack: %v", err)
+	}
+	code, body := testErrorBody(t, state.handleAttack(&testLogger{}, 11, data))
+	if code != CodeResourceExhausted || body.RetryAfter <= 0 {
+		t.Fatalf("attack a tick later: code %d body %+v", code, body)
+	}
+	if err := state.handleAttack(&testLogger{}, 10 + BattleMatchPlayerAttackTicks, data); err != nil {
+		t.Fatalf("attack after waiting: %v", err)
+	}
+	if len(state.Attacks) != 2 || !state.Dirty || player.BattleState.Enemies[targetID].Health != 8 {
+		t.Fatalf("attacks %d dirty %v enemy %+v", len(state.Attacks), state.Dirty, player.BattleState.Enemies[targetID])
+	}
+}
+
+func TestBattleMatchStatusTickOnlyDirtyOnChange(t *testing.T) {
+	InitStatusEffectsRegistry()
+	now := time.Unix(1000, 0)
+	clock := testFixedClock(t, now)
+	player := NewPlayer(UtilMakeUUID(), "tester")
+	targetID := UtilMakeUUID()
+	enemy := &Enemy{Type: Zombie, Health: 50, MaxHealth: 50, StatusEffects: []*StatusEffect{}}
+	player.BattleState.Enemies = map[string]*Enemy{targetID: enemy}
+	AddStatusEffect(&testLogger{}, Bleed, enemy, now.Unix())
+	state := &BattleMatchState{UserID: player.ID, Player: player}
+
+	//Less than an interval in, nothing changes so there is nothing to save.
+	clock.now = now.Add(2 * time.Second)
+	state.tickStatusEffects(&testLogger{})
+	if state.Dirty {
+		t.Fatal("a tick that changed nothing shouldn't need saving")
+	}
+	clock.now = now.Add(5 * time.Second)
+	state.tickStatusEffects(&testLogger{})
+	if !state.Dirty || enemy.Health != 48 {
+		t.Fatalf("bleed damage should need saving: dirty %v health %d", state.Dirty, enemy.Health)
+	}
+}
+
+func TestBattleMatchSaveMergesRpcWrites(t *testing.T) {
+	nk := newTestNakama()
+	ctx := context.Background()
+	if err := InitItemRegistry(ctx, &testLogger{}, nk); err != nil {
+		t.Fatalf("InitItemRegistry: %v", err)
+	}
+	userID := UtilMakeUUID()
+	if err := NewPlayer(userID, "tester").SavePlayerData(nk); err != nil {
+		t.Fatalf("SavePlayerData: %v", err)
+	}
+	player, err := LoadPlayerData(ctx, &testLogger{}, nk, userID)
+	if err != nil {
+		t.Fatalf("LoadPlayerData: %v", err)
+	}
+	gold := player.GetCurrency(Gold)
+	state := &BattleMatchState{UserID: userID, Player: player, Saved: player.clone()}
+
+	//An rpc buys something while the match runs.
+	other, err := LoadPlayerData(ctx, &testLogger{}, nk, userID)
+	if err != nil {
+		t.Fatalf("LoadPlayerData: %v", err)
+	}
+	other.AddCurrency(Gold, -20)
+	other.AddItem(Antidote, 1)
+	if err := other.SavePlayerData(nk); err != nil {
+		t.Fatalf("SavePlayerData: %v", err)
+	}
+
+	//The match kills an enemy and takes damage.
+	state.Player.SetHealth(state.Player.Health - 10)
+	state.Player.GrantRewards(&testLogger{}, []RewardInfo{{Type: Gold, Amount: 30}, {Type: ItemReward, Amount: 1, ItemID: HealthPotion}})
+	state.Player.RecordBattleStats(&testLogger{}, &Enemy{Type: Zombie})
+	state.Dirty = true
+	if err := state.save(ctx, &testLogger{}, nk); err != nil {
+		t.Fatalf("save should merge instead of failing: %v", err)
+	}
+
+	saved, err := LoadPlayerData(ctx, &testLogger{}, nk, userID)
+	if err != nil {
+		t.Fatalf("LoadPlayerData: %v", err)
+	}
+	if saved.GetCurrency(Gold) != gold + 10 || saved.Inventory[Antidote] != 1 || saved.Inventory[HealthPotion] != 1 {
+		t.Fatalf("expected both the purchase and the rewards, gold %d inventory %+v", saved.GetCurrency(Gold), saved.Inventory)
+	}
+	if saved.Health != PlayerBaseHealth - 10 || saved.BattleStats.Kills[Zombie] != 1 {
+		t.Fatalf("expected the match's health and kill, health %d stats %+v", saved.Health, saved.BattleStats)
+	}
+	if state.Dirty || state.Player.GetCurrency(Gold) != gold + 10 || state.Saved.GetCurrency(Gold) != gold + 10 {
+		t.Fatalf("match should carry on from the merged save")
+	}
+}
+
+func TestBattleMatchOwnsBattleState(t *testing.T) {
+	nk := newTestNakama()
+	ctx := context.Background()
+	if err := InitItemRegistry(ctx, &testLogger{}, nk); err != nil {
+		t.Fatalf("InitItemRegistry: %v", err)
+	}
+	attackType := testSureHitAttack(t, 10)
+	userID := UtilMakeUUID()
+	player := NewPlayer(userID, "tester")
+	player.Loadout = []AttackType{attackType}
+	targetID := UtilMakeUUID()
+	player.BattleState.Enemies = map[string]*Enemy{
+		targetID: {Type: Zombie, Health: 5, MaxHealth: 5, StatusEffects: []*StatusEffect{}, Rewards: []RewardInfo{{Type: Gold, Amount: 50}}},
+	}
+	if err := player.SavePlayerData(nk); err != nil {
+		t.Fatalf("SavePlayerData: %v", err)
+	}
+	gold := player.GetCurrency(Gold)
+	matchID, err := FindOrCreateBattleMatch(ctx, nk, userID)
+	if err != nil {
+		t.Fatalf("FindOrCreateBattleMatch: %v", err)
+	}
+	player, err = LoadPlayerData(ctx, &testLogger{}, nk, userID)
+	if err != nil {
+		t.Fatalf("LoadPlayerData: %v", err)
+	}
+	state := &BattleMatchState{UserID: userID, Player: player, Saved: player.clone()}
+
+	//Killing the enemy over rpc while the match runs is refused.
+	payload, _ := json.Marshal(AttackRequest{TargetID: targetID, Attack: attackType})
+	_, err = AttackTargetRPC()(testUserContext(userID), &testLogger{}, nil, nk, string(payload))
+	if code, body := testErrorBody(t, err); code != CodeFailedPrecondition || body.Reason != ReasonBattleMatchRunning {
+		t.Fatalf("expected the rpc attack refused during the match: code %d body %+v", code, body)
+	}
+
+	//The match kills it once and its save goes through.
+	if _, err := state.Player.PlayerAttack(&testLogger{}, targetID, attackType); err != nil {
+		t.Fatalf("PlayerAttack: %v", err)
+	}
+	state.Dirty = true
+	if err := state.save(ctx, &testLogger{}, nk); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	saved, err := LoadPlayerData(ctx, &testLogger{}, nk, userID)
+	if err != nil {
+		t.Fatalf("LoadPlayerData: %v", err)
+	}
+	if len(saved.BattleState.Enemies) != 0 || saved.GetCurrency(Gold) != gold + 50 || saved.BattleStats.Kills[Zombie] != 1 {
+		t.Fatalf("expected one kill and one reward, gold %d battle %+v stats %+v", saved.GetCurrency(Gold), saved.BattleState, saved.BattleStats)
+	}
+
+	//Once the match is over the rpcs can change the battle again.
+	delete(nk.matches, matchID)
+	if err := CheckNoBattleMatch(ctx, nk, userID); err != nil {
+		t.Fatalf("expected no running match: %v", err)
+	}
+}
+
+func TestFindOrCreateBattleMatch(t *testing.T) {
+	nk := newTestNakama()
+	ctx := context.Background()
+	userID := UtilMakeUUID()
+	matchID, err := FindOrCreateBattleMatch(ctx, nk, userID)
+	if err != nil {
+		t.Fatalf("FindOrCreateBattleMatch: %v", err)
+	}
+	if again, err := FindOrCreateBattleMatch(ctx, nk, userID); err != nil || again != matchID {
+		t.Fatalf("expected the running match %s, got %s: %v", matchID, again, err)
+	}
+
+	//The match ended, a new one replaces it.
+	delete(nk.matches, matchID)
+	replaced, err := FindOrCreateBattleMatch(ctx, nk, userID)
+	if err != nil || replaced == matchID {
+		t.Fatalf("expected a new match, got %s: %v", replaced, err)
+	}
+
+	//Another call records its match first, this call cancels its own and joins that one.
+	delete(nk.matches, replaced)
+	var winner string
+	nk.onMatchCreate = func() {
+		winner, err = FindOrCreateBattleMatch(ctx, nk, userID)
+		if err != nil {
+			t.Fatalf("FindOrCreateBattleMatch: %v", err)
+		}
+	}
+	loser, err := FindOrCreateBattleMatch(ctx, nk, userID)
+	if err != nil || loser != winner {
+		t.Fatalf("expected both calls to get %s, got %s: %v", winner, loser, err)
+	}
+	cancelled := 0
+	for id, signal := range nk.matches {
+		if signal == BattleMatchCancelSignal {
+			cancelled++
+			if id == winner {
+				t.Fatal("the recorded match shouldn't be cancelled")
+			}
+		}
+	}
+	if cancelled != 1 {
+		t.Fatalf("expected the losing match to be cancelled, got %d", cancelled)
+	}
+}
+
+func TestBattleMatchCancelSignal(t *testing.T) {
+	player := NewPlayer(UtilMakeUUID(), "tester")
+	state := &BattleMatchState{UserID: player.ID, Player: player, Dirty: true}
+	match := &BattleMatch{}
+	match.MatchSignal(context.Background(), &testLogger{}, nil, nil, nil, 1, state, BattleMatchCancelSignal)
+	if match.MatchLoop(context.Background(), &testLogger{}, nil, nil, nil, 2, state, []runtime.MatchData{}) != nil {
+		t.Fatal("a cancelled match should end")
+	}
+	//Nothing is saved, a nil nakama module would panic on a write.
+	if err := state.save(context.Background(), &testLogger{}, nil); err != nil {
+		t.Fatalf("cancelled save: %v", err)
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"context"
+	"encoding/json"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+var bestiaryDataStorageKey = "bestiary"
+
+const CodexNotificationCode = 107
+const CodexCompleteKey = "codex" //Key in the player's codex rewards for completing every entry.
+
+// Kills of an enemy type needed to reveal each part of its entry.
+type BestiaryThresholds struct {
+	Discover int `json:"discover"` //Name, description and health.
+	Weaknesses int `json:"weaknesses"`
+	Attacks int `json:"attacks"`
+	Loot int `json:"loot"`
+}
+
+// Descriptive information on an enemy type, the stats come from the enemy and attack registries.
+type BestiaryEntryInfo struct {
+	Name string `json:"name"`
+	Description string `json:"description"`
+	Weaknesses []StatusEffectType `json:"weaknesses"` //Status effects that work well against it.
+}
+
+// Stored layout of the bestiary configuration.
+type BestiaryConfig struct {
+	Thresholds BestiaryThresholds `json:"thresholds"`
+	Entries map[EnemyType]BestiaryEntryInfo `json:"entries"`
+	EntryRewards []RewardInfo `json:"entry_rewards"` //Granted once an entry is fully revealed.
+	CompletionRewards []RewardInfo `json:"completion_rewards"` //Granted once every entry is fully revealed.
+}
+
+// Registry to hold all of the definitions.  Using a mutex here since the data could be live-ops driven meaning it could change after nakama init.
+// **NOTE: If the plan is to not update this information after nakama init then this paradigm can be change to a simple read-only map instead.
+var BestiaryRegistry = struct {
+	sync.RWMutex //Read/write mutex to help with concurrent access allowing mulitple readers or a single writer.
+	BestiaryConfig
+}{
+	BestiaryConfig: BestiaryConfig{
+		Entries: make(map[EnemyType]BestiaryEntryInfo),
+	},
+}
+
+// Bestiary entry with only what the player's kills have revealed, sent to the client.
+type BestiaryEntry struct {
+	Type EnemyType `json:"type"`
+	Locked bool `json:"locked"` //Nothing is known until the first kill.
+	Kills int `json:"kills"`
+	Name string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	MaxHealth int `json:"max_health,omitempty"`
+	Weaknesses []StatusEffectType `json:"weaknesses,omitempty"`
+	Attacks []AttackType `json:"attacks,omitempty"`
+	Loot []RewardInfo `json:"loot,omitempty"`
+	NextReveal int `json:"next_reveal,omitempty"` //Kills needed for the next part, 0 once complete.
+	Complete bool `json:"complete"`
+}
+
+// This function will initialize the Bestiary Registry.
+func InitBestiaryRegistry(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) error {
+	//Read from the storage engine.
+	rObj, err := nk.StorageRead(ctx, []*runtime.StorageRead{
+		{
+			Collection: configDataStorageCollection,
+			Key: bestiaryDataStorageKey,
+		},
+	})
+	if err != nil {
+		logger.Error("Error getting bestiary configuration data: %v", err)
+		return err
+	}
+	//Load defaults if nothing was found in storage and save them into storage.
+	if len(rObj) == 0 {
+		BestiaryRegistry.Lock()  //Call lock on the mutex in preparation for writing.
+		BestiaryRegistry.Thresholds = BestiaryThresholds{
+			Discover: 1,
+			Weaknesses: 10,
+			Attacks: 25,
+			Loot: 50,
+		}
+		BestiaryRegistry.Entries[Zombie] = BestiaryEntryInfo{
+			Name: "Zombie",
+			Description: "Slow and relentless, it hits harder than it looks.",
+			Weaknesses: []StatusEffectType{Dazed},
+		}
+		BestiaryRegistry.Entries[Mutant] = BestiaryEntryInfo{
+			Name: "Mutant",
+			Description: "Tough hide and a long fuse, expect a long fight.",
+			Weaknesses: []StatusEffectType{Poison},
+		}
+		BestiaryRegistry.Entries[Beast] = BestiaryEntryInfo{
+			Name: "Beast",
+			Description: "Fragile but vicious, end it before it ends you.",
+			Weaknesses: []StatusEffectType{Bleed},
+		}
+		BestiaryRegistry.EntryRewards = []RewardInfo{
+			{Type: Gold, Amount: 250},
+		}
+		BestiaryRegistry.CompletionRewards = []RewardInfo{
+			{Type: Gems, Amount: 25},
+		}
+		BestiaryRegistry.Unlock() //Don't forget to release the mutex lock.
+		return SaveBestiaryRegistry(nk)
+	}
+
+	var config BestiaryConfig
+	if err := json.Unmarshal([]byte(rObj[0].Value), &config); err != nil {
+		logger.Error("Failed to unmarshal bestiary data: %v", err)
+		return err
+	}
+	if config.Entries == nil {
+		config.Entries = make(map[EnemyType]BestiaryEntryInfo)
+	}
+	BestiaryRegistry.Lock()  //Call lock on the mutex in preparation for writing.
+	BestiaryRegistry.BestiaryConfig = config
+	BestiaryRegistry.Unlock() //Don't forget to release the mutex lock.
+
+	return nil
+}
+
+// This function will save the Bestiary Registry to storage.
+func SaveBestiaryRegistry(nk runtime.NakamaModule) error {
+	BestiaryRegistry.RLock() //Read lock.
+	//Json-ify the bestiary registry in prepartion for storage.
+	data, err := json.Marshal(BestiaryRegistry.BestiaryConfig)
+	BestiaryRegistry.RUnlock() //Don't forget to release the lock.
+	if err != nil {
+		return err
+	}
+	wObj := []*runtime.StorageWrite{
+		{
+			Collection: configDataStorageCollection,
+			Key: bestiaryDataStorageKey,
+			Value: string(data),
+			PermissionRead: 1, // Owner and runtime can read.
+			PermissionWrite: 0, // No one can write save the runtime.
+		},
+	}
+	//Write to the storage engine.
+	if _, err := nk.StorageWrite(context.Background(), wObj); err != nil {
+		return fmt.Errorf("failed to write bestiary data to storage: %v", err)
+	}
+	return nil
+}
+
+// This function gives the kills needed to fully reveal an entry.
+func (t BestiaryThresholds) Complete() int {
+	complete := t.Discover
+	for _, threshold := range []int{t.Weaknesses, t.Attacks, t.Loot} {
+		if threshold > complete {
+			complete = threshold
+		}
+	}
+	if complete < 1 { //Every entry needs at least one kill.
+		complete = 1
+	}
+	return complete
+}
+
+// This function builds the bestiary for every enemy type in the registry, revealing what the player's kills unlocked.
+func (p *Player) Bestiary() []BestiaryEntry {
+	EnemyRegistry.RLock() //Read lock.
+	enemies := make([]Enemy, 0, len(EnemyRegistry.Enemies))
+	for _, enemy := range EnemyRegistry.Enemies {
+		enemies = append(enemies, enemy)
+	}
+	EnemyRegistry.RUnlock() //Release read lock.
+	sort.Slice(enemies, func(i, j int) bool {
+		return enemies[i].Type < enemies[j].Type
+	})
+	//Every enemy draws from the same attack pool and loot table for now.
+	attacks := []AttackType{}
+	for _, attack := range EnemyAttacks() {
+		attacks = append(attacks, attack.Type)
+	}
+
+	BestiaryRegistry.RLock() //Read lock.
+	defer BestiaryRegistry.RUnlock() //Don't forget to release the lock.
+	thresholds := BestiaryRegistry.Thresholds
+	entries := []BestiaryEntry{}
+	for _, enemy := range enemies {
+		kills := p.BattleStats.Kills[enemy.Type]
+		entry := BestiaryEntry{
+			Type: enemy.Type,
+			Locked: kills < thresholds.Discover || kills == 0,
+			Kills: kills,
+			Complete: kills >= thresholds.Complete(),
+		}
+		if !entry.Locked {
+			info, exists := BestiaryRegistry.Entries[enemy.Type]
+			entry.Name = info.Name
+			if !exists || entry.Name == "" { //Enemy types added by live-ops without an entry still show up.
+				entry.Name = string(enemy.Type)
+			}
+			entry.Description = info.Description
+			entry.MaxHealth = enemy.MaxHealth
+			if kills >= thresholds.Weaknesses {
+				entry.Weaknesses = info.Weaknesses
+			}
+			if kills >= thresholds.Attacks {
+				entry.Attacks = attacks
+			}
+			if kills >= thresholds.Loot {
+				entry.Loot = LootTable()
+			}
+		}
+		//The lowest threshold not reached yet.
+		for _, threshold := range []int{thresholds.Discover, thresholds.Weaknesses, thresholds.Attacks, thresholds.Loot} {
+			if threshold > kills && (entry.NextReveal == 0 || threshold < entry.NextReveal) {
+				entry.NextReveal = threshold
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// This function grants the codex rewards the player's kills have earned and not been given yet.  Called on kills so the
+// rewards are saved with them, an event is queued for each so the player can be told once saved.
+func (p *Player) GrantCodexRewards(logger runtime.Logger) {
+	if p.CodexRewards == nil {
+		p.CodexRewards = make(map[string]int64)
+	}
+	entries := p.Bestiary()
+	BestiaryRegistry.RLock() //Read lock.
+	entryRewards := BestiaryRegistry.EntryRewards
+	completionRewards := BestiaryRegistry.CompletionRewards
+	BestiaryRegistry.RUnlock() //Release read lock.
+
+	now := p.Now().Unix()
+	complete := len(entries) > 0
+	for _, entry := range entries {
+		if !entry.Complete {
+			complete = false
+			continue
+		}
+		if _, granted := p.CodexRewards[string(entry.Type)]; granted {
+			continue
+		}
+		logger.Debug("Codex entry completed: %s", entry.Type)
+		p.CodexRewards[string(entry.Type)] = now
+		p.GrantRewards(logger, entryRewards)
+		p.SetBattleEvent(BattleEvent{Event: EventCodexCompleted, Target: string(entry.Type)})
+	}
+	if _, granted := p.CodexRewards[CodexCompleteKey]; complete && !granted {
+		logger.Debug("Codex completed.")
+		p.CodexRewards[CodexCompleteKey] = now
+		p.GrantRewards(logger, completionRewards)
+		p.SetBattleEvent(BattleEvent{Event: EventCodexCompleted, Target: CodexCompleteKey})
+	}
+}
+
+// This function tells the player about codex rewards from the events.
+func NotifyCodexRewards(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, p *Player, events []BattleEvent) {
+	BestiaryRegistry.RLock() //Read lock.
+	entryRewards := BestiaryRegistry.EntryRewards
+	completionRewards := BestiaryRegistry.CompletionRewards
+	BestiaryRegistry.RUnlock() //Release read lock.
+	for _, event := range events {
+		if event.Event != EventCodexCompleted {
+			continue
+		}
+		content := map[string]interface{}{
+			"entry": event.Target,
+			"rewards": entryRewards,
+		}
+		if event.Target == CodexCompleteKey {
+			content["rewards"] = completionRewards
+		}
+		if err := nk.NotificationSend(ctx, p.ID, "Codex completed", content, CodexNotificationCode, "", true); err != nil {
+			logger.Error("Unable to send codex notification: %v", err)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func testBestiary(t *testing.T) {
+	t.Helper()
+	nk := newTestNakama()
+	InitAttackRegistry()
+	EnemyRegistry.Lock()
+	EnemyRegistry.Enemies = make(map[EnemyType]Enemy)
+	EnemyRegistry.Unlock()
+	if err := InitEnemyRegistry(context.Background(), &testLogger{}, nk); err != nil {
+		t.Fatalf("InitEnemyRegistry: %v", err)
+	}
+	if err := InitBestiaryRegistry(context.Background(), &testLogger{}, nk); err != nil {
+		t.Fatalf("InitBestiaryRegistry: %v", err)
+	}
+}
+
+func TestBestiaryReveals(t *testing.T) {
+	testBestiary(t)
+	player := NewPlayer(UtilMakeUUID(), "tester")
+	player.BattleStats.Kills[Zombie] = 10
+	entries := player.Bestiary()
+	if len(entries) != 3 {
+		t.Fatalf("expected an entry per enemy type, got %+v", entries)
+	}
+	for _, entry := range entries {
+		switch entry.Type {
+		case Zombie:
+			if entry.Locked || entry.Name != "Zombie" || entry.MaxHealth != 50 || len(entry.Weaknesses) == 0 {
+				t.Errorf("zombie should show health and weaknesses: %+v", entry)
+			}
+			if len(entry.Attacks) != 0 || len(entry.Loot) != 0 || entry.NextReveal != 25 || entry.Complete {
+				t.Errorf("zombie attacks and loot should still be hidden: %+v", entry)
+			}
+		default:
+			if !entry.Locked || entry.Name != "" || entry.MaxHealth != 0 || entry.NextReveal != 1 {
+				t.Errorf("%s should be locked: %+v", entry.Type, entry)
+			}
+		}
+	}
+}
+
+func TestCodexRewards(t *testing.T) {
+	testBestiary(t)
+	player := NewPlayer(UtilMakeUUID(), "tester")
+	gold, gems := player.GetCurrency(Gold), player.GetCurrency(Gems)
+	player.BattleStats.Kills[Zombie] = 49
+	player.BattleStats.Kills[Mutant] = 50
+	player.RecordBattleStats(&testLogger{}, &Enemy{Type: Zombie})
+	player.GrantCodexRewards(&testLogger{}) //Already granted, nothing more.
+	if player.GetCurrency(Gold) != gold + 500 || player.GetCurrency(Gems) != gems {
+		t.Fatalf("expected two entry rewards, gold %d gems %d", player.GetCurrency(Gold), player.GetCurrency(Gems))
+	}
+
+	player.BattleStats.Kills[Beast] = 49
+	player.RecordBattleStats(&testLogger{}, &Enemy{Type: Beast})
+	if player.GetCurrency(Gold) != gold + 750 || player.GetCurrency(Gems) != gems + 25 {
+		t.Fatalf("expected the completion reward, gold %d gems %d", player.GetCurrency(Gold), player.GetCurrency(Gems))
+	}
+	completed := 0
+	for _, event := range player.TakeBattleEvents() {
+		if event.Event == EventCodexCompleted {
+			completed++
+		}
+	}
+	if completed != 4 {
+		t.Errorf("expected 4 codex events, got %d", completed)
+	}
+}
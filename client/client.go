@@ -35,10 +35,14 @@ type Player struct {
 	Level        int            `json:"level"`
 	Experience   int            `json:"experience"`
 	Health       int            `json:"health"`
+	MaxHealth    int            `json:"max_health"`
 	Currency     []CurrencyItem `json:"currency"`
 	StatusEffects []interface{}  `json:"status_effects"`
 	BattleState  BattleState    `json:"battle_state"`
 	BattleStats  map[string]interface{} `json:"battle_stats"`
+	Inventory    map[string]int `json:"inventory"`
+	Equipment    map[string]string `json:"equipment"`
+	Loadout      []string       `json:"loadout"`
 	Attributes   map[string]interface{} `json:"attributes"`
 	CreatedAt    int64          `json:"created_at"`
 	UpdatedAt    int64          `json:"updated_at"`
@@ -59,6 +63,7 @@ type BattleState struct {
 type Enemy struct {
 	Type          string         `json:"type"`
 	Health        int            `json:"health"`
+	MaxHealth     int            `json:"max_health"`
 	AttackModifier float64        `json:"attack_modifier"`
 	StatusEffects []interface{}  `json:"status_effects"`
 	Rewards       []RewardItem   `json:"rewards"`
@@ -68,6 +73,7 @@ type Enemy struct {
 type RewardItem struct {
 	Type   string `json:"type"`
 	Amount int    `json:"amount"`
+	ItemID string `json:"item_id"`
 }
 
 //See link for Client API: https://heroiclabs.com/docs/nakama/api/client/
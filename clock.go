@@ -0,0 +1,65 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const MaxClockOffset = 365 * 24 * time.Hour //Furthest ahead a user's clock can be moved.
+
+// Source of the current time.  Every timed path goes through GameClock so tests can swap it out.
+type Clock interface {
+	Now() time.Time
+}
+
+// Clock reading the system time.
+type SystemClock struct{}
+
+// Interface function to get the current time.
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+var GameClock Clock = SystemClock{}
+
+// Per user clock offsets so testers can skip ahead, see set_clock_offset.  Only kept in memory on this node, it is a tool
+// for Local and Development where that is a single node.
+var ClockOffsets = struct {
+	sync.RWMutex //Read/write mutex to help with concurrent access allowing mulitple readers or a single writer.
+	Offsets map[string]time.Duration
+}{
+	Offsets: make(map[string]time.Duration),
+}
+
+// This function gets the current server time, without any user offset.
+func Now() time.Time {
+	return GameClock.Now()
+}
+
+// This function gets the current time as the user sees it.
+func UserNow(userID string) time.Time {
+	return Now().Add(GetClockOffset(userID))
+}
+
+// This function gets how far a user's clock is moved ahead.
+func GetClockOffset(userID string) time.Duration {
+	ClockOffsets.RLock() //Read lock.
+	defer ClockOffsets.RUnlock() //Don't forget to release the lock.
+	return ClockOffsets.Offsets[userID]
+}
+
+// This function moves a user's clock ahead, 0 puts it back.
+func SetClockOffset(userID string, offset time.Duration) {
+	ClockOffsets.Lock() //Call lock on the mutex in preparation for writing.
+	defer ClockOffsets.Unlock() //Don't forget to release the mutex lock.
+	if offset == 0 {
+		delete(ClockOffsets.Offsets, userID)
+		return
+	}
+	ClockOffsets.Offsets[userID] = offset
+}
+
+// This function gets the current time as the player sees it.
+func (p *Player) Now() time.Time {
+	return UserNow(p.ID)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// Clock stuck at a set time.
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+// This function swaps the game clock for one stuck at the given time until the test ends.
+func testFixedClock(t *testing.T, now time.Time) *testClock {
+	t.Helper()
+	clock := &testClock{now: now}
+	previous := GameClock
+	GameClock = clock
+	t.Cleanup(func() {
+		GameClock = previous
+	})
+	return clock
+}
+
+func TestClockOffsetSkipsStatusEffects(t *testing.T) {
+	InitStatusEffectsRegistry()
+	start := time.Unix(1700000000, 0)
+	testFixedClock(t, start)
+	player := NewPlayer(UtilMakeUUID(), "tester")
+	t.Cleanup(func() {
+		SetClockOffset(player.ID, 0)
+	})
+	if player.CreatedAt != start.Unix() {
+		t.Fatalf("created at = %d, want the game clock %d", player.CreatedAt, start.Unix())
+	}
+	AddStatusEffect(&testLogger{}, Poison, player, player.Now().Unix())
+	if len(player.StatusEffects) != 1 {
+		t.Fatalf("expected poison, got %+v", player.StatusEffects)
+	}
+
+	//Only the offset user's clock moves.
+	SetClockOffset(player.ID, 24 * time.Hour)
+	if !UserNow(UtilMakeUUID()).Equal(start) || !player.Now().Equal(start.Add(24 * time.Hour)) {
+		t.Fatalf("unexpected clocks: %v %v", UserNow(UtilMakeUUID()), player.Now())
+	}
+	player.TickPlayerStatusEffects(&testLogger{}, player.Now().Unix())
+	if len(player.StatusEffects) != 0 {
+		t.Fatalf("expected poison to expire after skipping ahead, got %+v", player.StatusEffects)
+	}
+
+	SetClockOffset(player.ID, 0)
+	if !player.Now().Equal(start) {
+		t.Fatalf("expected the offset cleared, got %v", player.Now())
+	}
+}
+
+func TestSetClockOffsetRPCOnlyMovesOthersForAdmins(t *testing.T) {
+	nk := newTestNakama()
+	callerID, otherID := UtilMakeUUID(), UtilMakeUUID()
+	t.Cleanup(func() {
+		SetClockOffset(callerID, 0)
+		SetClockOffset(otherID, 0)
+	})
+	payload, _ := json.Marshal(SetClockOffsetRequest{OffsetSeconds: 3600, UserID: otherID})
+	_, err := SetClockOffsetRPC()(testUserContext(callerID), &testLogger{}, nil, nk, string(payload))
+	if code, body := testErrorBody(t, err); code != CodePermissionDenied || body.Reason != ReasonPermissionDenied {
+		t.Fatalf("testers shouldn't move other clocks: code %d body %+v", code, body)
+	}
+	if GetClockOffset(otherID) != 0 {
+		t.Fatal("the other user's clock moved")
+	}
+	payload, _ = json.Marshal(SetClockOffsetRequest{OffsetSeconds: 3600})
+	if _, err := SetClockOffsetRPC()(testUserContext(callerID), &testLogger{}, nil, nk, string(payload)); err != nil || GetClockOffset(callerID) != time.Hour {
+		t.Fatalf("expected the caller's clock moved: %v", err)
+	}
+}
+
+func TestSharedObjectsUseServerClock(t *testing.T) {
+	nk := newTestNakama()
+	if err := InitEnemyRegistry(context.Background(), &testLogger{}, nk); err != nil {
+		t.Fatalf("InitEnemyRegistry: %v", err)
+	}
+	start := time.Unix(1700000000, 0)
+	testFixedClock(t, start)
+	challenger := NewPlayer(UtilMakeUUID(), "challenger")
+	SetClockOffset(challenger.ID, 24 * time.Hour)
+	t.Cleanup(func() {
+		SetClockOffset(challenger.ID, 0)
+	})
+
+	//A tester skipping ahead doesn't expire the challenge for the opponent.
+	duel, err := ChallengeDuel(context.Background(), &testLogger{}, nk, nil, challenger, UtilMakeUUID())
+	if err != nil {
+		t.Fatalf("ChallengeDuel: %v", err)
+	}
+	if duel.CreatedAt != start.Unix() {
+		t.Fatalf("expected the duel created on the server clock, got %d", duel.CreatedAt)
+	}
+
+	raid, err := JoinOrCreateRaid(context.Background(), nk, challenger.ID, "")
+	if err != nil {
+		t.Fatalf("JoinOrCreateRaid: %v", err)
+	}
+	if raid.CreatedAt != start.Unix() {
+		t.Fatalf("expected the raid created on the server clock, got %d", raid.CreatedAt)
+	}
+	if _, err := LoadMemberRaid(context.Background(), nk, challenger.ID, raid.ID); err != nil {
+		t.Fatalf("raid should still be open on the server clock: %v", err)
+	}
+}
+
+func TestSharedAttacksUseServerClock(t *testing.T) {
+	InitStatusEffectsRegistry()
+	start := time.Unix(1700000000, 0)
+	testFixedClock(t, start)
+	InitAttackRegistry()
+	bleedType := AttackType("test_bleed")
+	AttackRegistry.Lock()
+	AttackRegistry.Attacks[bleedType] = AttackInfo{
+		Type: bleedType,
+		Owner: OwnerPlayer,
+		BaseHitChance: 1,
+		ApplicableStatusEffect: []StatusEffectFromAttacks{{Type: Bleed, Chance: 1}},
+	}
+	AttackRegistry.Unlock()
+	t.Cleanup(func() {
+		AttackRegistry.Lock()
+		delete(AttackRegistry.Attacks, bleedType)
+		AttackRegistry.Unlock()
+	})
+	challenger := NewPlayer(UtilMakeUUID(), "challenger")
+	opponent := NewPlayer(UtilMakeUUID(), "opponent")
+	challenger.Loadout = []AttackType{bleedType}
+	SetClockOffset(challenger.ID, 24 * time.Hour)
+	t.Cleanup(func() {
+		SetClockOffset(challenger.ID, 0)
+	})
+
+	//The status effect a tester applies in a duel runs on the server clock, not theirs.
+	duel := &Duel{ID: UtilMakeUUID(), Challenger: challenger.ID, Opponent: opponent.ID, Status: DuelPending, CreatedAt: start.Unix(), UpdatedAt: start.Unix()}
+	if err := duel.Answer(challenger, opponent, true, start.Unix()); err != nil {
+		t.Fatalf("answer: %v", err)
+	}
+	if _, err := duel.Attack(&testLogger{}, challenger.ID, bleedType, start.Unix()); err != nil {
+		t.Fatalf("attack: %v", err)
+	}
+	effects := duel.Fighters[opponent.ID].StatusEffects
+	if len(effects) != 1 || effects[0].UpdatedAt != start.Unix() {
+		t.Fatalf("expected bleed applied on the server clock, got %+v", effects)
+	}
+}
@@ -14,8 +14,26 @@ type Currency struct {
 
 type RewardType interface {}
 
+// Reward types that aren't a currency.
+type RewardKind string
+const (
+	ItemReward RewardKind = "item"
+)
+
 // Information on rewards.
 type RewardInfo struct {
 	Type RewardType `json:"type"`
 	Amount int64 `json:"amount"`
+	ItemID ItemType `json:"item_id,omitempty"` //Only used by item rewards.
+}
+
+// This function adds (or with a negative amount removes) currency on the player.
+func (p *Player) AddCurrency(currencyType CurrencyType, amount int64) {
+	for i := range p.Currencies {
+		if p.Currencies[i].Type == currencyType {
+			p.Currencies[i].Amount += amount
+			return
+		}
+	}
+	p.Currencies = append(p.Currencies, Currency{Type: currencyType, Amount: amount})
 }
\ No newline at end of file
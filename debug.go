@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"context"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Debug and cheat tools for testers.  The rpcs are only registered when BuildEnvironment.DebugToolsEnabled, see main.go.
+
+var DebugAdminGroup = "debug_admins" //Nakama group whose members can use the debug rpcs on other players.
+
+// This function works out whose data a debug rpc changes: the user id from the payload, or the caller when there isn't
+// one.  Server to server calls have no caller so they must give a user id.  Clients can only give someone else's id
+// when they are in the DebugAdminGroup.
+func DebugTargetUser(ctx context.Context, nk runtime.NakamaModule, userID string) (string, error) {
+	callerID, err := UtilGetUserId(ctx)
+	if userID == "" {
+		if err != nil {
+			return "", NewGameError(CodeUnauthenticated, ReasonUnauthenticated, "No user id in the context.")
+		}
+		return callerID, nil
+	}
+	if err == nil && callerID != userID {
+		admin, err := IsDebugAdmin(ctx, nk, callerID)
+		if err != nil {
+			return "", err
+		}
+		if !admin {
+			return "", NewGameError(CodePermissionDenied, ReasonPermissionDenied, "Only debug admins can change other players.")
+		}
+	}
+	if _, err := nk.AccountGetId(ctx, userID); err != nil {
+		return "", NewGameError(CodeNotFound, ReasonAccountNotFound, fmt.Sprintf("Player not found: %s", userID))
+	}
+	return userID, nil
+}
+
+// This function checks if the user is a member of the DebugAdminGroup.  Join requests don't count.
+func IsDebugAdmin(ctx context.Context, nk runtime.NakamaModule, userID string) (bool, error) {
+	cursor := ""
+	for {
+		groups, next, err := nk.UserGroupsList(ctx, userID, 100, nil, cursor)
+		if err != nil {
+			return false, err
+		}
+		for _, group := range groups {
+			if group.GetGroup().GetName() == DebugAdminGroup && group.GetState().GetValue() < int32(api.UserGroupList_UserGroup_JOIN_REQUEST) {
+				return true, nil
+			}
+		}
+		if next == "" || next == cursor {
+			return false, nil
+		}
+		cursor = next
+	}
+}
+
+// This function sets the player's health, and max health when it's given.
+func (p *Player) DebugSetHealth(health, maxHealth int) {
+	if maxHealth > 0 {
+		p.SetMaxHealth(maxHealth)
+	}
+	p.SetHealth(health)
+}
+
+// This function starts a new battle against a specific enemy type.  Returns the enemy's id.
+func (p *Player) DebugSpawnEnemy(enemyType EnemyType) (string, error) {
+	enemy, err := SpawnRequest{Enemy: enemyType}.PickEnemy()
+	if err != nil {
+		return "", err
+	}
+	return p.StartBattle(enemy), nil
+}
+
+// This function applies a status effect to the player, or to an enemy in the battle when a target id is given.
+func (p *Player) DebugApplyStatusEffect(logger runtime.Logger, effectType StatusEffectType, targetID string) error {
+	var target EntityProcessor = p
+	if targetID != "" {
+		enemy := p.GetEnemy(targetID)
+		if enemy == nil {
+			return NewGameError(CodeNotFound, ReasonEnemyNotFound, fmt.Sprintf("Enemy not found by supplied ID: %s", targetID))
+		}
+		target = enemy
+	}
+	AddStatusEffect(logger, effectType, target, p.Now().Unix())
+	return nil
+}
+
+// This function puts the player back to a brand new character.  The storage version is kept so the save replaces the
+// current data.
+func (p *Player) DebugReset() {
+	fresh := NewPlayer(p.ID, p.DisplayName)
+	fresh.version = p.version
+	*p = *fresh
+}
+
+// This function builds the deletes for the rest of the player's progress, to go in the same write as the reset player.
+func DebugResetStorageDeletes(userID string) []*runtime.StorageDelete {
+	dObjs := []*runtime.StorageDelete{}
+	for _, key := range playerProgressStorageKeys {
+		dObjs = append(dObjs, &runtime.StorageDelete{
+			Collection: playerDataStorageCollection,
+			Key: key,
+			UserID: userID,
+		})
+	}
+	return dObjs
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+func TestDebugTools(t *testing.T) {
+	InitStatusEffectsRegistry()
+	InitAttackRegistry()
+	if err := InitEnemyRegistry(context.Background(), &testLogger{}, newTestNakama()); err != nil {
+		t.Fatalf("InitEnemyRegistry: %v", err)
+	}
+	player := NewPlayer(UtilMakeUUID(), "tester")
+
+	player.DebugSetHealth(500, 0)
+	if player.Health != player.MaxHealth {
+		t.Errorf("health should be capped at max, got %d", player.Health)
+	}
+	player.DebugSetHealth(150, 200)
+	if player.Health != 150 || player.MaxHealth != 200 {
+		t.Errorf("unexpected health %d/%d", player.Health, player.MaxHealth)
+	}
+
+	if _, err := player.DebugSpawnEnemy("dragon"); err == nil {
+		t.Error("expected an error for an unknown enemy type")
+	}
+	enemyID, err := player.DebugSpawnEnemy(Beast)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	enemy := player.GetEnemy(enemyID)
+	if enemy == nil || enemy.Type != Beast || len(player.BattleState.Enemies) != 1 || len(enemy.Rewards) == 0 {
+		t.Fatalf("expected a battle against a beast, got %+v", player.BattleState)
+	}
+
+	if err := player.DebugApplyStatusEffect(&testLogger{}, Bleed, enemyID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := player.DebugApplyStatusEffect(&testLogger{}, Poison, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := player.DebugApplyStatusEffect(&testLogger{}, Poison, UtilMakeUUID()); err == nil {
+		t.Error("expected an error for a missing enemy")
+	}
+	if CountStatusEffects(enemy, Bleed) != 1 || CountStatusEffects(player, Poison) != 1 {
+		t.Errorf("unexpected effects: %+v %+v", enemy.StatusEffects, player.StatusEffects)
+	}
+
+	player.version = "v1"
+	player.AddCurrency(Gold, 1000)
+	player.DebugReset()
+	if player.version != "v1" || player.MaxHealth != PlayerBaseHealth || player.GetCurrency(Gold) != StarterGold || len(player.BattleState.Enemies) != 0 {
+		t.Errorf("expected a fresh player keeping the version, got %+v", player)
+	}
+}
+
+func TestDebugTargetUser(t *testing.T) {
+	nk := newTestNakama()
+	callerID, otherID := UtilMakeUUID(), UtilMakeUUID()
+	if userID, err := DebugTargetUser(testUserContext(callerID), nk, ""); err != nil || userID != callerID {
+		t.Fatalf("expected the caller, got %s: %v", userID, err)
+	}
+	if userID, err := DebugTargetUser(testUserContext(callerID), nk, callerID); err != nil || userID != callerID {
+		t.Fatalf("expected the caller by id, got %s: %v", userID, err)
+	}
+	_, err := DebugTargetUser(testUserContext(callerID), nk, otherID)
+	if code, body := testErrorBody(t, err); code != CodePermissionDenied || body.Reason != ReasonPermissionDenied {
+		t.Fatalf("testers shouldn't change other players: code %d body %+v", code, body)
+	}
+	//Server to server calls and debug admins can.
+	if userID, err := DebugTargetUser(context.Background(), nk, otherID); err != nil || userID != otherID {
+		t.Fatalf("expected the server call to target %s, got %s: %v", otherID, userID, err)
+	}
+	nk.groups = map[string][]string{callerID: {"testers", DebugAdminGroup}}
+	if userID, err := DebugTargetUser(testUserContext(callerID), nk, otherID); err != nil || userID != otherID {
+		t.Fatalf("expected the admin to target %s, got %s: %v", otherID, userID, err)
+	}
+}
+
+func TestDebugResetPlayerRPC(t *testing.T) {
+	nk := newTestNakama()
+	ctx := context.Background()
+	InitAttackRegistry()
+	userID := UtilMakeUUID()
+	player := NewPlayer(userID, "tester")
+	player.version = "*"
+	player.AddCurrency(Gold, 1000)
+	if err := player.SavePlayerData(nk); err != nil {
+		t.Fatalf("save player: %v", err)
+	}
+	//Progress kept outside the player.
+	for _, key := range playerProgressStorageKeys {
+		if _, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{{Collection: playerDataStorageCollection, Key: key, UserID: userID, Value: "{}"}}); err != nil {
+			t.Fatalf("write %s: %v", key, err)
+		}
+	}
+
+	if _, err := DebugResetPlayerRPC()(testUserContext(userID), &testLogger{}, nil, nk, "{}"); err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+	player, err := LoadPlayerData(ctx, &testLogger{}, nk, userID)
+	if err != nil || player.GetCurrency(Gold) != StarterGold {
+		t.Fatalf("expected a fresh player, got %+v: %v", player, err)
+	}
+	for _, key := range playerProgressStorageKeys {
+		objects, _ := nk.StorageRead(ctx, []*runtime.StorageRead{{Collection: playerDataStorageCollection, Key: key, UserID: userID}})
+		if len(objects) != 0 {
+			t.Fatalf("expected %s deleted with the reset", key)
+		}
+	}
+}
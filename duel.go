@@ -0,0 +1,431 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"context"
+	"encoding/json"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+var duelStorageCollection = "duels" //Duels between two players, owned by the system user and keyed by duel id.
+var RatingStorageKey = "rating" //Player duel rating in the player data collection.
+
+const DuelChallengeTTL = 10 * 60 //Seconds a challenge waits for an answer.
+const DuelTurnTTL = 5 * 60 //Seconds a player has to take their turn before forfeiting.
+const DuelInitialRating = 1000 //Elo rating of a player that hasn't duelled.
+const DuelRatingK = 32 //Elo K factor, the most a rating moves in one duel.
+
+// Duel notification codes.
+const (
+	DuelChallengeNotificationCode = 102 //Sent to the opponent, persistent so it can be answered later.
+	DuelAnswerNotificationCode = 103 //Sent to the challenger when the opponent accepts or declines.
+	DuelTurnNotificationCode = 104 //Sent to the player whose turn it is.
+	DuelOverNotificationCode = 105 //Sent to both players when the duel ends.
+)
+
+// Duel states.
+type DuelStatus string
+const (
+	DuelPending DuelStatus = "pending" //Waiting for the opponent to answer.
+	DuelActive DuelStatus = "active"
+	DuelDeclined DuelStatus = "declined"
+	DuelExpired DuelStatus = "expired" //The challenge wasn't answered in time.
+	DuelFinished DuelStatus = "finished"
+)
+
+// Turn based fight between two players.  Each side fights with a copy of their player at full health so a duel doesn't
+// change the player's battle health or status effects.
+type Duel struct {
+	ID string `json:"id"`
+	Challenger string `json:"challenger"`
+	Opponent string `json:"opponent"`
+	Status DuelStatus `json:"status"`
+	Fighters map[string]*Player `json:"fighters"` //Copies of both players by user id, set when the challenge is accepted.
+	Turn string `json:"turn"` //User id of the player to act next.
+	Winner string `json:"winner,omitempty"`
+	Results []*AttackResult `json:"results"` //Every attack in order.
+	CreatedAt int64 `json:"created_at"`
+	UpdatedAt int64 `json:"updated_at"` //Last answer or attack, turn timeouts count from here.
+	version string //Storage version hash from the last read.
+}
+
+// What the players see of a fighter.
+type DuelFighterView struct {
+	DisplayName string `json:"display_name"`
+	Level int `json:"level"`
+	Health int `json:"health"`
+	MaxHealth int `json:"max_health"`
+	StatusEffects []*StatusEffect `json:"status_effects"`
+}
+
+// What the players see of a duel, the fighter copies hold the whole player so only the combat fields are sent.
+type DuelView struct {
+	ID string `json:"id"`
+	Challenger string `json:"challenger"`
+	Opponent string `json:"opponent"`
+	Status DuelStatus `json:"status"`
+	Fighters map[string]DuelFighterView `json:"fighters"`
+	Turn string `json:"turn"`
+	TurnEndsAt int64 `json:"turn_ends_at,omitempty"` //When the player to act forfeits.
+	Winner string `json:"winner,omitempty"`
+	Results []*AttackResult `json:"results"`
+}
+
+// Player duel rating.
+type DuelRating struct {
+	Rating float64 `json:"rating"`
+	Wins int `json:"wins"`
+	Losses int `json:"losses"`
+	version string //Storage version hash from the last read.
+}
+
+// This function gets a duel from nakama storage, nil when there isn't one.
+func LoadDuel(ctx context.Context, nk runtime.NakamaModule, duelID string) (*Duel, error) {
+	//Read from the storage engine.
+	rObj, err := nk.StorageRead(ctx, []*runtime.StorageRead{
+		{
+			Collection: duelStorageCollection,
+			Key: duelID,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(rObj) == 0 {
+		return nil, nil
+	}
+	//Unmarshal json data to duel object.
+	duel := &Duel{}
+	if err = json.Unmarshal([]byte(rObj[0].Value), duel); err != nil {
+		return nil, err
+	}
+	duel.version = rObj[0].Version
+	return duel, nil
+}
+
+// This function loads a duel the user is in.
+func LoadPlayerDuel(ctx context.Context, nk runtime.NakamaModule, userID, duelID string) (*Duel, error) {
+	duel, err := LoadDuel(ctx, nk, duelID)
+	if err != nil {
+		return nil, err
+	}
+	if duel == nil || (duel.Challenger != userID && duel.Opponent != userID) {
+		return nil, NewGameError(CodeNotFound, ReasonDuelNotFound, fmt.Sprintf("Duel not found: %s", duelID))
+	}
+	return duel, nil
+}
+
+// This function builds the storage write for the duel so it can be batched with the ratings.
+func (d *Duel) DuelStorageWrite() (*runtime.StorageWrite, error) {
+	//Json-ify the duel struct in prepartion for storage.
+	data, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	return &runtime.StorageWrite{
+		Collection: duelStorageCollection,
+		Key: d.ID,
+		Value: string(data),
+		Version: d.version,
+		PermissionRead: 0, // Only the runtime can read.
+		PermissionWrite: 0, // No one can write save the runtime.
+	}, nil
+}
+
+// This function gets the other player in the duel.
+func (d *Duel) OtherPlayer(userID string) string {
+	if userID == d.Challenger {
+		return d.Opponent
+	}
+	return d.Challenger
+}
+
+// This function ends challenges nobody answered and forfeits players that didn't take their turn.  Returns true when the
+// duel changed.
+func (d *Duel) CheckTimeout(timestamp int64) bool {
+	switch d.Status {
+	case DuelPending:
+		if d.CreatedAt + DuelChallengeTTL <= timestamp {
+			d.Status = DuelExpired
+			d.UpdatedAt = timestamp
+			return true
+		}
+	case DuelActive:
+		if d.UpdatedAt + DuelTurnTTL <= timestamp {
+			d.Finish(d.OtherPlayer(d.Turn), timestamp)
+			return true
+		}
+	}
+	return false
+}
+
+// This function ends the duel with a winner.
+func (d *Duel) Finish(winner string, timestamp int64) {
+	d.Status = DuelFinished
+	d.Winner = winner
+	d.Turn = ""
+	d.UpdatedAt = timestamp
+}
+
+// This function builds what the players see of the duel.
+func (d *Duel) View() DuelView {
+	view := DuelView{
+		ID: d.ID,
+		Challenger: d.Challenger,
+		Opponent: d.Opponent,
+		Status: d.Status,
+		Fighters: make(map[string]DuelFighterView),
+		Turn: d.Turn,
+		Winner: d.Winner,
+		Results: d.Results,
+	}
+	if d.Status == DuelActive {
+		view.TurnEndsAt = d.UpdatedAt + DuelTurnTTL
+	}
+	for userID, fighter := range d.Fighters {
+		view.Fighters[userID] = DuelFighterView{
+			DisplayName: fighter.DisplayName,
+			Level: fighter.Level,
+			Health: fighter.Health,
+			MaxHealth: fighter.MaxHealth,
+			StatusEffects: fighter.StatusEffects,
+		}
+	}
+	return view
+}
+
+// This function makes the copy of the player that fights in the duel.
+func DuelFighter(player *Player) *Player {
+	fighter := *player
+	fighter.Health = fighter.MaxHealth
+	fighter.StatusEffects = []*StatusEffect{}
+	fighter.BattleState = BattleState{}
+	return &fighter
+}
+
+// This function answers a challenge.  Accepting sets up both fighters and gives the challenger the first turn.
+func (d *Duel) Answer(challenger, opponent *Player, accept bool, timestamp int64) error {
+	if d.Status != DuelPending {
+		return NewGameError(CodeFailedPrecondition, ReasonDuelNotActive, fmt.Sprintf("Duel was already answered: %s", d.Status))
+	}
+	d.UpdatedAt = timestamp
+	if !accept {
+		d.Status = DuelDeclined
+		return nil
+	}
+	d.Status = DuelActive
+	d.Fighters = map[string]*Player{
+		challenger.ID: DuelFighter(challenger),
+		opponent.ID: DuelFighter(opponent),
+	}
+	d.Turn = challenger.ID
+	return nil
+}
+
+// This function performs the player's turn.  The duel is over when either fighter dies.
+func (d *Duel) Attack(logger runtime.Logger, userID string, attackRequest AttackType, timestamp int64) (*AttackResult, error) {
+	if d.Status != DuelActive {
+		return nil, NewGameError(CodeFailedPrecondition, ReasonDuelNotActive, fmt.Sprintf("Duel is not active: %s", d.Status))
+	}
+	if d.Turn != userID {
+		return nil, NewGameError(CodeFailedPrecondition, ReasonNotYourTurn, "Wait for the other player to take their turn.")
+	}
+	targetID := d.OtherPlayer(userID)
+	attacker, target := d.Fighters[userID], d.Fighters[targetID]
+	if attacker == nil || target == nil {
+		return nil, NewGameError(CodeInternal, ReasonInternal, "Duel is missing a fighter.")
+	}
+	result, err := attacker.AttackCombatant(logger, targetID, target, attackRequest, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	d.Results = append(d.Results, result)
+	d.UpdatedAt = timestamp
+	d.Turn = targetID
+	//Status effects can take out the attacker on their own turn.
+	if result.EnemyKilled {
+		d.Finish(userID, timestamp)
+	} else if result.PlayerDead {
+		d.Finish(targetID, timestamp)
+	}
+	return result, nil
+}
+
+// This function gets a player's duel rating from nakama storage.
+func LoadDuelRating(ctx context.Context, nk runtime.NakamaModule, userID string) (*DuelRating, error) {
+	//Read from the storage engine.
+	rObj, err := nk.StorageRead(ctx, []*runtime.StorageRead{
+		{
+			Collection: playerDataStorageCollection,
+			Key: RatingStorageKey,
+			UserID: userID,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	rating := &DuelRating{Rating: DuelInitialRating}
+	if len(rObj) == 0 {
+		rating.version = "*" //Only write if no one else created it first.
+		return rating, nil
+	}
+	//Unmarshal json data to rating object.
+	if err = json.Unmarshal([]byte(rObj[0].Value), rating); err != nil {
+		return nil, err
+	}
+	rating.version = rObj[0].Version
+	return rating, nil
+}
+
+// This function builds the storage write for the rating so it can be batched with the duel.
+func (r *DuelRating) RatingStorageWrite(userID string) (*runtime.StorageWrite, error) {
+	//Json-ify the rating struct in prepartion for storage.
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	return &runtime.StorageWrite{
+		Collection: playerDataStorageCollection,
+		Key: RatingStorageKey,
+		UserID: userID,
+		Value: string(data),
+		Version: r.version,
+		PermissionRead: 2, // Anyone can read so opponents can see it.
+		PermissionWrite: 0, // No one can write save the runtime.
+	}, nil
+}
+
+// This function works out the new Elo ratings after a duel.
+func EloRatings(winner, loser float64) (float64, float64) {
+	expected := 1 / (1 + math.Pow(10, (loser - winner) / 400)) //Chance the winner was expected to win.
+	change := DuelRatingK * (1 - expected)
+	return winner + change, loser - change
+}
+
+// This function builds the challenge_duel and answer_duel response.
+func DuelResponse(duel *Duel) interface{} {
+	//Limited scope response struct
+	return struct {
+		Duel DuelView `json:"duel"`
+	}{
+		Duel: duel.View(),
+	}
+}
+
+// This function builds the duel_attack response, the result is nil when the duel ended on a timeout instead.
+func DuelAttackResponse(result *AttackResult, duel *Duel) interface{} {
+	//Limited scope response struct
+	return struct {
+		Result *AttackResult `json:"result"`
+		Duel DuelView `json:"duel"`
+	}{
+		Result: result,
+		Duel: duel.View(),
+	}
+}
+
+// This function saves the duel, and when it just finished, both ratings in the same write so a result is never counted
+// twice or lost.  Other objects, ex: the request log, can be passed in to be saved in the same write.
+func SaveDuel(ctx context.Context, nk runtime.NakamaModule, duel *Duel, finished bool, writes ...*runtime.StorageWrite) error {
+	wObj, err := duel.DuelStorageWrite()
+	if err != nil {
+		return err
+	}
+	wObjs := []*runtime.StorageWrite{wObj}
+	for _, write := range writes {
+		if write != nil { //No request log to save.
+			wObjs = append(wObjs, write)
+		}
+	}
+	if finished {
+		loser := duel.OtherPlayer(duel.Winner)
+		winnerRating, err := LoadDuelRating(ctx, nk, duel.Winner)
+		if err != nil {
+			return err
+		}
+		loserRating, err := LoadDuelRating(ctx, nk, loser)
+		if err != nil {
+			return err
+		}
+		winnerRating.Rating, loserRating.Rating = EloRatings(winnerRating.Rating, loserRating.Rating)
+		winnerRating.Wins++
+		loserRating.Losses++
+		for userID, rating := range map[string]*DuelRating{duel.Winner: winnerRating, loser: loserRating} {
+			ratingWrite, err := rating.RatingStorageWrite(userID)
+			if err != nil {
+				return err
+			}
+			wObjs = append(wObjs, ratingWrite)
+		}
+	}
+	//Write to the storage engine, versions make this fail if the other player acted first.
+	acks, err := nk.StorageWrite(ctx, wObjs)
+	if err != nil {
+		return NewGameError(CodeAborted, ReasonConflict, "Duel was not saved, try again.")
+	}
+	duel.SetStorageVersion(acks)
+	return nil
+}
+
+// This function keeps the storage version current after a write.
+func (d *Duel) SetStorageVersion(acks []*api.StorageObjectAck) {
+	for _, ack := range acks {
+		if ack.Collection == duelStorageCollection && ack.Key == d.ID {
+			d.version = ack.Version
+		}
+	}
+}
+
+// This function creates a challenge and tells the opponent about it.  With a request log from BeginRequest the response
+// is saved with the duel.
+func ChallengeDuel(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, requestLog *RequestLog, challenger *Player, opponentID string) (*Duel, error) {
+	if opponentID == challenger.ID {
+		return nil, NewFieldError("opponent_id", "Players can't duel themselves.")
+	}
+	if _, err := nk.AccountGetId(ctx, opponentID); err != nil {
+		return nil, NewGameError(CodeNotFound, ReasonAccountNotFound, fmt.Sprintf("Player not found: %s", opponentID))
+	}
+	now := Now().Unix() //Duels are shared so they run on the server clock, not the challenger's.
+	duel := &Duel{
+		ID: UtilMakeUUID(),
+		Challenger: challenger.ID,
+		Opponent: opponentID,
+		Status: DuelPending,
+		Results: []*AttackResult{},
+		CreatedAt: now,
+		UpdatedAt: now,
+		version: "*",
+	}
+	_, logWrite, err := requestLog.RecordWrite(logger, DuelResponse(duel))
+	if err != nil {
+		return nil, err
+	}
+	if err := SaveDuel(ctx, nk, duel, false, logWrite); err != nil {
+		return nil, err
+	}
+	content := map[string]interface{}{
+		"duel_id": duel.ID,
+		"challenger_id": challenger.ID,
+		"challenger_name": challenger.DisplayName,
+		"expires_at": duel.CreatedAt + DuelChallengeTTL,
+	}
+	if err := nk.NotificationSend(ctx, opponentID, "Duel challenge", content, DuelChallengeNotificationCode, challenger.ID, true); err != nil {
+		logger.Error("Unable to send duel challenge: %v", err)
+	}
+	return duel, nil
+}
+
+// This function tells a player something happened in the duel.  Failures are logged, the duel is already saved.
+func NotifyDuel(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, duel *Duel, userID, subject string, code int) {
+	content := map[string]interface{}{
+		"duel_id": duel.ID,
+		"status": duel.Status,
+		"turn": duel.Turn,
+		"winner": duel.Winner,
+	}
+	if err := nk.NotificationSend(ctx, userID, subject, content, code, "", code != DuelTurnNotificationCode); err != nil {
+		logger.Error("Unable to send duel notification: %v", err)
+	}
+}
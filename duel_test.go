@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestEloRatings(t *testing.T) {
+	winner, loser := EloRatings(1000, 1000)
+	if winner != 1016 || loser != 984 {
+		t.Fatalf("even ratings: %v %v", winner, loser)
+	}
+	//Beating a much weaker player barely moves the ratings.
+	winner, loser = EloRatings(1400, 1000)
+	if winner - 1400 > 3 || math.Abs((winner - 1400) - (1000 - loser)) > 1e-9 {
+		t.Fatalf("favourite won: %v %v", winner, loser)
+	}
+}
+
+func TestDuelTurns(t *testing.T) {
+	nk := newTestNakama()
+	ctx := context.Background()
+	attackType := testSureHitAttack(t, 40)
+	challenger := NewPlayer(UtilMakeUUID(), "challenger")
+	opponent := NewPlayer(UtilMakeUUID(), "opponent")
+	challenger.Loadout = []AttackType{attackType}
+	opponent.Loadout = []AttackType{attackType}
+	challenger.Health = 1 //Duels are fought at full health.
+	duel := &Duel{ID: UtilMakeUUID(), Challenger: challenger.ID, Opponent: opponent.ID, Status: DuelPending, CreatedAt: 100, UpdatedAt: 100, version: "*"}
+
+	if _, err := duel.Attack(&testLogger{}, challenger.ID, attackType, 101); err == nil {
+		t.Fatal("pending duel shouldn't allow attacks")
+	}
+	if err := duel.Answer(challenger, opponent, true, 101); err != nil {
+		t.Fatalf("answer: %v", err)
+	}
+	if duel.Fighters[challenger.ID].Health != challenger.MaxHealth || challenger.Health != 1 {
+		t.Fatal("fighters should be copies at full health")
+	}
+	_, err := duel.Attack(&testLogger{}, opponent.ID, attackType, 102)
+	if code, body := testErrorBody(t, err); code != CodeFailedPrecondition || body.Reason != ReasonNotYourTurn {
+		t.Fatalf("out of turn: code %d body %+v", code, body)
+	}
+
+	//Trade hits until someone falls, the challenger hits first so wins with equal damage.
+	attacker := challenger.ID
+	for i := 0; duel.Status == DuelActive; i++ {
+		if i > 20 {
+			t.Fatal("duel never ended")
+		}
+		if _, err := duel.Attack(&testLogger{}, attacker, attackType, 103); err != nil {
+			t.Fatalf("attack %d: %v", i, err)
+		}
+		attacker = duel.OtherPlayer(attacker)
+	}
+	if duel.Winner != challenger.ID {
+		t.Fatalf("winner = %s, want the challenger", duel.Winner)
+	}
+
+	//Ratings are saved with the result.
+	if err := SaveDuel(ctx, nk, duel, true); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	winnerRating, _ := LoadDuelRating(ctx, nk, challenger.ID)
+	loserRating, _ := LoadDuelRating(ctx, nk, opponent.ID)
+	if winnerRating.Rating <= DuelInitialRating || winnerRating.Wins != 1 || loserRating.Rating >= DuelInitialRating || loserRating.Losses != 1 {
+		t.Fatalf("ratings: %+v %+v", winnerRating, loserRating)
+	}
+}
+
+func TestDuelTimeout(t *testing.T) {
+	duel := &Duel{Challenger: "a", Opponent: "b", Status: DuelPending, CreatedAt: 100, UpdatedAt: 100}
+	if duel.CheckTimeout(100 + DuelChallengeTTL - 1) {
+		t.Fatal("challenge expired early")
+	}
+	if !duel.CheckTimeout(100 + DuelChallengeTTL) || duel.Status != DuelExpired {
+		t.Fatalf("challenge should expire, status %s", duel.Status)
+	}
+
+	duel = &Duel{Challenger: "a", Opponent: "b", Status: DuelActive, Turn: "b", UpdatedAt: 100}
+	if !duel.CheckTimeout(100 + DuelTurnTTL) || duel.Status != DuelFinished || duel.Winner != "a" {
+		t.Fatalf("idle player should forfeit: %+v", duel)
+	}
+}
+
+func TestDuelAttackRPCAfterForfeit(t *testing.T) {
+	nk := newTestNakama()
+	start := time.Unix(1700000000, 0)
+	clock := testFixedClock(t, start)
+	attackType := testSureHitAttack(t, 10)
+	duel := &Duel{ID: UtilMakeUUID(), Challenger: UtilMakeUUID(), Opponent: UtilMakeUUID(), Status: DuelActive, CreatedAt: start.Unix(), UpdatedAt: start.Unix(), version: "*"}
+	duel.Turn = duel.Opponent
+	if err := SaveDuel(context.Background(), nk, duel, false); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	//The opponent let their turn run out, the challenger's attack gets the forfeit instead of a turn error.
+	clock.now = start.Add(DuelTurnTTL * time.Second)
+	payload, _ := json.Marshal(DuelAttackRequest{DuelID: duel.ID, Attack: attackType})
+	data, err := DuelAttackRPC()(testUserContext(duel.Challenger), &testLogger{}, nil, nk, string(payload))
+	if err != nil {
+		t.Fatalf("attack after forfeit: %v", err)
+	}
+	var response struct {
+		Result *AttackResult `json:"result"`
+		Duel DuelView `json:"duel"`
+	}
+	if err := json.Unmarshal([]byte(data), &response); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if response.Result != nil || response.Duel.Status != DuelFinished || response.Duel.Winner != duel.Challenger {
+		t.Fatalf("expected the finished duel without an attack: %s", data)
+	}
+}
+
+func TestDuelRPCReplay(t *testing.T) {
+	nk := newTestNakama()
+	ctx := context.Background()
+	testFixedClock(t, time.Unix(1700000000, 0))
+	attackType := testSureHitAttack(t, 10)
+	challenger := NewPlayer(UtilMakeUUID(), "challenger")
+	challenger.version = "*"
+	if err := challenger.SavePlayerData(nk); err != nil {
+		t.Fatalf("save player: %v", err)
+	}
+
+	//A retried challenge gets the first duel back instead of a second one.
+	payload, _ := json.Marshal(ChallengeDuelRequest{OpponentID: UtilMakeUUID(), RequestID: "challenge-1"})
+	first, err := ChallengeDuelRPC()(testUserContext(challenger.ID), &testLogger{}, nil, nk, string(payload))
+	if err != nil {
+		t.Fatalf("challenge: %v", err)
+	}
+	second, err := ChallengeDuelRPC()(testUserContext(challenger.ID), &testLogger{}, nil, nk, string(payload))
+	if err != nil || second != first {
+		t.Fatalf("challenge retry: %v\n%s\nwant\n%s", err, second, first)
+	}
+
+	//A retried attack gets the first result back instead of a turn error.
+	var challenge struct {
+		Duel DuelView `json:"duel"`
+	}
+	if err := json.Unmarshal([]byte(first), &challenge); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	duel, err := LoadDuel(ctx, nk, challenge.Duel.ID)
+	if err != nil {
+		t.Fatalf("load duel: %v", err)
+	}
+	opponent := NewPlayer(duel.Opponent, "opponent")
+	challenger.Loadout = []AttackType{attackType}
+	opponent.Loadout = []AttackType{attackType}
+	if err := duel.Answer(challenger, opponent, true, Now().Unix()); err != nil {
+		t.Fatalf("answer: %v", err)
+	}
+	if err := SaveDuel(ctx, nk, duel, false); err != nil {
+		t.Fatalf("save duel: %v", err)
+	}
+	payload, _ = json.Marshal(DuelAttackRequest{DuelID: duel.ID, Attack: attackType, RequestID: "attack-1"})
+	first, err = DuelAttackRPC()(testUserContext(challenger.ID), &testLogger{}, nil, nk, string(payload))
+	if err != nil {
+		t.Fatalf("attack: %v", err)
+	}
+	second, err = DuelAttackRPC()(testUserContext(challenger.ID), &testLogger{}, nil, nk, string(payload))
+	if err != nil || second != first {
+		t.Fatalf("attack retry: %v\n%s\nwant\n%s", err, second, first)
+	}
+	duel, _ = LoadDuel(ctx, nk, duel.ID)
+	if len(duel.Results) != 1 || duel.Turn != duel.Opponent {
+		t.Fatalf("retry attacked again: %d results, turn %s", len(duel.Results), duel.Turn)
+	}
+}
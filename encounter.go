@@ -0,0 +1,304 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"context"
+	"encoding/json"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+var encounterDataStorageKey = "encounters"
+
+// Enemy type and how likely it is to spawn from a pool.
+type SpawnWeight struct {
+	Enemy EnemyType `json:"enemy"`
+	Weight int `json:"weight"` //Relative to the rest of the pool, 0 or less never spawns.
+}
+
+// What a new battle spawns.  A specific enemy type wins over the pool, an empty request picks any enemy in the registry.
+type SpawnRequest struct {
+	Enemy EnemyType `json:"enemy,omitempty"`
+	Pool []SpawnWeight `json:"pool,omitempty"`
+}
+
+// Information on a single encounter a player can start.
+type EncounterInfo struct {
+	ID string `json:"id"`
+	Name string `json:"name"`
+	Description string `json:"description"`
+	Spawn SpawnRequest `json:"spawn"`
+	Unlock UnlockRequirement `json:"unlock"` //What a player needs before starting the encounter.
+	Event bool `json:"event"` //Live-ops event, while active it replaces the normal spawns for battles started without an encounter by players meeting its unlock.
+	StartAt int64 `json:"start_at"` //Timestamp of when the encounter is available, 0 is always.
+	EndAt int64 `json:"end_at"` //Timestamp of when the encounter is no longer available, 0 is never.
+}
+
+// Registry to hold all of the definitions.  Using a mutex here since the data could be live-ops driven meaning it could change after nakama init.
+// **NOTE: If the plan is to not update this information after nakama init then this paradigm can be change to a simple read-only map instead.
+var EncounterRegistry = struct {
+	sync.RWMutex //Read/write mutex to help with concurrent access allowing mulitple readers or a single writer.
+	Encounters map[string]EncounterInfo
+}{
+	Encounters: make(map[string]EncounterInfo),
+}
+
+// Encounter with whether the player can start it, sent to the client.
+type PlayerEncounter struct {
+	EncounterInfo
+	Locked bool `json:"locked"` //Unlock requirements aren't met.
+}
+
+// This function will initialize the Encounter Registry.
+func InitEncounterRegistry(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) error {
+	//Read from the storage engine.
+	rObj, err := nk.StorageRead(ctx, []*runtime.StorageRead{
+		{
+			Collection: configDataStorageCollection,
+			Key: encounterDataStorageKey,
+		},
+	})
+	if err != nil {
+		logger.Error("Error getting encounter configuration data: %v", err)
+		return err
+	}
+	//Load defaults if nothing was found in storage and save them into storage.
+	//Event encounters such as a zombie week are added by live-ops with a time window, there are none by default.
+	if len(rObj) == 0 {
+		EncounterRegistry.Lock()  //Call lock on the mutex in preparation for writing.
+		EncounterRegistry.Encounters["graveyard"] = EncounterInfo{
+			ID: "graveyard",
+			Name: "Graveyard",
+			Description: "The dead don't stay put here.",
+			Spawn: SpawnRequest{Enemy: Zombie},
+			Unlock: UnlockRequirement{Level: 1},
+		}
+		EncounterRegistry.Encounters["wilds"] = EncounterInfo{
+			ID: "wilds",
+			Name: "The Wilds",
+			Description: "Mostly beasts, the odd mutant wanders through.",
+			Spawn: SpawnRequest{Pool: []SpawnWeight{
+				{Enemy: Beast, Weight: 3},
+				{Enemy: Mutant, Weight: 1},
+			}},
+			Unlock: UnlockRequirement{Level: 3},
+		}
+		EncounterRegistry.Encounters["laboratory"] = EncounterInfo{
+			ID: "laboratory",
+			Name: "Laboratory",
+			Description: "Where the mutants come from.",
+			Spawn: SpawnRequest{Enemy: Mutant},
+			Unlock: UnlockRequirement{Level: 5},
+		}
+		EncounterRegistry.Unlock() //Don't forget to release the mutex lock.
+		return SaveEncounterRegistry(nk)
+	}
+
+	var encounters map[string]EncounterInfo
+	if err := json.Unmarshal([]byte(rObj[0].Value), &encounters); err != nil {
+		logger.Error("Failed to unmarshal encounter data: %v", err)
+		return err
+	}
+	if encounters == nil {
+		encounters = make(map[string]EncounterInfo)
+	}
+	EncounterRegistry.Lock()  //Call lock on the mutex in preparation for writing.
+	EncounterRegistry.Encounters = encounters
+	EncounterRegistry.Unlock() //Don't forget to release the mutex lock.
+
+	return nil
+}
+
+// This function will save the Encounter Registry to storage.
+func SaveEncounterRegistry(nk runtime.NakamaModule) error {
+	EncounterRegistry.RLock() //Read lock.
+	//Json-ify the encounter registry in prepartion for storage.
+	data, err := json.Marshal(EncounterRegistry.Encounters)
+	EncounterRegistry.RUnlock() //Don't forget to release the lock.
+	if err != nil {
+		return err
+	}
+	wObj := []*runtime.StorageWrite{
+		{
+			Collection: configDataStorageCollection,
+			Key: encounterDataStorageKey,
+			Value: string(data),
+			PermissionRead: 1, // Owner and runtime can read.
+			PermissionWrite: 0, // No one can write save the runtime.
+		},
+	}
+	//Write to the storage engine.
+	if _, err := nk.StorageWrite(context.Background(), wObj); err != nil {
+		return fmt.Errorf("failed to write encounter data to storage: %v", err)
+	}
+	return nil
+}
+
+// This function gets an encounter from the registry.
+func GetEncounter(id string) (EncounterInfo, bool) {
+	EncounterRegistry.RLock() //Read lock.
+	defer EncounterRegistry.RUnlock() //Don't forget to release the lock.
+	encounter, exists := EncounterRegistry.Encounters[id]
+	return encounter, exists
+}
+
+// This function checks if the encounter is inside its time window.
+func (e EncounterInfo) IsActive(timestamp int64) bool {
+	if e.StartAt > 0 && timestamp < e.StartAt {
+		return false
+	}
+	if e.EndAt > 0 && timestamp >= e.EndAt {
+		return false
+	}
+	return true
+}
+
+// This function finds the active event encounter, the one ending first when events overlap.
+func ActiveEventEncounter(timestamp int64) (EncounterInfo, bool) {
+	EncounterRegistry.RLock() //Read lock.
+	defer EncounterRegistry.RUnlock() //Don't forget to release the lock.
+	var active EncounterInfo
+	found := false
+	for _, encounter := range EncounterRegistry.Encounters {
+		if !encounter.Event || !encounter.IsActive(timestamp) {
+			continue
+		}
+		//Open ended events sort last, ties go to the id so the pick is stable.
+		if !found || endsBefore(encounter, active) {
+			active = encounter
+			found = true
+		}
+	}
+	return active, found
+}
+
+// This function orders encounters by their end time, 0 being never.
+func endsBefore(a, b EncounterInfo) bool {
+	if a.EndAt != b.EndAt {
+		if a.EndAt == 0 || b.EndAt == 0 {
+			return b.EndAt == 0
+		}
+		return a.EndAt < b.EndAt
+	}
+	return a.ID < b.ID
+}
+
+// This function gets what a battle started without an encounter spawns for the player, the active event pool when they
+// meet its unlock requirements or any enemy.
+func (p *Player) DefaultSpawn(timestamp int64) SpawnRequest {
+	if event, exists := ActiveEventEncounter(timestamp); exists && p.MeetsEncounterUnlock(event) == nil {
+		return event.Spawn
+	}
+	return SpawnRequest{}
+}
+
+// This function picks the enemy for the spawn request.
+func (s SpawnRequest) PickEnemy() (Enemy, error) {
+	if s.Enemy != "" {
+		enemy, exists := GetEnemyType(s.Enemy)
+		if !exists {
+			return Enemy{}, NewGameError(CodeNotFound, ReasonEnemyNotFound, fmt.Sprintf("Enemy type not found: %s", s.Enemy))
+		}
+		return enemy, nil
+	}
+	if len(s.Pool) == 0 {
+		enemy, exists := GetEnemy()
+		if !exists {
+			return Enemy{}, fmt.Errorf("unable to get an enemy, scope out of bounds possibly.")
+		}
+		return enemy, nil
+	}
+
+	//Only weigh the enemy types still in the registry.
+	EnemyRegistry.RLock() //Read lock.
+	candidates := []Enemy{}
+	weights := []int{}
+	total := 0
+	for _, spawn := range s.Pool {
+		enemy, exists := EnemyRegistry.Enemies[spawn.Enemy]
+		if !exists || spawn.Weight <= 0 {
+			continue
+		}
+		candidates = append(candidates, enemy)
+		weights = append(weights, spawn.Weight)
+		total += spawn.Weight
+	}
+	EnemyRegistry.RUnlock() //Release read lock.
+	if total == 0 {
+		return Enemy{}, NewGameError(CodeNotFound, ReasonEnemyNotFound, "No enemy in the spawn pool.")
+	}
+	roll := BattleDiceRoll(1, total)
+	for i, weight := range weights {
+		if roll <= weight {
+			return candidates[i], nil
+		}
+		roll -= weight
+	}
+	return candidates[len(candidates) - 1], nil
+}
+
+// This function checks if the player meets the encounter's unlock requirements.
+func (p *Player) MeetsEncounterUnlock(encounter EncounterInfo) error {
+	if p.Level < encounter.Unlock.Level {
+		return NewGameError(CodeFailedPrecondition, ReasonEncounterLocked, fmt.Sprintf("Encounter requires level %d: %s", encounter.Unlock.Level, encounter.ID))
+	}
+	if encounter.Unlock.Item != "" && !p.OwnsItem(encounter.Unlock.Item) {
+		return NewGameError(CodeFailedPrecondition, ReasonEncounterLocked, fmt.Sprintf("Encounter requires item %s: %s", encounter.Unlock.Item, encounter.ID))
+	}
+	if encounter.Unlock.Quest != "" && !p.HasCompletedQuest(encounter.Unlock.Quest) {
+		return NewGameError(CodeFailedPrecondition, ReasonEncounterLocked, fmt.Sprintf("Encounter requires quest %s: %s", encounter.Unlock.Quest, encounter.ID))
+	}
+	return nil
+}
+
+// This function starts a new battle from the encounter, or from the default spawns when the id is empty.  A battle in
+// progress has to be finished or fled first, unless it was spawned by loading the game and hasn't been fought.
+func (p *Player) StartEncounter(encounterID string) error {
+	if p.IsPlayerDead() {
+		return NewGameError(CodeFailedPrecondition, ReasonPlayerDead, "Player is deceased.")
+	}
+	if len(p.BattleState.Enemies) > 0 && !p.BattleState.Untouched() {
+		return NewGameError(CodeFailedPrecondition, ReasonBattleInProgress, "Finish or flee the current battle first.")
+	}
+	now := p.Now().Unix()
+	if encounterID == "" {
+		return p.CreateBattle(p.DefaultSpawn(now))
+	}
+	encounter, exists := GetEncounter(encounterID)
+	if !exists {
+		return NewGameError(CodeNotFound, ReasonEncounterNotFound, fmt.Sprintf("Encounter not found: %s", encounterID))
+	}
+	if !encounter.IsActive(now) {
+		return NewGameError(CodeFailedPrecondition, ReasonEncounterUnavailable, fmt.Sprintf("Encounter is not available: %s", encounterID))
+	}
+	if err := p.MeetsEncounterUnlock(encounter); err != nil {
+		return err
+	}
+	return p.CreateBattle(encounter.Spawn)
+}
+
+// This function lists the encounters available now, ordered by the level needed.
+func (p *Player) ListEncounters() []PlayerEncounter {
+	now := p.Now().Unix()
+	EncounterRegistry.RLock() //Read lock.
+	encounters := []PlayerEncounter{}
+	for _, encounter := range EncounterRegistry.Encounters {
+		if !encounter.IsActive(now) {
+			continue
+		}
+		encounters = append(encounters, PlayerEncounter{EncounterInfo: encounter})
+	}
+	EncounterRegistry.RUnlock() //Release read lock.
+	//Check the unlocks outside the registry lock, quests take their own.
+	for i := range encounters {
+		encounters[i].Locked = p.MeetsEncounterUnlock(encounters[i].EncounterInfo) != nil
+	}
+	sort.Slice(encounters, func(i, j int) bool {
+		if encounters[i].Unlock.Level != encounters[j].Unlock.Level {
+			return encounters[i].Unlock.Level < encounters[j].Unlock.Level
+		}
+		return encounters[i].ID < encounters[j].ID
+	})
+	return encounters
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func testEncounters(t *testing.T) {
+	t.Helper()
+	nk := newTestNakama()
+	EnemyRegistry.Lock()
+	EnemyRegistry.Enemies = make(map[EnemyType]Enemy)
+	EnemyRegistry.Unlock()
+	if err := InitEnemyRegistry(context.Background(), &testLogger{}, nk); err != nil {
+		t.Fatalf("InitEnemyRegistry: %v", err)
+	}
+	EncounterRegistry.Lock()
+	EncounterRegistry.Encounters = make(map[string]EncounterInfo)
+	EncounterRegistry.Unlock()
+	if err := InitEncounterRegistry(context.Background(), &testLogger{}, nk); err != nil {
+		t.Fatalf("InitEncounterRegistry: %v", err)
+	}
+	t.Cleanup(func() {
+		EncounterRegistry.Lock()
+		EncounterRegistry.Encounters = make(map[string]EncounterInfo)
+		EncounterRegistry.Unlock()
+	})
+}
+
+func TestSpawnRequestPicksEnemy(t *testing.T) {
+	testEncounters(t)
+	enemy, err := SpawnRequest{Enemy: Mutant}.PickEnemy()
+	if err != nil || enemy.Type != Mutant {
+		t.Fatalf("expected a mutant, got %+v: %v", enemy, err)
+	}
+	if _, err := (SpawnRequest{Enemy: "dragon"}).PickEnemy(); err == nil {
+		t.Fatalf("expected an unknown enemy type to fail")
+	}
+	//Only the weighted enemy can come out of the pool.
+	pool := SpawnRequest{Pool: []SpawnWeight{{Enemy: Beast, Weight: 5}, {Enemy: Zombie, Weight: 0}, {Enemy: "dragon", Weight: 10}}}
+	for i := 0; i < 20; i++ {
+		enemy, err := pool.PickEnemy()
+		if err != nil || enemy.Type != Beast {
+			t.Fatalf("expected a beast, got %+v: %v", enemy, err)
+		}
+	}
+	if _, err := (SpawnRequest{Pool: []SpawnWeight{{Enemy: Zombie, Weight: 0}}}).PickEnemy(); err == nil {
+		t.Fatalf("expected a pool without weight to fail")
+	}
+}
+
+func TestStartEncounterChecksUnlocks(t *testing.T) {
+	testEncounters(t)
+	player := NewPlayer(UtilMakeUUID(), "tester")
+	player.Level = 1
+	err := player.StartEncounter("laboratory")
+	if code, body := testErrorBody(t, err); code != CodeFailedPrecondition || body.Reason != ReasonEncounterLocked {
+		t.Fatalf("expected the laboratory to be locked, got %d %+v", code, body)
+	}
+	err = player.StartEncounter("nowhere")
+	if code, body := testErrorBody(t, err); code != CodeNotFound || body.Reason != ReasonEncounterNotFound {
+		t.Fatalf("expected an unknown encounter, got %d %+v", code, body)
+	}
+
+	player.Level = 5
+	if err := player.StartEncounter("laboratory"); err != nil {
+		t.Fatalf("StartEncounter: %v", err)
+	}
+	for _, enemy := range player.BattleState.Enemies {
+		if enemy.Type != Mutant {
+			t.Fatalf("expected a mutant, got %s", enemy.Type)
+		}
+	}
+	err = player.StartEncounter("graveyard")
+	if code, body := testErrorBody(t, err); code != CodeFailedPrecondition || body.Reason != ReasonBattleInProgress {
+		t.Fatalf("expected the battle in progress to block a new one, got %d %+v", code, body)
+	}
+}
+
+func TestEventEncounterReplacesDefaultSpawns(t *testing.T) {
+	testEncounters(t)
+	now := time.Date(2025, time.October, 6, 12, 0, 0, 0, time.UTC)
+	clock := testFixedClock(t, now)
+	EncounterRegistry.Lock()
+	EncounterRegistry.Encounters["zombie_week"] = EncounterInfo{
+		ID: "zombie_week",
+		Spawn: SpawnRequest{Pool: []SpawnWeight{{Enemy: Zombie, Weight: 1}}},
+		Event: true,
+		StartAt: now.Add(-time.Hour).Unix(),
+		EndAt: now.Add(7 * 24 * time.Hour).Unix(),
+	}
+	EncounterRegistry.Unlock()
+
+	player := NewPlayer(UtilMakeUUID(), "tester")
+	for i := 0; i < 10; i++ {
+		player.BattleState.Enemies = nil
+		if err := player.LoadBattleState(); err != nil {
+			t.Fatalf("LoadBattleState: %v", err)
+		}
+		for _, enemy := range player.BattleState.Enemies {
+			if enemy.Type != Zombie {
+				t.Fatalf("expected zombie week to only spawn zombies, got %s", enemy.Type)
+			}
+		}
+	}
+
+	//Once the event is over it can't be started and is left out of the list.
+	clock.now = now.Add(8 * 24 * time.Hour)
+	player.BattleState.Enemies = nil
+	err := player.StartEncounter("zombie_week")
+	if code, body := testErrorBody(t, err); code != CodeFailedPrecondition || body.Reason != ReasonEncounterUnavailable {
+		t.Fatalf("expected zombie week to be over, got %d %+v", code, body)
+	}
+	if _, exists := ActiveEventEncounter(clock.now.Unix()); exists {
+		t.Fatalf("expected no active event")
+	}
+	for _, encounter := range player.ListEncounters() {
+		if encounter.ID == "zombie_week" {
+			t.Fatalf("expected zombie week to be left out of the list")
+		}
+	}
+}
+
+func TestStartEncounterReplacesUntouchedAutoSpawn(t *testing.T) {
+	testEncounters(t)
+	player := NewPlayer(UtilMakeUUID(), "tester")
+	if err := player.LoadBattleState(); err != nil {
+		t.Fatalf("LoadBattleState: %v", err)
+	}
+	if !player.BattleState.AutoSpawned || !player.BattleState.Untouched() {
+		t.Fatalf("expected an untouched auto spawned battle: %+v", player.BattleState)
+	}
+	if err := player.StartEncounter("graveyard"); err != nil {
+		t.Fatalf("start_battle should replace the loaded battle: %v", err)
+	}
+	for _, enemy := range player.BattleState.Enemies {
+		if enemy.Type != Zombie {
+			t.Fatalf("expected a zombie, got %s", enemy.Type)
+		}
+	}
+	for _, event := range player.TakeBattleEvents() {
+		if event.Event == EventBattleFled {
+			t.Fatal("replacing the loaded battle shouldn't count as fleeing")
+		}
+	}
+	if player.BattleState.AutoSpawned {
+		t.Fatal("the started battle isn't auto spawned")
+	}
+
+	//Once the loaded battle has been fought it has to be finished or fled.
+	player.BattleState.Enemies = nil
+	if err := player.LoadBattleState(); err != nil {
+		t.Fatalf("LoadBattleState: %v", err)
+	}
+	for _, enemy := range player.BattleState.Enemies {
+		enemy.Health--
+	}
+	err := player.StartEncounter("graveyard")
+	if code, body := testErrorBody(t, err); code != CodeFailedPrecondition || body.Reason != ReasonBattleInProgress {
+		t.Fatalf("expected the fought battle to block a new one, got %d %+v", code, body)
+	}
+}
+
+func TestEventEncounterChecksUnlock(t *testing.T) {
+	testEncounters(t)
+	now := time.Date(2025, time.October, 6, 12, 0, 0, 0, time.UTC)
+	testFixedClock(t, now)
+	EncounterRegistry.Lock()
+	EncounterRegistry.Encounters["mutant_week"] = EncounterInfo{
+		ID: "mutant_week",
+		Spawn: SpawnRequest{Enemy: Mutant},
+		Unlock: UnlockRequirement{Level: 5},
+		Event: true,
+	}
+	EncounterRegistry.Unlock()
+
+	player := NewPlayer(UtilMakeUUID(), "tester")
+	if spawn := player.DefaultSpawn(now.Unix()); spawn.Enemy != "" || len(spawn.Pool) != 0 {
+		t.Fatalf("expected the normal spawns below the event's level, got %+v", spawn)
+	}
+	player.Level = 5
+	if spawn := player.DefaultSpawn(now.Unix()); spawn.Enemy != Mutant {
+		t.Fatalf("expected the event spawns, got %+v", spawn)
+	}
+}
@@ -22,9 +22,17 @@ const ( //Building it this way avoids using string values on maps but allows the
 type Enemy struct {
 	Type EnemyType `json:"type"`
 	Health int `json:"health"`
+	MaxHealth int `json:"max_health"` //Health pool cap, health is mutated in place during battle so this is kept for the client health bar.
 	AttackModifier float64 `json:"attack_modifier"` //This is used to adjust attack type damage values.
 	StatusEffects []*StatusEffect `json:"status_effects"` //Used to store player state modifiers.
 	Rewards []RewardInfo `json:"rewards"` //Rewards assigned at time of enemy selection.
+	SpawnedAt int64 `json:"spawned_at,omitempty"` //Unix milliseconds the enemy entered the battle, used for kill times.
+}
+
+// Stored layout of the enemy configuration.
+type EnemyConfig struct {
+	SchemaVersion int `json:"schema_version"` //Stored data layout version, see migrations.go.
+	Enemies map[EnemyType]Enemy `json:"enemies"`
 }
 
 // Registry to hold all of the definitions.  Using a mutex here since the data could be live-ops driven meaning it could change after nakama init.
@@ -55,6 +63,7 @@ func InitEnemyRegistry(ctx context.Context, logger runtime.Logger, nk runtime.Na
 		EnemyRegistry.Enemies[Zombie] = Enemy{
 			Type: Zombie,
 			Health: 50,
+			MaxHealth: 50,
 			AttackModifier: 1.5,
 			StatusEffects: []*StatusEffect{},
 			Rewards: []RewardInfo{},
@@ -62,6 +71,7 @@ func InitEnemyRegistry(ctx context.Context, logger runtime.Logger, nk runtime.Na
 		EnemyRegistry.Enemies[Mutant] = Enemy{
 			Type: Mutant,
 			Health: 75,
+			MaxHealth: 75,
 			AttackModifier: 1.1,
 			StatusEffects: []*StatusEffect{},
 			Rewards: []RewardInfo{},
@@ -69,6 +79,7 @@ func InitEnemyRegistry(ctx context.Context, logger runtime.Logger, nk runtime.Na
 		EnemyRegistry.Enemies[Beast] = Enemy{
 			Type: Beast,
 			Health: 25,
+			MaxHealth: 25,
 			AttackModifier: 2,
 			StatusEffects: []*StatusEffect{},
 			Rewards: []RewardInfo{},
@@ -77,15 +88,26 @@ func InitEnemyRegistry(ctx context.Context, logger runtime.Logger, nk runtime.Na
 		return SaveEnemyRegistry(nk)
 	}
 
-	var enemies map[EnemyType]Enemy
-	if err := json.Unmarshal([]byte(rObj[0].Value), &enemies); err != nil {
+	//Bring older configurations up to the current layout.
+	value, migrated, err := MigrateEnemyConfig(rObj[0].Value)
+	if err != nil {
+		logger.Error("Failed to migrate enemy data: %v", err)
+		return err
+	}
+	var config EnemyConfig
+	if err := json.Unmarshal([]byte(value), &config); err != nil {
 		logger.Error("Failed to unmarshal enemy data: %v", err)
 		return err
 	}
 	EnemyRegistry.Lock()  //Call lock on the mutex in preparation for writing.
-	EnemyRegistry.Enemies = enemies
+	EnemyRegistry.Enemies = config.Enemies
 	EnemyRegistry.Unlock() //Don't forget to release the mutex lock.
 
+	//Write migrated data back so it only has to happen once.
+	if migrated {
+		logger.Info("Migrated enemy data to schema version %d.", EnemyConfigSchemaVersion)
+		return SaveEnemyRegistry(nk)
+	}
 	return nil
 }
 
@@ -93,7 +115,10 @@ func InitEnemyRegistry(ctx context.Context, logger runtime.Logger, nk runtime.Na
 func SaveEnemyRegistry(nk runtime.NakamaModule) error {
 	EnemyRegistry.RLock() //Read lock.
 	//Json-ify the enemy registry in prepartion for storage.
-	data, err := json.Marshal(EnemyRegistry.Enemies)
+	data, err := json.Marshal(EnemyConfig{
+		SchemaVersion: EnemyConfigSchemaVersion,
+		Enemies: EnemyRegistry.Enemies,
+	})
 	EnemyRegistry.RUnlock() //Don't forget to release the lock.
 	if err != nil {
 		return err
@@ -114,12 +139,39 @@ func SaveEnemyRegistry(nk runtime.NakamaModule) error {
 	return nil
 }
 
+// This function gets the max health for an enemy type from the registry, falling back when it can't be found.
+func GetEnemyMaxHealth(enemyType EnemyType, fallback int) int {
+	EnemyRegistry.RLock() //Read lock.
+	defer EnemyRegistry.RUnlock() //Don't forget to release the lock.
+	enemy, exists := EnemyRegistry.Enemies[enemyType]
+	if !exists {
+		return fallback
+	}
+	if enemy.MaxHealth > 0 {
+		return enemy.MaxHealth
+	}
+	return enemy.Health
+}
+
 // Interface function to get health.
 func (e *Enemy) GetHealth() int {
 	return e.Health
 }
 
-// Interface function to set health.
+// Interface function to set health.  Healing is clamped to the max health.
 func (e *Enemy) SetHealth(health int) {
+	if e.MaxHealth > 0 && health > e.MaxHealth {
+		health = e.MaxHealth
+	}
 	e.Health = health
+}
+
+// Interface function to get max health.
+func (e *Enemy) GetMaxHealth() int {
+	return e.MaxHealth
+}
+
+// Interface function to set max health.
+func (e *Enemy) SetMaxHealth(maxHealth int) {
+	e.MaxHealth = maxHealth
 }
\ No newline at end of file
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"bytes"
+	"reflect"
+	"strings"
+	"encoding/json"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const ConfigOverridePrefix = "config." //runtime.env keys starting with this override a registry, see ApplyConfigOverrides.
+
+// This function gives the environment name used in runtime.env.
+func (e BuildEnvironment) String() string {
+	switch e {
+	case Local:
+		return "local"
+	case Development:
+		return "development"
+	case QA:
+		return "qa"
+	case Production:
+		return "production"
+	}
+	return fmt.Sprintf("unknown(%d)", int32(e))
+}
+
+// This function parses the configured environment.  Anything it doesn't know is treated as Production so a typo can't
+// turn the debug tools on, the bool says if the value was known.
+func ParseBuildEnvironment(value string) (BuildEnvironment, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "local":
+		return Local, true
+	case "development":
+		return Development, true
+	case "qa":
+		return QA, true
+	case "production":
+		return Production, true
+	}
+	return Production, false
+}
+
+// This function checks if the debug and cheat rpcs are available in the environment.
+func (e BuildEnvironment) DebugToolsEnabled() bool {
+	return e == Local || e == Development || e == QA
+}
+
+// Registry data a config override is merged into.
+type configOverride struct {
+	lock sync.Locker //The registry's mutex.
+	target interface{} //Pointer to the registry data, laid out like the config storage object.
+}
+
+// This function lists the registries that can be overridden by their config storage key.
+func configOverrides() map[string]configOverride {
+	return map[string]configOverride{
+		enemyDataStorageKey: {&EnemyRegistry, &struct {
+			Enemies *map[EnemyType]Enemy `json:"enemies"`
+		}{&EnemyRegistry.Enemies}},
+		itemDataStorageKey: {&ItemRegistry, &ItemRegistry.Items},
+		storeDataStorageKey: {&StoreRegistry, &StoreRegistry.Offers},
+		rateLimitDataStorageKey: {&RateLimitRegistry, &RateLimitRegistry.Limits},
+		achievementDataStorageKey: {&AchievementRegistry, &AchievementRegistry.Achievements},
+		questDataStorageKey: {&QuestRegistry, &QuestRegistry.QuestConfig},
+		idleDataStorageKey: {&IdleRegistry, &IdleRegistry.IdleConfig},
+		bestiaryDataStorageKey: {&BestiaryRegistry, &BestiaryRegistry.BestiaryConfig},
+		encounterDataStorageKey: {&EncounterRegistry, &EncounterRegistry.Encounters},
+	}
+}
+
+// This function merges config overrides from runtime.env into the loaded registries.  "config.<key>" applies in every
+// environment and "config.<environment>.<key>" only in that one, after the general ones.  Values are json in the layout
+// of the config storage object, only the fields given change.  Overrides live in memory only, storage keeps the live-ops
+// values.  Run it after the registries are loaded.
+func ApplyConfigOverrides(logger runtime.Logger, env map[string]string, environment BuildEnvironment) {
+	overrides := configOverrides()
+	keys := make([]string, 0, len(overrides))
+	for key := range overrides {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys) //Keep the order stable between runs.
+	for _, prefix := range []string{ConfigOverridePrefix, ConfigOverridePrefix + environment.String() + "."} {
+		for _, key := range keys {
+			value, exists := env[prefix + key]
+			if !exists {
+				continue
+			}
+			//Check the json first so a bad value doesn't leave a registry half changed.
+			if !json.Valid([]byte(value)) {
+				logger.Error("Config override %s%s is not valid json.", prefix, key)
+				continue
+			}
+			override := overrides[key]
+			override.lock.Lock() //Call lock on the mutex in preparation for writing.
+			err := MergeJSON([]byte(value), reflect.ValueOf(override.target))
+			override.lock.Unlock() //Don't forget to release the mutex lock.
+			if err != nil {
+				logger.Error("Unable to apply config override %s%s: %v", prefix, key, err)
+				continue
+			}
+			logger.Info("Applied config override %s%s.", prefix, key)
+		}
+	}
+}
+
+// This function unmarshals the json onto the target keeping anything the json leaves out.  json.Unmarshal replaces map
+// entries with fresh values, so maps and structs are decoded a key at a time onto a copy of what is already there.
+func MergeJSON(data []byte, target reflect.Value) error {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		return json.Unmarshal(data, target.Addr().Interface())
+	}
+	switch target.Kind() {
+	case reflect.Pointer:
+		if target.IsNil() {
+			return json.Unmarshal(data, target.Addr().Interface())
+		}
+		return MergeJSON(data, target.Elem())
+	case reflect.Map:
+		if target.Type().Key().Kind() != reflect.String {
+			break
+		}
+		var entries map[string]json.RawMessage
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return err
+		}
+		if target.IsNil() {
+			target.Set(reflect.MakeMap(target.Type()))
+		}
+		for key, raw := range entries {
+			mapKey := reflect.New(target.Type().Key()).Elem()
+			mapKey.SetString(key)
+			entry := reflect.New(target.Type().Elem()).Elem()
+			if existing := target.MapIndex(mapKey); existing.IsValid() {
+				entry.Set(existing)
+			}
+			if err := MergeJSON(raw, entry); err != nil {
+				return err
+			}
+			target.SetMapIndex(mapKey, entry)
+		}
+		return nil
+	case reflect.Struct:
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return err
+		}
+		for name, raw := range fields {
+			field, exists := jsonField(target, name)
+			if !exists {
+				continue //Unknown fields are ignored like json.Unmarshal does.
+			}
+			if err := MergeJSON(raw, field); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return json.Unmarshal(data, target.Addr().Interface())
+}
+
+// This function finds the struct field for a json name, looking inside embedded structs the way encoding/json does.
+func jsonField(target reflect.Value, name string) (reflect.Value, bool) {
+	for i := 0; i < target.NumField(); i++ {
+		field := target.Type().Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || !field.IsExported() {
+			continue
+		}
+		tagName, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && tagName == "" && field.Type.Kind() == reflect.Struct {
+			if value, exists := jsonField(target.Field(i), name); exists {
+				return value, true
+			}
+			continue
+		}
+		if tagName == "" {
+			tagName = field.Name
+		}
+		if strings.EqualFold(tagName, name) {
+			return target.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
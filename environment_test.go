@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseBuildEnvironment(t *testing.T) {
+	tests := []struct {
+		value string
+		want BuildEnvironment
+		known bool
+	}{
+		{"local", Local, true},
+		{"Development", Development, true},
+		{" qa ", QA, true},
+		{"production", Production, true},
+		{"", Production, false},
+		{"staging", Production, false},
+	}
+	for _, test := range tests {
+		got, known := ParseBuildEnvironment(test.value)
+		if got != test.want || known != test.known {
+			t.Errorf("ParseBuildEnvironment(%q) = %s %t, want %s %t", test.value, got, known, test.want, test.known)
+		}
+	}
+	if Production.DebugToolsEnabled() || !QA.DebugToolsEnabled() || !Local.DebugToolsEnabled() {
+		t.Error("debug tools should be on for every environment but production")
+	}
+}
+
+func TestApplyConfigOverrides(t *testing.T) {
+	nk := newTestNakama()
+	if err := InitIdleRegistry(context.Background(), &testLogger{}, nk); err != nil {
+		t.Fatalf("InitIdleRegistry: %v", err)
+	}
+	if err := InitEnemyRegistry(context.Background(), &testLogger{}, nk); err != nil {
+		t.Fatalf("InitEnemyRegistry: %v", err)
+	}
+	defaultZombie, _ := GetEnemyType(Zombie)
+	t.Cleanup(func() {
+		//Put the defaults back for the other tests.
+		InitIdleRegistry(context.Background(), &testLogger{}, newTestNakama())
+		InitEnemyRegistry(context.Background(), &testLogger{}, newTestNakama())
+	})
+	env := map[string]string{
+		"config.idle": `{"regen_interval": 10, "regen_amount": 2}`,
+		"config.qa.idle": `{"regen_amount": 5}`,
+		"config.production.idle": `{"regen_amount": 50}`,
+		"config.enemies": `{"enemies": {"zombie": {"health": 5, "max_health": 5}}}`,
+		"config.store": `{not json`,
+	}
+	ApplyConfigOverrides(&testLogger{}, env, QA)
+	if IdleRegistry.RegenInterval != 10 || IdleRegistry.RegenAmount != 5 || IdleRegistry.MaxIdleSeconds != 8 * 60 * 60 {
+		t.Errorf("unexpected idle config: %+v", IdleRegistry.IdleConfig)
+	}
+	zombie, _ := GetEnemyType(Zombie)
+	beast, exists := GetEnemyType(Beast)
+	if zombie.Health != 5 || !exists || beast.Health != 25 {
+		t.Errorf("expected only the zombie changed: %+v %+v", zombie, beast)
+	}
+	//Fields the override leaves out keep their values.
+	if zombie.Type != Zombie || zombie.AttackModifier != defaultZombie.AttackModifier || defaultZombie.AttackModifier == 0 {
+		t.Errorf("expected the zombie's other fields kept: %+v default %+v", zombie, defaultZombie)
+	}
+}
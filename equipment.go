@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Equipment slots
+type EquipmentSlot string
+const ( //Building it this way avoids using string values on maps but allows the json to bear the string value.
+	WeaponSlot EquipmentSlot = "weapon"
+	ArmorSlot EquipmentSlot = "armor"
+	TrinketSlot EquipmentSlot = "trinket"
+)
+
+// Combat stat modifiers from equipment.  These are added on top of the attack and entity values.
+type EquipmentStats struct {
+	Damage int `json:"damage"` //Flat damage added to attacks.
+	HitChance float64 `json:"hit_chance"` //Added to the attack hit chance.  Ex: +5% -> 0.05.
+	Defense int `json:"defense"` //Flat damage removed from incoming hits.
+	StatusEffectChance float64 `json:"status_effect_chance"` //Added to the chance of applying status effects.
+}
+
+// This function checks if a slot is one the player has.
+func IsEquipmentSlot(slot EquipmentSlot) bool {
+	switch slot {
+	case WeaponSlot, ArmorSlot, TrinketSlot:
+		return true
+	}
+	return false
+}
+
+// This function totals up the stats of everything the player has equipped.
+func (p *Player) GetEquipmentStats() EquipmentStats {
+	var stats EquipmentStats
+	for _, itemType := range p.Equipment {
+		item, exists := GetItem(itemType)
+		if !exists {
+			continue
+		}
+		stats.Damage += item.Stats.Damage
+		stats.HitChance += item.Stats.HitChance
+		stats.Defense += item.Stats.Defense
+		stats.StatusEffectChance += item.Stats.StatusEffectChance
+	}
+	return stats
+}
+
+// This function checks if any equipped item grants the attack.
+func (p *Player) HasEquipmentAttack(attackType AttackType) bool {
+	for _, itemType := range p.Equipment {
+		item, exists := GetItem(itemType)
+		if !exists {
+			continue
+		}
+		for _, granted := range item.GrantsAttacks {
+			if granted == attackType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// This function moves an item from the inventory into its equipment slot, swapping out whatever was there.
+func (p *Player) EquipItem(itemType ItemType) error {
+	item, exists := GetItem(itemType)
+	if !exists {
+		return NewGameError(CodeNotFound, ReasonItemNotFound, fmt.Sprintf("Item not found: %s", itemType))
+	}
+	if !IsEquipmentSlot(item.Slot) {
+		return NewGameError(CodeInvalidArgument, ReasonItemNotUsable, fmt.Sprintf("Item is not equipment: %s", itemType))
+	}
+	if p.Inventory[itemType] <= 0 {
+		return NewGameError(CodeFailedPrecondition, ReasonItemNotOwned, fmt.Sprintf("Item not in inventory: %s", itemType))
+	}
+	if p.Equipment == nil {
+		p.Equipment = make(map[EquipmentSlot]ItemType)
+	}
+	//Take the item out of the inventory first so there is room for the swapped out item.
+	p.RemoveItem(itemType, 1)
+	if current, equipped := p.Equipment[item.Slot]; equipped {
+		if p.AddItem(current, 1) != 1 {
+			p.AddItem(itemType, 1) //Put it back.
+			return NewGameError(CodeFailedPrecondition, ReasonInventoryFull, fmt.Sprintf("No inventory room for: %s", current))
+		}
+	}
+	p.Equipment[item.Slot] = itemType
+	return nil
+}
+
+// This function moves an item from its equipment slot back into the inventory.
+func (p *Player) UnequipItem(slot EquipmentSlot) error {
+	if !IsEquipmentSlot(slot) {
+		return NewFieldError("slot", fmt.Sprintf("Equipment slot not found: %s", slot))
+	}
+	itemType, equipped := p.Equipment[slot]
+	if !equipped {
+		return NewGameError(CodeFailedPrecondition, ReasonSlotEmpty, fmt.Sprintf("Nothing equipped in slot: %s", slot))
+	}
+	if p.AddItem(itemType, 1) != 1 {
+		return NewGameError(CodeFailedPrecondition, ReasonInventoryFull, fmt.Sprintf("No inventory room for: %s", itemType))
+	}
+	delete(p.Equipment, slot)
+	return nil
+}
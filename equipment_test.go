@@ -0,0 +1,113 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEquipItemSwapsSlot(t *testing.T) {
+	testItems(t)
+	club := ItemType("test_club")
+	ItemRegistry.Lock()
+	ItemRegistry.Items[club] = ItemInfo{Type: club, MaxStack: 1, Target: TargetSelf, Slot: WeaponSlot, Stats: EquipmentStats{Damage: 5}}
+	ItemRegistry.Unlock()
+	t.Cleanup(func() {
+		ItemRegistry.Lock()
+		delete(ItemRegistry.Items, club)
+		ItemRegistry.Unlock()
+	})
+	player := NewPlayer(UtilMakeUUID(), "tester")
+
+	err := player.EquipItem(RustySword)
+	if code, body := testErrorBody(t, err); code != CodeFailedPrecondition || body.Reason != ReasonItemNotOwned {
+		t.Fatalf("not owned: code %d body %+v", code, body)
+	}
+	player.AddItem(HealthPotion, 1)
+	err = player.EquipItem(HealthPotion)
+	if code, body := testErrorBody(t, err); code != CodeInvalidArgument || body.Reason != ReasonItemNotUsable {
+		t.Fatalf("not equipment: code %d body %+v", code, body)
+	}
+
+	player.AddItem(RustySword, 1)
+	if err := player.EquipItem(RustySword); err != nil {
+		t.Fatalf("equip: %v", err)
+	}
+	if player.Equipment[WeaponSlot] != RustySword || player.Inventory[RustySword] != 0 {
+		t.Fatalf("expected the sword moved into the weapon slot: %+v %+v", player.Equipment, player.Inventory)
+	}
+
+	//Equipping into a used slot swaps the old item back into the inventory.
+	player.AddItem(club, 1)
+	if err := player.EquipItem(club); err != nil {
+		t.Fatalf("swap: %v", err)
+	}
+	if player.Equipment[WeaponSlot] != club || player.Inventory[RustySword] != 1 || player.Inventory[club] != 0 {
+		t.Fatalf("expected the club swapped in for the sword: %+v %+v", player.Equipment, player.Inventory)
+	}
+
+	//No room for the swapped out item leaves everything as it was.
+	player.AddItem(club, 1)
+	player.Equipment[WeaponSlot] = RustySword
+	err = player.EquipItem(club)
+	if code, body := testErrorBody(t, err); code != CodeFailedPrecondition || body.Reason != ReasonInventoryFull {
+		t.Fatalf("full inventory: code %d body %+v", code, body)
+	}
+	if player.Equipment[WeaponSlot] != RustySword || player.Inventory[club] != 1 || player.Inventory[RustySword] != 1 {
+		t.Fatalf("failed swap changed the player: %+v %+v", player.Equipment, player.Inventory)
+	}
+
+	//Unequipping needs room too.
+	err = player.UnequipItem(WeaponSlot)
+	if code, body := testErrorBody(t, err); code != CodeFailedPrecondition || body.Reason != ReasonInventoryFull {
+		t.Fatalf("unequip into a full stack: code %d body %+v", code, body)
+	}
+	err = player.UnequipItem(ArmorSlot)
+	if code, body := testErrorBody(t, err); code != CodeFailedPrecondition || body.Reason != ReasonSlotEmpty {
+		t.Fatalf("empty slot: code %d body %+v", code, body)
+	}
+}
+
+func TestEquipmentStats(t *testing.T) {
+	testItems(t)
+	player := NewPlayer(UtilMakeUUID(), "tester")
+	if stats := player.GetEquipmentStats(); stats != (EquipmentStats{}) {
+		t.Fatalf("nothing equipped should add nothing: %+v", stats)
+	}
+	if player.HasEquipmentAttack(Slash) {
+		t.Fatal("slash needs the sword equipped")
+	}
+
+	for _, itemType := range []ItemType{RustySword, LeatherArmor, LuckyCharm} {
+		player.AddItem(itemType, 1)
+		if err := player.EquipItem(itemType); err != nil {
+			t.Fatalf("equip %s: %v", itemType, err)
+		}
+	}
+	stats := player.GetEquipmentStats()
+	if stats.Damage != 2 || stats.Defense != 2 || math.Abs(stats.HitChance) > 1e-9 || math.Abs(stats.StatusEffectChance - 0.1) > 1e-9 {
+		t.Fatalf("expected the gear stats totalled, got %+v", stats)
+	}
+	if !player.HasEquipmentAttack(Slash) {
+		t.Fatal("the equipped sword should grant slash")
+	}
+
+	//Gear adds its damage to attacks.
+	attackType := testSureHitAttack(t, 10)
+	player.Loadout = []AttackType{attackType}
+	targetID := UtilMakeUUID()
+	player.BattleState.Enemies = map[string]*Enemy{targetID: {Type: Zombie, Health: 100, MaxHealth: 100}}
+	result, err := player.PlayerAttack(&testLogger{}, targetID, attackType)
+	if err != nil {
+		t.Fatalf("attack: %v", err)
+	}
+	if result.Damage != 12 {
+		t.Fatalf("expected the weapon damage added, got %d", result.Damage)
+	}
+
+	if err := player.UnequipItem(WeaponSlot); err != nil {
+		t.Fatalf("unequip: %v", err)
+	}
+	if stats := player.GetEquipmentStats(); stats.Damage != 0 || stats.Defense != 2 {
+		t.Fatalf("expected the weapon stats gone, got %+v", stats)
+	}
+}
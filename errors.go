@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+	"encoding/json"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// gRPC status codes returned to clients, Nakama maps them to HTTP statuses for the REST api.
+// See https://grpc.github.io/grpc/core/md_doc_statuscodes.html for the full descriptions.
+const (
+	CodeOK = 0
+	CodeCanceled = 1
+	CodeUnknown = 2
+	CodeInvalidArgument = 3 //The payload couldn't be read or a field failed validation.  Don't retry without changing it.
+	CodeDeadlineExceeded = 4
+	CodeNotFound = 5 //The target, attack, item, slot, offer, raid or duel doesn't exist.
+	CodeAlreadyExists = 6 //A request id was reused for a different request.
+	CodePermissionDenied = 7 //The caller isn't allowed to do this, ex: client writes to server only collections.
+	CodeResourceExhausted = 8 //The caller is being rate limited.
+	CodeFailedPrecondition = 9 //Game state doesn't allow it right now, ex: dead player or enemy, locked attack, not enough gold.
+	CodeAborted = 10 //Someone else changed the data at the same time.  Safe to retry.
+	CodeOutOfRange = 11
+	CodeUnimplemented = 12
+	CodeInternal = 13 //Storage or server failure.
+	CodeUnavailable = 14
+	CodeDataLoss = 15
+	CodeUnauthenticated = 16 //No user on the session.
+)
+
+// Machine readable reason sent with every error so the client can switch on it instead of parsing the message.
+type ErrorReason string
+const (
+	ReasonInvalidPayload ErrorReason = "invalid_payload" //InvalidArgument, the payload isn't valid json.
+	ReasonInvalidField ErrorReason = "invalid_field" //InvalidArgument, see the field name for which one.
+	ReasonUnauthenticated ErrorReason = "unauthenticated" //Unauthenticated.
+	ReasonPermissionDenied ErrorReason = "permission_denied" //PermissionDenied.
+	ReasonAccountNotFound ErrorReason = "account_not_found" //NotFound.
+	ReasonEnemyNotFound ErrorReason = "enemy_not_found" //NotFound.
+	ReasonAttackNotFound ErrorReason = "attack_not_found" //NotFound.
+	ReasonItemNotFound ErrorReason = "item_not_found" //NotFound.
+	ReasonOfferNotFound ErrorReason = "offer_not_found" //NotFound.
+	ReasonEncounterNotFound ErrorReason = "encounter_not_found" //NotFound.
+	ReasonNoBattle ErrorReason = "no_battle" //FailedPrecondition, there is no battle in progress.
+	ReasonBattleInProgress ErrorReason = "battle_in_progress" //FailedPrecondition, finish or flee the battle first.
+	ReasonEncounterLocked ErrorReason = "encounter_locked" //FailedPrecondition, unlock requirements aren't met.
+	ReasonEncounterUnavailable ErrorReason = "encounter_unavailable" //FailedPrecondition, outside the encounter time window.
+	ReasonPlayerDead ErrorReason = "player_dead" //FailedPrecondition.
+	ReasonEnemyDead ErrorReason = "enemy_dead" //FailedPrecondition.
+	ReasonAttackNotInLoadout ErrorReason = "attack_not_in_loadout" //FailedPrecondition.
+	ReasonAttackLocked ErrorReason = "attack_locked" //FailedPrecondition, unlock requirements aren't met.
+	ReasonAttackNotPlayable ErrorReason = "attack_not_playable" //PermissionDenied, enemy only attack.
+	ReasonItemNotOwned ErrorReason = "item_not_owned" //FailedPrecondition.
+	ReasonItemNotUsable ErrorReason = "item_not_usable" //FailedPrecondition, or InvalidArgument for a bad target.
+	ReasonInventoryFull ErrorReason = "inventory_full" //FailedPrecondition.
+	ReasonSlotEmpty ErrorReason = "slot_empty" //FailedPrecondition.
+	ReasonOfferUnavailable ErrorReason = "offer_unavailable" //FailedPrecondition, outside the offer time window.
+	ReasonPurchaseLimit ErrorReason = "purchase_limit" //FailedPrecondition.
+	ReasonInsufficientFunds ErrorReason = "insufficient_funds" //FailedPrecondition.
+	ReasonRequestIDReused ErrorReason = "request_id_reused" //AlreadyExists.
+	ReasonRaidNotFound ErrorReason = "raid_not_found" //NotFound, the raid doesn't exist or the player isn't in it.
+	ReasonRaidFull ErrorReason = "raid_full" //FailedPrecondition.
+	ReasonRaidOver ErrorReason = "raid_over" //FailedPrecondition, every enemy was defeated or the raid expired.
+	ReasonBattleMatchRunning ErrorReason = "battle_match_running" //FailedPrecondition, the battle is being fought in the player's battle match.
+	ReasonNotPartyMember ErrorReason = "not_party_member" //PermissionDenied, the player isn't in the party.
+	ReasonDuelNotFound ErrorReason = "duel_not_found" //NotFound, the duel doesn't exist or the player isn't in it.
+	ReasonDuelNotActive ErrorReason = "duel_not_active" //FailedPrecondition, see the message for the duel status.
+	ReasonNotYourTurn ErrorReason = "not_your_turn" //FailedPrecondition.
+	ReasonQuestNotFound ErrorReason = "quest_not_found" //NotFound, the quest isn't assigned to the player or expired.
+	ReasonQuestIncomplete ErrorReason = "quest_incomplete" //FailedPrecondition.
+	ReasonQuestClaimed ErrorReason = "quest_claimed" //FailedPrecondition.
+	ReasonQuestPoolEmpty ErrorReason = "quest_pool_empty" //FailedPrecondition, no other quest to reroll into.
+	ReasonNoIdleRewards ErrorReason = "no_idle_rewards" //FailedPrecondition, not enough offline time banked yet.
+	ReasonRateLimited ErrorReason = "rate_limited" //ResourceExhausted, see retry_after for how long to wait.
+	ReasonConflict ErrorReason = "conflict" //Aborted.
+	ReasonInternal ErrorReason = "internal" //Internal.
+)
+
+// Error body sent to the client as the error message.
+type GameError struct {
+	Reason ErrorReason `json:"reason"`
+	Field string `json:"field,omitempty"` //Request field that failed validation.
+	Message string `json:"message"` //Human readable, don't switch on this.
+	RetryAfter float64 `json:"retry_after,omitempty"` //Seconds to wait before calling again.
+}
+
+// This function builds an error for the client with a gRPC code and a json body carrying the reason.
+func NewGameError(code int, reason ErrorReason, message string) *runtime.Error {
+	return newGameError(code, GameError{Reason: reason, Message: message})
+}
+
+// This function builds an InvalidArgument error for a request field.
+func NewFieldError(field, message string) *runtime.Error {
+	return newGameError(CodeInvalidArgument, GameError{Reason: ReasonInvalidField, Field: field, Message: message})
+}
+
+// This function builds a ResourceExhausted error telling the client how long to wait.
+func NewRateLimitError(rpcName string, wait time.Duration) *runtime.Error {
+	retryAfter := math.Ceil(wait.Seconds() * 1000) / 1000 //Round up to the millisecond so retrying at the hint succeeds.
+	return newGameError(CodeResourceExhausted, GameError{
+		Reason: ReasonRateLimited,
+		Message: fmt.Sprintf("Too many %s calls, retry after %.3fs.", rpcName, retryAfter),
+		RetryAfter: retryAfter,
+	})
+}
+
+func newGameError(code int, body GameError) *runtime.Error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return runtime.NewError(body.Message, code)
+	}
+	return runtime.NewError(string(data), code)
+}
+
+// This function reads the code and body back out of an error so it can be reported inside a successful response.
+func ErrorBody(err error) (int, GameError) {
+	rErr, ok := AsGameError(err).(*runtime.Error)
+	if !ok {
+		return CodeInternal, GameError{Reason: ReasonInternal, Message: "Internal server error."}
+	}
+	var body GameError
+	if jErr := json.Unmarshal([]byte(rErr.Message), &body); jErr != nil {
+		body = GameError{Reason: ReasonInternal, Message: rErr.Message}
+	}
+	return rErr.Code, body
+}
+
+// This function passes game errors through and turns anything else (storage, marshalling) into an Internal error so raw
+// Go errors never reach the client.
+func AsGameError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*runtime.Error); ok {
+		return err
+	}
+	return NewGameError(CodeInternal, ReasonInternal, "Internal server error.")
+}
@@ -7,4 +7,4 @@ require (
 	github.com/heroiclabs/nakama-common v1.36.0
 )
 
-require google.golang.org/protobuf v1.36.4 // indirect
+require google.golang.org/protobuf v1.36.4
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+var RequestLogStorageKey = "requests" //Recent request ids and their responses in the player data collection.
+
+const RequestLogTTL = 60 * 60 //Seconds a response is kept for replays.
+const RequestLogLimit = 20 //Most responses kept per player, the oldest are dropped first.
+
+// Response stored for a handled request.
+type RequestRecord struct {
+	RPC string `json:"rpc"`
+	PayloadHash string `json:"payload_hash"` //So a reused request id with a different payload isn't mistaken for a retry.
+	Response string `json:"response"`
+	CreatedAt int64 `json:"created_at"`
+}
+
+// Recent requests handled for a player, keyed by the client supplied request id.
+type RequestLog struct {
+	Records map[string]*RequestRecord `json:"records"`
+	userID string
+	rpcName string //Rpc and request being handled, set by BeginRequest.
+	requestID string
+	payloadHash string
+	version string //Storage version hash from the last read.
+}
+
+// This function gets the player's request log from nakama storage.
+func LoadRequestLog(ctx context.Context, nk runtime.NakamaModule, userID string) (*RequestLog, error) {
+	//Read from the storage engine.
+	rObj, err := nk.StorageRead(ctx, []*runtime.StorageRead{
+		{
+			Collection: playerDataStorageCollection,
+			Key: RequestLogStorageKey,
+			UserID: userID,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	requestLog := &RequestLog{
+		Records: make(map[string]*RequestRecord),
+		userID: userID,
+	}
+	if len(rObj) == 0 {
+		requestLog.version = "*" //Only write if no one else created it first.
+		return requestLog, nil
+	}
+	//Unmarshal json data to request log object.
+	if err = json.Unmarshal([]byte(rObj[0].Value), requestLog); err != nil {
+		return nil, err
+	}
+	if requestLog.Records == nil {
+		requestLog.Records = make(map[string]*RequestRecord)
+	}
+	requestLog.version = rObj[0].Version
+	return requestLog, nil
+}
+
+// This function starts handling a mutating rpc.  Without a request id there is nothing to remember and both returns are
+// empty.  If the request id was already handled the stored response is returned to send back instead of running again.
+func BeginRequest(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID, rpcName, requestID, payload string) (*RequestLog, string, error) {
+	if requestID == "" {
+		return nil, "", nil
+	}
+	requestLog, err := LoadRequestLog(ctx, nk, userID)
+	if err != nil {
+		logger.Error("Unable to load request log: %v", err)
+		return nil, "", AsGameError(err)
+	}
+	hash := sha256.Sum256([]byte(payload))
+	requestLog.rpcName = rpcName
+	requestLog.requestID = requestID
+	requestLog.payloadHash = hex.EncodeToString(hash[:])
+
+	record, exists := requestLog.Records[requestID]
+	if !exists || record.CreatedAt + RequestLogTTL <= UserNow(userID).Unix() {
+		return requestLog, "", nil
+	}
+	if record.RPC != rpcName || record.PayloadHash != requestLog.payloadHash {
+		return nil, "", NewGameError(CodeAlreadyExists, ReasonRequestIDReused, fmt.Sprintf("Request id was already used for a different request: %s", requestID))
+	}
+	logger.Debug("Replaying %s response for request id %s.", rpcName, requestID)
+	return nil, record.Response, nil
+}
+
+// This function reads the request log again after a failed write, keeping the request being handled.  If the request was
+// recorded by another call in the meantime it must not run again, so a conflict is returned and the retry replays it.
+func (l *RequestLog) Reload(ctx context.Context, nk runtime.NakamaModule) error {
+	fresh, err := LoadRequestLog(ctx, nk, l.userID)
+	if err != nil {
+		return err
+	}
+	if record, exists := fresh.Records[l.requestID]; exists && record.CreatedAt + RequestLogTTL > UserNow(l.userID).Unix() {
+		return NewGameError(CodeAborted, ReasonConflict, "Request was handled by another call, try again.")
+	}
+	l.Records = fresh.Records
+	l.version = fresh.version
+	return nil
+}
+
+// This function stores the response for the request being handled, dropping expired and excess records.
+func (l *RequestLog) Record(response string, now int64) {
+	for requestID, record := range l.Records {
+		if record.CreatedAt + RequestLogTTL <= now {
+			delete(l.Records, requestID)
+		}
+	}
+	l.Records[l.requestID] = &RequestRecord{
+		RPC: l.rpcName,
+		PayloadHash: l.payloadHash,
+		Response: response,
+		CreatedAt: now,
+	}
+	if len(l.Records) <= RequestLogLimit {
+		return
+	}
+	//Drop the oldest until under the limit.
+	requestIDs := make([]string, 0, len(l.Records))
+	for requestID := range l.Records {
+		requestIDs = append(requestIDs, requestID)
+	}
+	sort.Slice(requestIDs, func(i, j int) bool {
+		return l.Records[requestIDs[i]].CreatedAt < l.Records[requestIDs[j]].CreatedAt
+	})
+	for _, requestID := range requestIDs[:len(requestIDs) - RequestLogLimit] {
+		delete(l.Records, requestID)
+	}
+}
+
+// This function builds the storage write for the request log so it can be batched with the player data.
+func (l *RequestLog) RequestLogStorageWrite() (*runtime.StorageWrite, error) {
+	//Json-ify the request log struct in prepartion for storage.
+	data, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return &runtime.StorageWrite{
+		Collection: playerDataStorageCollection,
+		Key: RequestLogStorageKey,
+		UserID: l.userID,
+		Value: string(data),
+		Version: l.version,
+		PermissionRead: 0, // Only the runtime can read.
+		PermissionWrite: 0, // No one can write save the runtime.
+	}, nil
+}
+
+// This function records the response for rpcs that save other objects instead of a player, and returns the request log
+// write to batch with them.  The encoded response is returned either way, without a request log there is no write.
+func (l *RequestLog) RecordWrite(logger runtime.Logger, response interface{}) (string, *runtime.StorageWrite, error) {
+	data, err := EncodeResponse(logger, response)
+	if err != nil {
+		return "", nil, err
+	}
+	if l == nil {
+		return data, nil, nil
+	}
+	l.Record(data, UserNow(l.userID).Unix())
+	wObj, err := l.RequestLogStorageWrite()
+	if err != nil {
+		logger.Error("Unable to save request log: %v", err)
+		return "", nil, AsGameError(err)
+	}
+	return data, wObj, nil
+}
+
+// This function keeps the storage version current after a write.
+func (l *RequestLog) SetStorageVersion(acks []*api.StorageObjectAck) {
+	for _, ack := range acks {
+		if ack.Collection == playerDataStorageCollection && ack.Key == RequestLogStorageKey && ack.UserId == l.userID {
+			l.version = ack.Version
+		}
+	}
+}
+
+// This function finishes a mutating rpc.  The player is saved together with the response when there is a request id so a
+// retry either replays the response or runs on the unchanged player, never both.  Other objects the rpc changed can be
+// passed in to be saved in the same write.
+func CommitRequest(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, requestLog *RequestLog, player *Player, response interface{}, writes ...*runtime.StorageWrite) (string, error) {
+	playerWrite, err := player.PlayerStorageWrite()
+	if err != nil {
+		logger.Error("Unable to save player data: %v", err)
+		return "", AsGameError(err)
+	}
+	//Json-ify the response before saving so the stored copy is exactly what the client gets.
+	data, err := EncodeResponse(logger, response)
+	if err != nil {
+		return "", err
+	}
+	wObjs := append([]*runtime.StorageWrite{playerWrite}, writes...)
+	if requestLog != nil {
+		requestLog.Record(data, player.Now().Unix())
+		logWrite, err := requestLog.RequestLogStorageWrite()
+		if err != nil {
+			logger.Error("Unable to save request log: %v", err)
+			return "", AsGameError(err)
+		}
+		wObjs = append(wObjs, logWrite)
+	}
+	//Write to the storage engine, versions make this fail if either object changed since it was read.
+	acks, err := nk.StorageWrite(ctx, wObjs)
+	if err != nil {
+		logger.Error("Unable to save player data: %v", err)
+		return "", NewGameError(CodeAborted, ReasonConflict, "Player data was not saved, try again.")
+	}
+	player.SetStorageVersion(acks)
+	if requestLog != nil {
+		requestLog.SetStorageVersion(acks)
+	}
+	ProcessBattleEvents(ctx, logger, nk, player)
+	return data, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestRequestReplay(t *testing.T) {
+	nk := newTestNakama()
+	ctx := context.Background()
+	userID := "0a4c1c8e-6f53-4a2e-9a55-2b8f3d0f7c11"
+	player := NewPlayer(userID, "tester")
+	player.version = "*"
+	payload := `{"item":"health_potion","request_id":"abc"}`
+
+	requestLog, replay, err := BeginRequest(ctx, &testLogger{}, nk, userID, "use_item", "abc", payload)
+	if err != nil || replay != "" || requestLog == nil {
+		t.Fatalf("first call: log %v replay %q err %v", requestLog, replay, err)
+	}
+	player.Health = 42
+	response, err := CommitRequest(ctx, &testLogger{}, nk, requestLog, player, map[string]int{"health": player.Health})
+	if err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	//A retry gets the first response back without running again.
+	requestLog, replay, err = BeginRequest(ctx, &testLogger{}, nk, userID, "use_item", "abc", payload)
+	if err != nil || requestLog != nil || replay != response {
+		t.Fatalf("retry: log %v replay %q err %v, want %q", requestLog, replay, err, response)
+	}
+
+	//The same id with a different request is rejected.
+	_, _, err = BeginRequest(ctx, &testLogger{}, nk, userID, "use_item", "abc", `{"item":"antidote","request_id":"abc"}`)
+	if code, body := testErrorBody(t, err); code != CodeAlreadyExists || body.Reason != ReasonRequestIDReused {
+		t.Fatalf("reused id: code %d body %+v", code, body)
+	}
+
+	//No request id, nothing to replay or record.
+	requestLog, replay, err = BeginRequest(ctx, &testLogger{}, nk, userID, "use_item", "", payload)
+	if err != nil || requestLog != nil || replay != "" {
+		t.Fatalf("no request id: log %v replay %q err %v", requestLog, replay, err)
+	}
+}
+
+func TestRequestLogRecordPrunes(t *testing.T) {
+	requestLog := &RequestLog{Records: make(map[string]*RequestRecord)}
+	requestLog.Records["expired"] = &RequestRecord{CreatedAt: 0}
+	now := int64(RequestLogTTL * 10)
+	for i := 0; i < RequestLogLimit + 5; i++ {
+		requestLog.requestID = fmt.Sprintf("id-%d", i)
+		requestLog.Record("{}", now + int64(i))
+	}
+	if len(requestLog.Records) != RequestLogLimit {
+		t.Fatalf("kept %d records, want %d", len(requestLog.Records), RequestLogLimit)
+	}
+	if _, exists := requestLog.Records["expired"]; exists {
+		t.Fatal("expired record was kept")
+	}
+	if _, exists := requestLog.Records["id-0"]; exists {
+		t.Fatal("oldest record was kept")
+	}
+	if _, exists := requestLog.Records[fmt.Sprintf("id-%d", RequestLogLimit + 4)]; !exists {
+		t.Fatal("newest record was dropped")
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"context"
+	"encoding/json"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+var idleDataStorageKey = "idle"
+
+const IdleSaveRetries = 3 //Attempts at marking the player online or offline when a request saved them at the same time.
+const StreamModeNotifications uint8 = 0 //Nakama's presence stream mode for a user's sessions, nakama-common doesn't export it.
+
+// Stored layout of the offline progression configuration.
+type IdleConfig struct {
+	RegenInterval int64 `json:"regen_interval"` //Seconds per regen tick, 0 turns regen off.
+	RegenAmount int `json:"regen_amount"` //Health healed per tick.
+	MinOfflineSeconds int64 `json:"min_offline_seconds"` //Shorter times away don't count as offline.
+	MaxIdleSeconds int64 `json:"max_idle_seconds"` //Most offline time that can be banked for rewards.
+	RewardsPerHour []RewardInfo `json:"rewards_per_hour"` //Paid out for banked offline time.
+}
+
+// Registry to hold all of the definitions.  Using a mutex here since the data could be live-ops driven meaning it could change after nakama init.
+// **NOTE: If the plan is to not update this information after nakama init then this paradigm can be change to a simple read-only map instead.
+var IdleRegistry = struct {
+	sync.RWMutex //Read/write mutex to help with concurrent access allowing mulitple readers or a single writer.
+	IdleConfig
+}{}
+
+// This function will initialize the Idle Registry.
+func InitIdleRegistry(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) error {
+	//Read from the storage engine.
+	rObj, err := nk.StorageRead(ctx, []*runtime.StorageRead{
+		{
+			Collection: configDataStorageCollection,
+			Key: idleDataStorageKey,
+		},
+	})
+	if err != nil {
+		logger.Error("Error getting idle configuration data: %v", err)
+		return err
+	}
+	//Load defaults if nothing was found in storage and save them into storage.
+	if len(rObj) == 0 {
+		IdleRegistry.Lock()  //Call lock on the mutex in preparation for writing.
+		IdleRegistry.IdleConfig = IdleConfig{
+			RegenInterval: 60,
+			RegenAmount: 1,
+			MinOfflineSeconds: 300,
+			MaxIdleSeconds: 8 * 60 * 60,
+			RewardsPerHour: []RewardInfo{
+				{Type: Gold, Amount: 20},
+				{Type: Experience, Amount: 10},
+			},
+		}
+		IdleRegistry.Unlock() //Don't forget to release the mutex lock.
+		return SaveIdleRegistry(nk)
+	}
+
+	var config IdleConfig
+	if err := json.Unmarshal([]byte(rObj[0].Value), &config); err != nil {
+		logger.Error("Failed to unmarshal idle data: %v", err)
+		return err
+	}
+	IdleRegistry.Lock()  //Call lock on the mutex in preparation for writing.
+	IdleRegistry.IdleConfig = config
+	IdleRegistry.Unlock() //Don't forget to release the mutex lock.
+
+	return nil
+}
+
+// This function will save the Idle Registry to storage.
+func SaveIdleRegistry(nk runtime.NakamaModule) error {
+	IdleRegistry.RLock() //Read lock.
+	//Json-ify the idle registry in prepartion for storage.
+	data, err := json.Marshal(IdleRegistry.IdleConfig)
+	IdleRegistry.RUnlock() //Don't forget to release the lock.
+	if err != nil {
+		return err
+	}
+	wObj := []*runtime.StorageWrite{
+		{
+			Collection: configDataStorageCollection,
+			Key: idleDataStorageKey,
+			Value: string(data),
+			PermissionRead: 1, // Owner and runtime can read.
+			PermissionWrite: 0, // No one can write save the runtime.
+		},
+	}
+	//Write to the storage engine.
+	if _, err := nk.StorageWrite(context.Background(), wObj); err != nil {
+		return fmt.Errorf("failed to write idle data to storage: %v", err)
+	}
+	return nil
+}
+
+// This function catches the player up on the time since they were last saved: health regenerates and offline time is
+// banked for idle rewards.  Runs on every load, nothing is stored until the player is saved so loads that don't save
+// work out the same result again.
+func (p *Player) ApplyOfflineProgress(now int64) {
+	IdleRegistry.RLock() //Read lock.
+	config := IdleRegistry.IdleConfig
+	IdleRegistry.RUnlock() //Release read lock.
+
+	//Only time since the last session ended is offline, saves by matches or raid members don't mean the player was away.
+	//The mark moves up once it's banked, or the next save moves the last save up, so the time is only counted once.
+	since := p.OfflineSince
+	if !p.SessionTracked {
+		since = p.UpdatedAt //Http only clients never send session events, the time since their last save counts instead.
+	}
+	if offline := now - since; since > 0 && offline >= config.MinOfflineSeconds && offline > 0 {
+		p.IdleSeconds += offline
+		if p.IdleSeconds > config.MaxIdleSeconds {
+			p.IdleSeconds = config.MaxIdleSeconds
+		}
+		if p.SessionTracked {
+			p.OfflineSince = now
+		}
+	}
+	p.RegenerateHealth(now, config)
+}
+
+// This function marks the player online, banking the offline time first, or offline from now on.
+func SetPlayerOnline(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID string, online bool) error {
+	for attempt := 0; attempt < IdleSaveRetries; attempt++ {
+		player, err := LoadPlayerData(ctx, logger, nk, userID)
+		if err != nil {
+			return err
+		}
+		player.SessionTracked = true
+		if online {
+			player.OfflineSince = 0
+		} else {
+			player.OfflineSince = player.Now().Unix()
+		}
+		if err := player.SavePlayerData(nk); err != nil {
+			logger.Debug("Online status save conflict, attempt %d: %v", attempt + 1, err)
+			continue
+		}
+		return nil
+	}
+	return NewGameError(CodeAborted, ReasonConflict, "Online status was not saved, try again.")
+}
+
+// Session start event that stops offline time for the player.
+func SessionStartEvent(nk runtime.NakamaModule) func(ctx context.Context, logger runtime.Logger, evt *api.Event) {
+	return func(ctx context.Context, logger runtime.Logger, evt *api.Event) {
+		userID, err := UtilGetUserId(ctx)
+		if err != nil {
+			return
+		}
+		if err := SetPlayerOnline(ctx, logger, nk, userID, true); err != nil {
+			logger.Error("Unable to mark player %s online: %v", userID, err)
+		}
+	}
+}
+
+// Session end event that starts offline time for the player, unless they are still connected on another session.
+func SessionEndEvent(nk runtime.NakamaModule) func(ctx context.Context, logger runtime.Logger, evt *api.Event) {
+	return func(ctx context.Context, logger runtime.Logger, evt *api.Event) {
+		userID, err := UtilGetUserId(ctx)
+		if err != nil {
+			return
+		}
+		sessions, err := nk.StreamUserList(StreamModeNotifications, userID, "", "", true, true)
+		if err != nil {
+			logger.Error("Unable to list sessions for %s: %v", userID, err)
+		} else if len(sessions) > 0 {
+			return
+		}
+		if err := SetPlayerOnline(ctx, logger, nk, userID, false); err != nil {
+			logger.Error("Unable to mark player %s offline: %v", userID, err)
+		}
+	}
+}
+
+// This function heals the player for every regen tick since the last one.  No regen happens in battle, while dead or at
+// full health, the clock restarts instead so that time doesn't count later.
+func (p *Player) RegenerateHealth(now int64, config IdleConfig) {
+	if p.RegenAt == 0 {
+		p.RegenAt = p.UpdatedAt //Saves from before regen start from their last save.
+	}
+	if config.RegenInterval <= 0 || config.RegenAmount <= 0 || len(p.BattleState.Enemies) > 0 || p.IsPlayerDead() || p.Health >= p.MaxHealth || p.RegenAt > now {
+		p.RegenAt = now
+		return
+	}
+	ticks := (now - p.RegenAt) / config.RegenInterval
+	if ticks <= 0 {
+		return
+	}
+	p.SetHealth(p.Health + int(ticks) * config.RegenAmount)
+	p.RegenAt += ticks * config.RegenInterval //Keep the part of a tick that has passed.
+}
+
+// This function works out the rewards for the banked offline time.
+func (p *Player) IdleRewards() []RewardInfo {
+	IdleRegistry.RLock() //Read lock.
+	defer IdleRegistry.RUnlock() //Don't forget to release the lock.
+	rewards := []RewardInfo{}
+	for _, reward := range IdleRegistry.RewardsPerHour {
+		reward.Amount = reward.Amount * p.IdleSeconds / 3600
+		if reward.Amount > 0 {
+			rewards = append(rewards, reward)
+		}
+	}
+	return rewards
+}
+
+// This function grants the rewards for the banked offline time and empties the bank.
+func (p *Player) ClaimIdleRewards(logger runtime.Logger) ([]RewardInfo, error) {
+	rewards := p.IdleRewards()
+	if len(rewards) == 0 {
+		return nil, NewGameError(CodeFailedPrecondition, ReasonNoIdleRewards, "Not enough offline time for idle rewards.")
+	}
+	p.GrantRewards(logger, rewards)
+	p.IdleSeconds = 0
+	return rewards, nil
+}
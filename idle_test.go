@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func testIdle(t *testing.T) {
+	t.Helper()
+	InitAttackRegistry()
+	if err := InitIdleRegistry(context.Background(), &testLogger{}, newTestNakama()); err != nil {
+		t.Fatalf("InitIdleRegistry: %v", err)
+	}
+}
+
+func TestOfflineHealthRegen(t *testing.T) {
+	testIdle(t)
+	now := int64(1000000)
+	player := NewPlayer(UtilMakeUUID(), "tester")
+	player.Health = 50
+	player.UpdatedAt = now - 630
+	player.RegenAt = 0 //Saves from before regen use the last save.
+	player.ApplyOfflineProgress(now)
+	if player.Health != 60 || player.RegenAt != now - 30 {
+		t.Fatalf("expected 10 ticks of regen keeping the partial tick, got health %d regen at %d", player.Health, player.RegenAt)
+	}
+
+	//Capped by max health.
+	player.RegenAt = now - 3600
+	player.ApplyOfflineProgress(now)
+	if player.Health != player.MaxHealth {
+		t.Fatalf("expected full health, got %d", player.Health)
+	}
+
+	//No regen in battle, the clock restarts.
+	player.Health = 50
+	player.RegenAt = now - 600
+	player.BattleState.Enemies = map[string]*Enemy{UtilMakeUUID(): {Type: Zombie, Health: 5}}
+	player.ApplyOfflineProgress(now)
+	if player.Health != 50 || player.RegenAt != now {
+		t.Fatalf("expected no regen in battle, got health %d regen at %d", player.Health, player.RegenAt)
+	}
+}
+
+func TestIdleRewards(t *testing.T) {
+	testIdle(t)
+	now := int64(1000000)
+	player := NewPlayer(UtilMakeUUID(), "tester")
+	if _, err := player.ClaimIdleRewards(&testLogger{}); err == nil {
+		t.Fatalf("expected an error with nothing banked")
+	}
+
+	//Online players don't bank time however long ago they were saved.
+	player.SessionTracked = true
+	player.UpdatedAt = now - 3600
+	player.ApplyOfflineProgress(now)
+	if player.IdleSeconds != 0 {
+		t.Fatalf("expected nothing banked while online, got %d", player.IdleSeconds)
+	}
+
+	//Short gaps aren't offline time.
+	player.OfflineSince = now - 60
+	player.ApplyOfflineProgress(now)
+	if player.IdleSeconds != 0 || player.OfflineSince != now - 60 {
+		t.Fatalf("expected nothing banked, got %d", player.IdleSeconds)
+	}
+
+	//Banked time only counts once.
+	player.OfflineSince = now - 2 * 3600
+	player.ApplyOfflineProgress(now)
+	player.ApplyOfflineProgress(now + 60)
+	if player.IdleSeconds != 2 * 3600 || player.OfflineSince != now {
+		t.Fatalf("expected 2 hours banked once, got %d", player.IdleSeconds)
+	}
+
+	//Banked time is capped.
+	player.OfflineSince = now - 24 * 3600
+	player.ApplyOfflineProgress(now)
+	if player.IdleSeconds != IdleRegistry.MaxIdleSeconds {
+		t.Fatalf("expected the bank capped at %d, got %d", IdleRegistry.MaxIdleSeconds, player.IdleSeconds)
+	}
+
+	gold := player.GetCurrency(Gold)
+	rewards, err := player.ClaimIdleRewards(&testLogger{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rewards) != 2 || player.GetCurrency(Gold) != gold + 160 || player.IdleSeconds != 0 {
+		t.Fatalf("unexpected claim: %+v gold %d idle %d", rewards, player.GetCurrency(Gold), player.IdleSeconds)
+	}
+}
+
+func TestSessionEventsTrackOfflineTime(t *testing.T) {
+	testIdle(t)
+	nk := newTestNakama()
+	start := time.Unix(1700000000, 0)
+	clock := testFixedClock(t, start)
+	userID := UtilMakeUUID()
+	if err := NewPlayer(userID, "tester").SavePlayerData(nk); err != nil {
+		t.Fatalf("SavePlayerData: %v", err)
+	}
+	ctx := testUserContext(userID)
+	SessionStartEvent(nk)(ctx, &testLogger{}, nil)
+
+	//Connected but saved by someone else, ex: a raid member's attack, banks nothing.
+	clock.now = start.Add(time.Hour)
+	player, err := LoadPlayerData(context.Background(), &testLogger{}, nk, userID)
+	if err != nil || player.IdleSeconds != 0 {
+		t.Fatalf("expected no idle time while online, got %d: %v", player.IdleSeconds, err)
+	}
+
+	SessionEndEvent(nk)(ctx, &testLogger{}, nil)
+	clock.now = start.Add(3 * time.Hour)
+	SessionStartEvent(nk)(ctx, &testLogger{}, nil)
+	clock.now = start.Add(5 * time.Hour)
+	player, err = LoadPlayerData(context.Background(), &testLogger{}, nk, userID)
+	if err != nil || player.IdleSeconds != 2 * 3600 || player.OfflineSince != 0 {
+		t.Fatalf("expected the 2 hours between sessions banked, got %d since %d: %v", player.IdleSeconds, player.OfflineSince, err)
+	}
+}
+
+func TestHttpOnlyOfflineTime(t *testing.T) {
+	testIdle(t)
+	nk := newTestNakama()
+	start := time.Unix(1700000000, 0)
+	clock := testFixedClock(t, start)
+	userID := UtilMakeUUID()
+	if err := NewPlayer(userID, "tester").SavePlayerData(nk); err != nil {
+		t.Fatalf("SavePlayerData: %v", err)
+	}
+
+	//Without session events the time since the last save counts, once.
+	clock.now = start.Add(2 * time.Hour)
+	player, err := LoadPlayerData(context.Background(), &testLogger{}, nk, userID)
+	if err != nil || player.IdleSeconds != 2 * 3600 {
+		t.Fatalf("expected 2 hours banked since the last save, got %d: %v", player.IdleSeconds, err)
+	}
+	if err := player.SavePlayerData(nk); err != nil {
+		t.Fatalf("SavePlayerData: %v", err)
+	}
+	clock.now = start.Add(2 * time.Hour + time.Minute)
+	player, err = LoadPlayerData(context.Background(), &testLogger{}, nk, userID)
+	if err != nil || player.IdleSeconds != 2 * 3600 {
+		t.Fatalf("expected a short gap between requests not to count, got %d: %v", player.IdleSeconds, err)
+	}
+}
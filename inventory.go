@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// This function adds items to the player's inventory up to the item's stack size.  Returns the amount actually added.
+func (p *Player) AddItem(itemType ItemType, amount int) int {
+	item, exists := GetItem(itemType)
+	if !exists || amount <= 0 {
+		return 0
+	}
+	if p.Inventory == nil {
+		p.Inventory = make(map[ItemType]int)
+	}
+	//Anything over the stack size is lost.
+	count := p.Inventory[itemType]
+	if item.MaxStack > 0 && count+amount > item.MaxStack {
+		amount = item.MaxStack - count
+	}
+	if amount <= 0 {
+		return 0
+	}
+	p.Inventory[itemType] = count + amount
+	return amount
+}
+
+// This function removes items from the player's inventory.  Returns false if the player doesn't have enough.
+func (p *Player) RemoveItem(itemType ItemType, amount int) bool {
+	count := p.Inventory[itemType]
+	if amount <= 0 || count < amount {
+		return false
+	}
+	count -= amount
+	if count == 0 {
+		delete(p.Inventory, itemType)
+	} else {
+		p.Inventory[itemType] = count
+	}
+	return true
+}
+
+// This function uses an item from the inventory on the player or, if a target id is supplied, an enemy in the battle.
+func (p *Player) UseItem(logger runtime.Logger, itemType ItemType, targetID string) error {
+	//Check item.
+	item, exists := GetItem(itemType)
+	if !exists {
+		return NewGameError(CodeNotFound, ReasonItemNotFound, fmt.Sprintf("Item not found: %s", itemType))
+	}
+	if !item.Consumable {
+		return NewGameError(CodeFailedPrecondition, ReasonItemNotUsable, fmt.Sprintf("Item is not usable: %s", itemType))
+	}
+	if p.Inventory[itemType] <= 0 {
+		return NewGameError(CodeFailedPrecondition, ReasonItemNotOwned, fmt.Sprintf("Item not in inventory: %s", itemType))
+	}
+	if p.IsPlayerDead() == true {
+		return NewGameError(CodeFailedPrecondition, ReasonPlayerDead, "Player is deceased.")
+	}
+
+	//Find who the item is being used on.
+	var target EntityProcessor = p
+	if targetID != "" {
+		if item.Target == TargetSelf {
+			return NewGameError(CodeInvalidArgument, ReasonItemNotUsable, fmt.Sprintf("Item can only be used on self: %s", itemType))
+		}
+		targetEnemy := p.GetEnemy(targetID)
+		if targetEnemy == nil || targetEnemy.Type == "" {
+			return NewGameError(CodeNotFound, ReasonEnemyNotFound, fmt.Sprintf("Enemy not found by supplied ID: %s", targetID))
+		}
+		if targetEnemy.IsEnemyDead() == true {
+			return NewGameError(CodeFailedPrecondition, ReasonEnemyDead, "Enemy is deceased.")
+		}
+		target = targetEnemy
+	} else if item.Target == TargetEnemy {
+		return NewFieldError("target_id", fmt.Sprintf("Item requires a target: %s", itemType))
+	}
+
+	//Use it up.
+	p.RemoveItem(itemType, 1)
+	ApplyItem(logger, item, target)
+	return nil
+}
+
+// This function grants rewards (experience, currencies and items) to the player.
+func (p *Player) GrantRewards(logger runtime.Logger, rewards []RewardInfo) {
+	for _, reward := range rewards {
+		//The type is a string once it has been through storage so compare on the string value.
+		switch fmt.Sprint(reward.Type) {
+		case string(Experience):
+			p.Experience += reward.Amount
+			if p.CheckLevelUp() {
+				logger.Debug("Player leveled up to: %d", p.Level)
+			}
+		case string(Gold), string(Gems):
+			p.AddCurrency(CurrencyType(fmt.Sprint(reward.Type)), reward.Amount)
+		case string(ItemReward):
+			added := p.AddItem(reward.ItemID, int(reward.Amount))
+			logger.Debug("Item reward %s added %d of %d.", reward.ItemID, added, reward.Amount)
+		default:
+			logger.Error("Unknown reward type: %+v", reward)
+		}
+	}
+}
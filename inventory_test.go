@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func testItems(t *testing.T) {
+	t.Helper()
+	InitAttackRegistry()
+	InitStatusEffectsRegistry()
+	if err := InitItemRegistry(context.Background(), &testLogger{}, newTestNakama()); err != nil {
+		t.Fatalf("InitItemRegistry: %v", err)
+	}
+}
+
+func TestAddItemStackCap(t *testing.T) {
+	testItems(t)
+	player := NewPlayer(UtilMakeUUID(), "tester")
+	if added := player.AddItem(HealthPotion, 8); added != 8 {
+		t.Fatalf("added %d, want 8", added)
+	}
+	//Anything over the stack size is lost.
+	if added := player.AddItem(HealthPotion, 7); added != 2 || player.Inventory[HealthPotion] != 10 {
+		t.Fatalf("added %d to %d, want 2 to a full stack of 10", added, player.Inventory[HealthPotion])
+	}
+	if added := player.AddItem(HealthPotion, 1); added != 0 {
+		t.Fatalf("added %d to a full stack", added)
+	}
+	if player.AddItem("missing_item", 1) != 0 || player.AddItem(Antidote, 0) != 0 || player.AddItem(Antidote, -1) != 0 {
+		t.Fatal("unknown items and empty amounts shouldn't be added")
+	}
+	if _, exists := player.Inventory[Antidote]; exists {
+		t.Fatalf("nothing should be stored for items not added: %+v", player.Inventory)
+	}
+
+	if player.RemoveItem(HealthPotion, 11) || player.Inventory[HealthPotion] != 10 {
+		t.Fatal("removing more than owned should fail without changing the inventory")
+	}
+	if !player.RemoveItem(HealthPotion, 10) {
+		t.Fatal("expected the stack removed")
+	}
+	if _, exists := player.Inventory[HealthPotion]; exists {
+		t.Fatal("empty stacks should be deleted")
+	}
+}
+
+func TestUseItem(t *testing.T) {
+	testItems(t)
+	selfOnly := ItemType("test_self_only")
+	ItemRegistry.Lock()
+	ItemRegistry.Items[selfOnly] = ItemInfo{Type: selfOnly, Consumable: true, MaxStack: 1, Target: TargetSelf, Heal: 1}
+	ItemRegistry.Unlock()
+	t.Cleanup(func() {
+		ItemRegistry.Lock()
+		delete(ItemRegistry.Items, selfOnly)
+		ItemRegistry.Unlock()
+	})
+	logger := &testLogger{}
+	player := NewPlayer(UtilMakeUUID(), "tester")
+	enemyID, deadID := UtilMakeUUID(), UtilMakeUUID()
+	enemy := &Enemy{Type: Zombie, Health: 5, MaxHealth: 20}
+	player.BattleState.Enemies = map[string]*Enemy{
+		enemyID: enemy,
+		deadID: {Type: Zombie, Health: 0, MaxHealth: 20},
+	}
+
+	err := player.UseItem(logger, HealthPotion, "")
+	if code, body := testErrorBody(t, err); code != CodeFailedPrecondition || body.Reason != ReasonItemNotOwned {
+		t.Fatalf("not owned: code %d body %+v", code, body)
+	}
+	player.AddItem(RustySword, 1)
+	err = player.UseItem(logger, RustySword, "")
+	if code, body := testErrorBody(t, err); code != CodeFailedPrecondition || body.Reason != ReasonItemNotUsable {
+		t.Fatalf("not consumable: code %d body %+v", code, body)
+	}
+
+	//No target uses it on the player.
+	player.AddItem(HealthPotion, 3)
+	player.Health = 50
+	if err := player.UseItem(logger, HealthPotion, ""); err != nil {
+		t.Fatalf("use on self: %v", err)
+	}
+	if player.Health != 75 || player.Inventory[HealthPotion] != 2 {
+		t.Fatalf("expected a heal of 25 using one potion, got health %d potions %d", player.Health, player.Inventory[HealthPotion])
+	}
+
+	//A target id uses it on that enemy.
+	player.AddItem(Bandage, 1)
+	AddStatusEffect(logger, Bleed, enemy, player.Now().Unix())
+	if err := player.UseItem(logger, Bandage, enemyID); err != nil {
+		t.Fatalf("use on enemy: %v", err)
+	}
+	if enemy.Health != 10 || CountStatusEffects(enemy, Bleed) != 0 || player.Health != 75 {
+		t.Fatalf("expected the bandage on the enemy, got enemy %+v player health %d", enemy, player.Health)
+	}
+
+	//Bad targets don't use up the item.
+	err = player.UseItem(logger, HealthPotion, UtilMakeUUID())
+	if code, body := testErrorBody(t, err); code != CodeNotFound || body.Reason != ReasonEnemyNotFound {
+		t.Fatalf("missing enemy: code %d body %+v", code, body)
+	}
+	err = player.UseItem(logger, HealthPotion, deadID)
+	if code, body := testErrorBody(t, err); code != CodeFailedPrecondition || body.Reason != ReasonEnemyDead {
+		t.Fatalf("dead enemy: code %d body %+v", code, body)
+	}
+	player.AddItem(selfOnly, 1)
+	err = player.UseItem(logger, selfOnly, enemyID)
+	if code, body := testErrorBody(t, err); code != CodeInvalidArgument || body.Reason != ReasonItemNotUsable {
+		t.Fatalf("self only item on an enemy: code %d body %+v", code, body)
+	}
+	if player.Inventory[HealthPotion] != 2 || player.Inventory[selfOnly] != 1 {
+		t.Fatalf("failed uses shouldn't use up items: %+v", player.Inventory)
+	}
+
+	//Nothing can be used once dead.
+	player.Health = 0
+	err = player.UseItem(logger, HealthPotion, "")
+	if code, body := testErrorBody(t, err); code != CodeFailedPrecondition || body.Reason != ReasonPlayerDead {
+		t.Fatalf("dead player: code %d body %+v", code, body)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"context"
+	"encoding/json"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+var itemDataStorageKey = "items"
+
+// Item types
+type ItemType string
+const ( //Building it this way avoids using string values on maps but allows the json to bear the string value.
+	HealthPotion ItemType = "health_potion"
+	Antidote ItemType = "antidote"
+	Bandage ItemType = "bandage"
+	RustySword ItemType = "rusty_sword"
+	LeatherArmor ItemType = "leather_armor"
+	LuckyCharm ItemType = "lucky_charm"
+)
+
+// Who an item can be used on.
+type ItemTarget string
+const (
+	TargetSelf ItemTarget = "self"
+	TargetEnemy ItemTarget = "enemy"
+	TargetAny ItemTarget = "any"
+)
+
+// Information on a single item definition.
+type ItemInfo struct {
+	Type ItemType `json:"type"`
+	Consumable bool `json:"consumable"` //Consumables are removed from the inventory when used.
+	MaxStack int `json:"max_stack"` //Maximum amount of this item the player can hold.
+	Target ItemTarget `json:"target"` //Who the item can be used on.
+	Heal int `json:"heal"` //Health restored when used, clamped to the max health.
+	RemovesStatusEffects []StatusEffectType `json:"removes_status_effects"` //Status effects cleansed when used.
+	Slot EquipmentSlot `json:"slot,omitempty"` //Equipment slot, empty if the item can't be equipped.
+	Stats EquipmentStats `json:"stats"` //Combat stat modifiers while equipped.
+	GrantsAttacks []AttackType `json:"grants_attacks"` //Attacks usable while equipped.
+}
+
+// Registry to hold all of the definitions.  Using a mutex here since the data could be live-ops driven meaning it could change after nakama init.
+// **NOTE: If the plan is to not update this information after nakama init then this paradigm can be change to a simple read-only map instead.
+var ItemRegistry = struct {
+	sync.RWMutex //Read/write mutex to help with concurrent access allowing mulitple readers or a single writer.
+	Items map[ItemType]ItemInfo
+}{
+	Items: make(map[ItemType]ItemInfo),
+}
+
+// This function will initialize the Item Registry.
+func InitItemRegistry(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) error {
+	//Read from the storage engine.
+	rObj, err := nk.StorageRead(ctx, []*runtime.StorageRead{
+		{
+			Collection: configDataStorageCollection,
+			Key: itemDataStorageKey,
+		},
+	})
+	if err != nil {
+		logger.Error("Error getting item configuration data: %v", err)
+		return err
+	}
+	//Load defaults if nothing was found in storage and save them into storage.
+	if len(rObj) == 0 {
+		ItemRegistry.Lock()  //Call lock on the mutex in preparation for writing.
+		ItemRegistry.Items[HealthPotion] = ItemInfo{
+			Type: HealthPotion,
+			Consumable: true,
+			MaxStack: 10,
+			Target: TargetAny,
+			Heal: 25,
+			RemovesStatusEffects: []StatusEffectType{},
+		}
+		ItemRegistry.Items[Antidote] = ItemInfo{
+			Type: Antidote,
+			Consumable: true,
+			MaxStack: 5,
+			Target: TargetAny,
+			Heal: 0,
+			RemovesStatusEffects: []StatusEffectType{Poison},
+		}
+		ItemRegistry.Items[Bandage] = ItemInfo{
+			Type: Bandage,
+			Consumable: true,
+			MaxStack: 5,
+			Target: TargetAny,
+			Heal: 5,
+			RemovesStatusEffects: []StatusEffectType{Bleed},
+		}
+		ItemRegistry.Items[RustySword] = ItemInfo{
+			Type: RustySword,
+			Consumable: false,
+			MaxStack: 1,
+			Target: TargetSelf,
+			Slot: WeaponSlot,
+			Stats: EquipmentStats{
+				Damage: 2,
+				HitChance: -0.05,
+			},
+			GrantsAttacks: []AttackType{Slash},
+		}
+		ItemRegistry.Items[LeatherArmor] = ItemInfo{
+			Type: LeatherArmor,
+			Consumable: false,
+			MaxStack: 1,
+			Target: TargetSelf,
+			Slot: ArmorSlot,
+			Stats: EquipmentStats{
+				Defense: 2,
+			},
+			GrantsAttacks: []AttackType{},
+		}
+		ItemRegistry.Items[LuckyCharm] = ItemInfo{
+			Type: LuckyCharm,
+			Consumable: false,
+			MaxStack: 1,
+			Target: TargetSelf,
+			Slot: TrinketSlot,
+			Stats: EquipmentStats{
+				HitChance: 0.05,
+				StatusEffectChance: 0.1,
+			},
+			GrantsAttacks: []AttackType{},
+		}
+		ItemRegistry.Unlock() //Don't forget to release the mutex lock.
+		return SaveItemRegistry(nk)
+	}
+
+	var items map[ItemType]ItemInfo
+	if err := json.Unmarshal([]byte(rObj[0].Value), &items); err != nil {
+		logger.Error("Failed to unmarshal item data: %v", err)
+		return err
+	}
+	ItemRegistry.Lock()  //Call lock on the mutex in preparation for writing.
+	ItemRegistry.Items = items
+	ItemRegistry.Unlock() //Don't forget to release the mutex lock.
+
+	return nil
+}
+
+// This function will save the Item Registry to storage.
+func SaveItemRegistry(nk runtime.NakamaModule) error {
+	ItemRegistry.RLock() //Read lock.
+	//Json-ify the item registry in prepartion for storage.
+	data, err := json.Marshal(ItemRegistry.Items)
+	ItemRegistry.RUnlock() //Don't forget to release the lock.
+	if err != nil {
+		return err
+	}
+	wObj := []*runtime.StorageWrite{
+		{
+			Collection: configDataStorageCollection,
+			Key: itemDataStorageKey,
+			Value: string(data),
+			PermissionRead: 1, // Owner and runtime can read.
+			PermissionWrite: 0, // No one can write save the runtime.
+		},
+	}
+	//Write to the storage engine.
+	if _, err := nk.StorageWrite(context.Background(), wObj); err != nil {
+		return fmt.Errorf("failed to write item data to storage: %v", err)
+	}
+	return nil
+}
+
+// This function gets an item definition from the registry.
+func GetItem(itemType ItemType) (ItemInfo, bool) {
+	ItemRegistry.RLock() //Read lock.
+	defer ItemRegistry.RUnlock() //Don't forget to release the lock.
+	item, exists := ItemRegistry.Items[itemType]
+	return item, exists
+}
+
+// This function applies an item's effects to an entity (player or enemy).
+func ApplyItem(logger runtime.Logger, item ItemInfo, ep EntityProcessor) {
+	//Restore health, SetHealth clamps it to the max health.
+	if item.Heal != 0 {
+		ep.SetHealth(ep.GetHealth() + item.Heal)
+		logger.Debug("Item %s healed to: %d/%d", item.Type, ep.GetHealth(), ep.GetMaxHealth())
+	}
+	//Cleanse status effects.
+	if len(item.RemovesStatusEffects) > 0 {
+		var remainingEffects []*StatusEffect
+		for _, effect := range ep.GetStatusEffects() {
+			removed := false
+			for _, effectType := range item.RemovesStatusEffects {
+				if effect.Type == effectType {
+					removed = true
+					break
+				}
+			}
+			if !removed {
+				remainingEffects = append(remainingEffects, effect)
+			}
+		}
+		logger.Debug("Item %s removed %d status effects.", item.Type, len(ep.GetStatusEffects())-len(remainingEffects))
+		ep.SetStatusEffects(remainingEffects)
+	}
+}
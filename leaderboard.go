@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"context"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Leaderboard ids, kills per enemy type use EnemyKillsLeaderboard.
+const (
+	KillsLeaderboard = "kills" //Total enemies killed.
+	LevelLeaderboard = "level" //Highest level reached.
+	BattleDamageLeaderboard = "battle_damage" //Most damage dealt in a single battle.
+)
+
+const WeeklyLeaderboardSuffix = "_weekly" //Weekly variants share the id with this suffix.
+const WeeklyResetSchedule = "0 0 * * 1" //CRON, Mondays at midnight UTC.
+const RankingsDefaultLimit = 10
+const RankingsMaxLimit = 100
+
+// Leaderboard definition used to create the nakama leaderboards.
+type LeaderboardInfo struct {
+	ID string `json:"id"`
+	Operator string `json:"operator"` //"incr" adds to the score, "best" keeps the highest.
+	ResetSchedule string `json:"reset_schedule,omitempty"` //Empty never resets.
+}
+
+// This function gives the leaderboard id for kills of an enemy type.
+func EnemyKillsLeaderboard(enemyType EnemyType) string {
+	return fmt.Sprintf("%s_%s", KillsLeaderboard, enemyType)
+}
+
+// This function gives the id of the weekly variant of a leaderboard.
+func WeeklyLeaderboard(id string) string {
+	return id + WeeklyLeaderboardSuffix
+}
+
+// This function lists every leaderboard, including a kills board for each enemy type in the registry and the weekly
+// variants.  Enemy types added by live-ops get their boards the next time nakama starts.
+func Leaderboards() []LeaderboardInfo {
+	leaderboards := []LeaderboardInfo{
+		{ID: KillsLeaderboard, Operator: "incr"},
+		{ID: LevelLeaderboard, Operator: "best"},
+		{ID: BattleDamageLeaderboard, Operator: "best"},
+	}
+	EnemyRegistry.RLock() //Read lock.
+	enemyTypes := make([]string, 0, len(EnemyRegistry.Enemies))
+	for enemyType := range EnemyRegistry.Enemies {
+		enemyTypes = append(enemyTypes, EnemyKillsLeaderboard(enemyType))
+	}
+	EnemyRegistry.RUnlock() //Release read lock.
+	sort.Strings(enemyTypes) //Keep the order stable between runs.
+	for _, id := range enemyTypes {
+		leaderboards = append(leaderboards, LeaderboardInfo{ID: id, Operator: "incr"})
+	}
+	for _, leaderboard := range leaderboards { //The range is evaluated once so the appended variants aren't visited.
+		leaderboards = append(leaderboards, LeaderboardInfo{
+			ID: WeeklyLeaderboard(leaderboard.ID),
+			Operator: leaderboard.Operator,
+			ResetSchedule: WeeklyResetSchedule,
+		})
+	}
+	return leaderboards
+}
+
+// This function checks if an id is one of our leaderboards.
+func IsLeaderboard(id string) bool {
+	for _, leaderboard := range Leaderboards() {
+		if leaderboard.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// This function creates the leaderboards, nakama leaves existing ones as they are.  Needs the enemy registry loaded first.
+func InitLeaderboards(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) error {
+	for _, leaderboard := range Leaderboards() {
+		//Authoritative so only the server can submit scores.
+		err := nk.LeaderboardCreate(ctx, leaderboard.ID, true, "desc", leaderboard.Operator, leaderboard.ResetSchedule, nil, true)
+		if err != nil {
+			logger.Error("Unable to create leaderboard %s: %v", leaderboard.ID, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// This function works out the scores the events add to each leaderboard, weekly variants included.
+func LeaderboardScores(events []BattleEvent) map[string]int64 {
+	scores := make(map[string]int64)
+	best := func(id string, score int64) {
+		if score > scores[id] {
+			scores[id] = score
+		}
+	}
+	for _, event := range events {
+		switch event.Event {
+		case EventKill:
+			scores[KillsLeaderboard]++
+			scores[EnemyKillsLeaderboard(EnemyType(event.Target))]++
+		case EventLevelUp:
+			best(LevelLeaderboard, int64(event.Value))
+		case EventBattleWon:
+			best(BattleDamageLeaderboard, int64(event.Damage))
+		}
+	}
+	weekly := make(map[string]int64, len(scores))
+	for id, score := range scores {
+		weekly[WeeklyLeaderboard(id)] = score
+	}
+	for id, score := range weekly {
+		scores[id] = score
+	}
+	return scores
+}
+
+// This function submits the scores earned by the events.  Failures are logged and not returned since the player was already
+// saved and a missed score shouldn't fail the request.
+func SubmitLeaderboardScores(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, p *Player, events []BattleEvent) {
+	for id, score := range LeaderboardScores(events) {
+		if score <= 0 {
+			continue
+		}
+		if _, err := nk.LeaderboardRecordWrite(ctx, id, p.ID, p.DisplayName, score, 0, nil, nil); err != nil {
+			logger.Error("Unable to write leaderboard %s record: %v", id, err)
+		}
+	}
+}
+
+// Player's place on a leaderboard.
+type Ranking struct {
+	UserID string `json:"user_id"`
+	Username string `json:"username"`
+	Score int64 `json:"score"`
+	Rank int64 `json:"rank"`
+}
+
+// This function gets the caller's record and the records around it.  A caller without a record gets the top of the board.
+func GetRankings(ctx context.Context, nk runtime.NakamaModule, userID, leaderboardID string, limit int) (*Ranking, []*Ranking, error) {
+	records, ownerRecords, _, _, err := nk.LeaderboardRecordsList(ctx, leaderboardID, []string{userID}, limit, "", 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	var caller *Ranking
+	if len(ownerRecords) > 0 {
+		caller = &Ranking{
+			UserID: ownerRecords[0].OwnerId,
+			Username: ownerRecords[0].GetUsername().GetValue(),
+			Score: ownerRecords[0].Score,
+			Rank: ownerRecords[0].Rank,
+		}
+		haystack, err := nk.LeaderboardRecordsHaystack(ctx, leaderboardID, userID, limit, "", 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		records = haystack.Records
+	}
+	rankings := []*Ranking{}
+	for _, record := range records {
+		rankings = append(rankings, &Ranking{
+			UserID: record.OwnerId,
+			Username: record.GetUsername().GetValue(),
+			Score: record.Score,
+			Rank: record.Rank,
+		})
+	}
+	return caller, rankings, nil
+}
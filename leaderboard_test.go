@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestLeaderboardsIncludeEnemyTypesAndWeekly(t *testing.T) {
+	nk := newTestNakama()
+	if err := InitEnemyRegistry(context.Background(), &testLogger{}, nk); err != nil {
+		t.Fatalf("InitEnemyRegistry: %v", err)
+	}
+	for _, id := range []string{KillsLeaderboard, LevelLeaderboard, BattleDamageLeaderboard, EnemyKillsLeaderboard(Zombie), WeeklyLeaderboard(EnemyKillsLeaderboard(Zombie))} {
+		if !IsLeaderboard(id) {
+			t.Errorf("%s should be a leaderboard", id)
+		}
+	}
+	if IsLeaderboard(WeeklyLeaderboard(WeeklyLeaderboard(KillsLeaderboard))) {
+		t.Error("weekly boards shouldn't get their own weekly variant")
+	}
+	for _, leaderboard := range Leaderboards() {
+		weekly := leaderboard.ResetSchedule != ""
+		if weekly != strings.HasSuffix(leaderboard.ID, WeeklyLeaderboardSuffix) {
+			t.Errorf("%s reset schedule is %q", leaderboard.ID, leaderboard.ResetSchedule)
+		}
+	}
+}
+
+func TestLeaderboardScores(t *testing.T) {
+	scores := LeaderboardScores([]BattleEvent{
+		{Event: EventKill, Target: string(Zombie)},
+		{Event: EventLevelUp, Value: 2},
+		{Event: EventKill, Target: string(Zombie)},
+		{Event: EventLevelUp, Value: 3},
+		{Event: EventAttackHit, Damage: 10},
+		{Event: EventBattleWon, Damage: 120},
+	})
+	expected := map[string]int64{
+		KillsLeaderboard: 2,
+		EnemyKillsLeaderboard(Zombie): 2,
+		LevelLeaderboard: 3,
+		BattleDamageLeaderboard: 120,
+	}
+	for id, score := range expected {
+		if scores[id] != score || scores[WeeklyLeaderboard(id)] != score {
+			t.Errorf("%s scored %d and %d weekly, want %d", id, scores[id], scores[WeeklyLeaderboard(id)], score)
+		}
+	}
+	if len(scores) != len(expected) * 2 {
+		t.Errorf("unexpected scores: %+v", scores)
+	}
+}
+
+func TestKillUpdatesRankings(t *testing.T) {
+	ctx := context.Background()
+	logger := &testLogger{}
+	nk := newTestNakama()
+	if err := InitEnemyRegistry(ctx, logger, nk); err != nil {
+		t.Fatalf("InitEnemyRegistry: %v", err)
+	}
+	if err := InitLeaderboards(ctx, logger, nk); err != nil {
+		t.Fatalf("InitLeaderboards: %v", err)
+	}
+	attackType := testSureHitAttack(t, 30)
+	rival := UtilMakeUUID()
+	nk.LeaderboardRecordWrite(ctx, KillsLeaderboard, rival, "rival", 5, 0, nil, nil)
+
+	player := NewPlayer(UtilMakeUUID(), "tester")
+	player.Loadout = []AttackType{attackType}
+	targetID := UtilMakeUUID()
+	player.BattleState.Enemies = map[string]*Enemy{
+		targetID: {Type: Zombie, Health: 30, MaxHealth: 30},
+	}
+	result, err := player.PlayerAttack(logger, targetID, attackType)
+	if err != nil || !result.EnemyKilled {
+		t.Fatalf("attack should kill the enemy: %+v %v", result, err)
+	}
+	//Nothing is submitted until the player is saved.
+	if nk.scores[KillsLeaderboard][player.ID] != 0 {
+		t.Fatal("kills submitted before the player was saved")
+	}
+	if _, err := CommitRequest(ctx, logger, nk, nil, player, struct{}{}); err != nil {
+		t.Fatalf("CommitRequest: %v", err)
+	}
+	for _, id := range []string{KillsLeaderboard, WeeklyLeaderboard(KillsLeaderboard), EnemyKillsLeaderboard(Zombie)} {
+		if nk.scores[id][player.ID] != 1 {
+			t.Errorf("%s score is %d, want 1", id, nk.scores[id][player.ID])
+		}
+	}
+	if nk.scores[BattleDamageLeaderboard][player.ID] != 30 {
+		t.Errorf("battle damage is %d, want 30", nk.scores[BattleDamageLeaderboard][player.ID])
+	}
+	if len(player.TakeBattleEvents()) != 0 {
+		t.Error("events should be cleared once processed")
+	}
+
+	caller, rankings, err := GetRankings(ctx, nk, player.ID, KillsLeaderboard, 10)
+	if err != nil {
+		t.Fatalf("GetRankings: %v", err)
+	}
+	if caller == nil || caller.Rank != 2 || caller.Score != 1 {
+		t.Fatalf("caller ranking: %+v", caller)
+	}
+	if len(rankings) != 2 || rankings[0].UserID != rival {
+		t.Errorf("rankings: %+v", rankings)
+	}
+
+	//Players without a score get the top of the board.
+	caller, rankings, err = GetRankings(ctx, nk, UtilMakeUUID(), KillsLeaderboard, 1)
+	if err != nil || caller != nil || len(rankings) != 1 || rankings[0].UserID != rival {
+		t.Errorf("unranked caller got %+v %+v %v", caller, rankings, err)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+)
+
+const LoadoutSize = 4 //Maximum number of attacks a player can have equipped.
+
+// Attack information as seen by a specific player.
+type PlayerAttackInfo struct {
+	AttackInfo
+	Unlocked bool `json:"unlocked"`
+	Equipped bool `json:"equipped"`
+}
+
+// This function checks the attack owner flag and unlock requirements for the player.
+func (p *Player) CanUseAttack(attack AttackInfo) error {
+	if attack.Owner == OwnerEnemy {
+		return NewGameError(CodePermissionDenied, ReasonAttackNotPlayable, fmt.Sprintf("Attack action is not usable by players: %s", attack.Type))
+	}
+	if attack.EquipmentOnly && !p.HasEquipmentAttack(attack.Type) {
+		return NewGameError(CodeFailedPrecondition, ReasonAttackLocked, fmt.Sprintf("Attack action requires equipment: %s", attack.Type))
+	}
+	if p.Level < attack.Unlock.Level {
+		return NewGameError(CodeFailedPrecondition, ReasonAttackLocked, fmt.Sprintf("Attack action requires level %d: %s", attack.Unlock.Level, attack.Type))
+	}
+	if attack.Unlock.Item != "" && !p.OwnsItem(attack.Unlock.Item) {
+		return NewGameError(CodeFailedPrecondition, ReasonAttackLocked, fmt.Sprintf("Attack action requires item %s: %s", attack.Unlock.Item, attack.Type))
+	}
+	if attack.Unlock.Quest != "" && !p.HasCompletedQuest(attack.Unlock.Quest) {
+		return NewGameError(CodeFailedPrecondition, ReasonAttackLocked, fmt.Sprintf("Attack action requires quest %s: %s", attack.Unlock.Quest, attack.Type))
+	}
+	return nil
+}
+
+// This function checks if the attack is in the player's loadout.
+func (p *Player) InLoadout(attackType AttackType) bool {
+	for _, equipped := range p.Loadout {
+		if equipped == attackType {
+			return true
+		}
+	}
+	return false
+}
+
+// This function checks if the player has the item in the inventory or equipped.
+func (p *Player) OwnsItem(itemType ItemType) bool {
+	if p.Inventory[itemType] > 0 {
+		return true
+	}
+	for _, equipped := range p.Equipment {
+		if equipped == itemType {
+			return true
+		}
+	}
+	return false
+}
+
+// This function checks if the player has completed a quest.
+func (p *Player) HasCompletedQuest(questID string) bool {
+	for _, completed := range p.CompletedQuests {
+		if completed == questID {
+			return true
+		}
+	}
+	return false
+}
+
+// This function validates and sets the attacks equipped in the player's loadout.
+func (p *Player) SetLoadout(attacks []AttackType) error {
+	if len(attacks) == 0 || len(attacks) > LoadoutSize {
+		return NewFieldError("attacks", fmt.Sprintf("Loadout must have between 1 and %d attacks.", LoadoutSize))
+	}
+	seen := make(map[AttackType]bool)
+	AttackRegistry.RLock() //Read lock.
+	defer AttackRegistry.RUnlock() //Release read lock.
+	for _, attackType := range attacks {
+		if seen[attackType] {
+			return NewFieldError("attacks", fmt.Sprintf("Attack action listed more than once: %s", attackType))
+		}
+		seen[attackType] = true
+		attack, exists := AttackRegistry.Attacks[attackType]
+		if !exists {
+			return NewGameError(CodeNotFound, ReasonAttackNotFound, fmt.Sprintf("Attack action not found: %s", attackType))
+		}
+		if err := p.CanUseAttack(attack); err != nil {
+			return err
+		}
+	}
+	p.Loadout = attacks
+	return nil
+}
+
+// This function builds a loadout from the unlocked player attacks, used for new players or saves without one.
+func (p *Player) DefaultLoadout() []AttackType {
+	AttackRegistry.RLock() //Read lock.
+	defer AttackRegistry.RUnlock() //Release read lock.
+	//Walk a fixed order so the loadout doesn't depend on map ordering.
+	loadout := []AttackType{}
+	for _, attackType := range []AttackType{Jab, Punch, Kick, UpperCut, HeadButt} {
+		attack, exists := AttackRegistry.Attacks[attackType]
+		if !exists || p.CanUseAttack(attack) != nil {
+			continue
+		}
+		loadout = append(loadout, attackType)
+		if len(loadout) == LoadoutSize {
+			break
+		}
+	}
+	return loadout
+}
+
+// This function lists every attack a player could use with their unlock and equipped state.
+func (p *Player) ListAttacks() []PlayerAttackInfo {
+	AttackRegistry.RLock() //Read lock.
+	defer AttackRegistry.RUnlock() //Release read lock.
+	attacks := []PlayerAttackInfo{}
+	for _, attack := range AttackRegistry.Attacks {
+		if attack.Owner == OwnerEnemy {
+			continue
+		}
+		attacks = append(attacks, PlayerAttackInfo{
+			AttackInfo: attack,
+			Unlocked: p.CanUseAttack(attack) == nil,
+			Equipped: p.InLoadout(attack.Type),
+		})
+	}
+	return attacks
+}
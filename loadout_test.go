@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSetLoadoutSize(t *testing.T) {
+	testItems(t)
+	player := NewPlayer(UtilMakeUUID(), "tester")
+	player.Level = 5
+	for _, attacks := range [][]AttackType{
+		{},
+		{Jab, Punch, Kick, UpperCut, HeadButt},
+		{Jab, Punch, Jab},
+	} {
+		err := player.SetLoadout(attacks)
+		if code, body := testErrorBody(t, err); code != CodeInvalidArgument || body.Reason != ReasonInvalidField || body.Field != "attacks" {
+			t.Fatalf("loadout %v: code %d body %+v", attacks, code, body)
+		}
+	}
+	err := player.SetLoadout([]AttackType{Jab, "missing_attack"})
+	if code, body := testErrorBody(t, err); code != CodeNotFound || body.Reason != ReasonAttackNotFound {
+		t.Fatalf("unknown attack: code %d body %+v", code, body)
+	}
+	if len(player.Loadout) != 2 || player.Loadout[0] != Jab || player.Loadout[1] != Punch {
+		t.Fatalf("rejected loadouts shouldn't change the player: %v", player.Loadout)
+	}
+
+	attacks := []AttackType{Jab, Punch, Kick, UpperCut}
+	if err := player.SetLoadout(attacks); err != nil {
+		t.Fatalf("full loadout: %v", err)
+	}
+	if len(player.Loadout) != LoadoutSize || !player.InLoadout(UpperCut) || player.InLoadout(HeadButt) {
+		t.Fatalf("unexpected loadout: %v", player.Loadout)
+	}
+}
+
+func TestCanUseAttackUnlocks(t *testing.T) {
+	testItems(t)
+	gated := AttackType("test_gated")
+	AttackRegistry.Lock()
+	AttackRegistry.Attacks[gated] = AttackInfo{
+		Type: gated,
+		Owner: OwnerPlayer,
+		Unlock: UnlockRequirement{Level: 1, Item: LuckyCharm, Quest: "test_quest"},
+	}
+	AttackRegistry.Unlock()
+	t.Cleanup(func() {
+		AttackRegistry.Lock()
+		delete(AttackRegistry.Attacks, gated)
+		AttackRegistry.Unlock()
+	})
+	player := NewPlayer(UtilMakeUUID(), "tester")
+
+	for _, attackType := range []AttackType{Kick, Slash, gated} {
+		err := player.SetLoadout([]AttackType{attackType})
+		if code, body := testErrorBody(t, err); code != CodeFailedPrecondition || body.Reason != ReasonAttackLocked {
+			t.Fatalf("%s should be locked: code %d body %+v", attackType, code, body)
+		}
+	}
+	err := player.SetLoadout([]AttackType{Bite})
+	if code, body := testErrorBody(t, err); code != CodePermissionDenied || body.Reason != ReasonAttackNotPlayable {
+		t.Fatalf("enemy attack: code %d body %+v", code, body)
+	}
+
+	//Each requirement met in turn.
+	player.Level = 2
+	player.AddItem(RustySword, 1)
+	if err := player.EquipItem(RustySword); err != nil {
+		t.Fatalf("equip: %v", err)
+	}
+	if err := player.SetLoadout([]AttackType{Kick, Slash}); err != nil {
+		t.Fatalf("level and equipment unlocks: %v", err)
+	}
+	player.AddItem(LuckyCharm, 1)
+	err = player.SetLoadout([]AttackType{gated})
+	if code, body := testErrorBody(t, err); code != CodeFailedPrecondition || body.Reason != ReasonAttackLocked {
+		t.Fatalf("quest still needed: code %d body %+v", code, body)
+	}
+	player.CompletedQuests = append(player.CompletedQuests, "test_quest")
+	if err := player.SetLoadout([]AttackType{gated}); err != nil {
+		t.Fatalf("item and quest unlocks: %v", err)
+	}
+
+	//Items count when equipped too.
+	if err := player.EquipItem(LuckyCharm); err != nil {
+		t.Fatalf("equip: %v", err)
+	}
+	AttackRegistry.RLock()
+	attack := AttackRegistry.Attacks[gated]
+	AttackRegistry.RUnlock()
+	if err := player.CanUseAttack(attack); err != nil {
+		t.Fatalf("equipped item should unlock: %v", err)
+	}
+}
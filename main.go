@@ -30,23 +30,14 @@ func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runti
 	}
 	//Make sure we can get the configured environment.  This will facilitate a seperation of logic as/if needed by environment.
 	configuredEnvironment, ok := env["ConfiguredEnvironement"]
-	var environment BuildEnvironment
+	logger.Info("ConfiguredEnvironement: %v", configuredEnvironment)
+	environment, known := ParseBuildEnvironment(configuredEnvironment)
 	if !ok {
-		environment = Production
 		logger.Error("ConfiguredEnvironement not found, defaulting to production.")
+	} else if !known {
+		logger.Error("ConfiguredEnvironement %q is unknown, defaulting to production.", configuredEnvironment)
 	}
-	logger.Info("ConfiguredEnvironement: %v", configuredEnvironment)
-	switch configuredEnvironment {
-	case "local":
-		environment = Local
-	case "development":
-		environment = Development
-	case "qa":
-		environment = QA
-	case "production":
-		environment = Production
-	}
-	logger.Info("Environment: %d", environment)
+	logger.Info("Environment: %s", environment)
 
 	//Initialize registries.
 	InitStatusEffectsRegistry()
@@ -58,24 +49,254 @@ func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runti
 		logger.Error("Error processing InitEnemyRegistry(): %v", err)
 	}
 	logger.Debug("Loaded EnemyRegistry: %+v", EnemyRegistry)
+	err = InitItemRegistry(ctx, logger, nk)
+	if err != nil {
+		logger.Error("Error processing InitItemRegistry(): %v", err)
+	}
+	logger.Debug("Loaded ItemRegistry: %+v", ItemRegistry.Items)
+	err = InitStoreRegistry(ctx, logger, nk)
+	if err != nil {
+		logger.Error("Error processing InitStoreRegistry(): %v", err)
+	}
+	logger.Debug("Loaded StoreRegistry: %+v", StoreRegistry.Offers)
+	err = InitRateLimitRegistry(ctx, logger, nk)
+	if err != nil {
+		logger.Error("Error processing InitRateLimitRegistry(): %v", err)
+	}
+	logger.Debug("Loaded RateLimitRegistry: %+v", RateLimitRegistry.Limits)
+	err = InitAchievementRegistry(ctx, logger, nk)
+	if err != nil {
+		logger.Error("Error processing InitAchievementRegistry(): %v", err)
+	}
+	logger.Debug("Loaded AchievementRegistry: %+v", AchievementRegistry.Achievements)
+	err = InitQuestRegistry(ctx, logger, nk)
+	if err != nil {
+		logger.Error("Error processing InitQuestRegistry(): %v", err)
+	}
+	logger.Debug("Loaded QuestRegistry: %+v", QuestRegistry.QuestConfig)
+	err = InitIdleRegistry(ctx, logger, nk)
+	if err != nil {
+		logger.Error("Error processing InitIdleRegistry(): %v", err)
+	}
+	logger.Debug("Loaded IdleRegistry: %+v", IdleRegistry.IdleConfig)
+	err = InitBestiaryRegistry(ctx, logger, nk)
+	if err != nil {
+		logger.Error("Error processing InitBestiaryRegistry(): %v", err)
+	}
+	logger.Debug("Loaded BestiaryRegistry: %+v", BestiaryRegistry.BestiaryConfig)
+	err = InitEncounterRegistry(ctx, logger, nk)
+	if err != nil {
+		logger.Error("Error processing InitEncounterRegistry(): %v", err)
+	}
+	logger.Debug("Loaded EncounterRegistry: %+v", EncounterRegistry.Encounters)
+	//Overrides from runtime.env for this environment, before anything is built from the registries.
+	ApplyConfigOverrides(logger, env, environment)
+	//Leaderboards need the enemy registry for the per enemy type boards.
+	err = InitLeaderboards(ctx, logger, nk)
+	if err != nil {
+		logger.Error("Error processing InitLeaderboards(): %v", err)
+	}
+
+	//Fix permissions on player data saved before it was made server only.
+	err = MigrateStoragePermissions(ctx, logger, nk)
+	if err != nil {
+		logger.Error("Error processing MigrateStoragePermissions(): %v", err)
+	}
+
+	//Take accounts deleted from the console or admin api out of the shared raids and duels.
+	err = CleanUpDeletedAccounts(ctx, logger, nk)
+	if err != nil {
+		logger.Error("Error processing CleanUpDeletedAccounts(): %v", err)
+	}
 
 	//Before/After hooks if any.
+	//Reject client writes to the data and config collections, only the runtime writes those.
+	if err := initializer.RegisterBeforeWriteStorageObjects(BeforeWriteStorageObjects); err != nil {
+		return err
+	}
+	//Create the player with a starter wallet on first login.
+	if err := initializer.RegisterAfterAuthenticateDevice(AfterAuthenticateDevice); err != nil {
+		return err
+	}
+	if err := initializer.RegisterAfterAuthenticateCustom(AfterAuthenticateCustom); err != nil {
+		return err
+	}
+	//Put players matched for a raid into one together.
+	if err := initializer.RegisterMatchmakerMatched(MatchmakerMatched); err != nil {
+		return err
+	}
+	//Remove the game data along with the account, then take the user out of shared raids and duels.
+	if err := initializer.RegisterBeforeDeleteAccount(BeforeDeleteAccount); err != nil {
+		return err
+	}
+	if err := initializer.RegisterAfterDeleteAccount(AfterDeleteAccount); err != nil {
+		return err
+	}
 
-	//Custom RPCs if any.
+	//Offline time for idle rewards runs from the end of the player's last session until the next one starts.
+	if err := initializer.RegisterEventSessionStart(SessionStartEvent(nk)); err != nil {
+		return err
+	}
+	if err := initializer.RegisterEventSessionEnd(SessionEndEvent(nk)); err != nil {
+		return err
+	}
+
+	//Real time battles, the client joins the match returned by the battle_match rpc and sends attacks over the socket.
+	if err := initializer.RegisterMatch(BattleMatchModule, NewBattleMatch); err != nil {
+		return err
+	}
+
+	//Custom RPCs if any.  Combat rpcs are wrapped with a per user rate limit, see ratelimit.go.
 	//RPC to load game.  This will allow either enemy selection and enter a battle or finish an un-finished battle.
-	if err := initializer.RegisterRpc("load_game", LoadGameRPC()); err != nil {
+	if err := initializer.RegisterRpc("load_game", RateLimited("load_game", LoadGameRPC())); err != nil {
 		return err
 	}
 
 	//RPC to do attacks, successful hits return updated values.
-	if err := initializer.RegisterRpc("attack_target", AttackTargetRPC()); err != nil {
+	if err := initializer.RegisterRpc("attack_target", RateLimited("attack_target", AttackTargetRPC())); err != nil {
+		return err
+	}
+
+	//RPC to do several attacks in order with a single save, stops early when the player dies or the battle ends.
+	if err := initializer.RegisterRpc("attack_sequence", RateLimited("attack_sequence", AttackSequenceRPC())); err != nil {
+		return err
+	}
+
+	//RPCs to list the encounters and start a battle from one, or from the live-ops event pool without an encounter.
+	if err := initializer.RegisterRpc("list_encounters", ListEncountersRPC()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("start_battle", StartBattleRPC()); err != nil {
 		return err
 	}
 
-	//RPC to get player health, status effects, and the number of enemy TYPES the player has killed.
-	if err := initializer.RegisterRpc("player_info", PlayerInfoRPC()); err != nil {
+	//RPC to leave the current battle without a win, counted in the battle stats.
+	if err := initializer.RegisterRpc("flee_battle", FleeBattleRPC()); err != nil {
 		return err
 	}
+
+	//RPC to get the player's real time battle match, starting one if needed.
+	if err := initializer.RegisterRpc("battle_match", BattleMatchRPC()); err != nil {
+		return err
+	}
+
+	//RPCs for co-op raids, the party shares the enemies and rewards are split by damage done.
+	if err := initializer.RegisterRpc("join_raid", JoinRaidRPC()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("raid_info", RaidInfoRPC()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("raid_attack", RateLimited("raid_attack", RaidAttackRPC())); err != nil {
+		return err
+	}
+
+	//RPCs for turn based duels between players, challenges and turns are sent as notifications.
+	if err := initializer.RegisterRpc("challenge_duel", ChallengeDuelRPC()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("answer_duel", AnswerDuelRPC()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("duel_attack", DuelAttackRPC()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("duel_info", DuelInfoRPC()); err != nil {
+		return err
+	}
+	//Caller's rank on a leaderboard and the players around them.
+	if err := initializer.RegisterRpc("get_rankings", GetRankingsRPC()); err != nil {
+		return err
+	}
+	//Achievements with the player's progress, unlocks are sent as notifications.
+	if err := initializer.RegisterRpc("get_achievements", GetAchievementsRPC()); err != nil {
+		return err
+	}
+	//Enemy codex, entries reveal more as the player kills that enemy type.
+	if err := initializer.RegisterRpc("get_bestiary", GetBestiaryRPC()); err != nil {
+		return err
+	}
+
+	//RPCs for daily and weekly quests, progress comes from battle events.
+	if err := initializer.RegisterRpc("get_quests", GetQuestsRPC()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("claim_quest", ClaimQuestRPC()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("reroll_quest", RerollQuestRPC()); err != nil {
+		return err
+	}
+
+	//RPC to get player health, status effects, the battle stats and the idle rewards ready to claim.
+	if err := initializer.RegisterRpc("player_info", RateLimited("player_info", PlayerInfoRPC())); err != nil {
+		return err
+	}
+	//RPC to collect the rewards for offline time.
+	if err := initializer.RegisterRpc("claim_idle_rewards", ClaimIdleRewardsRPC()); err != nil {
+		return err
+	}
+
+	//RPC to use a consumable item on the player or a target.
+	if err := initializer.RegisterRpc("use_item", UseItemRPC()); err != nil {
+		return err
+	}
+
+	//RPCs to move gear between the inventory and equipment slots.
+	if err := initializer.RegisterRpc("equip_item", EquipItemRPC()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("unequip_item", UnequipItemRPC()); err != nil {
+		return err
+	}
+
+	//RPCs to see the attacks available to the player and pick which ones are in the loadout.
+	if err := initializer.RegisterRpc("list_attacks", ListAttacksRPC()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("set_loadout", SetLoadoutRPC()); err != nil {
+		return err
+	}
+
+	//RPCs to see the storefront and spend currencies on it.
+	if err := initializer.RegisterRpc("list_store", ListStoreRPC()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("purchase", PurchaseRPC()); err != nil {
+		return err
+	}
+
+	//RPC to export all of the game data held for the player.
+	if err := initializer.RegisterRpc("export_my_data", ExportMyDataRPC()); err != nil {
+		return err
+	}
+
+	//Tester tools, never registered in QA or Production.
+	if environment == Local || environment == Development {
+		//RPC to move a user's clock ahead to skip through status effects, cooldowns and resets.
+		if err := initializer.RegisterRpc("set_clock_offset", SetClockOffsetRPC()); err != nil {
+			return err
+		}
+	}
+	//Debug and cheat RPCs, never registered in Production.  They change the caller or the user_id in the payload.
+	if environment.DebugToolsEnabled() {
+		if err := initializer.RegisterRpc("debug_set_health", DebugSetHealthRPC()); err != nil {
+			return err
+		}
+		if err := initializer.RegisterRpc("debug_grant_currency", DebugGrantCurrencyRPC()); err != nil {
+			return err
+		}
+		if err := initializer.RegisterRpc("debug_spawn_enemy", DebugSpawnEnemyRPC()); err != nil {
+			return err
+		}
+		if err := initializer.RegisterRpc("debug_apply_status_effect", DebugApplyStatusEffectRPC()); err != nil {
+			return err
+		}
+		if err := initializer.RegisterRpc("debug_reset_player", DebugResetPlayerRPC()); err != nil {
+			return err
+		}
+		logger.Warn("Debug RPCs registered for the %s environment.", environment)
+	}
 	//@JWK TODO: Bonus, implement unit tests.
 
 	return nil
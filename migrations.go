@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"encoding/json"
+)
+
+// A single schema migration step working on the raw json object so old shapes can be read before the current structs.
+type Migration func(data map[string]interface{}) (map[string]interface{}, error)
+
+// Ordered migrations, the step at index i moves an object from schema version i to i+1.  Objects saved before
+// versioning have no schema_version and are treated as version 0.  Only ever append to these lists.
+var PlayerMigrations = []Migration{
+	MigratePlayerV0ToV1,
+	MigratePlayerV1ToV2,
+}
+var BattleStateMigrations = []Migration{
+	MigrateBattleStateV0ToV1,
+}
+var EnemyConfigMigrations = []Migration{
+	MigrateEnemyConfigV0ToV1,
+}
+
+// Current schema versions, written with every save.
+var PlayerSchemaVersion = len(PlayerMigrations)
+var BattleStateSchemaVersion = len(BattleStateMigrations)
+var EnemyConfigSchemaVersion = len(EnemyConfigMigrations)
+
+const schemaVersionKey = "schema_version"
+
+// This function runs every migration step from the object's schema version up to the current one.  Returns true if anything ran.
+func ApplyMigrations(data map[string]interface{}, migrations []Migration) (map[string]interface{}, bool, error) {
+	version := mapInt(data, schemaVersionKey)
+	if version > len(migrations) {
+		return nil, false, fmt.Errorf("schema version %d is newer than the supported version %d", version, len(migrations))
+	}
+	for v := version; v < len(migrations); v++ {
+		migrated, err := migrations[v](data)
+		if err != nil {
+			return nil, false, fmt.Errorf("schema migration %d to %d failed: %v", v, v+1, err)
+		}
+		data = migrated
+		data[schemaVersionKey] = v + 1
+	}
+	return data, version < len(migrations), nil
+}
+
+// This function migrates a stored player object, including the battle state that has its own schema version.
+func MigratePlayerData(raw string) (string, bool, error) {
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &data); err != nil {
+		return "", false, err
+	}
+	data, migrated, err := ApplyMigrations(data, PlayerMigrations)
+	if err != nil {
+		return "", false, err
+	}
+	//Battle state is versioned on its own.
+	battleState, ok := data["battle_state"].(map[string]interface{})
+	if !ok {
+		battleState = make(map[string]interface{})
+	}
+	battleState, battleMigrated, err := ApplyMigrations(battleState, BattleStateMigrations)
+	if err != nil {
+		return "", false, err
+	}
+	data["battle_state"] = battleState
+	if !migrated && !battleMigrated {
+		return raw, false, nil
+	}
+	out, err := json.Marshal(data)
+	if err != nil {
+		return "", false, err
+	}
+	return string(out), true, nil
+}
+
+// This function migrates the stored enemy configuration.
+func MigrateEnemyConfig(raw string) (string, bool, error) {
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &data); err != nil {
+		return "", false, err
+	}
+	data, migrated, err := ApplyMigrations(data, EnemyConfigMigrations)
+	if err != nil || !migrated {
+		return raw, false, err
+	}
+	out, err := json.Marshal(data)
+	if err != nil {
+		return "", false, err
+	}
+	return string(out), true, nil
+}
+
+// Player v0 -> v1: fill in max health, inventory, equipment, loadout and completed quests for saves from before they existed.
+func MigratePlayerV0ToV1(data map[string]interface{}) (map[string]interface{}, error) {
+	if mapInt(data, "max_health") <= 0 {
+		maxHealth := PlayerBaseHealth
+		if health := mapInt(data, "health"); health > maxHealth { //Don't let the cap sit below the current health.
+			maxHealth = health
+		}
+		data["max_health"] = maxHealth
+	}
+	if _, ok := data["inventory"].(map[string]interface{}); !ok {
+		data["inventory"] = map[string]interface{}{}
+	}
+	if _, ok := data["equipment"].(map[string]interface{}); !ok {
+		data["equipment"] = map[string]interface{}{}
+	}
+	if _, ok := data["completed_quests"].([]interface{}); !ok {
+		data["completed_quests"] = []interface{}{}
+	}
+	if _, ok := data["loadout"].([]interface{}); !ok {
+		player := Player{Level: mapInt(data, "level")}
+		data["loadout"] = player.DefaultLoadout()
+	}
+	return data, nil
+}
+
+// Player v1 -> v2: battle stats were only the kills by enemy type, move them into the stats object.
+func MigratePlayerV1ToV2(data map[string]interface{}) (map[string]interface{}, error) {
+	kills, _ := data["battle_stats"].(map[string]interface{})
+	if kills == nil {
+		kills = map[string]interface{}{}
+	}
+	total := 0
+	for _, count := range kills {
+		if n, ok := count.(float64); ok {
+			total += int(n)
+		}
+	}
+	data["battle_stats"] = map[string]interface{}{
+		"kills": kills,
+		"total_kills": total,
+	}
+	return data, nil
+}
+
+// Battle state v0 -> v1: fill in max health on enemies already in a battle.
+func MigrateBattleStateV0ToV1(data map[string]interface{}) (map[string]interface{}, error) {
+	enemies, _ := data["enemies"].(map[string]interface{})
+	for _, e := range enemies {
+		enemy, ok := e.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if mapInt(enemy, "max_health") <= 0 {
+			health := mapInt(enemy, "health")
+			maxHealth := GetEnemyMaxHealth(EnemyType(fmt.Sprint(enemy["type"])), health)
+			if health > maxHealth {
+				maxHealth = health
+			}
+			enemy["max_health"] = maxHealth
+		}
+	}
+	return data, nil
+}
+
+// Enemy config v0 -> v1: the enemies map was stored bare, wrap it so the object can carry a schema version and fill in max health.
+func MigrateEnemyConfigV0ToV1(data map[string]interface{}) (map[string]interface{}, error) {
+	enemies := make(map[string]interface{})
+	for key, e := range data {
+		if key == schemaVersionKey {
+			continue
+		}
+		enemy, ok := e.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unexpected enemy entry %s: %v", key, e)
+		}
+		if mapInt(enemy, "max_health") <= 0 {
+			enemy["max_health"] = mapInt(enemy, "health")
+		}
+		enemies[key] = enemy
+	}
+	return map[string]interface{}{"enemies": enemies}, nil
+}
+
+// This function reads a json number from a raw object, missing or non-numeric values are 0.
+func mapInt(data map[string]interface{}, key string) int {
+	switch v := data[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
+}
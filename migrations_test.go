@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestApplyMigrationsRunsFromStoredVersion(t *testing.T) {
+	var ran []int
+	step := func(n int) Migration {
+		return func(data map[string]interface{}) (map[string]interface{}, error) {
+			ran = append(ran, n)
+			return data, nil
+		}
+	}
+	migrations := []Migration{step(0), step(1), step(2)}
+
+	data, migrated, err := ApplyMigrations(map[string]interface{}{"schema_version": float64(1)}, migrations)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !migrated {
+		t.Fatalf("expected migration to run")
+	}
+	if len(ran) != 2 || ran[0] != 1 || ran[1] != 2 {
+		t.Fatalf("expected steps [1 2] to run, got %v", ran)
+	}
+	if mapInt(data, "schema_version") != 3 {
+		t.Fatalf("expected schema version 3, got %v", data["schema_version"])
+	}
+
+	//Already current.
+	ran = nil
+	_, migrated, err = ApplyMigrations(map[string]interface{}{"schema_version": float64(3)}, migrations)
+	if err != nil || migrated || len(ran) != 0 {
+		t.Fatalf("expected no migration, got migrated=%t ran=%v err=%v", migrated, ran, err)
+	}
+}
+
+func TestApplyMigrationsRejectsNewerVersion(t *testing.T) {
+	_, _, err := ApplyMigrations(map[string]interface{}{"schema_version": float64(5)}, []Migration{})
+	if err == nil {
+		t.Fatalf("expected an error for a schema version newer than the server")
+	}
+}
+
+func TestMigratePlayerV0ToV1(t *testing.T) {
+	InitAttackRegistry()
+	data := map[string]interface{}{
+		"id": "user",
+		"level": float64(1),
+		"health": float64(80),
+	}
+	data, err := MigratePlayerV0ToV1(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mapInt(data, "max_health") != PlayerBaseHealth {
+		t.Fatalf("expected max health %d, got %v", PlayerBaseHealth, data["max_health"])
+	}
+	if _, ok := data["inventory"].(map[string]interface{}); !ok {
+		t.Fatalf("expected an inventory, got %v", data["inventory"])
+	}
+	if _, ok := data["equipment"].(map[string]interface{}); !ok {
+		t.Fatalf("expected equipment, got %v", data["equipment"])
+	}
+	loadout, ok := data["loadout"].([]AttackType)
+	if !ok || len(loadout) == 0 {
+		t.Fatalf("expected a default loadout, got %v", data["loadout"])
+	}
+
+	//Health over the base keeps the player from being clamped down.
+	data, _ = MigratePlayerV0ToV1(map[string]interface{}{"health": float64(150)})
+	if mapInt(data, "max_health") != 150 {
+		t.Fatalf("expected max health 150, got %v", data["max_health"])
+	}
+}
+
+func TestMigratePlayerV1ToV2(t *testing.T) {
+	value, migrated, err := MigratePlayerData(`{"schema_version":1,"id":"user","battle_stats":{"zombie":3,"mutant":2}}`)
+	if err != nil || !migrated {
+		t.Fatalf("expected migration, got migrated=%t err=%v", migrated, err)
+	}
+	var player Player
+	if err := json.Unmarshal([]byte(value), &player); err != nil {
+		t.Fatalf("unable to unmarshal migrated player: %v", err)
+	}
+	if player.BattleStats.Kills[Zombie] != 3 || player.BattleStats.Kills[Mutant] != 2 || player.BattleStats.TotalKills != 5 {
+		t.Fatalf("unexpected migrated stats: %+v", player.BattleStats)
+	}
+}
+
+func TestMigrateBattleStateV0ToV1(t *testing.T) {
+	EnemyRegistry.Lock()
+	EnemyRegistry.Enemies = map[EnemyType]Enemy{Zombie: {Type: Zombie, Health: 50, MaxHealth: 50}}
+	EnemyRegistry.Unlock()
+
+	data := map[string]interface{}{
+		"enemies": map[string]interface{}{
+			"a": map[string]interface{}{"type": "zombie", "health": float64(20)},
+			"b": map[string]interface{}{"type": "unknown", "health": float64(30)},
+		},
+	}
+	data, err := MigrateBattleStateV0ToV1(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	enemies := data["enemies"].(map[string]interface{})
+	if got := mapInt(enemies["a"].(map[string]interface{}), "max_health"); got != 50 {
+		t.Fatalf("expected registry max health 50, got %d", got)
+	}
+	if got := mapInt(enemies["b"].(map[string]interface{}), "max_health"); got != 30 {
+		t.Fatalf("expected fallback max health 30, got %d", got)
+	}
+}
+
+func TestMigrateEnemyConfigV0ToV1(t *testing.T) {
+	raw := `{"zombie":{"type":"zombie","health":50},"beast":{"type":"beast","health":25,"max_health":30}}`
+	value, migrated, err := MigrateEnemyConfig(raw)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !migrated {
+		t.Fatalf("expected migration to run")
+	}
+	var config EnemyConfig
+	if err := json.Unmarshal([]byte(value), &config); err != nil {
+		t.Fatalf("unable to unmarshal migrated config: %v", err)
+	}
+	if config.SchemaVersion != EnemyConfigSchemaVersion {
+		t.Fatalf("expected schema version %d, got %d", EnemyConfigSchemaVersion, config.SchemaVersion)
+	}
+	if config.Enemies[Zombie].MaxHealth != 50 || config.Enemies[Beast].MaxHealth != 30 {
+		t.Fatalf("unexpected max health: %+v", config.Enemies)
+	}
+}
+
+func TestMigratePlayerDataLeavesCurrentSavesAlone(t *testing.T) {
+	InitAttackRegistry()
+	data, err := json.Marshal(NewPlayer("user", "name"))
+	if err != nil {
+		t.Fatalf("unable to marshal player: %v", err)
+	}
+	_, migrated, err := MigratePlayerData(string(data))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if migrated {
+		t.Fatalf("expected a new player to already be current")
+	}
+
+	//A save from before versioning is migrated, battle state included.
+	value, migrated, err := MigratePlayerData(`{"id":"user","level":1,"health":100,"battle_state":{"enemies":{}}}`)
+	if err != nil || !migrated {
+		t.Fatalf("expected migration, got migrated=%t err=%v", migrated, err)
+	}
+	var player Player
+	if err := json.Unmarshal([]byte(value), &player); err != nil {
+		t.Fatalf("unable to unmarshal migrated player: %v", err)
+	}
+	if player.SchemaVersion != PlayerSchemaVersion || player.BattleState.SchemaVersion != BattleStateSchemaVersion {
+		t.Fatalf("unexpected schema versions: %d %d", player.SchemaVersion, player.BattleState.SchemaVersion)
+	}
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// Logger that drops everything, used by tests.
+type testLogger struct{}
+
+func (l *testLogger) Debug(format string, v ...interface{}) {}
+func (l *testLogger) Info(format string, v ...interface{}) {}
+func (l *testLogger) Warn(format string, v ...interface{}) {}
+func (l *testLogger) Error(format string, v ...interface{}) {}
+func (l *testLogger) WithField(key string, v interface{}) runtime.Logger { return l }
+func (l *testLogger) WithFields(fields map[string]interface{}) runtime.Logger { return l }
+func (l *testLogger) Fields() map[string]interface{} { return map[string]interface{}{} }
+
+// Wallet ledger entry used by tests.
+type testLedgerItem struct {
+	id string
+	userID string
+	changeset map[string]int64
+}
+
+func (i *testLedgerItem) GetID() string { return i.id }
+func (i *testLedgerItem) GetUserID() string { return i.userID }
+func (i *testLedgerItem) GetCreateTime() int64 { return 0 }
+func (i *testLedgerItem) GetUpdateTime() int64 { return 0 }
+func (i *testLedgerItem) GetChangeset() map[string]int64 { return i.changeset }
+func (i *testLedgerItem) GetMetadata() map[string]interface{} { return map[string]interface{}{} }
+
+// In memory stand in for the parts of the Nakama module the game uses.  Calling anything else panics on the nil embedded interface.
+type testNakama struct {
+	runtime.NakamaModule
+	sync.Mutex
+	objects map[string]*api.StorageObject
+	ledger []runtime.WalletLedgerItem
+	versions int
+	leaderboards map[string]string //Operator by leaderboard id.
+	scores map[string]map[string]int64 //Scores by leaderboard id then owner id.
+	notifications []*runtime.NotificationSend
+	deletedUsers map[string]bool //Accounts AccountsGetId doesn't find, every other id exists.
+	matches map[string]string //Signal last sent by match id, running matches only.
+	onMatchCreate func() //Runs before a match is created, lets tests race another caller.
+	parties map[string][]string //User ids on each party stream by subject.
+	groups map[string][]string //Names of the groups each user is a member of, by user id.
+	displayNames map[string]string //Set by AccountUpdateId, until then accounts only have a username.
+}
+
+// Presence for a user, only the user id is filled in.
+type testPresence struct {
+	runtime.Presence
+	userID string
+}
+
+func (p *testPresence) GetUserId() string { return p.userID }
+
+func newTestNakama() *testNakama {
+	return &testNakama{
+		objects: make(map[string]*api.StorageObject),
+		leaderboards: make(map[string]string),
+		scores: make(map[string]map[string]int64),
+	}
+}
+
+func testStorageKey(collection, key, userID string) string {
+	return collection + "/" + key + "/" + userID
+}
+
+func (nk *testNakama) StorageRead(ctx context.Context, reads []*runtime.StorageRead) ([]*api.StorageObject, error) {
+	nk.Lock()
+	defer nk.Unlock()
+	var objects []*api.StorageObject
+	for _, read := range reads {
+		if object, exists := nk.objects[testStorageKey(read.Collection, read.Key, read.UserID)]; exists {
+			objects = append(objects, object)
+		}
+	}
+	return objects, nil
+}
+
+func (nk *testNakama) StorageWrite(ctx context.Context, writes []*runtime.StorageWrite) ([]*api.StorageObjectAck, error) {
+	nk.Lock()
+	defer nk.Unlock()
+	//Check every version first so the batch is all or nothing like the real storage engine.
+	for _, write := range writes {
+		existing, exists := nk.objects[testStorageKey(write.Collection, write.Key, write.UserID)]
+		if write.Version == "*" && exists {
+			return nil, fmt.Errorf("storage write rejected, object exists: %s/%s", write.Collection, write.Key)
+		}
+		if write.Version != "" && write.Version != "*" && (!exists || existing.Version != write.Version) {
+			return nil, fmt.Errorf("storage write rejected, version mismatch: %s/%s", write.Collection, write.Key)
+		}
+	}
+	var acks []*api.StorageObjectAck
+	for _, write := range writes {
+		nk.versions++
+		version := strconv.Itoa(nk.versions)
+		nk.objects[testStorageKey(write.Collection, write.Key, write.UserID)] = &api.StorageObject{
+			Collection: write.Collection,
+			Key: write.Key,
+			UserId: write.UserID,
+			Value: write.Value,
+			Version: version,
+			PermissionRead: int32(write.PermissionRead),
+			PermissionWrite: int32(write.PermissionWrite),
+		}
+		acks = append(acks, &api.StorageObjectAck{Collection: write.Collection, Key: write.Key, UserId: write.UserID, Version: version})
+	}
+	return acks, nil
+}
+
+func (nk *testNakama) StorageList(ctx context.Context, callerID, userID, collection string, limit int, cursor string) ([]*api.StorageObject, string, error) {
+	nk.Lock()
+	defer nk.Unlock()
+	var keys []string
+	for key, object := range nk.objects {
+		if object.Collection == collection && (userID == "" || object.UserId == userID) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	//The cursor is the index to start from.
+	start, _ := strconv.Atoi(cursor)
+	var objects []*api.StorageObject
+	for i := start; i < len(keys) && len(objects) < limit; i++ {
+		objects = append(objects, nk.objects[keys[i]])
+	}
+	nextCursor := ""
+	if start+len(objects) < len(keys) {
+		nextCursor = strconv.Itoa(start + len(objects))
+	}
+	return objects, nextCursor, nil
+}
+
+func (nk *testNakama) StorageDelete(ctx context.Context, deletes []*runtime.StorageDelete) error {
+	nk.Lock()
+	defer nk.Unlock()
+	for _, d := range deletes {
+		delete(nk.objects, testStorageKey(d.Collection, d.Key, d.UserID))
+	}
+	return nil
+}
+
+func (nk *testNakama) MultiUpdate(ctx context.Context, accountUpdates []*runtime.AccountUpdate, storageWrites []*runtime.StorageWrite, storageDeletes []*runtime.StorageDelete, walletUpdates []*runtime.WalletUpdate, updateLedger bool) ([]*api.StorageObjectAck, []*runtime.WalletUpdateResult, error) {
+	if len(accountUpdates) > 0 || len(walletUpdates) > 0 {
+		return nil, nil, fmt.Errorf("multi update only fakes storage changes")
+	}
+	//Deletes can't fail here, so the writes going first keeps the batch all or nothing.
+	acks, err := nk.StorageWrite(ctx, storageWrites)
+	if err != nil {
+		return nil, nil, err
+	}
+	return acks, nil, nk.StorageDelete(ctx, storageDeletes)
+}
+
+func (nk *testNakama) AccountsGetId(ctx context.Context, userIDs []string) ([]*api.Account, error) {
+	nk.Lock()
+	defer nk.Unlock()
+	var accounts []*api.Account
+	for _, userID := range userIDs {
+		if !nk.deletedUsers[userID] {
+			accounts = append(accounts, &api.Account{User: &api.User{Id: userID, Username: "user_" + userID, DisplayName: nk.displayNames[userID]}})
+		}
+	}
+	return accounts, nil
+}
+
+func (nk *testNakama) AccountGetId(ctx context.Context, userID string) (*api.Account, error) {
+	accounts, _ := nk.AccountsGetId(ctx, []string{userID})
+	if len(accounts) == 0 {
+		return nil, fmt.Errorf("account not found")
+	}
+	return accounts[0], nil
+}
+
+func (nk *testNakama) AccountUpdateId(ctx context.Context, userID, username string, metadata map[string]interface{}, displayName, timezone, location, langTag, avatarUrl string) error {
+	nk.Lock()
+	defer nk.Unlock()
+	if nk.displayNames == nil {
+		nk.displayNames = make(map[string]string)
+	}
+	nk.displayNames[userID] = displayName
+	return nil
+}
+
+func (nk *testNakama) MatchCreate(ctx context.Context, module string, params map[string]interface{}) (string, error) {
+	if nk.onMatchCreate != nil {
+		onMatchCreate := nk.onMatchCreate
+		nk.onMatchCreate = nil
+		onMatchCreate()
+	}
+	nk.Lock()
+	defer nk.Unlock()
+	if nk.matches == nil {
+		nk.matches = make(map[string]string)
+	}
+	matchID := UtilMakeUUID() + "."
+	nk.matches[matchID] = ""
+	return matchID, nil
+}
+
+func (nk *testNakama) MatchGet(ctx context.Context, id string) (*api.Match, error) {
+	nk.Lock()
+	defer nk.Unlock()
+	if _, exists := nk.matches[id]; !exists {
+		return nil, nil
+	}
+	return &api.Match{MatchId: id, Authoritative: true}, nil
+}
+
+func (nk *testNakama) MatchSignal(ctx context.Context, id string, data string) (string, error) {
+	nk.Lock()
+	defer nk.Unlock()
+	if _, exists := nk.matches[id]; !exists {
+		return "", runtime.ErrMatchNotFound
+	}
+	nk.matches[id] = data
+	return "", nil
+}
+
+// This function puts the users in a new party, returning the party id.
+func (nk *testNakama) testParty(userIDs ...string) string {
+	nk.Lock()
+	defer nk.Unlock()
+	if nk.parties == nil {
+		nk.parties = make(map[string][]string)
+	}
+	subject := UtilMakeUUID()
+	nk.parties[subject] = userIDs
+	return subject + ".testnode"
+}
+
+func (nk *testNakama) StreamUserList(mode uint8, subject, subcontext, label string, includeHidden, includeNotHidden bool) ([]runtime.Presence, error) {
+	nk.Lock()
+	defer nk.Unlock()
+	presences := []runtime.Presence{}
+	if mode != StreamModeParty {
+		return presences, nil
+	}
+	for _, userID := range nk.parties[subject] {
+		presences = append(presences, &testPresence{userID: userID})
+	}
+	return presences, nil
+}
+
+func (nk *testNakama) UserGroupsList(ctx context.Context, userID string, limit int, state *int, cursor string) ([]*api.UserGroupList_UserGroup, string, error) {
+	nk.Lock()
+	defer nk.Unlock()
+	groups := []*api.UserGroupList_UserGroup{}
+	for _, name := range nk.groups[userID] {
+		groups = append(groups, &api.UserGroupList_UserGroup{
+			Group: &api.Group{Name: name},
+			State: wrapperspb.Int32(int32(api.UserGroupList_UserGroup_MEMBER)),
+		})
+	}
+	return groups, "", nil
+}
+
+func (nk *testNakama) WalletLedgerList(ctx context.Context, userID string, limit int, cursor string) ([]runtime.WalletLedgerItem, string, error) {
+	var items []runtime.WalletLedgerItem
+	for _, item := range nk.ledger {
+		if item.GetUserID() == userID {
+			items = append(items, item)
+		}
+	}
+	return items, "", nil
+}
+
+func (nk *testNakama) LeaderboardCreate(ctx context.Context, id string, authoritative bool, sortOrder, operator, resetSchedule string, metadata map[string]interface{}, enableRanks bool) error {
+	nk.Lock()
+	defer nk.Unlock()
+	if _, exists := nk.leaderboards[id]; !exists {
+		nk.leaderboards[id] = operator
+		nk.scores[id] = make(map[string]int64)
+	}
+	return nil
+}
+
+func (nk *testNakama) LeaderboardRecordWrite(ctx context.Context, id, ownerID, username string, score, subscore int64, metadata map[string]interface{}, overrideOperator *int) (*api.LeaderboardRecord, error) {
+	nk.Lock()
+	defer nk.Unlock()
+	operator, exists := nk.leaderboards[id]
+	if !exists {
+		return nil, runtime.ErrLeaderboardNotFound
+	}
+	switch {
+	case operator == "incr":
+		nk.scores[id][ownerID] += score
+	case score > nk.scores[id][ownerID]:
+		nk.scores[id][ownerID] = score
+	}
+	return &api.LeaderboardRecord{LeaderboardId: id, OwnerId: ownerID, Score: nk.scores[id][ownerID]}, nil
+}
+
+// Every record on a leaderboard ranked highest score first.
+func (nk *testNakama) testLeaderboardRecords(id string) []*api.LeaderboardRecord {
+	var records []*api.LeaderboardRecord
+	for ownerID, score := range nk.scores[id] {
+		records = append(records, &api.LeaderboardRecord{LeaderboardId: id, OwnerId: ownerID, Score: score})
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Score == records[j].Score {
+			return records[i].OwnerId < records[j].OwnerId
+		}
+		return records[i].Score > records[j].Score
+	})
+	for i, record := range records {
+		record.Rank = int64(i + 1)
+	}
+	return records
+}
+
+func (nk *testNakama) LeaderboardRecordsList(ctx context.Context, id string, ownerIDs []string, limit int, cursor string, expiry int64) ([]*api.LeaderboardRecord, []*api.LeaderboardRecord, string, string, error) {
+	nk.Lock()
+	defer nk.Unlock()
+	if _, exists := nk.leaderboards[id]; !exists {
+		return nil, nil, "", "", runtime.ErrLeaderboardNotFound
+	}
+	all := nk.testLeaderboardRecords(id)
+	var records, ownerRecords []*api.LeaderboardRecord
+	for _, record := range all {
+		if len(records) < limit {
+			records = append(records, record)
+		}
+		for _, ownerID := range ownerIDs {
+			if record.OwnerId == ownerID {
+				ownerRecords = append(ownerRecords, record)
+			}
+		}
+	}
+	return records, ownerRecords, "", "", nil
+}
+
+func (nk *testNakama) LeaderboardRecordsHaystack(ctx context.Context, id, ownerID string, limit int, cursor string, expiry int64) (*api.LeaderboardRecordList, error) {
+	nk.Lock()
+	defer nk.Unlock()
+	all := nk.testLeaderboardRecords(id)
+	//Center the page on the owner as far as the ends of the board allow.
+	start := 0
+	for i, record := range all {
+		if record.OwnerId == ownerID {
+			start = i - limit/2
+		}
+	}
+	if start > len(all)-limit {
+		start = len(all) - limit
+	}
+	if start < 0 {
+		start = 0
+	}
+	end := start + limit
+	if end > len(all) {
+		end = len(all)
+	}
+	return &api.LeaderboardRecordList{Records: all[start:end]}, nil
+}
+
+func (nk *testNakama) NotificationSend(ctx context.Context, userID, subject string, content map[string]interface{}, code int, sender string, persistent bool) error {
+	nk.Lock()
+	defer nk.Unlock()
+	nk.notifications = append(nk.notifications, &runtime.NotificationSend{
+		UserID: userID,
+		Subject: subject,
+		Content: content,
+		Code: code,
+		Sender: sender,
+		Persistent: persistent,
+	})
+	return nil
+}
+
+// Context carrying a user id the way the runtime passes it to rpcs and hooks.
+func testUserContext(userID string) context.Context {
+	return context.WithValue(context.Background(), runtime.RUNTIME_CTX_USER_ID, userID)
+}
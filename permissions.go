@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"context"
+	"database/sql"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const permissionMigrationPageSize = 100 //Objects listed per page while fixing permissions at startup.
+
+// Collections that only the runtime is allowed to write to.
+var serverOnlyStorageCollections = map[string]bool{
+	playerDataStorageCollection: true,
+	configDataStorageCollection: true,
+	rateLimitStorageCollection: true,
+	raidStorageCollection: true,
+	duelStorageCollection: true,
+}
+
+// Before hook that rejects client writes to the collections this module owns.  Runtime writes don't go through this hook.
+func BeforeWriteStorageObjects(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, in *api.WriteStorageObjectsRequest) (*api.WriteStorageObjectsRequest, error) {
+	for _, object := range in.GetObjects() {
+		if serverOnlyStorageCollections[object.GetCollection()] {
+			userID, _ := UtilGetUserId(ctx)
+			//More robust logging to get more info.
+			logger.WithFields(map[string]interface{}{
+				"userID": userID,
+				"collection": object.GetCollection(),
+				"key": object.GetKey(),
+			}).Warn("Rejected client write to a server only collection.")
+			return nil, NewGameError(CodePermissionDenied, ReasonPermissionDenied, fmt.Sprintf("Writing to collection is not allowed: %s", object.GetCollection()))
+		}
+	}
+	return in, nil
+}
+
+// This function rewrites any player objects that were saved with client write permission so only the runtime can write them.
+func MigrateStoragePermissions(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) error {
+	fixed := 0
+	cursor := ""
+	for {
+		//An empty user id lists the objects of every user.
+		objects, nextCursor, err := nk.StorageList(ctx, "", "", playerDataStorageCollection, permissionMigrationPageSize, cursor)
+		if err != nil {
+			return fmt.Errorf("failed to list player data for permission migration: %v", err)
+		}
+		var wObj []*runtime.StorageWrite
+		for _, object := range objects {
+			if object.PermissionWrite == 0 {
+				continue
+			}
+			wObj = append(wObj, &runtime.StorageWrite{
+				Collection: object.Collection,
+				Key: object.Key,
+				UserID: object.UserId,
+				Value: object.Value,
+				Version: object.Version, //Skip it if a player saved in the meantime, that save already fixed it.
+				PermissionRead: int(object.PermissionRead),
+				PermissionWrite: 0, // No one can write save the runtime.
+			})
+		}
+		//Write one at a time so a single version conflict doesn't stop the rest.
+		for _, w := range wObj {
+			if _, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{w}); err != nil {
+				logger.Warn("Unable to fix permissions for %s/%s/%s: %v", w.Collection, w.Key, w.UserID, err)
+				continue
+			}
+			fixed++
+		}
+		if nextCursor == "" {
+			break
+		}
+		cursor = nextCursor
+	}
+	logger.Info("Storage permission migration fixed %d objects.", fixed)
+	return nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/api"
+)
+
+func TestBeforeWriteStorageObjectsRejectsServerCollections(t *testing.T) {
+	ctx := testUserContext(UtilMakeUUID())
+	for collection := range serverOnlyStorageCollections {
+		in := &api.WriteStorageObjectsRequest{Objects: []*api.WriteStorageObject{
+			{Collection: "client_settings", Key: "audio", Value: "{}"},
+			{Collection: collection, Key: PlayerDataStorageKey, Value: "{}"},
+		}}
+		out, err := BeforeWriteStorageObjects(ctx, &testLogger{}, nil, nil, in)
+		if out != nil {
+			t.Fatalf("%s: expected the whole write to be rejected", collection)
+		}
+		if code, body := testErrorBody(t, err); code != CodePermissionDenied || body.Reason != ReasonPermissionDenied {
+			t.Fatalf("%s: expected permission denied, got %d %+v", collection, code, body)
+		}
+	}
+
+	//Collections the module doesn't own pass through untouched.
+	in := &api.WriteStorageObjectsRequest{Objects: []*api.WriteStorageObject{{Collection: "client_settings", Key: "audio", Value: "{}"}}}
+	out, err := BeforeWriteStorageObjects(ctx, &testLogger{}, nil, nil, in)
+	if err != nil || out != in {
+		t.Fatalf("expected the client collection write to pass, got %v: %v", out, err)
+	}
+}
@@ -3,79 +3,126 @@ package main
 import (
 	"fmt"
 	"context"
-	"time"
 	"encoding/json"
+	"github.com/heroiclabs/nakama-common/api"
 	"github.com/heroiclabs/nakama-common/runtime"
 )
 
 var playerDataStorageCollection = "data" //This is the collection name for all of the player related data.
 var PlayerDataStorageKey = "player"
 
+const PlayerBaseHealth = 100 //Starting and max health pool for a new player.
+const ExperiencePerLevel = 250 //Experience needed for each level, used to gate attack unlocks.
+const StarterGold = 100 //Gold granted to a new player.
+const StarterGems = 5 //Gems granted to a new player.
+
 // Player data structure.
 type Player struct {
+	SchemaVersion int `json:"schema_version"` //Stored data layout version, see migrations.go.
 	ID string `json:"id"` //Nakama user id.
 	DisplayName string `json:"display_name"`
 	Level int `json:"level"`
 	Experience int64 `json:"experience"`
 	Health int `json:"health"`
+	MaxHealth int `json:"max_health"` //Health pool cap, healing can't exceed this value.
 	Currencies []Currency `json:"currency"` //Nakama supports a wallet that can be implemented at a later time.
 	StatusEffects []*StatusEffect `json:"status_effects"` //Used to store player state modifiers.
 	BattleState BattleState `json:"battle_state"` //Used to store the battle game state.
-	BattleStats map[EnemyType]int `json:"battle_stats"` //Used to store the number of enemies vanquished.  @JWK TODO: Expound upon this to include other stats.
+	BattleStats BattleStats `json:"battle_stats"` //Kills, deaths, damage and more, see stats.go.
+	CodexRewards map[string]int64 `json:"codex_rewards"` //When codex rewards were granted by enemy type, see bestiary.go.
+	Inventory map[ItemType]int `json:"inventory"` //Item counts, capped by the item's stack size.
+	Equipment map[EquipmentSlot]ItemType `json:"equipment"` //Equipped gear by slot, modifies combat stats.
+	Loadout []AttackType `json:"loadout"` //Attacks the player can use in battle.
+	CompletedQuests []string `json:"completed_quests"` //Quest ids used for unlock requirements.
 	Attributes map[string]interface{} `json:"attributes"` //Key-Value map for addional data as needed.
+	RegenAt int64 `json:"regen_at"` //Last health regen tick, see idle.go.
+	IdleSeconds int64 `json:"idle_seconds"` //Offline time banked for idle rewards.
+	OfflineSince int64 `json:"offline_since"` //When the player's last session ended, 0 while online.  See idle.go.
+	SessionTracked bool `json:"session_tracked,omitempty"` //Set by the first socket session event, until then offline time runs from the last save.
 	CreatedAt int64 `json:"created_at"`
 	UpdatedAt int64 `json:"updated_at"`
+	version string //Storage version hash from the last read/write, used to reject overwrites from concurrent requests.
+	events []BattleEvent //Queued by combat until the player is saved, see ProcessBattleEvents.
 }
 
 // Used to setup the player data when one isn't found for the user in storage.
 func NewPlayer(userID, displayerName string) *Player {
-	return &Player{
+	player := &Player{
+		SchemaVersion: PlayerSchemaVersion,
 		ID: userID,
 		DisplayName: displayerName,
 		Level: 1,
 		Experience: 0,
-		Health: 100,
+		Health: PlayerBaseHealth,
+		MaxHealth: PlayerBaseHealth,
 		Currencies: []Currency{
-			{Type: Gold, Amount: 0, },
-			{Type: Gems, Amount: 0, },
+			{Type: Gold, Amount: StarterGold, },
+			{Type: Gems, Amount: StarterGems, },
 		},
 		StatusEffects: []*StatusEffect{},
-		BattleState: BattleState{},
-		BattleStats: make(map[EnemyType]int),
+		BattleState: BattleState{SchemaVersion: BattleStateSchemaVersion},
+		BattleStats: NewBattleStats(),
+		CodexRewards: make(map[string]int64),
+		Inventory: make(map[ItemType]int),
+		Equipment: make(map[EquipmentSlot]ItemType),
+		CompletedQuests: []string{},
 		Attributes: make(map[string]interface{}),
-		CreatedAt: time.Now().Unix(),
-		UpdatedAt: time.Now().Unix(),
+		RegenAt: UserNow(userID).Unix(),
+		CreatedAt: UserNow(userID).Unix(),
+		UpdatedAt: UserNow(userID).Unix(),
 	}
+	player.Loadout = player.DefaultLoadout()
+	return player
 }
 
-// This function saves the player data to nakama storage.
+// This function builds the storage write for the player data so it can be batched with other objects in one transaction.
 // See https://heroiclabs.com/docs/nakama/concepts/storage/permissions/ for information on public read/write permissions or other storage information.
-// @JWK TODO: Implement saving only if there is dirty data.
-func (p *Player) SavePlayerData(nk runtime.NakamaModule) error {
-	p.UpdatedAt = time.Now().Unix()
+func (p *Player) PlayerStorageWrite() (*runtime.StorageWrite, error) {
+	p.UpdatedAt = p.Now().Unix()
+	//Anything loaded has already been migrated so it is saved as the current layout.
+	p.SchemaVersion = PlayerSchemaVersion
+	p.BattleState.SchemaVersion = BattleStateSchemaVersion
 	//Json-ify the player struct in prepartion for storage.
 	data, err := json.Marshal(p)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	wObj := []*runtime.StorageWrite{
-		{
-			Collection: playerDataStorageCollection,
-			Key: PlayerDataStorageKey,
-			UserID: p.ID, 
-			Value: string(data),
-			PermissionRead: 1, // Owner and runtime can read.
-			PermissionWrite: 1, // Owner and runtime can read.
-		},
+	return &runtime.StorageWrite{
+		Collection: playerDataStorageCollection,
+		Key: PlayerDataStorageKey,
+		UserID: p.ID, 
+		Value: string(data),
+		Version: p.version, //From the last read/write ("*" for new players) so the write fails if someone else saved first.
+		PermissionRead: 1, // Owner and runtime can read.
+		PermissionWrite: 0, // No one can write save the runtime.
+	}, nil
+}
+
+// This function saves the player data to nakama storage.
+// @JWK TODO: Implement saving only if there is dirty data.
+func (p *Player) SavePlayerData(nk runtime.NakamaModule) error {
+	wObj, err := p.PlayerStorageWrite()
+	if err != nil {
+		return err
 	}
 	//Write to the storage engine.
-	//@JWK TODO: On load need to grab the version hash and use that to validate when saving to prevent overwrites.
-	if _, err := nk.StorageWrite(context.Background(), wObj); err != nil {
+	acks, err := nk.StorageWrite(context.Background(), []*runtime.StorageWrite{wObj})
+	if err != nil {
 		return fmt.Errorf("failed to write player data to storage: %v", err)
 	}
+	p.SetStorageVersion(acks)
 	return nil
 }
 
+// This function keeps the storage version current after a write so the player can be saved again.
+func (p *Player) SetStorageVersion(acks []*api.StorageObjectAck) {
+	for _, ack := range acks {
+		if ack.Collection == playerDataStorageCollection && ack.Key == PlayerDataStorageKey && ack.UserId == p.ID {
+			p.version = ack.Version
+		}
+	}
+}
+
 // This function gets the player data from nakama storage.
 func LoadPlayerData(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID string) (*Player, error) {
 	//Read from the storage engine.
@@ -90,45 +137,73 @@ func LoadPlayerData(ctx context.Context, logger runtime.Logger, nk runtime.Nakam
 		return nil, err
 	}
 	if len(rObj) == 0 {
-		//Get the users account data to get a display name.
-		accounts, err := nk.AccountsGetId(ctx, []string{userID})
-		if err != nil {
-			//More robust logging to get more info.
-			logger.WithFields(map[string]interface{}{
-				"userID": userID,
-			}).Error("Unable to lookup account due to error: %v.", err)
-			return nil, err
-		}
-		if len(accounts) != 1 {
-			//More robust logging to get more info.
-			logger.WithFields(map[string]interface{}{
-				"userID": userID,
-			}).Error("Found either no account or more than one.")
-			return nil, err
-		}
-		//Set the display name from the users account data.
-		displayName := accounts[0].User.DisplayName
-		if displayName == "" {  //This is often empty as it requies a separate call to set.
-			displayName = accounts[0].User.Username
-		}
-		//Create new player object.
-		player := NewPlayer(userID, displayName)
-		return player, nil
+		//Fallback for accounts from before the authentication hooks, the player is normally created on first login.
+		logger.WithFields(map[string]interface{}{
+			"userID": userID,
+		}).Warn("No player data found, creating it.")
+		return CreatePlayer(ctx, logger, nk, userID)
+	}
+	//Bring older saves up to the current layout.
+	value, migrated, err := MigratePlayerData(rObj[0].Value)
+	if err != nil {
+		logger.WithFields(map[string]interface{}{
+			"userID": userID,
+		}).Error("Unable to migrate player data: %v.", err)
+		return nil, err
 	}
 	var player Player
 	//Unmarshal json data to player object.
-	if err = json.Unmarshal([]byte(rObj[0].Value), &player); err != nil {
+	if err = json.Unmarshal([]byte(value), &player); err != nil {
 		return nil, err
 	}
+	player.version = rObj[0].Version
+	player.BattleStats.ensureMaps()
+	//Catch up on health regen since the last save and idle time since the last session.
+	player.ApplyOfflineProgress(player.Now().Unix())
+	//Write migrated data back so it only has to happen once.
+	if migrated {
+		logger.Info("Migrated player data for %s to schema version %d.", userID, PlayerSchemaVersion)
+		if err := player.SavePlayerData(nk); err != nil {
+			logger.Error("Unable to save migrated player data: %v", err)
+			return nil, err
+		}
+	}
 	return &player, nil
 }
 
+// This function levels the player up based on the experience earned.
+func (p *Player) CheckLevelUp() bool {
+	level := int(p.Experience / ExperiencePerLevel) + 1
+	if level <= p.Level {
+		return false
+	}
+	p.Level = level
+	p.SetBattleEvent(BattleEvent{
+		Event: EventLevelUp,
+		Value: level,
+	})
+	return true
+}
+
 // Interface function to get health.
 func (p *Player) GetHealth() int {
 	return p.Health
 }
 
-// Interface function to set health.
+// Interface function to set health.  Healing is clamped to the max health.
 func (p *Player) SetHealth(health int) {
+	if p.MaxHealth > 0 && health > p.MaxHealth {
+		health = p.MaxHealth
+	}
 	p.Health = health
+}
+
+// Interface function to get max health.
+func (p *Player) GetMaxHealth() int {
+	return p.MaxHealth
+}
+
+// Interface function to set max health.
+func (p *Player) SetMaxHealth(maxHealth int) {
+	p.MaxHealth = maxHealth
 }
\ No newline at end of file
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"fmt"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const privacyPageSize = 100 //Objects and ledger items read per page while exporting or deleting.
+
+// Collections holding per user objects owned by this module.  Anything stored per user must live in one of these so
+// it is exported and deleted with the account.
+var userDataStorageCollections = []string{
+	playerDataStorageCollection,
+	rateLimitStorageCollection,
+}
+
+// Per user objects in the player data collection that hold progress kept apart from the player.  A debug reset deletes
+// them with the player so the new character starts from nothing.
+var playerProgressStorageKeys = []string{
+	AchievementStorageKey,
+	QuestStorageKey,
+	RatingStorageKey,
+	BattleMatchStorageKey,
+	RequestLogStorageKey,
+}
+
+// Collections shared between users, owned by the system user.  They keep user ids in their values so deleted users are
+// taken out of them by RemoveUsersFromSharedData.
+var sharedDataStorageCollections = []string{
+	raidStorageCollection,
+	duelStorageCollection,
+}
+
+// Exported wallet ledger entry.
+type WalletLedgerExport struct {
+	ID string `json:"id"`
+	Changeset map[string]int64 `json:"changeset"`
+	Metadata map[string]interface{} `json:"metadata"`
+	CreateTime int64 `json:"create_time"`
+	UpdateTime int64 `json:"update_time"`
+}
+
+// Exported storage object.
+type StorageObjectExport struct {
+	Collection string `json:"collection"`
+	Key string `json:"key"`
+	Value json.RawMessage `json:"value"`
+	CreateTime int64 `json:"create_time"`
+	UpdateTime int64 `json:"update_time"`
+}
+
+// Everything the module holds for a user in one document.
+type PlayerDataExport struct {
+	UserID string `json:"user_id"`
+	ExportedAt int64 `json:"exported_at"`
+	Player *Player `json:"player"`
+	BattleStats BattleStats `json:"battle_stats"`
+	Currencies []Currency `json:"currency"`
+	WalletLedger []*WalletLedgerExport `json:"wallet_ledger"`
+	PurchaseHistory *PlayerStore `json:"purchase_history"`
+	StorageObjects []*StorageObjectExport `json:"storage_objects"` //Raw copy of every object stored for the user, including history.
+}
+
+// This function gathers all of the game data held for a user.  Nothing is written, older saves are migrated in memory only.
+func ExportPlayerData(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID string) (*PlayerDataExport, error) {
+	export := &PlayerDataExport{
+		UserID: userID,
+		ExportedAt: UserNow(userID).Unix(),
+		WalletLedger: []*WalletLedgerExport{},
+		StorageObjects: []*StorageObjectExport{},
+	}
+
+	//Every object the module stores for the user.
+	for _, collection := range userDataStorageCollections {
+		cursor := ""
+		for {
+			objects, nextCursor, err := nk.StorageList(ctx, "", userID, collection, privacyPageSize, cursor)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list %s for export: %v", collection, err)
+			}
+			for _, object := range objects {
+				export.StorageObjects = append(export.StorageObjects, &StorageObjectExport{
+					Collection: object.Collection,
+					Key: object.Key,
+					Value: json.RawMessage(object.Value),
+					CreateTime: object.GetCreateTime().GetSeconds(),
+					UpdateTime: object.GetUpdateTime().GetSeconds(),
+				})
+				if collection != playerDataStorageCollection {
+					continue
+				}
+				switch object.Key {
+				case PlayerDataStorageKey:
+					value, _, err := MigratePlayerData(object.Value)
+					if err != nil {
+						return nil, err
+					}
+					var player Player
+					if err := json.Unmarshal([]byte(value), &player); err != nil {
+						return nil, err
+					}
+					export.Player = &player
+					export.BattleStats = player.BattleStats
+					export.Currencies = player.Currencies
+				case PlayerStoreStorageKey:
+					var store PlayerStore
+					if err := json.Unmarshal([]byte(object.Value), &store); err != nil {
+						return nil, err
+					}
+					export.PurchaseHistory = &store
+				}
+			}
+			if nextCursor == "" {
+				break
+			}
+			cursor = nextCursor
+		}
+	}
+
+	//Wallet ledger.
+	cursor := ""
+	for {
+		items, nextCursor, err := nk.WalletLedgerList(ctx, userID, privacyPageSize, cursor)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list wallet ledger for export: %v", err)
+		}
+		for _, item := range items {
+			export.WalletLedger = append(export.WalletLedger, &WalletLedgerExport{
+				ID: item.GetID(),
+				Changeset: item.GetChangeset(),
+				Metadata: item.GetMetadata(),
+				CreateTime: item.GetCreateTime(),
+				UpdateTime: item.GetUpdateTime(),
+			})
+		}
+		if nextCursor == "" {
+			break
+		}
+		cursor = nextCursor
+	}
+
+	logger.Debug("Exported %d storage objects and %d ledger items for %s.", len(export.StorageObjects), len(export.WalletLedger), userID)
+	return export, nil
+}
+
+// This function removes every object the module stores for a user.
+func DeletePlayerData(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID string) error {
+	deleted := 0
+	for _, collection := range userDataStorageCollections {
+		lastFirstKey, lastCount := "", 0
+		for {
+			//Always read the first page, the previous page is gone once it is deleted.
+			objects, _, err := nk.StorageList(ctx, "", userID, collection, privacyPageSize, "")
+			if err != nil {
+				return fmt.Errorf("failed to list %s for deletion: %v", collection, err)
+			}
+			if len(objects) == 0 {
+				break
+			}
+			//A page that comes back the same means the deletes aren't landing, stop instead of looping forever.
+			if objects[0].Key == lastFirstKey && len(objects) == lastCount {
+				return fmt.Errorf("failed to delete %s: no progress after deleting %d objects", collection, deleted)
+			}
+			lastFirstKey, lastCount = objects[0].Key, len(objects)
+			var dObj []*runtime.StorageDelete
+			for _, object := range objects {
+				dObj = append(dObj, &runtime.StorageDelete{
+					Collection: object.Collection,
+					Key: object.Key,
+					UserID: userID,
+				})
+			}
+			if err := nk.StorageDelete(ctx, dObj); err != nil {
+				return fmt.Errorf("failed to delete %s: %v", collection, err)
+			}
+			deleted += len(dObj)
+		}
+	}
+	logger.Info("Deleted %d storage objects for %s.", deleted, userID)
+	return nil
+}
+
+// This function gets the users a shared raid or duel object refers to.
+func sharedObjectUsers(collection, value string) ([]string, error) {
+	switch collection {
+	case raidStorageCollection:
+		raid := &Raid{}
+		if err := json.Unmarshal([]byte(value), raid); err != nil {
+			return nil, err
+		}
+		return raid.Members, nil
+	case duelStorageCollection:
+		duel := &Duel{}
+		if err := json.Unmarshal([]byte(value), duel); err != nil {
+			return nil, err
+		}
+		return []string{duel.Challenger, duel.Opponent}, nil
+	}
+	return nil, nil
+}
+
+// This function builds the change that takes the removed users out of a shared object, nil for both when it doesn't
+// refer to any of them.  Raids carry on for the other members and are deleted once empty.  Duels are deleted, the
+// result can't be rated without both players.
+func removeSharedObjectUsers(object *api.StorageObject, removed map[string]bool) (*runtime.StorageWrite, *runtime.StorageDelete, error) {
+	remove := &runtime.StorageDelete{
+		Collection: object.Collection,
+		Key: object.Key,
+		Version: object.Version, //Skip it if it changed since it was listed, the next startup sweep picks it up.
+	}
+	switch object.Collection {
+	case raidStorageCollection:
+		raid := &Raid{}
+		if err := json.Unmarshal([]byte(object.Value), raid); err != nil {
+			return nil, nil, err
+		}
+		members := []string{}
+		for _, member := range raid.Members {
+			if removed[member] {
+				delete(raid.Damage, member)
+				for _, contributions := range raid.Contributions {
+					delete(contributions, member)
+				}
+				continue
+			}
+			members = append(members, member)
+		}
+		if len(members) == len(raid.Members) {
+			return nil, nil, nil
+		}
+		if len(members) == 0 {
+			return nil, remove, nil
+		}
+		raid.Members = members
+		raid.version = object.Version
+		write, err := raid.RaidStorageWrite()
+		return write, nil, err
+	case duelStorageCollection:
+		duel := &Duel{}
+		if err := json.Unmarshal([]byte(object.Value), duel); err != nil {
+			return nil, nil, err
+		}
+		if removed[duel.Challenger] || removed[duel.Opponent] {
+			return nil, remove, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// This function takes users out of the shared raids and duels.  removed is given the users each page refers to and
+// picks the ones to take out, so a sweep can check which accounts still exist a page at a time.  Changes are made
+// after listing so deletes don't move the cursor.  Returns how many objects changed.
+func RemoveUsersFromSharedData(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, removed func(userIDs []string) (map[string]bool, error)) (int, error) {
+	changed := 0
+	for _, collection := range sharedDataStorageCollections {
+		var wObj []*runtime.StorageWrite
+		var dObj []*runtime.StorageDelete
+		cursor := ""
+		for {
+			objects, nextCursor, err := nk.StorageList(ctx, "", "", collection, privacyPageSize, cursor)
+			if err != nil {
+				return changed, fmt.Errorf("failed to list %s for clean up: %v", collection, err)
+			}
+			userIDs := []string{}
+			for _, object := range objects {
+				users, err := sharedObjectUsers(collection, object.Value)
+				if err != nil {
+					logger.Warn("Unable to read %s/%s for clean up: %v", collection, object.Key, err)
+					continue
+				}
+				userIDs = append(userIDs, users...)
+			}
+			removedUsers, err := removed(userIDs)
+			if err != nil {
+				return changed, err
+			}
+			if len(removedUsers) > 0 {
+				for _, object := range objects {
+					write, remove, err := removeSharedObjectUsers(object, removedUsers)
+					if err != nil {
+						logger.Warn("Unable to clean up %s/%s: %v", collection, object.Key, err)
+						continue
+					}
+					if write != nil {
+						wObj = append(wObj, write)
+					}
+					if remove != nil {
+						dObj = append(dObj, remove)
+					}
+				}
+			}
+			if nextCursor == "" {
+				break
+			}
+			cursor = nextCursor
+		}
+		//One at a time so a single version conflict doesn't stop the rest.
+		for _, w := range wObj {
+			if _, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{w}); err != nil {
+				logger.Warn("Unable to clean up %s/%s: %v", w.Collection, w.Key, err)
+				continue
+			}
+			changed++
+		}
+		for _, d := range dObj {
+			if err := nk.StorageDelete(ctx, []*runtime.StorageDelete{d}); err != nil {
+				logger.Warn("Unable to clean up %s/%s: %v", d.Collection, d.Key, err)
+				continue
+			}
+			changed++
+		}
+	}
+	return changed, nil
+}
+
+// This function cleans up after accounts deleted without the delete account hooks, ex: from the console or the admin
+// api.  Nakama removes the objects a user owns with the account, so only the shared raids and duels are left pointing
+// at it.  Run at startup.
+func CleanUpDeletedAccounts(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) error {
+	changed, err := RemoveUsersFromSharedData(ctx, logger, nk, func(userIDs []string) (map[string]bool, error) {
+		removed := make(map[string]bool)
+		if len(userIDs) == 0 {
+			return removed, nil
+		}
+		accounts, err := nk.AccountsGetId(ctx, userIDs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get accounts for clean up: %v", err)
+		}
+		existing := make(map[string]bool)
+		for _, account := range accounts {
+			existing[account.GetUser().GetId()] = true
+		}
+		for _, userID := range userIDs {
+			if userID != "" && !existing[userID] {
+				removed[userID] = true
+			}
+		}
+		return removed, nil
+	})
+	if err != nil {
+		return err
+	}
+	logger.Info("Deleted account clean up changed %d shared objects.", changed)
+	return nil
+}
+
+// Before hook that removes the module's data when an account is deleted.
+func BeforeDeleteAccount(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule) error {
+	//Get the user id from the runtime.
+	userID, err := UtilGetUserId(ctx)
+	if err != nil {
+		logger.Error("Unable to extract user id from context due to error: %v", err)
+		return err
+	}
+	if err := DeletePlayerData(ctx, logger, nk, userID); err != nil {
+		logger.Error("Unable to delete player data: %v", err)
+		return err
+	}
+	return nil
+}
+
+// After hook that takes the deleted user out of the shared raids and duels.  Done after the delete so the user can't
+// join anything again in between.
+func AfterDeleteAccount(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule) error {
+	//Get the user id from the runtime.
+	userID, err := UtilGetUserId(ctx)
+	if err != nil {
+		logger.Error("Unable to extract user id from context due to error: %v", err)
+		return err
+	}
+	changed, err := RemoveUsersFromSharedData(ctx, logger, nk, func(userIDs []string) (map[string]bool, error) {
+		return map[string]bool{userID: true}, nil
+	})
+	if err != nil {
+		logger.Error("Unable to remove the user from shared data: %v", err)
+		return err
+	}
+	logger.Info("Removed %s from %d shared objects.", userID, changed)
+	return nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+func TestExportPlayerData(t *testing.T) {
+	InitAttackRegistry()
+	nk := newTestNakama()
+	ctx := context.Background()
+	player := NewPlayer("user-1", "Player One")
+	player.BattleStats.Kills[Zombie] = 3
+	if err := player.SavePlayerData(nk); err != nil {
+		t.Fatalf("unable to save player: %v", err)
+	}
+	store := &PlayerStore{Purchases: map[string]int{"health_potion": 1}, Receipts: []*StoreReceipt{{RequestID: "r1", OfferID: "health_potion"}}}
+	if err := SavePurchase(ctx, nk, player, store); err != nil {
+		t.Fatalf("unable to save store: %v", err)
+	}
+	nk.StorageWrite(ctx, []*runtime.StorageWrite{
+		{Collection: playerDataStorageCollection, Key: "battle_log", UserID: "user-1", Value: `{"events":[]}`},
+		{Collection: playerDataStorageCollection, Key: PlayerDataStorageKey, UserID: "user-2", Value: `{"id":"user-2"}`},
+	})
+	nk.ledger = []runtime.WalletLedgerItem{
+		&testLedgerItem{id: "l1", userID: "user-1", changeset: map[string]int64{"gold": 10}},
+		&testLedgerItem{id: "l2", userID: "user-2", changeset: map[string]int64{"gold": 5}},
+	}
+
+	export, err := ExportPlayerData(ctx, &testLogger{}, nk, "user-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if export.Player == nil || export.Player.ID != "user-1" {
+		t.Fatalf("expected the player in the export, got %+v", export.Player)
+	}
+	if export.BattleStats.Kills[Zombie] != 3 {
+		t.Fatalf("expected battle stats in the export, got %+v", export.BattleStats)
+	}
+	if len(export.Currencies) != 2 {
+		t.Fatalf("expected currencies in the export, got %+v", export.Currencies)
+	}
+	if export.PurchaseHistory == nil || export.PurchaseHistory.Purchases["health_potion"] != 1 {
+		t.Fatalf("expected purchase history in the export, got %+v", export.PurchaseHistory)
+	}
+	if len(export.StorageObjects) != 3 {
+		t.Fatalf("expected 3 storage objects for the user, got %d", len(export.StorageObjects))
+	}
+	if len(export.WalletLedger) != 1 || export.WalletLedger[0].ID != "l1" {
+		t.Fatalf("expected only the user's ledger items, got %+v", export.WalletLedger)
+	}
+	//The document is a single json object.
+	if _, err := json.Marshal(export); err != nil {
+		t.Fatalf("unable to marshal export: %v", err)
+	}
+}
+
+func TestDeletePlayerData(t *testing.T) {
+	nk := newTestNakama()
+	ctx := context.Background()
+	var writes []*runtime.StorageWrite
+	for i := 0; i < privacyPageSize+5; i++ { //More than a page to make sure every page goes.
+		writes = append(writes, &runtime.StorageWrite{Collection: playerDataStorageCollection, Key: UtilMakeUUID(), UserID: "user-1", Value: "{}"})
+	}
+	writes = append(writes,
+		&runtime.StorageWrite{Collection: playerDataStorageCollection, Key: PlayerDataStorageKey, UserID: "user-2", Value: "{}"},
+		&runtime.StorageWrite{Collection: configDataStorageCollection, Key: enemyDataStorageKey, Value: "{}"},
+	)
+	if _, err := nk.StorageWrite(ctx, writes); err != nil {
+		t.Fatalf("unable to seed storage: %v", err)
+	}
+
+	if err := BeforeDeleteAccount(testUserContext("user-1"), &testLogger{}, nil, nk); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, object := range nk.objects {
+		if object.UserId == "user-1" {
+			t.Fatalf("expected every object for the user to be deleted, found %s/%s", object.Collection, object.Key)
+		}
+	}
+	if len(nk.objects) != 2 {
+		t.Fatalf("expected other users and config to be untouched, got %d objects", len(nk.objects))
+	}
+}
+
+// Stand in where deletes never land.
+type testStuckNakama struct {
+	*testNakama
+}
+
+func (nk *testStuckNakama) StorageDelete(ctx context.Context, deletes []*runtime.StorageDelete) error {
+	return nil
+}
+
+func TestDeletePlayerDataStopsWithoutProgress(t *testing.T) {
+	nk := &testStuckNakama{newTestNakama()}
+	ctx := context.Background()
+	if _, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{{Collection: playerDataStorageCollection, Key: PlayerDataStorageKey, UserID: "user-1", Value: "{}"}}); err != nil {
+		t.Fatalf("unable to seed storage: %v", err)
+	}
+	if err := DeletePlayerData(ctx, &testLogger{}, nk, "user-1"); err == nil {
+		t.Fatalf("expected an error when the deletes don't land")
+	}
+}
+
+// This function seeds raids and duels between user-1, user-2 and user-3.
+func testSharedData(t *testing.T, nk *testNakama) {
+	t.Helper()
+	var writes []*runtime.StorageWrite
+	for _, raid := range []*Raid{
+		{ID: "raid-shared", Members: []string{"user-1", "user-2"}, Damage: map[string]int{"user-1": 5, "user-2": 3}, Contributions: map[string]map[string]int{"enemy": {"user-1": 5, "user-2": 3}}},
+		{ID: "raid-alone", Members: []string{"user-1"}},
+	} {
+		write, err := raid.RaidStorageWrite()
+		if err != nil {
+			t.Fatalf("RaidStorageWrite: %v", err)
+		}
+		writes = append(writes, write)
+	}
+	for _, duel := range []*Duel{
+		{ID: "duel-1", Challenger: "user-2", Opponent: "user-1", Status: DuelActive},
+		{ID: "duel-2", Challenger: "user-2", Opponent: "user-3", Status: DuelActive},
+	} {
+		write, err := duel.DuelStorageWrite()
+		if err != nil {
+			t.Fatalf("DuelStorageWrite: %v", err)
+		}
+		writes = append(writes, write)
+	}
+	if _, err := nk.StorageWrite(context.Background(), writes); err != nil {
+		t.Fatalf("unable to seed storage: %v", err)
+	}
+}
+
+// This function checks user-1 is gone from the shared data and everything else is kept.
+func testSharedDataWithoutUser(t *testing.T, nk *testNakama) {
+	t.Helper()
+	ctx := context.Background()
+	raid, err := LoadRaid(ctx, nk, "raid-shared")
+	if err != nil || raid == nil {
+		t.Fatalf("expected the shared raid to be kept: %v", err)
+	}
+	if raid.IsMember("user-1") || !raid.IsMember("user-2") || raid.Damage["user-1"] != 0 || raid.Contributions["enemy"]["user-1"] != 0 || raid.Contributions["enemy"]["user-2"] != 3 {
+		t.Fatalf("expected only user-1 taken out of the raid, got %+v", raid)
+	}
+	if raid, _ := LoadRaid(ctx, nk, "raid-alone"); raid != nil {
+		t.Fatalf("expected the empty raid to be deleted")
+	}
+	if duel, _ := LoadDuel(ctx, nk, "duel-1"); duel != nil {
+		t.Fatalf("expected the duel with user-1 to be deleted")
+	}
+	if duel, _ := LoadDuel(ctx, nk, "duel-2"); duel == nil {
+		t.Fatalf("expected the other duel to be kept")
+	}
+}
+
+func TestAfterDeleteAccountRemovesSharedData(t *testing.T) {
+	nk := newTestNakama()
+	testSharedData(t, nk)
+	if err := AfterDeleteAccount(testUserContext("user-1"), &testLogger{}, nil, nk); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	testSharedDataWithoutUser(t, nk)
+}
+
+func TestCleanUpDeletedAccounts(t *testing.T) {
+	nk := newTestNakama()
+	testSharedData(t, nk)
+	nk.deletedUsers = map[string]bool{"user-1": true} //Deleted from the console, no hooks ran.
+	if err := CleanUpDeletedAccounts(context.Background(), &testLogger{}, nk); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	testSharedDataWithoutUser(t, nk)
+}
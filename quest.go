@@ -0,0 +1,528 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"context"
+	"encoding/json"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+var questDataStorageKey = "quests" //Quest pool in the config collection.
+var QuestStorageKey = "quests" //Assigned quests in the player data collection.
+
+const QuestSaveRetries = 3
+
+// How often a quest is replaced.
+type QuestPeriod string
+const (
+	QuestDaily QuestPeriod = "daily" //Resets at midnight in the configured timezone.
+	QuestWeekly QuestPeriod = "weekly" //Resets Monday at midnight in the configured timezone.
+)
+
+// Information on a single quest definition.
+type QuestInfo struct {
+	ID string `json:"id"`
+	Name string `json:"name"`
+	Description string `json:"description"`
+	Period QuestPeriod `json:"period"`
+	Weight int `json:"weight"` //Relative chance of being drawn from the pool.
+	Condition EventCondition `json:"condition"` //What has to happen to complete it.
+	Rewards []RewardInfo `json:"rewards"` //Granted when claimed.
+}
+
+// Stored layout of the quest configuration.
+type QuestConfig struct {
+	Timezone string `json:"timezone"` //IANA name used for the resets, ex: "America/New_York".
+	DailyCount int `json:"daily_count"` //Daily quests assigned at once.
+	WeeklyCount int `json:"weekly_count"` //Weekly quests assigned at once.
+	RerollCost int64 `json:"reroll_cost"` //Gems to replace a quest.
+	Quests map[string]QuestInfo `json:"quests"`
+}
+
+// Registry to hold all of the definitions.  Using a mutex here since the data could be live-ops driven meaning it could change after nakama init.
+// **NOTE: If the plan is to not update this information after nakama init then this paradigm can be change to a simple read-only map instead.
+var QuestRegistry = struct {
+	sync.RWMutex //Read/write mutex to help with concurrent access allowing mulitple readers or a single writer.
+	QuestConfig
+}{
+	QuestConfig: QuestConfig{
+		Timezone: "UTC",
+		Quests: make(map[string]QuestInfo),
+	},
+}
+
+// Quest assigned to a player.
+type PlayerQuest struct {
+	ID string `json:"id"`
+	Period QuestPeriod `json:"period"`
+	Progress int `json:"progress"`
+	ExpiresAt int64 `json:"expires_at"` //End of the period it was assigned for.
+	ClaimedAt int64 `json:"claimed_at,omitempty"`
+}
+
+// A player's assigned quests.
+type PlayerQuests struct {
+	Quests []*PlayerQuest `json:"quests"`
+	version string //Storage version hash from the last read.
+}
+
+// Assigned quest with its definition, sent to the client.
+type QuestView struct {
+	QuestInfo
+	Progress int `json:"progress"`
+	Complete bool `json:"complete"`
+	ExpiresAt int64 `json:"expires_at"`
+	ClaimedAt int64 `json:"claimed_at,omitempty"`
+}
+
+// This function will initialize the Quest Registry.
+func InitQuestRegistry(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) error {
+	//Read from the storage engine.
+	rObj, err := nk.StorageRead(ctx, []*runtime.StorageRead{
+		{
+			Collection: configDataStorageCollection,
+			Key: questDataStorageKey,
+		},
+	})
+	if err != nil {
+		logger.Error("Error getting quest configuration data: %v", err)
+		return err
+	}
+	//Load defaults if nothing was found in storage and save them into storage.
+	if len(rObj) == 0 {
+		QuestRegistry.Lock()  //Call lock on the mutex in preparation for writing.
+		QuestRegistry.Timezone = "UTC"
+		QuestRegistry.DailyCount = 3
+		QuestRegistry.WeeklyCount = 2
+		QuestRegistry.RerollCost = 5
+		QuestRegistry.Quests["kill_mutants"] = QuestInfo{
+			ID: "kill_mutants",
+			Name: "Mutant Hunter",
+			Description: "Kill 5 mutants.",
+			Period: QuestDaily,
+			Weight: 10,
+			Condition: EventCondition{Event: EventKill, Target: string(Mutant), Count: 5},
+			Rewards: []RewardInfo{
+				{Type: Gold, Amount: 100},
+				{Type: Experience, Amount: 50},
+			},
+		}
+		QuestRegistry.Quests["kill_zombies"] = QuestInfo{
+			ID: "kill_zombies",
+			Name: "Zombie Hunter",
+			Description: "Kill 5 zombies.",
+			Period: QuestDaily,
+			Weight: 10,
+			Condition: EventCondition{Event: EventKill, Target: string(Zombie), Count: 5},
+			Rewards: []RewardInfo{
+				{Type: Gold, Amount: 100},
+				{Type: Experience, Amount: 50},
+			},
+		}
+		QuestRegistry.Quests["poison_damage"] = QuestInfo{
+			ID: "poison_damage",
+			Name: "Venomous",
+			Description: "Deal 200 poison damage.",
+			Period: QuestDaily,
+			Weight: 5,
+			Condition: EventCondition{Event: EventStatusEffectDamage, StatusEffect: Poison, CountDamage: true, Count: 200},
+			Rewards: []RewardInfo{
+				{Type: Gold, Amount: 150},
+			},
+		}
+		QuestRegistry.Quests["use_kick"] = QuestInfo{
+			ID: "use_kick",
+			Name: "Footwork",
+			Description: "Use Kick 20 times.",
+			Period: QuestDaily,
+			Weight: 5,
+			Condition: EventCondition{Event: EventAttackUsed, Attack: Kick, Count: 20},
+			Rewards: []RewardInfo{
+				{Type: Gold, Amount: 120},
+			},
+		}
+		QuestRegistry.Quests["win_battles"] = QuestInfo{
+			ID: "win_battles",
+			Name: "Veteran",
+			Description: "Win 25 battles.",
+			Period: QuestWeekly,
+			Weight: 10,
+			Condition: EventCondition{Event: EventBattleWon, Count: 25},
+			Rewards: []RewardInfo{
+				{Type: Gems, Amount: 10},
+			},
+		}
+		QuestRegistry.Quests["kill_beasts"] = QuestInfo{
+			ID: "kill_beasts",
+			Name: "Beast Tamer",
+			Description: "Kill 30 beasts.",
+			Period: QuestWeekly,
+			Weight: 10,
+			Condition: EventCondition{Event: EventKill, Target: string(Beast), Count: 30},
+			Rewards: []RewardInfo{
+				{Type: Gems, Amount: 8},
+			},
+		}
+		QuestRegistry.Quests["bleed_damage"] = QuestInfo{
+			ID: "bleed_damage",
+			Name: "Blood Price",
+			Description: "Deal 500 bleed damage.",
+			Period: QuestWeekly,
+			Weight: 5,
+			Condition: EventCondition{Event: EventStatusEffectDamage, StatusEffect: Bleed, CountDamage: true, Count: 500},
+			Rewards: []RewardInfo{
+				{Type: Gems, Amount: 10},
+			},
+		}
+		QuestRegistry.Unlock() //Don't forget to release the mutex lock.
+		return SaveQuestRegistry(nk)
+	}
+
+	var config QuestConfig
+	if err := json.Unmarshal([]byte(rObj[0].Value), &config); err != nil {
+		logger.Error("Failed to unmarshal quest data: %v", err)
+		return err
+	}
+	if config.Quests == nil {
+		config.Quests = make(map[string]QuestInfo)
+	}
+	QuestRegistry.Lock()  //Call lock on the mutex in preparation for writing.
+	QuestRegistry.QuestConfig = config
+	QuestRegistry.Unlock() //Don't forget to release the mutex lock.
+
+	return nil
+}
+
+// This function will save the Quest Registry to storage.
+func SaveQuestRegistry(nk runtime.NakamaModule) error {
+	QuestRegistry.RLock() //Read lock.
+	//Json-ify the quest registry in prepartion for storage.
+	data, err := json.Marshal(QuestRegistry.QuestConfig)
+	QuestRegistry.RUnlock() //Don't forget to release the lock.
+	if err != nil {
+		return err
+	}
+	wObj := []*runtime.StorageWrite{
+		{
+			Collection: configDataStorageCollection,
+			Key: questDataStorageKey,
+			Value: string(data),
+			PermissionRead: 1, // Owner and runtime can read.
+			PermissionWrite: 0, // No one can write save the runtime.
+		},
+	}
+	//Write to the storage engine.
+	if _, err := nk.StorageWrite(context.Background(), wObj); err != nil {
+		return fmt.Errorf("failed to write quest data to storage: %v", err)
+	}
+	return nil
+}
+
+// This function gets a quest definition from the registry.
+func GetQuest(questID string) (QuestInfo, bool) {
+	QuestRegistry.RLock() //Read lock.
+	defer QuestRegistry.RUnlock() //Don't forget to release the lock.
+	quest, exists := QuestRegistry.Quests[questID]
+	return quest, exists
+}
+
+// This function gets the configured timezone for resets, falling back to UTC if it can't be loaded.
+func QuestLocation() *time.Location {
+	QuestRegistry.RLock() //Read lock.
+	timezone := QuestRegistry.Timezone
+	QuestRegistry.RUnlock() //Release read lock.
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// This function gives the timestamp a period started at now ends, midnight for daily and Monday midnight for weekly.
+func QuestPeriodEnd(period QuestPeriod, now time.Time, location *time.Location) int64 {
+	local := now.In(location)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, location)
+	if period == QuestWeekly {
+		days := (8 - int(local.Weekday())) % 7 //Days until next Monday.
+		if days == 0 {
+			days = 7
+		}
+		return midnight.AddDate(0, 0, days).Unix()
+	}
+	return midnight.AddDate(0, 0, 1).Unix()
+}
+
+// This function draws quests of a period from the pool by weight, skipping excluded ids.  Fewer are returned if the pool
+// runs out.
+func DrawQuests(period QuestPeriod, count int, exclude map[string]bool) []QuestInfo {
+	QuestRegistry.RLock() //Read lock.
+	candidates := []QuestInfo{}
+	for id, quest := range QuestRegistry.Quests {
+		if quest.Period == period && quest.Weight > 0 && !exclude[id] {
+			candidates = append(candidates, quest)
+		}
+	}
+	QuestRegistry.RUnlock() //Release read lock.
+	sort.Slice(candidates, func(i, j int) bool { //Map order is random, keep the draw fair to the weights only.
+		return candidates[i].ID < candidates[j].ID
+	})
+	drawn := []QuestInfo{}
+	for len(drawn) < count && len(candidates) > 0 {
+		total := 0
+		for _, quest := range candidates {
+			total += quest.Weight
+		}
+		roll := BattleDiceRoll(1, total)
+		for i, quest := range candidates {
+			roll -= quest.Weight
+			if roll <= 0 {
+				drawn = append(drawn, quest)
+				candidates = append(candidates[:i], candidates[i+1:]...)
+				break
+			}
+		}
+	}
+	return drawn
+}
+
+// This function gets the player's quests from nakama storage.
+func LoadPlayerQuests(ctx context.Context, nk runtime.NakamaModule, userID string) (*PlayerQuests, error) {
+	//Read from the storage engine.
+	rObj, err := nk.StorageRead(ctx, []*runtime.StorageRead{
+		{
+			Collection: playerDataStorageCollection,
+			Key: QuestStorageKey,
+			UserID: userID,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	quests := &PlayerQuests{Quests: []*PlayerQuest{}}
+	if len(rObj) == 0 {
+		quests.version = "*" //Only write if no one else created it first.
+		return quests, nil
+	}
+	//Unmarshal json data to quests object.
+	if err = json.Unmarshal([]byte(rObj[0].Value), quests); err != nil {
+		return nil, err
+	}
+	quests.version = rObj[0].Version
+	return quests, nil
+}
+
+// This function builds the storage write for the quests so it can be batched with the player data.
+func (q *PlayerQuests) QuestStorageWrite(userID string) (*runtime.StorageWrite, error) {
+	//Json-ify the quests struct in prepartion for storage.
+	data, err := json.Marshal(q)
+	if err != nil {
+		return nil, err
+	}
+	return &runtime.StorageWrite{
+		Collection: playerDataStorageCollection,
+		Key: QuestStorageKey,
+		UserID: userID,
+		Value: string(data),
+		Version: q.version,
+		PermissionRead: 1, // Owner and runtime can read.
+		PermissionWrite: 0, // No one can write save the runtime.
+	}, nil
+}
+
+// This function replaces the quests of any period that ended with a new draw.  Returns true if anything changed.
+func (q *PlayerQuests) Refresh(now time.Time) bool {
+	QuestRegistry.RLock() //Read lock.
+	counts := map[QuestPeriod]int{
+		QuestDaily: QuestRegistry.DailyCount,
+		QuestWeekly: QuestRegistry.WeeklyCount,
+	}
+	QuestRegistry.RUnlock() //Release read lock.
+	location := QuestLocation()
+	changed := false
+	for _, period := range []QuestPeriod{QuestDaily, QuestWeekly} {
+		current := false
+		kept := []*PlayerQuest{}
+		for _, quest := range q.Quests {
+			if quest.Period != period {
+				kept = append(kept, quest)
+			} else if quest.ExpiresAt > now.Unix() {
+				current = true
+				kept = append(kept, quest)
+			}
+		}
+		if current {
+			continue
+		}
+		changed = changed || len(kept) != len(q.Quests)
+		q.Quests = kept
+		expiresAt := QuestPeriodEnd(period, now, location)
+		for _, quest := range DrawQuests(period, counts[period], nil) {
+			q.Quests = append(q.Quests, &PlayerQuest{
+				ID: quest.ID,
+				Period: period,
+				ExpiresAt: expiresAt,
+			})
+			changed = true
+		}
+	}
+	return changed
+}
+
+// This function gets an active quest by id.
+func (q *PlayerQuests) GetQuest(questID string, now int64) *PlayerQuest {
+	for _, quest := range q.Quests {
+		if quest.ID == questID && quest.ExpiresAt > now {
+			return quest
+		}
+	}
+	return nil
+}
+
+// This function counts the events towards the active quests.  Returns true if any progress was made.
+func (q *PlayerQuests) Track(events []BattleEvent, now int64) bool {
+	changed := false
+	for _, quest := range q.Quests {
+		if quest.ExpiresAt <= now || quest.ClaimedAt > 0 {
+			continue
+		}
+		info, exists := GetQuest(quest.ID)
+		if !exists || quest.Progress >= info.Condition.Count {
+			continue
+		}
+		progress := 0
+		for _, event := range events {
+			progress += info.Condition.Progress(event)
+		}
+		if progress == 0 {
+			continue
+		}
+		quest.Progress += progress
+		if quest.Progress > info.Condition.Count {
+			quest.Progress = info.Condition.Count
+		}
+		changed = true
+	}
+	return changed
+}
+
+// This function lists the active quests with their definitions.
+func (q *PlayerQuests) View(now int64) []QuestView {
+	views := []QuestView{}
+	for _, quest := range q.Quests {
+		info, exists := GetQuest(quest.ID)
+		if !exists || quest.ExpiresAt <= now {
+			continue
+		}
+		views = append(views, QuestView{
+			QuestInfo: info,
+			Progress: quest.Progress,
+			Complete: quest.Progress >= info.Condition.Count,
+			ExpiresAt: quest.ExpiresAt,
+			ClaimedAt: quest.ClaimedAt,
+		})
+	}
+	return views
+}
+
+// This function grants a completed quest's rewards and records it as completed on the player.
+func (p *Player) ClaimQuest(logger runtime.Logger, quests *PlayerQuests, questID string, now int64) (*QuestInfo, error) {
+	quest := quests.GetQuest(questID, now)
+	info, exists := GetQuest(questID)
+	if quest == nil || !exists {
+		return nil, NewGameError(CodeNotFound, ReasonQuestNotFound, fmt.Sprintf("Quest not found: %s", questID))
+	}
+	if quest.ClaimedAt > 0 {
+		return nil, NewGameError(CodeFailedPrecondition, ReasonQuestClaimed, fmt.Sprintf("Quest already claimed: %s", questID))
+	}
+	if quest.Progress < info.Condition.Count {
+		return nil, NewGameError(CodeFailedPrecondition, ReasonQuestIncomplete, fmt.Sprintf("Quest not complete: %s", questID))
+	}
+	p.GrantRewards(logger, info.Rewards)
+	quest.ClaimedAt = now
+	//Completed quests count towards unlock requirements.
+	for _, completed := range p.CompletedQuests {
+		if completed == questID {
+			return &info, nil
+		}
+	}
+	p.CompletedQuests = append(p.CompletedQuests, questID)
+	return &info, nil
+}
+
+// This function swaps an unclaimed quest for another from the same period for gems.  Progress on it is lost.
+func (p *Player) RerollQuest(quests *PlayerQuests, questID string, now int64) (*PlayerQuest, error) {
+	quest := quests.GetQuest(questID, now)
+	if quest == nil {
+		return nil, NewGameError(CodeNotFound, ReasonQuestNotFound, fmt.Sprintf("Quest not found: %s", questID))
+	}
+	if quest.ClaimedAt > 0 {
+		return nil, NewGameError(CodeFailedPrecondition, ReasonQuestClaimed, fmt.Sprintf("Quest already claimed: %s", questID))
+	}
+	QuestRegistry.RLock() //Read lock.
+	cost := QuestRegistry.RerollCost
+	QuestRegistry.RUnlock() //Release read lock.
+	if p.GetCurrency(Gems) < cost {
+		return nil, NewGameError(CodeFailedPrecondition, ReasonInsufficientFunds, fmt.Sprintf("Insufficient %s to reroll quest: %s", Gems, questID))
+	}
+	//Don't draw a quest the player already has.
+	exclude := make(map[string]bool)
+	for _, assigned := range quests.Quests {
+		exclude[assigned.ID] = true
+	}
+	drawn := DrawQuests(quest.Period, 1, exclude)
+	if len(drawn) == 0 {
+		return nil, NewGameError(CodeFailedPrecondition, ReasonQuestPoolEmpty, fmt.Sprintf("No other %s quests to reroll into.", quest.Period))
+	}
+	p.AddCurrency(Gems, cost * -1)
+	quest.ID = drawn[0].ID
+	quest.Progress = 0
+	return quest, nil
+}
+
+// This function feeds battle events into the player's quests.  It runs after the player was saved, a conflict reloads
+// the quests and tries again.  Failures are logged and not returned since the request already succeeded.
+func TrackQuests(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, p *Player, events []BattleEvent) {
+	if !QuestEvents(events) {
+		return
+	}
+	for attempt := 0; attempt < QuestSaveRetries; attempt++ {
+		quests, err := LoadPlayerQuests(ctx, nk, p.ID)
+		if err != nil {
+			logger.Error("Unable to load quests: %v", err)
+			return
+		}
+		now := p.Now()
+		changed := quests.Refresh(now)
+		if !quests.Track(events, now.Unix()) && !changed {
+			return
+		}
+		wObj, err := quests.QuestStorageWrite(p.ID)
+		if err != nil {
+			logger.Error("Unable to save quests: %v", err)
+			return
+		}
+		if _, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{wObj}); err != nil {
+			logger.Debug("Quest save conflict, attempt %d: %v", attempt + 1, err)
+			continue
+		}
+		return
+	}
+	logger.Error("Quest progress was not saved for user %s.", p.ID)
+}
+
+// This function checks if any quest cares about the events, so quests aren't read from storage for nothing.
+func QuestEvents(events []BattleEvent) bool {
+	QuestRegistry.RLock() //Read lock.
+	defer QuestRegistry.RUnlock() //Don't forget to release the lock.
+	for _, quest := range QuestRegistry.Quests {
+		for _, event := range events {
+			if quest.Condition.Matches(event) {
+				return true
+			}
+		}
+	}
+	return false
+}
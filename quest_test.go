@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+func testQuestRegistry(t *testing.T) {
+	t.Helper()
+	if err := InitQuestRegistry(context.Background(), &testLogger{}, newTestNakama()); err != nil {
+		t.Fatalf("InitQuestRegistry: %v", err)
+	}
+}
+
+func TestQuestPeriodEnd(t *testing.T) {
+	location := time.FixedZone("UTC-5", -5 * 60 * 60)
+	//Tuesday 02:00 UTC is still Monday evening at UTC-5.
+	now := time.Date(2025, time.March, 11, 2, 0, 0, 0, time.UTC)
+	daily := time.Unix(QuestPeriodEnd(QuestDaily, now, location), 0).In(location)
+	if daily.Day() != 11 || daily.Hour() != 0 {
+		t.Errorf("daily should end at local midnight on the 11th: %v", daily)
+	}
+	weekly := time.Unix(QuestPeriodEnd(QuestWeekly, now, location), 0).In(location)
+	if weekly.Weekday() != time.Monday || weekly.Day() != 17 || weekly.Hour() != 0 {
+		t.Errorf("weekly should end at local midnight next Monday: %v", weekly)
+	}
+}
+
+func TestRefreshAssignsQuestsPerPeriod(t *testing.T) {
+	testQuestRegistry(t)
+	quests := &PlayerQuests{}
+	now := time.Now()
+	if !quests.Refresh(now) {
+		t.Fatal("new players should get quests")
+	}
+	seen := make(map[string]bool)
+	periods := make(map[QuestPeriod]int)
+	for _, quest := range quests.Quests {
+		info, _ := GetQuest(quest.ID)
+		if seen[quest.ID] || info.Period != quest.Period {
+			t.Errorf("bad assignment: %+v", quest)
+		}
+		seen[quest.ID] = true
+		periods[quest.Period]++
+	}
+	if periods[QuestDaily] != QuestRegistry.DailyCount || periods[QuestWeekly] != QuestRegistry.WeeklyCount {
+		t.Errorf("assigned %+v", periods)
+	}
+	if quests.Refresh(now) {
+		t.Error("quests shouldn't change before the period ends")
+	}
+	//Only the ended period is replaced.
+	for _, quest := range quests.Quests {
+		if quest.Period == QuestDaily {
+			quest.ExpiresAt = now.Unix() - 1
+		}
+	}
+	weekly := quests.Quests[periods[QuestDaily]] //First weekly, dailies were drawn first.
+	if !quests.Refresh(now) || quests.Quests[0] != weekly {
+		t.Error("daily quests should be redrawn and the weekly ones kept")
+	}
+}
+
+func TestQuestTrackClaimAndReroll(t *testing.T) {
+	testQuestRegistry(t)
+	now := time.Now().Unix()
+	quests := &PlayerQuests{Quests: []*PlayerQuest{
+		{ID: "poison_damage", Period: QuestDaily, ExpiresAt: now + 60},
+		{ID: "kill_zombies", Period: QuestDaily, ExpiresAt: now + 60},
+	}}
+	events := []BattleEvent{
+		{Event: EventStatusEffectDamage, StatusEffect: Poison, Damage: 150},
+		{Event: EventStatusEffectDamage, StatusEffect: Bleed, Damage: 100},
+		{Event: EventStatusEffectDamage, StatusEffect: Poison, Damage: 100},
+	}
+	if !quests.Track(events, now) || quests.Quests[0].Progress != 200 || quests.Quests[1].Progress != 0 {
+		t.Fatalf("progress: %+v %+v", quests.Quests[0], quests.Quests[1])
+	}
+
+	player := NewPlayer(UtilMakeUUID(), "tester")
+	gold := player.GetCurrency(Gold)
+	_, err := player.ClaimQuest(&testLogger{}, quests, "kill_zombies", now)
+	if code, body := testErrorBody(t, err); code != CodeFailedPrecondition || body.Reason != ReasonQuestIncomplete {
+		t.Errorf("incomplete claim: %d %+v", code, body)
+	}
+	if _, err := player.ClaimQuest(&testLogger{}, quests, "poison_damage", now); err != nil {
+		t.Fatalf("ClaimQuest: %v", err)
+	}
+	if player.GetCurrency(Gold) != gold + 150 || len(player.CompletedQuests) != 1 || player.CompletedQuests[0] != "poison_damage" {
+		t.Errorf("claim didn't reward: %+v", player)
+	}
+	_, err = player.ClaimQuest(&testLogger{}, quests, "poison_damage", now)
+	if code, body := testErrorBody(t, err); code != CodeFailedPrecondition || body.Reason != ReasonQuestClaimed {
+		t.Errorf("second claim: %d %+v", code, body)
+	}
+
+	//Rerolls cost gems and draw a quest the player doesn't have.
+	player.AddCurrency(Gems, player.GetCurrency(Gems) * -1)
+	_, err = player.RerollQuest(quests, "kill_zombies", now)
+	if code, body := testErrorBody(t, err); code != CodeFailedPrecondition || body.Reason != ReasonInsufficientFunds {
+		t.Errorf("reroll without gems: %d %+v", code, body)
+	}
+	player.AddCurrency(Gems, QuestRegistry.RerollCost)
+	quest, err := player.RerollQuest(quests, "kill_zombies", now)
+	if err != nil {
+		t.Fatalf("RerollQuest: %v", err)
+	}
+	if quest.ID == "kill_zombies" || quest.ID == "poison_damage" || quest.Period != QuestDaily || player.GetCurrency(Gems) != 0 {
+		t.Errorf("reroll: %+v gems %d", quest, player.GetCurrency(Gems))
+	}
+}
+
+func TestKillsTrackQuests(t *testing.T) {
+	ctx := context.Background()
+	logger := &testLogger{}
+	nk := newTestNakama()
+	if err := InitQuestRegistry(ctx, logger, nk); err != nil {
+		t.Fatalf("InitQuestRegistry: %v", err)
+	}
+	player := NewPlayer(UtilMakeUUID(), "tester")
+	quests := &PlayerQuests{version: "*"}
+	quests.Refresh(time.Now())
+	quests.Quests = append(quests.Quests, &PlayerQuest{ID: "kill_zombies", Period: QuestDaily, ExpiresAt: time.Now().Unix() + 60})
+	wObj, _ := quests.QuestStorageWrite(player.ID)
+	if _, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{wObj}); err != nil {
+		t.Fatalf("StorageWrite: %v", err)
+	}
+
+	attackType := testSureHitAttack(t, 30)
+	player.Loadout = []AttackType{attackType}
+	targetID := UtilMakeUUID()
+	player.BattleState.Enemies = map[string]*Enemy{
+		targetID: {Type: Zombie, Health: 30, MaxHealth: 30},
+	}
+	if _, err := player.PlayerAttack(logger, targetID, attackType); err != nil {
+		t.Fatalf("PlayerAttack: %v", err)
+	}
+	if _, err := CommitRequest(ctx, logger, nk, nil, player, struct{}{}); err != nil {
+		t.Fatalf("CommitRequest: %v", err)
+	}
+	stored, err := LoadPlayerQuests(ctx, nk, player.ID)
+	if err != nil {
+		t.Fatalf("LoadPlayerQuests: %v", err)
+	}
+	if quest := stored.GetQuest("kill_zombies", time.Now().Unix()); quest == nil || quest.Progress != 1 {
+		t.Errorf("kill wasn't counted: %+v", quest)
+	}
+}
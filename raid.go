@@ -0,0 +1,436 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+var raidStorageCollection = "raids" //Shared raid battles, owned by the system user and keyed by raid id.
+
+const RaidMaxMembers = 4 //Largest party that can join a raid.
+const RaidEnemyScale = RaidMaxMembers //Raid enemy health and rewards are scaled up for a full party.
+const RaidTTL = 2 * 60 * 60 //Seconds a raid stays open before it can be replaced.
+const RaidSaveRetries = 3 //Attempts at saving an attack when other members save at the same time.
+const RaidNotificationCode = 101 //Notification sent when the matchmaker puts the player in a raid.
+const StreamModeParty uint8 = 7 //Nakama's presence stream mode for parties, nakama-common doesn't export it.
+
+// Shared battle fought by a party.  Stored on its own so every member reads and writes the same enemies.
+type Raid struct {
+	ID string `json:"id"`
+	PartyID string `json:"party_id,omitempty"`
+	Members []string `json:"members"` //User ids, capped by RaidMaxMembers.
+	Enemies map[string]*Enemy `json:"enemies"`
+	Contributions map[string]map[string]int `json:"contributions"` //Damage dealt to each enemy by user id, rewards are split by this.
+	Damage map[string]int `json:"damage"` //Total damage dealt in the raid by user id.
+	CreatedAt int64 `json:"created_at"`
+	FinishedAt int64 `json:"finished_at"` //0 until every enemy is defeated.
+	version string //Storage version hash from the last read.
+}
+
+// This function gets a raid from nakama storage, nil when there isn't one.
+func LoadRaid(ctx context.Context, nk runtime.NakamaModule, raidID string) (*Raid, error) {
+	//Read from the storage engine.
+	rObj, err := nk.StorageRead(ctx, []*runtime.StorageRead{
+		{
+			Collection: raidStorageCollection,
+			Key: raidID,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(rObj) == 0 {
+		return nil, nil
+	}
+	//Unmarshal json data to raid object.
+	raid := &Raid{}
+	if err = json.Unmarshal([]byte(rObj[0].Value), raid); err != nil {
+		return nil, err
+	}
+	if raid.Contributions == nil {
+		raid.Contributions = make(map[string]map[string]int)
+	}
+	if raid.Damage == nil {
+		raid.Damage = make(map[string]int)
+	}
+	raid.version = rObj[0].Version
+	return raid, nil
+}
+
+// This function builds the storage write for the raid so it can be batched with the member player data.
+func (r *Raid) RaidStorageWrite() (*runtime.StorageWrite, error) {
+	//Json-ify the raid struct in prepartion for storage.
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	return &runtime.StorageWrite{
+		Collection: raidStorageCollection,
+		Key: r.ID,
+		Value: string(data),
+		Version: r.version,
+		PermissionRead: 0, // Only the runtime can read.
+		PermissionWrite: 0, // No one can write save the runtime.
+	}, nil
+}
+
+// This function checks if the raid can still be fought.
+func (r *Raid) IsOpen(timestamp int64) bool {
+	return r.FinishedAt == 0 && r.CreatedAt + RaidTTL > timestamp
+}
+
+// This function checks if the user is in the raid.
+func (r *Raid) IsMember(userID string) bool {
+	for _, member := range r.Members {
+		if member == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// This function adds the user to the raid.  Joining again is allowed.
+func (r *Raid) Join(userID string) error {
+	if r.IsMember(userID) {
+		return nil
+	}
+	if len(r.Members) >= RaidMaxMembers {
+		return NewGameError(CodeFailedPrecondition, ReasonRaidFull, fmt.Sprintf("Raid is full: %s", r.ID))
+	}
+	r.Members = append(r.Members, userID)
+	return nil
+}
+
+// This function credits damage dealt to a raid enemy to the user.
+func (r *Raid) Credit(targetID, userID string, damage int) {
+	if damage <= 0 {
+		return
+	}
+	if r.Contributions[targetID] == nil {
+		r.Contributions[targetID] = make(map[string]int)
+	}
+	r.Contributions[targetID][userID] += damage
+	r.Damage[userID] += damage
+}
+
+// This function checks the user is in the nakama party.  Party ids are the party's stream subject and node joined by a
+// dot.
+func IsPartyMember(nk runtime.NakamaModule, partyID, userID string) (bool, error) {
+	subject, node, found := strings.Cut(partyID, ".")
+	if !found || subject == "" || node == "" {
+		return false, nil
+	}
+	presences, err := nk.StreamUserList(StreamModeParty, subject, "", node, true, true)
+	if err != nil {
+		return false, err
+	}
+	for _, presence := range presences {
+		if presence.GetUserId() == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// This function builds a new raid with a scaled up enemy.  The party id is used as the raid id so the party shares it.
+func NewRaid(partyID string, members []string, timestamp int64) (*Raid, error) {
+	enemy, exists := GetEnemy()
+	if !exists {
+		return nil, fmt.Errorf("unable to get an enemy, scope out of bounds possibly.")
+	}
+	EnsureMaxHealth(&enemy, enemy.Health)
+	enemy.Health *= RaidEnemyScale
+	enemy.MaxHealth *= RaidEnemyScale
+	enemy.Rewards = CreateRewards()
+	for i := range enemy.Rewards {
+		if fmt.Sprint(enemy.Rewards[i].Type) != string(ItemReward) {
+			enemy.Rewards[i].Amount *= RaidEnemyScale
+		}
+	}
+	raid := &Raid{
+		ID: partyID,
+		PartyID: partyID,
+		Members: []string{},
+		Enemies: map[string]*Enemy{UtilMakeUUID(): &enemy},
+		Contributions: make(map[string]map[string]int),
+		Damage: make(map[string]int),
+		CreatedAt: timestamp,
+		version: "*", //Only write if no one else created it first.
+	}
+	if raid.ID == "" {
+		raid.ID = UtilMakeUUID()
+	}
+	for _, member := range members {
+		if err := raid.Join(member); err != nil {
+			return nil, err
+		}
+	}
+	return raid, nil
+}
+
+// This function joins the party's raid, starting one when there isn't an open one.  The user has to be in the nakama
+// party so the raid can't be joined by guessing the id.  Without a party id a new raid is always started.
+func JoinOrCreateRaid(ctx context.Context, nk runtime.NakamaModule, userID, partyID string) (*Raid, error) {
+	if partyID != "" {
+		member, err := IsPartyMember(nk, partyID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if !member {
+			return nil, NewGameError(CodePermissionDenied, ReasonNotPartyMember, fmt.Sprintf("Not a member of the party: %s", partyID))
+		}
+	}
+	for attempt := 0; attempt < RaidSaveRetries; attempt++ {
+		var raid *Raid
+		var err error
+		if partyID != "" {
+			if raid, err = LoadRaid(ctx, nk, partyID); err != nil {
+				return nil, err
+			}
+		}
+		now := Now().Unix() //Raids are shared so they run on the server clock.
+		if raid != nil && raid.IsOpen(now) {
+			if raid.IsMember(userID) {
+				return raid, nil
+			}
+			if err := raid.Join(userID); err != nil {
+				return nil, err
+			}
+		} else {
+			replaced := raid
+			if raid, err = NewRaid(partyID, []string{userID}, now); err != nil {
+				return nil, err
+			}
+			if replaced != nil {
+				raid.version = replaced.version //Overwrite the finished raid.
+			}
+		}
+		wObj, err := raid.RaidStorageWrite()
+		if err != nil {
+			return nil, err
+		}
+		//Write to the storage engine, the version makes this fail if another member joined first.
+		acks, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{wObj})
+		if err != nil {
+			continue
+		}
+		raid.version = acks[0].Version
+		return raid, nil
+	}
+	return nil, NewGameError(CodeAborted, ReasonConflict, "Raid was not joined, try again.")
+}
+
+// This function loads an open raid the user is a member of.
+func LoadMemberRaid(ctx context.Context, nk runtime.NakamaModule, userID, raidID string) (*Raid, error) {
+	raid, err := LoadRaid(ctx, nk, raidID)
+	if err != nil {
+		return nil, err
+	}
+	if raid == nil || !raid.IsMember(userID) {
+		return nil, NewGameError(CodeNotFound, ReasonRaidNotFound, fmt.Sprintf("Raid not found: %s", raidID))
+	}
+	if !raid.IsOpen(Now().Unix()) {
+		return nil, NewGameError(CodeFailedPrecondition, ReasonRaidOver, fmt.Sprintf("Raid is over: %s", raidID))
+	}
+	return raid, nil
+}
+
+// This function splits rewards between players by how much damage they did.  Amounts are rounded down with what is left
+// going to the top contributor, who also gets any item drops.  Players that did no damage get nothing, unless no one did
+// in which case the members split it evenly.
+func SplitRewards(rewards []RewardInfo, contributions map[string]int, members []string) map[string][]RewardInfo {
+	split := make(map[string][]RewardInfo)
+	total := 0
+	userIDs := []string{}
+	for userID, damage := range contributions {
+		if damage > 0 {
+			total += damage
+			userIDs = append(userIDs, userID)
+		}
+	}
+	if total == 0 {
+		contributions = make(map[string]int)
+		for _, userID := range members {
+			contributions[userID] = 1
+			userIDs = append(userIDs, userID)
+		}
+		total = len(userIDs)
+	}
+	if total == 0 {
+		return split
+	}
+	//Most damage first, ties broken by user id so the split doesn't depend on map ordering.
+	sort.Slice(userIDs, func(i, j int) bool {
+		if contributions[userIDs[i]] != contributions[userIDs[j]] {
+			return contributions[userIDs[i]] > contributions[userIDs[j]]
+		}
+		return userIDs[i] < userIDs[j]
+	})
+	top := userIDs[0]
+	for _, reward := range rewards {
+		if fmt.Sprint(reward.Type) == string(ItemReward) {
+			split[top] = append(split[top], reward)
+			continue
+		}
+		remaining := reward.Amount
+		for _, userID := range userIDs {
+			share := reward.Amount * int64(contributions[userID]) / int64(total)
+			remaining -= share
+			if userID == top || share == 0 {
+				continue
+			}
+			split[userID] = append(split[userID], RewardInfo{Type: reward.Type, Amount: share})
+		}
+		split[top] = append(split[top], RewardInfo{Type: reward.Type, Amount: reward.Amount * int64(contributions[top]) / int64(total) + remaining})
+	}
+	return split
+}
+
+// This function builds the raid_attack response, it is also what gets stored for request id replays.
+func RaidAttackResponse(result *AttackResult, raid *Raid, player *Player) interface{} {
+	//Limited scope response struct
+	return struct {
+		Result *AttackResult `json:"result"`
+		Raid *Raid `json:"raid"`
+		PlayerData *Player `json:"player_data"`
+	}{
+		Result: result,
+		Raid: raid,
+		PlayerData: player,
+	}
+}
+
+// This function performs the player's attack on a raid enemy and saves the raid and players together.  Members attacking
+// at the same time make the save fail on the storage version, so the attack is tried again on the fresh raid.  With a
+// request log from BeginRequest the response is saved in the same write.
+func RaidAttack(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, requestLog *RequestLog, userID, raidID, targetID string, attackRequest AttackType) (*AttackResult, *Raid, *Player, error) {
+	for attempt := 0; attempt < RaidSaveRetries; attempt++ {
+		if attempt > 0 && requestLog != nil {
+			if err := requestLog.Reload(ctx, nk); err != nil {
+				return nil, nil, nil, AsGameError(err)
+			}
+		}
+		raid, err := LoadMemberRaid(ctx, nk, userID, raidID)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		player, err := LoadPlayerData(ctx, logger, nk, userID)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		targetEnemy, exists := raid.Enemies[targetID]
+		if !exists {
+			return nil, nil, nil, NewGameError(CodeNotFound, ReasonEnemyNotFound, fmt.Sprintf("Enemy not found by supplied ID: %s", targetID))
+		}
+		result, err := player.AttackCombatant(logger, targetID, targetEnemy, attackRequest, Now().Unix()) //Shared enemies, so the server clock.
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		raid.Credit(targetID, userID, result.Damage)
+		//Status effect damage goes to whoever applied the effect, the attacker when it wasn't tracked or they left.
+		for source, damage := range result.StatusEffectDamage {
+			if source == "" || !raid.IsMember(source) {
+				source = userID
+			}
+			raid.Credit(targetID, source, damage)
+		}
+
+		//Players whose data changes with this attack.
+		players := map[string]*Player{userID: player}
+		if result.EnemyKilled {
+			logger.Debug("Raid enemy died, splitting rewards.")
+			for memberID, rewards := range SplitRewards(targetEnemy.Rewards, raid.Contributions[targetID], raid.Members) {
+				member, exists := players[memberID]
+				if !exists {
+					if member, err = LoadPlayerData(ctx, logger, nk, memberID); err != nil {
+						return nil, nil, nil, err
+					}
+					players[memberID] = member
+				}
+				member.RecordBattleStats(logger, targetEnemy)
+				member.GrantRewards(logger, rewards)
+				if memberID == userID {
+					result.Rewards = rewards
+				}
+			}
+			delete(raid.Enemies, targetID)
+			if len(raid.Enemies) == 0 {
+				raid.FinishedAt = Now().Unix()
+			}
+		}
+
+		//Save the raid with every changed player so rewards can't be granted twice or lost.
+		wObj, err := raid.RaidStorageWrite()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		wObjs := []*runtime.StorageWrite{wObj}
+		for _, member := range players {
+			playerWrite, err := member.PlayerStorageWrite()
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			wObjs = append(wObjs, playerWrite)
+		}
+		//Recorded after the player writes so the stored response has the saved player.
+		_, logWrite, err := requestLog.RecordWrite(logger, RaidAttackResponse(result, raid, player))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if logWrite != nil {
+			wObjs = append(wObjs, logWrite)
+		}
+		acks, err := nk.StorageWrite(ctx, wObjs)
+		if err != nil {
+			logger.Debug("Raid attack save conflict, attempt %d: %v", attempt + 1, err)
+			continue
+		}
+		player.SetStorageVersion(acks)
+		if requestLog != nil {
+			requestLog.SetStorageVersion(acks)
+		}
+		for _, member := range players {
+			ProcessBattleEvents(ctx, logger, nk, member)
+		}
+		return result, raid, player, nil
+	}
+	return nil, nil, nil, NewGameError(CodeAborted, ReasonConflict, "Raid attack was not saved, try again.")
+}
+
+// Matchmaker hook that puts players matched with the "mode" property set to "raid" into a new raid together.  Other
+// matches are left to the default relayed match.
+func MatchmakerMatched(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, entries []runtime.MatchmakerEntry) (string, error) {
+	if len(entries) == 0 || entries[0].GetProperties()["mode"] != "raid" {
+		return "", nil
+	}
+	members := []string{}
+	for _, entry := range entries {
+		members = append(members, entry.GetPresence().GetUserId())
+	}
+	raid, err := NewRaid("", members, Now().Unix())
+	if err != nil {
+		logger.Error("Unable to create matchmaker raid: %v", err)
+		return "", err
+	}
+	wObj, err := raid.RaidStorageWrite()
+	if err != nil {
+		return "", err
+	}
+	if _, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{wObj}); err != nil {
+		logger.Error("Unable to save matchmaker raid: %v", err)
+		return "", err
+	}
+	//Tell each member which raid they are in.
+	for _, member := range members {
+		content := map[string]interface{}{"raid_id": raid.ID}
+		if err := nk.NotificationSend(ctx, member, "Raid ready", content, RaidNotificationCode, "", false); err != nil {
+			logger.Error("Unable to notify raid member %s: %v", member, err)
+		}
+	}
+	return "", nil
+}
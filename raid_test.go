@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSplitRewards(t *testing.T) {
+	rewards := []RewardInfo{
+		{Type: Gold, Amount: 100},
+		{Type: Experience, Amount: 10},
+		{Type: ItemReward, Amount: 1, ItemID: HealthPotion},
+	}
+	split := SplitRewards(rewards, map[string]int{"a": 50, "b": 30, "c": 20, "d": 0}, []string{"a", "b", "c", "d"})
+
+	totals := map[string]map[string]int64{}
+	for userID, userRewards := range split {
+		totals[userID] = map[string]int64{}
+		for _, reward := range userRewards {
+			totals[userID][fmt.Sprint(reward.Type)] += reward.Amount
+		}
+	}
+	if totals["a"]["gold"] != 50 || totals["b"]["gold"] != 30 || totals["c"]["gold"] != 20 {
+		t.Fatalf("gold split: %+v", totals)
+	}
+	//10 experience doesn't split evenly, the remainder goes to the top contributor.
+	if totals["a"]["experience"] + totals["b"]["experience"] + totals["c"]["experience"] != 10 || totals["a"]["experience"] != 5 {
+		t.Fatalf("experience split: %+v", totals)
+	}
+	if totals["a"]["item"] != 1 || totals["b"]["item"] != 0 {
+		t.Fatalf("item drop should go to the top contributor: %+v", totals)
+	}
+	if _, exists := split["d"]; exists {
+		t.Fatal("no damage should mean no rewards")
+	}
+
+	//No one did damage, the members split it evenly.
+	split = SplitRewards(rewards, map[string]int{}, []string{"b", "a"})
+	totals = map[string]map[string]int64{}
+	for userID, userRewards := range split {
+		totals[userID] = map[string]int64{}
+		for _, reward := range userRewards {
+			totals[userID][fmt.Sprint(reward.Type)] += reward.Amount
+		}
+	}
+	if totals["a"]["gold"] != 50 || totals["b"]["gold"] != 50 || totals["a"]["item"] + totals["b"]["item"] != 1 {
+		t.Fatalf("even split: %+v", totals)
+	}
+}
+
+func TestRaidJoinAndAttack(t *testing.T) {
+	nk := newTestNakama()
+	ctx := context.Background()
+	attackType := testSureHitAttack(t, 20)
+	if err := InitEnemyRegistry(ctx, &testLogger{}, nk); err != nil {
+		t.Fatalf("enemy registry: %v", err)
+	}
+
+	members := []string{}
+	for i := 0; i < RaidMaxMembers + 1; i++ {
+		members = append(members, UtilMakeUUID())
+	}
+	partyID := nk.testParty(members...)
+	for i, userID := range members[:RaidMaxMembers] {
+		player := NewPlayer(userID, "tester")
+		player.version = "*"
+		player.Loadout = []AttackType{attackType}
+		if err := player.SavePlayerData(nk); err != nil {
+			t.Fatalf("save player: %v", err)
+		}
+		raid, err := JoinOrCreateRaid(ctx, nk, userID, partyID)
+		if err != nil {
+			t.Fatalf("join %d: %v", i, err)
+		}
+		if raid.ID != partyID || len(raid.Members) != i + 1 {
+			t.Fatalf("join %d: raid %s members %v", i, raid.ID, raid.Members)
+		}
+	}
+	_, err := JoinOrCreateRaid(ctx, nk, members[RaidMaxMembers], partyID)
+	if code, body := testErrorBody(t, err); code != CodeFailedPrecondition || body.Reason != ReasonRaidFull {
+		t.Fatalf("full raid: code %d body %+v", code, body)
+	}
+	//Knowing the party id isn't enough to join.
+	_, err = JoinOrCreateRaid(ctx, nk, UtilMakeUUID(), partyID)
+	if code, body := testErrorBody(t, err); code != CodePermissionDenied || body.Reason != ReasonNotPartyMember {
+		t.Fatalf("not in the party: code %d body %+v", code, body)
+	}
+
+	raid, _ := LoadRaid(ctx, nk, partyID)
+	var targetID string
+	for id := range raid.Enemies {
+		targetID = id
+	}
+	//Not a member.
+	_, _, _, err = RaidAttack(ctx, &testLogger{}, nk, nil, UtilMakeUUID(), partyID, targetID, attackType)
+	if code, body := testErrorBody(t, err); code != CodeNotFound || body.Reason != ReasonRaidNotFound {
+		t.Fatalf("non member: code %d body %+v", code, body)
+	}
+
+	//Members take turns until the enemy dies.
+	var result *AttackResult
+	for i := 0; result == nil || !result.EnemyKilled; i++ {
+		if i > 100 {
+			t.Fatal("enemy never died")
+		}
+		result, raid, _, err = RaidAttack(ctx, &testLogger{}, nk, nil, members[i % 2], partyID, targetID, attackType)
+		if err != nil {
+			t.Fatalf("attack %d: %v", i, err)
+		}
+	}
+	if raid.FinishedAt == 0 || raid.IsOpen(time.Now().Unix()) {
+		t.Fatal("raid should be over once every enemy is dead")
+	}
+	if raid.Damage[members[0]] <= 0 || raid.Damage[members[1]] <= 0 || raid.Damage[members[2]] != 0 {
+		t.Fatalf("damage: %+v", raid.Damage)
+	}
+	//Both attackers got a share of the experience, the others didn't.
+	for i, userID := range members[:RaidMaxMembers] {
+		player, err := LoadPlayerData(ctx, &testLogger{}, nk, userID)
+		if err != nil {
+			t.Fatalf("load %d: %v", i, err)
+		}
+		if (i < 2) != (player.Experience > 0) {
+			t.Fatalf("member %d experience %d", i, player.Experience)
+		}
+	}
+}
+
+func TestRaidStatusEffectDamageCredit(t *testing.T) {
+	nk := newTestNakama()
+	ctx := context.Background()
+	InitStatusEffectsRegistry()
+	start := time.Unix(1700000000, 0)
+	clock := testFixedClock(t, start)
+	hitType := testSureHitAttack(t, 1)
+	if err := InitEnemyRegistry(ctx, &testLogger{}, nk); err != nil {
+		t.Fatalf("enemy registry: %v", err)
+	}
+	//Attack that does nothing but make the target bleed.
+	bleedType := AttackType("test_bleed")
+	AttackRegistry.Lock()
+	AttackRegistry.Attacks[bleedType] = AttackInfo{
+		Type: bleedType,
+		Owner: OwnerPlayer,
+		BaseHitChance: 1,
+		ApplicableStatusEffect: []StatusEffectFromAttacks{{Type: Bleed, Chance: 1}},
+	}
+	AttackRegistry.Unlock()
+	t.Cleanup(func() {
+		AttackRegistry.Lock()
+		delete(AttackRegistry.Attacks, bleedType)
+		AttackRegistry.Unlock()
+	})
+
+	bleeder, hitter := UtilMakeUUID(), UtilMakeUUID()
+	partyID := nk.testParty(bleeder, hitter)
+	for _, userID := range []string{bleeder, hitter} {
+		player := NewPlayer(userID, "tester")
+		player.version = "*"
+		player.Loadout = []AttackType{hitType, bleedType}
+		if err := player.SavePlayerData(nk); err != nil {
+			t.Fatalf("save player: %v", err)
+		}
+		if _, err := JoinOrCreateRaid(ctx, nk, userID, partyID); err != nil {
+			t.Fatalf("join: %v", err)
+		}
+	}
+	raid, _ := LoadRaid(ctx, nk, partyID)
+	var targetID string
+	for id := range raid.Enemies {
+		targetID = id
+	}
+	if _, _, _, err := RaidAttack(ctx, &testLogger{}, nk, nil, bleeder, partyID, targetID, bleedType); err != nil {
+		t.Fatalf("bleed attack: %v", err)
+	}
+	//Two intervals later the other member's attack ticks the bleed.
+	clock.now = start.Add(10 * time.Second)
+	_, raid, _, err := RaidAttack(ctx, &testLogger{}, nk, nil, hitter, partyID, targetID, hitType)
+	if err != nil {
+		t.Fatalf("hit attack: %v", err)
+	}
+	if raid.Contributions[targetID][bleeder] != 4 || raid.Contributions[targetID][hitter] != 1 {
+		t.Fatalf("bleed damage should be credited to who applied it: %+v", raid.Contributions[targetID])
+	}
+	if raid.Damage[bleeder] != 4 || raid.Damage[hitter] != 1 {
+		t.Fatalf("damage: %+v", raid.Damage)
+	}
+}
+
+func TestRaidAttackRPCReplay(t *testing.T) {
+	nk := newTestNakama()
+	ctx := context.Background()
+	attackType := testSureHitAttack(t, 1)
+	if err := InitEnemyRegistry(ctx, &testLogger{}, nk); err != nil {
+		t.Fatalf("enemy registry: %v", err)
+	}
+	userID := UtilMakeUUID()
+	partyID := nk.testParty(userID)
+	player := NewPlayer(userID, "tester")
+	player.version = "*"
+	player.Loadout = []AttackType{attackType}
+	if err := player.SavePlayerData(nk); err != nil {
+		t.Fatalf("save player: %v", err)
+	}
+	raid, err := JoinOrCreateRaid(ctx, nk, userID, partyID)
+	if err != nil {
+		t.Fatalf("join: %v", err)
+	}
+	var targetID string
+	for id := range raid.Enemies {
+		targetID = id
+	}
+	payload := fmt.Sprintf(`{"raid_id":%q,"target_id":%q,"attack":%q,"request_id":"raid-1"}`, partyID, targetID, attackType)
+
+	first, err := RaidAttackRPC()(testUserContext(userID), &testLogger{}, nil, nk, payload)
+	if err != nil {
+		t.Fatalf("attack: %v", err)
+	}
+	//A retry gets the first response back and doesn't attack again.
+	second, err := RaidAttackRPC()(testUserContext(userID), &testLogger{}, nil, nk, payload)
+	if err != nil || second != first {
+		t.Fatalf("retry: %v\n%s\nwant\n%s", err, second, first)
+	}
+	raid, _ = LoadRaid(ctx, nk, partyID)
+	if raid.Damage[userID] != 1 {
+		t.Fatalf("retry attacked again, damage %d", raid.Damage[userID])
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+var rateLimitDataStorageKey = "rate_limits" //Limits in the config collection.
+var rateLimitStorageCollection = "ratelimit" //Per user bucket state, keyed by rpc name.
+
+const rateLimitPruneSize = 10000 //Number of in memory buckets before idle ones are dropped.
+const rateLimitIdleSeconds = 600 //Buckets untouched this long are dropped when pruning.
+const rateLimitSaveRetries = 3 //Attempts at saving a bucket when another node or request saved it first.
+
+// Signature of a Nakama rpc handler.
+type RpcFunction func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error)
+
+// Token bucket settings for an rpc.
+type RateLimit struct {
+	Capacity float64 `json:"capacity"` //Burst size, the most calls that can be made back to back.
+	RefillPerSecond float64 `json:"refill_per_second"` //Sustained calls per second, 0 never refills so the capacity is every call a user gets.
+	LocalOnly bool `json:"local_only"` //Keep buckets in memory only, each node in a cluster then enforces its own limit.
+}
+
+// Token bucket state for one user and rpc.
+type TokenBucket struct {
+	Tokens float64 `json:"tokens"`
+	UpdatedAt int64 `json:"updated_at"` //Unix nanoseconds of the last refill.
+	version string //Storage version hash from the last read/write ("*" when not stored yet).
+}
+
+// Registry to hold all of the definitions.  Using a mutex here since the data could be live-ops driven meaning it could change after nakama init.
+// **NOTE: If the plan is to not update this information after nakama init then this paradigm can be change to a simple read-only map instead.
+var RateLimitRegistry = struct {
+	sync.RWMutex //Read/write mutex to help with concurrent access allowing mulitple readers or a single writer.
+	Limits map[string]RateLimit
+}{
+	Limits: make(map[string]RateLimit),
+}
+
+// In memory buckets keyed by user id and rpc name.  Storage holds the shared copy, memory keeps its version so a call
+// is a single versioned write unless another node changed it.
+var rateLimitBuckets = struct {
+	sync.Mutex
+	Buckets map[string]*TokenBucket
+}{
+	Buckets: make(map[string]*TokenBucket),
+}
+
+// This function will initialize the Rate Limit Registry.
+func InitRateLimitRegistry(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) error {
+	//Read from the storage engine.
+	rObj, err := nk.StorageRead(ctx, []*runtime.StorageRead{
+		{
+			Collection: configDataStorageCollection,
+			Key: rateLimitDataStorageKey,
+		},
+	})
+	if err != nil {
+		logger.Error("Error getting rate limit configuration data: %v", err)
+		return err
+	}
+	//Load defaults if nothing was found in storage and save them into storage.
+	if len(rObj) == 0 {
+		RateLimitRegistry.Lock()  //Call lock on the mutex in preparation for writing.
+		RateLimitRegistry.Limits["attack_target"] = RateLimit{
+			Capacity: 5,
+			RefillPerSecond: 2,
+		}
+		RateLimitRegistry.Limits["attack_sequence"] = RateLimit{
+			Capacity: 2,
+			RefillPerSecond: 0.5,
+		}
+		RateLimitRegistry.Limits["raid_attack"] = RateLimit{
+			Capacity: 5,
+			RefillPerSecond: 2,
+		}
+		RateLimitRegistry.Limits["load_game"] = RateLimit{
+			Capacity: 3,
+			RefillPerSecond: 0.5,
+		}
+		RateLimitRegistry.Limits["player_info"] = RateLimit{
+			Capacity: 5,
+			RefillPerSecond: 1,
+		}
+		RateLimitRegistry.Unlock() //Don't forget to release the mutex lock.
+		return SaveRateLimitRegistry(nk)
+	}
+
+	var limits map[string]RateLimit
+	if err := json.Unmarshal([]byte(rObj[0].Value), &limits); err != nil {
+		logger.Error("Failed to unmarshal rate limit data: %v", err)
+		return err
+	}
+	RateLimitRegistry.Lock()  //Call lock on the mutex in preparation for writing.
+	RateLimitRegistry.Limits = limits
+	RateLimitRegistry.Unlock() //Don't forget to release the mutex lock.
+
+	return nil
+}
+
+// This function will save the Rate Limit Registry to storage.
+func SaveRateLimitRegistry(nk runtime.NakamaModule) error {
+	RateLimitRegistry.RLock() //Read lock.
+	//Json-ify the rate limit registry in prepartion for storage.
+	data, err := json.Marshal(RateLimitRegistry.Limits)
+	RateLimitRegistry.RUnlock() //Don't forget to release the lock.
+	if err != nil {
+		return err
+	}
+	wObj := []*runtime.StorageWrite{
+		{
+			Collection: configDataStorageCollection,
+			Key: rateLimitDataStorageKey,
+			Value: string(data),
+			PermissionRead: 1, // Owner and runtime can read.
+			PermissionWrite: 0, // No one can write save the runtime.
+		},
+	}
+	//Write to the storage engine.
+	if _, err := nk.StorageWrite(context.Background(), wObj); err != nil {
+		return fmt.Errorf("failed to write rate limit data to storage: %v", err)
+	}
+	return nil
+}
+
+// This function refills the bucket for the time passed and takes a token.  When there isn't one it returns how long until there is.
+func (b *TokenBucket) Take(limit RateLimit, now time.Time) (bool, time.Duration) {
+	elapsed := float64(now.UnixNano() - b.UpdatedAt) / float64(time.Second)
+	if elapsed > 0 {
+		b.Tokens = math.Min(limit.Capacity, b.Tokens + elapsed * limit.RefillPerSecond)
+		b.UpdatedAt = now.UnixNano()
+	}
+	if b.Tokens >= 1 {
+		b.Tokens--
+		return true, 0
+	}
+	if limit.RefillPerSecond <= 0 {
+		return false, 0 //Never refills, there is nothing to wait for.
+	}
+	wait := (1 - b.Tokens) / limit.RefillPerSecond
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+// This function gets a copy of the user's bucket from memory, reading it from storage when it isn't there or reload is
+// set after another node saved it.  Local only buckets never touch storage.
+func getTokenBucket(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID, rpcName string, limit RateLimit, now time.Time, reload bool) TokenBucket {
+	key := userID + "/" + rpcName
+	rateLimitBuckets.Lock()
+	bucket, exists := rateLimitBuckets.Buckets[key]
+	if exists && (!reload || limit.LocalOnly) {
+		copied := *bucket
+		rateLimitBuckets.Unlock()
+		return copied
+	}
+	rateLimitBuckets.Unlock()
+
+	loaded := TokenBucket{Tokens: limit.Capacity, UpdatedAt: now.UnixNano(), version: "*"}
+	if limit.LocalOnly {
+		return loaded
+	}
+	//Read from the storage engine.
+	rObj, err := nk.StorageRead(ctx, []*runtime.StorageRead{
+		{
+			Collection: rateLimitStorageCollection,
+			Key: rpcName,
+			UserID: userID,
+		},
+	})
+	if err != nil {
+		logger.Warn("Unable to read rate limit state, using a full bucket: %v", err)
+		return loaded
+	}
+	if len(rObj) > 0 {
+		stored := TokenBucket{}
+		if err := json.Unmarshal([]byte(rObj[0].Value), &stored); err != nil {
+			logger.Warn("Unable to read rate limit state, replacing it: %v", err)
+		} else {
+			loaded = stored
+		}
+		loaded.version = rObj[0].Version
+	}
+	return loaded
+}
+
+// This function keeps the bucket in memory for the next call.
+func setTokenBucket(userID, rpcName string, bucket TokenBucket, now time.Time) {
+	rateLimitBuckets.Lock()
+	defer rateLimitBuckets.Unlock()
+	if len(rateLimitBuckets.Buckets) >= rateLimitPruneSize {
+		pruneTokenBuckets(now)
+	}
+	rateLimitBuckets.Buckets[userID + "/" + rpcName] = &bucket
+}
+
+// This function drops idle buckets so memory doesn't grow with every user ever seen.  Caller holds the lock.
+func pruneTokenBuckets(now time.Time) {
+	for key, bucket := range rateLimitBuckets.Buckets {
+		if now.UnixNano() - bucket.UpdatedAt > int64(rateLimitIdleSeconds) * int64(time.Second) {
+			delete(rateLimitBuckets.Buckets, key)
+		}
+	}
+}
+
+// This function saves the bucket so other nodes see it.  The version makes it fail if someone else saved it first.
+func saveTokenBucket(ctx context.Context, nk runtime.NakamaModule, userID, rpcName string, bucket *TokenBucket) error {
+	data, err := json.Marshal(bucket)
+	if err != nil {
+		return err
+	}
+	acks, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{
+		{
+			Collection: rateLimitStorageCollection,
+			Key: rpcName,
+			UserID: userID,
+			Value: string(data),
+			Version: bucket.version,
+			PermissionRead: 0, // Only the runtime can read.
+			PermissionWrite: 0, // No one can write save the runtime.
+		},
+	})
+	if err != nil {
+		return err
+	}
+	bucket.version = acks[0].Version
+	return nil
+}
+
+// This function checks the user's token bucket for the rpc.  Returns a ResourceExhausted error with a retry hint when limited.
+func CheckRateLimit(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID, rpcName string) error {
+	RateLimitRegistry.RLock() //Read lock.
+	limit, exists := RateLimitRegistry.Limits[rpcName]
+	RateLimitRegistry.RUnlock() //Release read lock.
+	if !exists || limit.Capacity <= 0 {
+		return nil //Not limited.
+	}
+
+	now := Now() //Server time, user clock offsets don't refill buckets.
+	var allowed bool
+	var wait time.Duration
+	for attempt := 0; attempt < rateLimitSaveRetries; attempt++ {
+		bucket := getTokenBucket(ctx, logger, nk, userID, rpcName, limit, now, attempt > 0)
+		allowed, wait = bucket.Take(limit, now)
+		if limit.LocalOnly {
+			setTokenBucket(userID, rpcName, bucket, now)
+			break
+		}
+		if err := saveTokenBucket(ctx, nk, userID, rpcName, &bucket); err != nil {
+			//Another node or request took a token first, take it again from the stored bucket.
+			logger.Debug("Rate limit save conflict, attempt %d: %v", attempt + 1, err)
+			continue
+		}
+		setTokenBucket(userID, rpcName, bucket, now)
+		break
+	}
+	//When every save failed the last result still stands, storage trouble shouldn't lock players out or let them through.
+	if !allowed {
+		if wait <= 0 {
+			logger.Debug("Rate limited %s for %s, the limit doesn't refill.", rpcName, userID)
+			return NewGameError(CodeResourceExhausted, ReasonRateLimited, fmt.Sprintf("No more %s calls are allowed.", rpcName))
+		}
+		logger.Debug("Rate limited %s for %s, retry after %v.", rpcName, userID, wait)
+		return NewRateLimitError(rpcName, wait)
+	}
+	return nil
+}
+
+// This function wraps an rpc so each call takes a token from the user's bucket first.
+func RateLimited(rpcName string, fn RpcFunction) RpcFunction {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Get the user id from the runtime.
+		userID, err := UtilGetUserId(ctx)
+		if err != nil {
+			logger.Error("Unable to extract user id from context due to error: %v", err)
+			return "", NewGameError(CodeUnauthenticated, ReasonUnauthenticated, "No user id in the context.")
+		}
+		if err := CheckRateLimit(ctx, logger, nk, userID, rpcName); err != nil {
+			return "", err
+		}
+		return fn(ctx, logger, db, nk, payload)
+	}
+}
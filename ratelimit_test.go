@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+func TestTokenBucketTake(t *testing.T) {
+	limit := RateLimit{Capacity: 2, RefillPerSecond: 1}
+	now := time.Unix(1000, 0)
+	bucket := &TokenBucket{Tokens: limit.Capacity, UpdatedAt: now.UnixNano()}
+
+	for i := 0; i < 2; i++ {
+		if allowed, _ := bucket.Take(limit, now); !allowed {
+			t.Fatalf("call %d should be allowed", i)
+		}
+	}
+	allowed, wait := bucket.Take(limit, now)
+	if allowed {
+		t.Fatal("third call should be limited")
+	}
+	if wait != time.Second {
+		t.Fatalf("wait = %v, want 1s", wait)
+	}
+	//Half a token back isn't enough.
+	if allowed, wait := bucket.Take(limit, now.Add(500*time.Millisecond)); allowed || wait != 500*time.Millisecond {
+		t.Fatalf("allowed = %v wait = %v, want limited for 500ms", allowed, wait)
+	}
+	if allowed, _ := bucket.Take(limit, now.Add(time.Second)); !allowed {
+		t.Fatal("call after refill should be allowed")
+	}
+	//Refill never goes over capacity.
+	bucket.Take(limit, now.Add(time.Hour))
+	if bucket.Tokens != limit.Capacity - 1 {
+		t.Fatalf("tokens = %v, want %v", bucket.Tokens, limit.Capacity - 1)
+	}
+}
+
+func TestCheckRateLimit(t *testing.T) {
+	nk := newTestNakama()
+	userID := "7f0e4a55-0d2b-4d38-9d6c-3c3b1f0f4b2a"
+	RateLimitRegistry.Lock()
+	RateLimitRegistry.Limits["test_rpc"] = RateLimit{Capacity: 1, RefillPerSecond: 0.1}
+	RateLimitRegistry.Limits["test_local_rpc"] = RateLimit{Capacity: 1, RefillPerSecond: 0.1, LocalOnly: true}
+	RateLimitRegistry.Unlock()
+	defer func() {
+		RateLimitRegistry.Lock()
+		delete(RateLimitRegistry.Limits, "test_rpc")
+		delete(RateLimitRegistry.Limits, "test_local_rpc")
+		RateLimitRegistry.Unlock()
+		rateLimitBuckets.Lock()
+		delete(rateLimitBuckets.Buckets, userID + "/test_rpc")
+		delete(rateLimitBuckets.Buckets, userID + "/test_local_rpc")
+		rateLimitBuckets.Unlock()
+	}()
+
+	for _, rpcName := range []string{"test_rpc", "test_local_rpc"} {
+		if err := CheckRateLimit(context.Background(), &testLogger{}, nk, userID, rpcName); err != nil {
+			t.Fatalf("%s: first call: %v", rpcName, err)
+		}
+		err := CheckRateLimit(context.Background(), &testLogger{}, nk, userID, rpcName)
+		code, body := testErrorBody(t, err)
+		if code != CodeResourceExhausted || body.Reason != ReasonRateLimited || body.RetryAfter <= 0 {
+			t.Fatalf("%s: got code %d body %+v, want rate limited with a retry hint", rpcName, code, body)
+		}
+	}
+	if objects, _ := nk.StorageRead(context.Background(), []*runtime.StorageRead{{Collection: rateLimitStorageCollection, Key: "test_local_rpc", UserID: userID}}); len(objects) != 0 {
+		t.Fatal("local only buckets shouldn't be stored")
+	}
+
+	//Another node without the bucket in memory picks it up from storage.
+	rateLimitBuckets.Lock()
+	delete(rateLimitBuckets.Buckets, userID + "/test_rpc")
+	rateLimitBuckets.Unlock()
+	if err := CheckRateLimit(context.Background(), &testLogger{}, nk, userID, "test_rpc"); err == nil {
+		t.Fatal("bucket from storage should still be empty")
+	}
+
+	//Rpcs without a limit aren't limited.
+	for i := 0; i < 10; i++ {
+		if err := CheckRateLimit(context.Background(), &testLogger{}, nk, userID, "unlimited_rpc"); err != nil {
+			t.Fatalf("unlimited call: %v", err)
+		}
+	}
+}
+
+func TestCheckRateLimitSharedBetweenNodes(t *testing.T) {
+	nk := newTestNakama()
+	userID := UtilMakeUUID()
+	now := time.Unix(1000, 0)
+	testFixedClock(t, now)
+	RateLimitRegistry.Lock()
+	RateLimitRegistry.Limits["test_shared_rpc"] = RateLimit{Capacity: 2, RefillPerSecond: 0.1}
+	RateLimitRegistry.Unlock()
+	defer func() {
+		RateLimitRegistry.Lock()
+		delete(RateLimitRegistry.Limits, "test_shared_rpc")
+		RateLimitRegistry.Unlock()
+		rateLimitBuckets.Lock()
+		delete(rateLimitBuckets.Buckets, userID + "/test_shared_rpc")
+		rateLimitBuckets.Unlock()
+	}()
+
+	if err := CheckRateLimit(context.Background(), &testLogger{}, nk, userID, "test_shared_rpc"); err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+	//Another node takes the last token, this node's cached version is now stale.
+	bucket := getTokenBucket(context.Background(), &testLogger{}, nk, userID, "test_shared_rpc", RateLimit{Capacity: 2}, now, true)
+	bucket.Tokens = 0
+	if err := saveTokenBucket(context.Background(), nk, userID, "test_shared_rpc", &bucket); err != nil {
+		t.Fatalf("saveTokenBucket: %v", err)
+	}
+	err := CheckRateLimit(context.Background(), &testLogger{}, nk, userID, "test_shared_rpc")
+	if code, body := testErrorBody(t, err); code != CodeResourceExhausted || body.Reason != ReasonRateLimited {
+		t.Fatalf("expected the other node's call to count, got %d %+v", code, body)
+	}
+}
+
+func TestCheckRateLimitWithoutRefill(t *testing.T) {
+	nk := newTestNakama()
+	userID := UtilMakeUUID()
+	RateLimitRegistry.Lock()
+	RateLimitRegistry.Limits["test_capped_rpc"] = RateLimit{Capacity: 1}
+	RateLimitRegistry.Unlock()
+	defer func() {
+		RateLimitRegistry.Lock()
+		delete(RateLimitRegistry.Limits, "test_capped_rpc")
+		RateLimitRegistry.Unlock()
+		rateLimitBuckets.Lock()
+		delete(rateLimitBuckets.Buckets, userID + "/test_capped_rpc")
+		rateLimitBuckets.Unlock()
+	}()
+
+	if err := CheckRateLimit(context.Background(), &testLogger{}, nk, userID, "test_capped_rpc"); err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+	err := CheckRateLimit(context.Background(), &testLogger{}, nk, userID, "test_capped_rpc")
+	if code, body := testErrorBody(t, err); code != CodeResourceExhausted || body.Reason != ReasonRateLimited || body.RetryAfter != 0 {
+		t.Fatalf("expected a rejection without a retry hint, got %d %+v", code, body)
+	}
+}
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+const RequestIDMaxLength = 128 //Longest client supplied request id accepted.
+const EncounterIDMaxLength = 64 //Longest encounter id accepted.
+const AttackSequenceLimit = 10 //Most actions accepted in a single attack_sequence call.
+
+// Every rpc payload implements this so it is checked before any game logic runs.
+type RpcRequest interface {
+	Validate() error
+}
+
+// Payload for load_game.
+type LoadGameRequest struct {
+	RequestID string `json:"request_id"` //Optional, retries with the same id replay the first response.
+}
+
+// Payload for flee_battle.
+type FleeBattleRequest struct {
+	RequestID string `json:"request_id"` //Optional, retries with the same id replay the first response.
+}
+
+// Payload for start_battle, an empty encounter id spawns from the active event or any enemy.
+type StartBattleRequest struct {
+	EncounterID string `json:"encounter_id"`
+	RequestID string `json:"request_id"` //Optional, retries with the same id replay the first response.
+}
+
+// Payload for attack_target.
+type AttackRequest struct {
+	TargetID string `json:"target_id"`
+	Attack AttackType `json:"attack"`
+	RequestID string `json:"request_id"` //Optional, retries with the same id replay the first response.
+}
+
+// Single action in an attack_sequence.  Checked when it runs so a bad action stops the sequence instead of failing it.
+type AttackAction struct {
+	TargetID string `json:"target_id"`
+	Attack AttackType `json:"attack"`
+}
+
+// Payload for attack_sequence, the actions run in order.
+type AttackSequenceRequest struct {
+	Actions []AttackAction `json:"actions"`
+	RequestID string `json:"request_id"` //Optional, retries with the same id replay the first response.
+}
+
+// Payload for join_raid, players sharing a party id share a raid.  Without one a new raid is started.
+type JoinRaidRequest struct {
+	PartyID string `json:"party_id"`
+}
+
+// Payload for raid_info.
+type RaidInfoRequest struct {
+	RaidID string `json:"raid_id"`
+}
+
+// Payload for raid_attack.
+type RaidAttackRequest struct {
+	RaidID string `json:"raid_id"`
+	TargetID string `json:"target_id"`
+	Attack AttackType `json:"attack"`
+	RequestID string `json:"request_id"` //Optional, retries with the same id replay the first response.
+}
+
+// Payload for challenge_duel.
+type ChallengeDuelRequest struct {
+	OpponentID string `json:"opponent_id"`
+	RequestID string `json:"request_id"` //Optional, retries with the same id replay the first response.
+}
+
+// Payload for answer_duel.
+type AnswerDuelRequest struct {
+	DuelID string `json:"duel_id"`
+	Accept bool `json:"accept"`
+}
+
+// Payload for duel_attack.
+type DuelAttackRequest struct {
+	DuelID string `json:"duel_id"`
+	Attack AttackType `json:"attack"`
+	RequestID string `json:"request_id"` //Optional, retries with the same id replay the first response.
+}
+
+// Payload for duel_info.
+type DuelInfoRequest struct {
+	DuelID string `json:"duel_id"`
+}
+
+// Payload for get_rankings.
+type GetRankingsRequest struct {
+	Leaderboard string `json:"leaderboard"` //Leaderboard id, ex: "kills_zombie" or "kills_zombie_weekly".
+	Limit int `json:"limit"` //Optional, how many records to return around the caller.
+}
+
+// Payload for claim_quest and reroll_quest.
+type QuestRequest struct {
+	QuestID string `json:"quest_id"`
+	RequestID string `json:"request_id"` //Optional, retries with the same id replay the first response.
+}
+
+// Payload for claim_idle_rewards.
+type ClaimIdleRewardsRequest struct {
+	RequestID string `json:"request_id"` //Optional, retries with the same id replay the first response.
+}
+
+// Payload for set_clock_offset.
+type SetClockOffsetRequest struct {
+	UserID string `json:"user_id"` //Optional, defaults to the caller.  Required for server to server calls.
+	OffsetSeconds int64 `json:"offset_seconds"` //How far ahead the user's clock runs, 0 resets it.
+}
+
+// Payload for debug_set_health.
+type DebugSetHealthRequest struct {
+	UserID string `json:"user_id"` //Optional, defaults to the caller.  Required for server to server calls.
+	Health int `json:"health"`
+	MaxHealth int `json:"max_health"` //Optional, 0 keeps the current max health.
+}
+
+// Payload for debug_grant_currency.
+type DebugGrantCurrencyRequest struct {
+	UserID string `json:"user_id"` //Optional, defaults to the caller.  Required for server to server calls.
+	Currency CurrencyType `json:"currency"` //Gold, gems or experience.
+	Amount int64 `json:"amount"`
+}
+
+// Payload for debug_spawn_enemy.
+type DebugSpawnEnemyRequest struct {
+	UserID string `json:"user_id"` //Optional, defaults to the caller.  Required for server to server calls.
+	Enemy EnemyType `json:"enemy"`
+}
+
+// Payload for debug_apply_status_effect, an empty target id applies it to the player.
+type DebugApplyStatusEffectRequest struct {
+	UserID string `json:"user_id"` //Optional, defaults to the caller.  Required for server to server calls.
+	StatusEffect StatusEffectType `json:"status_effect"`
+	TargetID string `json:"target_id"`
+}
+
+// Payload for debug_reset_player.
+type DebugResetPlayerRequest struct {
+	UserID string `json:"user_id"` //Optional, defaults to the caller.  Required for server to server calls.
+}
+
+// Payload for use_item, an empty target id means the item is used on the player.
+type UseItemRequest struct {
+	Item ItemType `json:"item"`
+	TargetID string `json:"target_id"`
+	RequestID string `json:"request_id"` //Optional, retries with the same id replay the first response.
+}
+
+// Payload for equip_item.
+type EquipItemRequest struct {
+	Item ItemType `json:"item"`
+	RequestID string `json:"request_id"` //Optional, retries with the same id replay the first response.
+}
+
+// Payload for unequip_item.
+type UnequipItemRequest struct {
+	Slot EquipmentSlot `json:"slot"`
+	RequestID string `json:"request_id"` //Optional, retries with the same id replay the first response.
+}
+
+// Payload for set_loadout.
+type SetLoadoutRequest struct {
+	Attacks []AttackType `json:"attacks"`
+	RequestID string `json:"request_id"` //Optional, retries with the same id replay the first response.
+}
+
+// Payload for purchase, the request id is generated by the client and reused on retries.
+type PurchaseRequest struct {
+	OfferID string `json:"offer_id"`
+	RequestID string `json:"request_id"`
+}
+
+// This function reads the payload into the request and validates it.  An empty payload is treated as an empty object.
+func DecodeRequest(payload string, request RpcRequest) error {
+	if strings.TrimSpace(payload) == "" {
+		payload = "{}"
+	}
+	if err := json.Unmarshal([]byte(payload), request); err != nil {
+		return NewGameError(CodeInvalidArgument, ReasonInvalidPayload, "Unable to unmarshal payload.")
+	}
+	return request.Validate()
+}
+
+// This function marshals the response for the client.
+func EncodeResponse(logger runtime.Logger, response interface{}) (string, error) {
+	jRes, err := json.Marshal(response)
+	if err != nil {
+		//More robust logging to get more info.
+		logger.WithFields(map[string]interface{}{
+			"response": response,
+		}).Error("Unable to marshal client response: %v.", err)
+		return "", AsGameError(err)
+	}
+	return string(jRes), nil
+}
+
+// This function checks a field holds a UUID.
+func ValidateUUID(field, value string) error {
+	if value == "" {
+		return NewFieldError(field, fmt.Sprintf("%s is required.", field))
+	}
+	if _, err := uuid.Parse(value); err != nil {
+		return NewFieldError(field, fmt.Sprintf("%s must be a UUID.", field))
+	}
+	return nil
+}
+
+// This function checks a field is empty or holds a UUID.
+func ValidateOptionalUUID(field, value string) error {
+	if value == "" {
+		return nil
+	}
+	return ValidateUUID(field, value)
+}
+
+// This function checks a field holds an attack from the registry.
+func ValidateAttackType(field string, attackType AttackType) error {
+	if attackType == "" {
+		return NewFieldError(field, fmt.Sprintf("%s is required.", field))
+	}
+	AttackRegistry.RLock() //Read lock.
+	_, exists := AttackRegistry.Attacks[attackType]
+	AttackRegistry.RUnlock() //Release read lock.
+	if !exists {
+		return NewFieldError(field, fmt.Sprintf("Unknown attack: %s", attackType))
+	}
+	return nil
+}
+
+// This function checks a field holds an item from the registry.
+func ValidateItemType(field string, itemType ItemType) error {
+	if itemType == "" {
+		return NewFieldError(field, fmt.Sprintf("%s is required.", field))
+	}
+	if _, exists := GetItem(itemType); !exists {
+		return NewFieldError(field, fmt.Sprintf("Unknown item: %s", itemType))
+	}
+	return nil
+}
+
+// This function checks a client supplied request id.
+func ValidateRequestID(field, requestID string, required bool) error {
+	if requestID == "" {
+		if required {
+			return NewFieldError(field, fmt.Sprintf("%s is required.", field))
+		}
+		return nil
+	}
+	if len(requestID) > RequestIDMaxLength {
+		return NewFieldError(field, fmt.Sprintf("%s can't be longer than %d characters.", field, RequestIDMaxLength))
+	}
+	return nil
+}
+
+// Request with no fields, used by rpcs that don't take a payload.
+type EmptyRequest struct{}
+
+func (r *EmptyRequest) Validate() error {
+	return nil
+}
+
+func (r *LoadGameRequest) Validate() error {
+	return ValidateRequestID("request_id", r.RequestID, false)
+}
+
+func (r *ClaimIdleRewardsRequest) Validate() error {
+	return ValidateRequestID("request_id", r.RequestID, false)
+}
+
+func (r *SetClockOffsetRequest) Validate() error {
+	if err := ValidateOptionalUUID("user_id", r.UserID); err != nil {
+		return err
+	}
+	if r.OffsetSeconds < 0 || r.OffsetSeconds > int64(MaxClockOffset.Seconds()) {
+		return NewFieldError("offset_seconds", fmt.Sprintf("offset_seconds must be between 0 and %d.", int64(MaxClockOffset.Seconds())))
+	}
+	return nil
+}
+
+func (r *DebugSetHealthRequest) Validate() error {
+	if err := ValidateOptionalUUID("user_id", r.UserID); err != nil {
+		return err
+	}
+	if r.Health < 0 {
+		return NewFieldError("health", "health can't be negative.")
+	}
+	if r.MaxHealth < 0 {
+		return NewFieldError("max_health", "max_health can't be negative.")
+	}
+	return nil
+}
+
+func (r *DebugGrantCurrencyRequest) Validate() error {
+	if err := ValidateOptionalUUID("user_id", r.UserID); err != nil {
+		return err
+	}
+	if r.Currency != Gold && r.Currency != Gems && r.Currency != Experience {
+		return NewFieldError("currency", fmt.Sprintf("Unknown currency: %s", r.Currency))
+	}
+	if r.Amount <= 0 {
+		return NewFieldError("amount", "amount must be at least 1.")
+	}
+	return nil
+}
+
+func (r *DebugSpawnEnemyRequest) Validate() error {
+	if err := ValidateOptionalUUID("user_id", r.UserID); err != nil {
+		return err
+	}
+	if r.Enemy == "" {
+		return NewFieldError("enemy", "enemy is required.")
+	}
+	return nil
+}
+
+func (r *DebugApplyStatusEffectRequest) Validate() error {
+	if err := ValidateOptionalUUID("user_id", r.UserID); err != nil {
+		return err
+	}
+	if err := ValidateOptionalUUID("target_id", r.TargetID); err != nil {
+		return err
+	}
+	if r.StatusEffect == "" {
+		return NewFieldError("status_effect", "status_effect is required.")
+	}
+	StatusEffectsRegistry.RLock() //Read lock.
+	_, exists := StatusEffectsRegistry.StatusEffects[r.StatusEffect]
+	StatusEffectsRegistry.RUnlock() //Release read lock.
+	if !exists {
+		return NewFieldError("status_effect", fmt.Sprintf("Unknown status effect: %s", r.StatusEffect))
+	}
+	return nil
+}
+
+func (r *DebugResetPlayerRequest) Validate() error {
+	return ValidateOptionalUUID("user_id", r.UserID)
+}
+
+func (r *FleeBattleRequest) Validate() error {
+	return ValidateRequestID("request_id", r.RequestID, false)
+}
+
+func (r *StartBattleRequest) Validate() error {
+	if len(r.EncounterID) > EncounterIDMaxLength {
+		return NewFieldError("encounter_id", fmt.Sprintf("encounter_id can't be longer than %d characters.", EncounterIDMaxLength))
+	}
+	return ValidateRequestID("request_id", r.RequestID, false)
+}
+
+func (r *AttackRequest) Validate() error {
+	if err := ValidateUUID("target_id", r.TargetID); err != nil {
+		return err
+	}
+	if err := ValidateAttackType("attack", r.Attack); err != nil {
+		return err
+	}
+	return ValidateRequestID("request_id", r.RequestID, false)
+}
+
+func (r *AttackSequenceRequest) Validate() error {
+	if len(r.Actions) == 0 || len(r.Actions) > AttackSequenceLimit {
+		return NewFieldError("actions", fmt.Sprintf("Sequence must have between 1 and %d actions.", AttackSequenceLimit))
+	}
+	return ValidateRequestID("request_id", r.RequestID, false)
+}
+
+// This function checks a single sequence action the same way attack_target checks its payload.
+func (a AttackAction) Validate() error {
+	if err := ValidateUUID("target_id", a.TargetID); err != nil {
+		return err
+	}
+	return ValidateAttackType("attack", a.Attack)
+}
+
+func (r *JoinRaidRequest) Validate() error {
+	return ValidateRequestID("party_id", r.PartyID, false)
+}
+
+func (r *RaidInfoRequest) Validate() error {
+	return ValidateRequestID("raid_id", r.RaidID, true)
+}
+
+func (r *RaidAttackRequest) Validate() error {
+	if err := ValidateRequestID("raid_id", r.RaidID, true); err != nil {
+		return err
+	}
+	if err := (AttackAction{TargetID: r.TargetID, Attack: r.Attack}).Validate(); err != nil {
+		return err
+	}
+	return ValidateRequestID("request_id", r.RequestID, false)
+}
+
+func (r *ChallengeDuelRequest) Validate() error {
+	if err := ValidateUUID("opponent_id", r.OpponentID); err != nil {
+		return err
+	}
+	return ValidateRequestID("request_id", r.RequestID, false)
+}
+
+func (r *AnswerDuelRequest) Validate() error {
+	return ValidateUUID("duel_id", r.DuelID)
+}
+
+func (r *DuelAttackRequest) Validate() error {
+	if err := ValidateUUID("duel_id", r.DuelID); err != nil {
+		return err
+	}
+	if err := ValidateAttackType("attack", r.Attack); err != nil {
+		return err
+	}
+	return ValidateRequestID("request_id", r.RequestID, false)
+}
+
+func (r *DuelInfoRequest) Validate() error {
+	return ValidateUUID("duel_id", r.DuelID)
+}
+
+func (r *GetRankingsRequest) Validate() error {
+	if r.Leaderboard == "" {
+		return NewFieldError("leaderboard", "leaderboard is required.")
+	}
+	if !IsLeaderboard(r.Leaderboard) {
+		return NewFieldError("leaderboard", fmt.Sprintf("Unknown leaderboard: %s", r.Leaderboard))
+	}
+	if r.Limit < 0 || r.Limit > RankingsMaxLimit {
+		return NewFieldError("limit", fmt.Sprintf("limit must be between 1 and %d, or 0 for the default of %d.", RankingsMaxLimit, RankingsDefaultLimit))
+	}
+	return nil
+}
+
+func (r *QuestRequest) Validate() error {
+	if err := ValidateRequestID("quest_id", r.QuestID, true); err != nil {
+		return err
+	}
+	return ValidateRequestID("request_id", r.RequestID, false)
+}
+
+func (r *UseItemRequest) Validate() error {
+	if err := ValidateItemType("item", r.Item); err != nil {
+		return err
+	}
+	if r.TargetID != "" {
+		if err := ValidateUUID("target_id", r.TargetID); err != nil {
+			return err
+		}
+	}
+	return ValidateRequestID("request_id", r.RequestID, false)
+}
+
+func (r *EquipItemRequest) Validate() error {
+	if err := ValidateItemType("item", r.Item); err != nil {
+		return err
+	}
+	return ValidateRequestID("request_id", r.RequestID, false)
+}
+
+func (r *UnequipItemRequest) Validate() error {
+	if !IsEquipmentSlot(r.Slot) {
+		return NewFieldError("slot", fmt.Sprintf("Unknown equipment slot: %s", r.Slot))
+	}
+	return ValidateRequestID("request_id", r.RequestID, false)
+}
+
+func (r *SetLoadoutRequest) Validate() error {
+	if len(r.Attacks) == 0 || len(r.Attacks) > LoadoutSize {
+		return NewFieldError("attacks", fmt.Sprintf("Loadout must have between 1 and %d attacks.", LoadoutSize))
+	}
+	for _, attackType := range r.Attacks {
+		if err := ValidateAttackType("attacks", attackType); err != nil {
+			return err
+		}
+	}
+	return ValidateRequestID("request_id", r.RequestID, false)
+}
+
+func (r *PurchaseRequest) Validate() error {
+	if r.OfferID == "" {
+		return NewFieldError("offer_id", "offer_id is required.")
+	}
+	return ValidateRequestID("request_id", r.RequestID, true)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"encoding/json"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// This function reads the reason and field out of a game error.
+func testErrorBody(t *testing.T, err error) (int, GameError) {
+	t.Helper()
+	rErr, ok := err.(*runtime.Error)
+	if !ok {
+		t.Fatalf("expected a runtime error, got %T: %v", err, err)
+	}
+	var body GameError
+	if jErr := json.Unmarshal([]byte(rErr.Message), &body); jErr != nil {
+		t.Fatalf("expected a json error body, got %q", rErr.Message)
+	}
+	return rErr.Code, body
+}
+
+func TestDecodeAttackRequest(t *testing.T) {
+	InitAttackRegistry()
+	var request AttackRequest
+	if err := DecodeRequest(`{"target_id":"`+UtilMakeUUID()+`","attack":"jab"}`, &request); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cases := []struct {
+		payload string
+		reason ErrorReason
+		field string
+	}{
+		{`not json`, ReasonInvalidPayload, ""},
+		{``, ReasonInvalidField, "target_id"},
+		{`{"target_id":"abc","attack":"jab"}`, ReasonInvalidField, "target_id"},
+		{`{"target_id":"` + UtilMakeUUID() + `","attack":"fireball"}`, ReasonInvalidField, "attack"},
+	}
+	for _, c := range cases {
+		err := DecodeRequest(c.payload, &AttackRequest{})
+		code, body := testErrorBody(t, err)
+		if code != CodeInvalidArgument || body.Reason != c.reason || body.Field != c.field {
+			t.Fatalf("payload %q: expected %d/%s/%s, got %d/%+v", c.payload, CodeInvalidArgument, c.reason, c.field, code, body)
+		}
+	}
+}
+
+func TestAsGameErrorHidesRawErrors(t *testing.T) {
+	code, body := testErrorBody(t, AsGameError(json.Unmarshal([]byte("x"), &struct{}{})))
+	if code != CodeInternal || body.Reason != ReasonInternal {
+		t.Fatalf("expected an internal error, got %d/%+v", code, body)
+	}
+	gameErr := NewGameError(CodeFailedPrecondition, ReasonPlayerDead, "Player is deceased.")
+	if AsGameError(gameErr) != gameErr {
+		t.Fatalf("expected game errors to pass through")
+	}
+}
+
+func TestGetRankingsRequestLimit(t *testing.T) {
+	request := GetRankingsRequest{Leaderboard: KillsLeaderboard}
+	if err := request.Validate(); err != nil {
+		t.Fatalf("0 should use the default limit: %v", err)
+	}
+	for _, limit := range []int{-1, RankingsMaxLimit + 1} {
+		request.Limit = limit
+		code, body := testErrorBody(t, request.Validate())
+		if code != CodeInvalidArgument || body.Field != "limit" || body.Message != fmt.Sprintf("limit must be between 1 and %d, or 0 for the default of %d.", RankingsMaxLimit, RankingsDefaultLimit) {
+			t.Fatalf("limit %d: code %d body %+v", limit, code, body)
+		}
+	}
+}
@@ -3,7 +3,8 @@ package main
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
+	"fmt"
+	"time"
 
 	"github.com/heroiclabs/nakama-common/runtime"
 )
@@ -14,92 +15,257 @@ func LoadGameRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB,
 		userID, err := UtilGetUserId(ctx)
 		if err != nil {
 			logger.Error("Unable to extract user id from context due to error: %v", err)
+			return "", NewGameError(CodeUnauthenticated, ReasonUnauthenticated, "No user id in the context.")
+		}
+
+		//Read and validate the client payload.
+		var loadGameRequest LoadGameRequest
+		if err := DecodeRequest(payload, &loadGameRequest); err != nil {
+			return "", err
+		}
+
+		//Replay the response if this request id was already handled.
+		requestLog, replay, err := BeginRequest(ctx, logger, nk, userID, "load_game", loadGameRequest.RequestID, payload)
+		if err != nil {
 			return "", err
 		}
+		if replay != "" {
+			return replay, nil
+		}
 
 		//Get Player object.
 		player, err := LoadPlayerData(ctx, logger, nk, userID)
 		if err != nil {
 			logger.Error("Unable to load player data: %v", err)
-			return "", err
+			return "", AsGameError(err)
 		}
 
 		//Get on-going battle state OR start a battle.
 		err = player.LoadBattleState()
 		if err != nil {
 			logger.Error("Unable to get battle state: %v", err)
+			return "", AsGameError(err)
+		}
+
+		//Limited scope response struct
+		response := struct {
+			PlayerData *Player `json:"player_data"`
+		}{
+			PlayerData: player,
+		}
+
+		//Save any changes to player object along with the response for retries, then return info to the client.
+		return CommitRequest(ctx, logger, nk, requestLog, player, response)
+	}
+}
+
+func AttackTargetRPC()func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Get the user id from the runtime.
+		userID, err := UtilGetUserId(ctx)
+		if err != nil {
+			logger.Error("Unable to extract user id from context due to error: %v", err)
+			return "", NewGameError(CodeUnauthenticated, ReasonUnauthenticated, "No user id in the context.")
+		}
+
+		//Read and validate the client payload.
+		var attackRequest AttackRequest
+		if err := DecodeRequest(payload, &attackRequest); err != nil {
 			return "", err
 		}
+		logger.Debug("attackRequest: %+v", attackRequest)
 
-		//Save the changes to player object.
-		err = player.SavePlayerData(nk)
+		//Replay the response if this request id was already handled.
+		requestLog, replay, err := BeginRequest(ctx, logger, nk, userID, "attack_target", attackRequest.RequestID, payload)
 		if err != nil {
-			logger.Error("Unable to save player data: %v", err)
 			return "", err
 		}
+		if replay != "" {
+			return replay, nil
+		}
+
+		//The running battle match owns the battle, a change saved here would be written over by the match.
+		if err := CheckNoBattleMatch(ctx, nk, userID); err != nil {
+			return "", AsGameError(err)
+		}
+
+		//Get Player object.
+		player, err := LoadPlayerData(ctx, logger, nk, userID)
+		if err != nil {
+			logger.Error("Unable to load player data: %v", err)
+			return "", AsGameError(err)
+		}
+
+		//Perform the attack.
+		result, err := player.PlayerAttack(logger, attackRequest.TargetID, attackRequest.Attack)
+		if err != nil {
+			return "", AsGameError(err)
+		}
 
 		//Limited scope response struct
 		response := struct {
+			Result *AttackResult `json:"result"`
 			PlayerData *Player `json:"player_data"`
 		}{
+			Result: result,
 			PlayerData: player,
 		}
 
-		//Return info to the client.
-		jRes, err := json.Marshal(response)
+		//Save any changes to player object along with the response for retries, then return info to the client.
+		return CommitRequest(ctx, logger, nk, requestLog, player, response)
+	}
+}
+
+func AttackSequenceRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Get the user id from the runtime.
+		userID, err := UtilGetUserId(ctx)
+		if err != nil {
+			logger.Error("Unable to extract user id from context due to error: %v", err)
+			return "", NewGameError(CodeUnauthenticated, ReasonUnauthenticated, "No user id in the context.")
+		}
+
+		//Read and validate the client payload.
+		var sequenceRequest AttackSequenceRequest
+		if err := DecodeRequest(payload, &sequenceRequest); err != nil {
+			return "", err
+		}
+		logger.Debug("sequenceRequest: %+v", sequenceRequest)
+
+		//Replay the response if this request id was already handled.
+		requestLog, replay, err := BeginRequest(ctx, logger, nk, userID, "attack_sequence", sequenceRequest.RequestID, payload)
 		if err != nil {
-			//More robust logging to get more info.
-			logger.WithFields(map[string]interface{}{
-				"response": response,
-			}).Error("Unable to marshal client response: %v.", err)
 			return "", err
 		}
+		if replay != "" {
+			return replay, nil
+		}
+
+		//The running battle match owns the battle, a change saved here would be written over by the match.
+		if err := CheckNoBattleMatch(ctx, nk, userID); err != nil {
+			return "", AsGameError(err)
+		}
+
+		//Get Player object.
+		player, err := LoadPlayerData(ctx, logger, nk, userID)
+		if err != nil {
+			logger.Error("Unable to load player data: %v", err)
+			return "", AsGameError(err)
+		}
+
+		//Perform the attacks in order.
+		results, stopReason := player.AttackSequence(logger, sequenceRequest.Actions)
+
+		//Limited scope response struct
+		response := struct {
+			Results []AttackSequenceResult `json:"results"`
+			StopReason SequenceStopReason `json:"stop_reason,omitempty"`
+			PlayerData *Player `json:"player_data"`
+		}{
+			Results: results,
+			StopReason: stopReason,
+			PlayerData: player,
+		}
 
-		return string(jRes), nil
+		//Save any changes to player object along with the response for retries, then return info to the client.
+		return CommitRequest(ctx, logger, nk, requestLog, player, response)
 	}
 }
 
-func AttackTargetRPC()func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+func FleeBattleRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
 	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
 		//Get the user id from the runtime.
 		userID, err := UtilGetUserId(ctx)
 		if err != nil {
 			logger.Error("Unable to extract user id from context due to error: %v", err)
+			return "", NewGameError(CodeUnauthenticated, ReasonUnauthenticated, "No user id in the context.")
+		}
+
+		//Read and validate the client payload.
+		var fleeRequest FleeBattleRequest
+		if err := DecodeRequest(payload, &fleeRequest); err != nil {
 			return "", err
 		}
 
-		//Client payload structure
-		var attackRequest = struct {
-			TargetID string `json:"target_id"`
-			Attack AttackType `json:"attack"`
-		}{
-			TargetID: "",
-			Attack: "",
+		//Replay the response if this request id was already handled.
+		requestLog, replay, err := BeginRequest(ctx, logger, nk, userID, "flee_battle", fleeRequest.RequestID, payload)
+		if err != nil {
+			return "", err
 		}
-		if err := json.Unmarshal([]byte(payload), &attackRequest); err != nil {
-			return "", runtime.NewError("unable to unmarshal payload", 13)
+		if replay != "" {
+			return replay, nil
+		}
+
+		//The running battle match owns the battle, a change saved here would be written over by the match.
+		if err := CheckNoBattleMatch(ctx, nk, userID); err != nil {
+			return "", AsGameError(err)
 		}
-		logger.Debug("attackRequest: %+v", attackRequest)
 
 		//Get Player object.
 		player, err := LoadPlayerData(ctx, logger, nk, userID)
 		if err != nil {
 			logger.Error("Unable to load player data: %v", err)
-			return "", err
+			return "", AsGameError(err)
 		}
 
-		//Perform the attack.
-		err = player.PlayerAttack(logger, attackRequest.TargetID, attackRequest.Attack)
+		//Leave the battle, the next load_game starts a new one.
+		if err := player.FleeBattle(); err != nil {
+			return "", AsGameError(err)
+		}
+
+		//Limited scope response struct
+		response := struct {
+			PlayerData *Player `json:"player_data"`
+		}{
+			PlayerData: player,
+		}
+
+		//Save any changes to player object along with the response for retries, then return info to the client.
+		return CommitRequest(ctx, logger, nk, requestLog, player, response)
+	}
+}
+
+func StartBattleRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Get the user id from the runtime.
+		userID, err := UtilGetUserId(ctx)
 		if err != nil {
+			logger.Error("Unable to extract user id from context due to error: %v", err)
+			return "", NewGameError(CodeUnauthenticated, ReasonUnauthenticated, "No user id in the context.")
+		}
+
+		//Read and validate the client payload.
+		var startRequest StartBattleRequest
+		if err := DecodeRequest(payload, &startRequest); err != nil {
 			return "", err
 		}
+		logger.Debug("Start battle request: %+v", startRequest)
 
-		//Save any changes to player object.
-		err = player.SavePlayerData(nk)
+		//Replay the response if this request id was already handled.
+		requestLog, replay, err := BeginRequest(ctx, logger, nk, userID, "start_battle", startRequest.RequestID, payload)
 		if err != nil {
-			logger.Error("Unable to save player data: %v", err)
 			return "", err
 		}
+		if replay != "" {
+			return replay, nil
+		}
+
+		//The running battle match owns the battle, a change saved here would be written over by the match.
+		if err := CheckNoBattleMatch(ctx, nk, userID); err != nil {
+			return "", AsGameError(err)
+		}
+
+		//Get Player object.
+		player, err := LoadPlayerData(ctx, logger, nk, userID)
+		if err != nil {
+			logger.Error("Unable to load player data: %v", err)
+			return "", AsGameError(err)
+		}
+
+		//Spawn the encounter's enemies, checked against the player's level and unlocks.
+		if err := player.StartEncounter(startRequest.EncounterID); err != nil {
+			return "", AsGameError(err)
+		}
 
 		//Limited scope response struct
 		response := struct {
@@ -108,57 +274,1368 @@ func AttackTargetRPC()func(ctx context.Context, logger runtime.Logger, db *sql.D
 			PlayerData: player,
 		}
 
+		//Save any changes to player object along with the response for retries, then return info to the client.
+		return CommitRequest(ctx, logger, nk, requestLog, player, response)
+	}
+}
+
+func ListEncountersRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Get the user id from the runtime.
+		userID, err := UtilGetUserId(ctx)
+		if err != nil {
+			logger.Error("Unable to extract user id from context due to error: %v", err)
+			return "", NewGameError(CodeUnauthenticated, ReasonUnauthenticated, "No user id in the context.")
+		}
+
+		//Get Player object for the unlocks.
+		player, err := LoadPlayerData(ctx, logger, nk, userID)
+		if err != nil {
+			logger.Error("Unable to load player data: %v", err)
+			return "", AsGameError(err)
+		}
+
+		//Limited scope response struct
+		response := struct {
+			Encounters []PlayerEncounter `json:"encounters"`
+		}{
+			Encounters: player.ListEncounters(),
+		}
+
 		//Return info to the client.
-		jRes, err := json.Marshal(response)
+		return EncodeResponse(logger, response)
+	}
+}
+
+func BattleMatchRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Get the user id from the runtime.
+		userID, err := UtilGetUserId(ctx)
 		if err != nil {
-			//More robust logging to get more info.
-			logger.WithFields(map[string]interface{}{
-				"response": response,
-			}).Error("Unable to marshal client response: %v.", err)
-			return "", err
+			logger.Error("Unable to extract user id from context due to error: %v", err)
+			return "", NewGameError(CodeUnauthenticated, ReasonUnauthenticated, "No user id in the context.")
+		}
+
+		//Get the running battle match or start one.
+		matchID, err := FindOrCreateBattleMatch(ctx, nk, userID)
+		if err != nil {
+			logger.Error("Unable to create battle match: %v", err)
+			return "", AsGameError(err)
+		}
+
+		//Limited scope response struct
+		response := struct {
+			MatchID string `json:"match_id"`
+		}{
+			MatchID: matchID,
 		}
 
-		return string(jRes), nil
+		//Return info to the client.
+		return EncodeResponse(logger, response)
 	}
 }
 
-func PlayerInfoRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+func JoinRaidRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
 	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
 		//Get the user id from the runtime.
 		userID, err := UtilGetUserId(ctx)
 		if err != nil {
 			logger.Error("Unable to extract user id from context due to error: %v", err)
+			return "", NewGameError(CodeUnauthenticated, ReasonUnauthenticated, "No user id in the context.")
+		}
+
+		//Read and validate the client payload.
+		var joinRequest JoinRaidRequest
+		if err := DecodeRequest(payload, &joinRequest); err != nil {
 			return "", err
 		}
+		logger.Debug("joinRequest: %+v", joinRequest)
 
-		//Get Player object.
-		player, err := LoadPlayerData(ctx, logger, nk, userID)
+		//Join the party raid or start one.
+		raid, err := JoinOrCreateRaid(ctx, nk, userID, joinRequest.PartyID)
 		if err != nil {
-			logger.Error("Unable to load player data: %v", err)
+			logger.Error("Unable to join raid: %v", err)
+			return "", AsGameError(err)
+		}
+
+		//Limited scope response struct
+		response := struct {
+			Raid *Raid `json:"raid"`
+		}{
+			Raid: raid,
+		}
+
+		//Return info to the client.
+		return EncodeResponse(logger, response)
+	}
+}
+
+func RaidInfoRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Get the user id from the runtime.
+		userID, err := UtilGetUserId(ctx)
+		if err != nil {
+			logger.Error("Unable to extract user id from context due to error: %v", err)
+			return "", NewGameError(CodeUnauthenticated, ReasonUnauthenticated, "No user id in the context.")
+		}
+
+		//Read and validate the client payload.
+		var infoRequest RaidInfoRequest
+		if err := DecodeRequest(payload, &infoRequest); err != nil {
 			return "", err
 		}
 
+		//Get the raid, finished raids are still shown.
+		raid, err := LoadRaid(ctx, nk, infoRequest.RaidID)
+		if err != nil {
+			logger.Error("Unable to load raid: %v", err)
+			return "", AsGameError(err)
+		}
+		if raid == nil || !raid.IsMember(userID) {
+			return "", NewGameError(CodeNotFound, ReasonRaidNotFound, fmt.Sprintf("Raid not found: %s", infoRequest.RaidID))
+		}
+
 		//Limited scope response struct
 		response := struct {
-			PlayerHealth int `json:"player_health"`
-			StatusEffects []*StatusEffect `json:"status_effects"`
-			BattleStats map[EnemyType]int `json:"battle_stats"`
+			Raid *Raid `json:"raid"`
 		}{
-			PlayerHealth: player.Health,
-			StatusEffects: player.StatusEffects,
-			BattleStats: player.BattleStats,
+			Raid: raid,
+		}
+
+		//Return info to the client.
+		return EncodeResponse(logger, response)
+	}
+}
+
+func RaidAttackRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Get the user id from the runtime.
+		userID, err := UtilGetUserId(ctx)
+		if err != nil {
+			logger.Error("Unable to extract user id from context due to error: %v", err)
+			return "", NewGameError(CodeUnauthenticated, ReasonUnauthenticated, "No user id in the context.")
+		}
+
+		//Read and validate the client payload.
+		var raidAttackRequest RaidAttackRequest
+		if err := DecodeRequest(payload, &raidAttackRequest); err != nil {
+			return "", err
+		}
+		logger.Debug("raidAttackRequest: %+v", raidAttackRequest)
+
+		//Replay the response if this request id was already handled.
+		requestLog, replay, err := BeginRequest(ctx, logger, nk, userID, "raid_attack", raidAttackRequest.RequestID, payload)
+		if err != nil {
+			return "", err
+		}
+		if replay != "" {
+			return replay, nil
+		}
+
+		//Perform the attack, the raid, players and request log are saved inside.
+		result, raid, player, err := RaidAttack(ctx, logger, nk, requestLog, userID, raidAttackRequest.RaidID, raidAttackRequest.TargetID, raidAttackRequest.Attack)
+		if err != nil {
+			return "", AsGameError(err)
 		}
 
 		//Return info to the client.
-		jRes, err := json.Marshal(response)
+		return EncodeResponse(logger, RaidAttackResponse(result, raid, player))
+	}
+}
+
+func ChallengeDuelRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Get the user id from the runtime.
+		userID, err := UtilGetUserId(ctx)
+		if err != nil {
+			logger.Error("Unable to extract user id from context due to error: %v", err)
+			return "", NewGameError(CodeUnauthenticated, ReasonUnauthenticated, "No user id in the context.")
+		}
+
+		//Read and validate the client payload.
+		var challengeRequest ChallengeDuelRequest
+		if err := DecodeRequest(payload, &challengeRequest); err != nil {
+			return "", err
+		}
+		logger.Debug("challengeRequest: %+v", challengeRequest)
+
+		//Replay the response if this request id was already handled.
+		requestLog, replay, err := BeginRequest(ctx, logger, nk, userID, "challenge_duel", challengeRequest.RequestID, payload)
 		if err != nil {
-			//More robust logging to get more info.
-			logger.WithFields(map[string]interface{}{
-				"response": response,
-			}).Error("Unable to marshal client response: %v.", err)
 			return "", err
 		}
+		if replay != "" {
+			return replay, nil
+		}
+
+		//Get Player object.
+		player, err := LoadPlayerData(ctx, logger, nk, userID)
+		if err != nil {
+			logger.Error("Unable to load player data: %v", err)
+			return "", AsGameError(err)
+		}
+
+		//Create the challenge and notify the opponent, the request log is saved with the duel.
+		duel, err := ChallengeDuel(ctx, logger, nk, requestLog, player, challengeRequest.OpponentID)
+		if err != nil {
+			logger.Error("Unable to create duel: %v", err)
+			return "", AsGameError(err)
+		}
 
-		return string(jRes), nil
+		//Return info to the client.
+		return EncodeResponse(logger, DuelResponse(duel))
 	}
-}
\ No newline at end of file
+}
+
+func AnswerDuelRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Get the user id from the runtime.
+		userID, err := UtilGetUserId(ctx)
+		if err != nil {
+			logger.Error("Unable to extract user id from context due to error: %v", err)
+			return "", NewGameError(CodeUnauthenticated, ReasonUnauthenticated, "No user id in the context.")
+		}
+
+		//Read and validate the client payload.
+		var answerRequest AnswerDuelRequest
+		if err := DecodeRequest(payload, &answerRequest); err != nil {
+			return "", err
+		}
+		logger.Debug("answerRequest: %+v", answerRequest)
+
+		//Only the challenged player can answer.
+		duel, err := LoadPlayerDuel(ctx, nk, userID, answerRequest.DuelID)
+		if err != nil {
+			return "", AsGameError(err)
+		}
+		if duel.Opponent != userID {
+			return "", NewGameError(CodePermissionDenied, ReasonPermissionDenied, "Only the challenged player can answer.")
+		}
+		now := Now().Unix() //Server clock, a tester's clock offset mustn't time out the other player.
+		if duel.CheckTimeout(now) {
+			if err := SaveDuel(ctx, nk, duel, false); err != nil {
+				return "", AsGameError(err)
+			}
+		}
+
+		//Get both Player objects for the fighters.
+		challenger, err := LoadPlayerData(ctx, logger, nk, duel.Challenger)
+		if err != nil {
+			logger.Error("Unable to load player data: %v", err)
+			return "", AsGameError(err)
+		}
+		opponent, err := LoadPlayerData(ctx, logger, nk, userID)
+		if err != nil {
+			logger.Error("Unable to load player data: %v", err)
+			return "", AsGameError(err)
+		}
+
+		//Answer and let the challenger know.
+		if err := duel.Answer(challenger, opponent, answerRequest.Accept, now); err != nil {
+			return "", AsGameError(err)
+		}
+		if err := SaveDuel(ctx, nk, duel, false); err != nil {
+			logger.Error("Unable to save duel: %v", err)
+			return "", AsGameError(err)
+		}
+		NotifyDuel(ctx, logger, nk, duel, duel.Challenger, "Duel answered", DuelAnswerNotificationCode)
+
+		//Return info to the client.
+		return EncodeResponse(logger, DuelResponse(duel))
+	}
+}
+
+func DuelAttackRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Get the user id from the runtime.
+		userID, err := UtilGetUserId(ctx)
+		if err != nil {
+			logger.Error("Unable to extract user id from context due to error: %v", err)
+			return "", NewGameError(CodeUnauthenticated, ReasonUnauthenticated, "No user id in the context.")
+		}
+
+		//Read and validate the client payload.
+		var duelAttackRequest DuelAttackRequest
+		if err := DecodeRequest(payload, &duelAttackRequest); err != nil {
+			return "", err
+		}
+		logger.Debug("duelAttackRequest: %+v", duelAttackRequest)
+
+		//Replay the response if this request id was already handled, a retry must not be told it isn't their turn.
+		requestLog, replay, err := BeginRequest(ctx, logger, nk, userID, "duel_attack", duelAttackRequest.RequestID, payload)
+		if err != nil {
+			return "", err
+		}
+		if replay != "" {
+			return replay, nil
+		}
+
+		//Get the duel, a player that ran out of time forfeits here.
+		duel, err := LoadPlayerDuel(ctx, nk, userID, duelAttackRequest.DuelID)
+		if err != nil {
+			return "", AsGameError(err)
+		}
+		now := Now().Unix() //Server clock, a tester's clock offset mustn't time out the other player.
+		if duel.CheckTimeout(now) {
+			//The duel is over so there is no turn to take, send back how it ended.
+			data, logWrite, err := requestLog.RecordWrite(logger, DuelAttackResponse(nil, duel))
+			if err != nil {
+				return "", err
+			}
+			if err := SaveDuel(ctx, nk, duel, duel.Status == DuelFinished, logWrite); err != nil {
+				return "", AsGameError(err)
+			}
+			if duel.Status == DuelFinished {
+				NotifyDuel(ctx, logger, nk, duel, duel.OtherPlayer(userID), "Duel over", DuelOverNotificationCode)
+			}
+			return data, nil
+		}
+
+		//Take the turn.
+		result, err := duel.Attack(logger, userID, duelAttackRequest.Attack, now)
+		if err != nil {
+			return "", AsGameError(err)
+		}
+		//The response is saved with the duel so a retry replays it.
+		data, logWrite, err := requestLog.RecordWrite(logger, DuelAttackResponse(result, duel))
+		if err != nil {
+			return "", err
+		}
+		if err := SaveDuel(ctx, nk, duel, duel.Status == DuelFinished, logWrite); err != nil {
+			logger.Error("Unable to save duel: %v", err)
+			return "", AsGameError(err)
+		}
+		if duel.Status == DuelFinished {
+			NotifyDuel(ctx, logger, nk, duel, duel.OtherPlayer(userID), "Duel over", DuelOverNotificationCode)
+		} else {
+			NotifyDuel(ctx, logger, nk, duel, duel.Turn, "Your turn", DuelTurnNotificationCode)
+		}
+
+		//Return info to the client.
+		return data, nil
+	}
+}
+
+func DuelInfoRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Get the user id from the runtime.
+		userID, err := UtilGetUserId(ctx)
+		if err != nil {
+			logger.Error("Unable to extract user id from context due to error: %v", err)
+			return "", NewGameError(CodeUnauthenticated, ReasonUnauthenticated, "No user id in the context.")
+		}
+
+		//Read and validate the client payload.
+		var infoRequest DuelInfoRequest
+		if err := DecodeRequest(payload, &infoRequest); err != nil {
+			return "", err
+		}
+
+		//Get the duel, settling any timeout.
+		duel, err := LoadPlayerDuel(ctx, nk, userID, infoRequest.DuelID)
+		if err != nil {
+			return "", AsGameError(err)
+		}
+		if duel.CheckTimeout(Now().Unix()) {
+			if err := SaveDuel(ctx, nk, duel, duel.Status == DuelFinished); err != nil {
+				return "", AsGameError(err)
+			}
+		}
+
+		//Ratings for both players.
+		ratings := make(map[string]*DuelRating)
+		for _, duelistID := range []string{duel.Challenger, duel.Opponent} {
+			rating, err := LoadDuelRating(ctx, nk, duelistID)
+			if err != nil {
+				logger.Error("Unable to load duel rating: %v", err)
+				return "", AsGameError(err)
+			}
+			ratings[duelistID] = rating
+		}
+
+		//Limited scope response struct
+		response := struct {
+			Duel DuelView `json:"duel"`
+			Ratings map[string]*DuelRating `json:"ratings"`
+		}{
+			Duel: duel.View(),
+			Ratings: ratings,
+		}
+
+		//Return info to the client.
+		return EncodeResponse(logger, response)
+	}
+}
+
+func PlayerInfoRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Get the user id from the runtime.
+		userID, err := UtilGetUserId(ctx)
+		if err != nil {
+			logger.Error("Unable to extract user id from context due to error: %v", err)
+			return "", NewGameError(CodeUnauthenticated, ReasonUnauthenticated, "No user id in the context.")
+		}
+
+		//Get Player object.
+		player, err := LoadPlayerData(ctx, logger, nk, userID)
+		if err != nil {
+			logger.Error("Unable to load player data: %v", err)
+			return "", AsGameError(err)
+		}
+
+		//Limited scope response struct
+		response := struct {
+			PlayerHealth int `json:"player_health"`
+			PlayerMaxHealth int `json:"player_max_health"`
+			StatusEffects []*StatusEffect `json:"status_effects"`
+			BattleStats BattleStats `json:"battle_stats"`
+			IdleRewards []RewardInfo `json:"idle_rewards"`
+		}{
+			PlayerHealth: player.Health,
+			PlayerMaxHealth: player.MaxHealth,
+			StatusEffects: player.StatusEffects,
+			BattleStats: player.BattleStats,
+			IdleRewards: player.IdleRewards(),
+		}
+
+		//Return info to the client.
+		return EncodeResponse(logger, response)
+	}
+}
+
+func ClaimIdleRewardsRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Get the user id from the runtime.
+		userID, err := UtilGetUserId(ctx)
+		if err != nil {
+			logger.Error("Unable to extract user id from context due to error: %v", err)
+			return "", NewGameError(CodeUnauthenticated, ReasonUnauthenticated, "No user id in the context.")
+		}
+
+		//Read and validate the client payload.
+		var claimRequest ClaimIdleRewardsRequest
+		if err := DecodeRequest(payload, &claimRequest); err != nil {
+			return "", err
+		}
+
+		//Replay the response if this request id was already handled.
+		requestLog, replay, err := BeginRequest(ctx, logger, nk, userID, "claim_idle_rewards", claimRequest.RequestID, payload)
+		if err != nil {
+			return "", err
+		}
+		if replay != "" {
+			return replay, nil
+		}
+
+		//Get Player object, loading banks any offline time.
+		player, err := LoadPlayerData(ctx, logger, nk, userID)
+		if err != nil {
+			logger.Error("Unable to load player data: %v", err)
+			return "", AsGameError(err)
+		}
+
+		//Claim the rewards.
+		rewards, err := player.ClaimIdleRewards(logger)
+		if err != nil {
+			return "", AsGameError(err)
+		}
+
+		//Limited scope response struct
+		response := struct {
+			Rewards []RewardInfo `json:"rewards"`
+			PlayerData *Player `json:"player_data"`
+		}{
+			Rewards: rewards,
+			PlayerData: player,
+		}
+
+		//Save any changes to player object along with the response for retries, then return info to the client.
+		return CommitRequest(ctx, logger, nk, requestLog, player, response)
+	}
+}
+
+func UseItemRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Get the user id from the runtime.
+		userID, err := UtilGetUserId(ctx)
+		if err != nil {
+			logger.Error("Unable to extract user id from context due to error: %v", err)
+			return "", NewGameError(CodeUnauthenticated, ReasonUnauthenticated, "No user id in the context.")
+		}
+
+		//Read and validate the client payload.
+		var useItemRequest UseItemRequest
+		if err := DecodeRequest(payload, &useItemRequest); err != nil {
+			return "", err
+		}
+		logger.Debug("useItemRequest: %+v", useItemRequest)
+
+		//Replay the response if this request id was already handled.
+		requestLog, replay, err := BeginRequest(ctx, logger, nk, userID, "use_item", useItemRequest.RequestID, payload)
+		if err != nil {
+			return "", err
+		}
+		if replay != "" {
+			return replay, nil
+		}
+
+		//The running battle match owns the battle, a change saved here would be written over by the match.
+		if err := CheckNoBattleMatch(ctx, nk, userID); err != nil {
+			return "", AsGameError(err)
+		}
+
+		//Get Player object.
+		player, err := LoadPlayerData(ctx, logger, nk, userID)
+		if err != nil {
+			logger.Error("Unable to load player data: %v", err)
+			return "", AsGameError(err)
+		}
+
+		//Use the item.
+		err = player.UseItem(logger, useItemRequest.Item, useItemRequest.TargetID)
+		if err != nil {
+			return "", AsGameError(err)
+		}
+
+		//Limited scope response struct
+		response := struct {
+			PlayerData *Player `json:"player_data"`
+		}{
+			PlayerData: player,
+		}
+
+		//Save any changes to player object along with the response for retries, then return info to the client.
+		return CommitRequest(ctx, logger, nk, requestLog, player, response)
+	}
+}
+
+func EquipItemRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Get the user id from the runtime.
+		userID, err := UtilGetUserId(ctx)
+		if err != nil {
+			logger.Error("Unable to extract user id from context due to error: %v", err)
+			return "", NewGameError(CodeUnauthenticated, ReasonUnauthenticated, "No user id in the context.")
+		}
+
+		//Read and validate the client payload.
+		var equipRequest EquipItemRequest
+		if err := DecodeRequest(payload, &equipRequest); err != nil {
+			return "", err
+		}
+		logger.Debug("equipRequest: %+v", equipRequest)
+
+		//Replay the response if this request id was already handled.
+		requestLog, replay, err := BeginRequest(ctx, logger, nk, userID, "equip_item", equipRequest.RequestID, payload)
+		if err != nil {
+			return "", err
+		}
+		if replay != "" {
+			return replay, nil
+		}
+
+		//Get Player object.
+		player, err := LoadPlayerData(ctx, logger, nk, userID)
+		if err != nil {
+			logger.Error("Unable to load player data: %v", err)
+			return "", AsGameError(err)
+		}
+
+		//Equip the item.
+		err = player.EquipItem(equipRequest.Item)
+		if err != nil {
+			return "", AsGameError(err)
+		}
+
+		//Limited scope response struct
+		response := struct {
+			PlayerData *Player `json:"player_data"`
+		}{
+			PlayerData: player,
+		}
+
+		//Save any changes to player object along with the response for retries, then return info to the client.
+		return CommitRequest(ctx, logger, nk, requestLog, player, response)
+	}
+}
+
+func UnequipItemRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Get the user id from the runtime.
+		userID, err := UtilGetUserId(ctx)
+		if err != nil {
+			logger.Error("Unable to extract user id from context due to error: %v", err)
+			return "", NewGameError(CodeUnauthenticated, ReasonUnauthenticated, "No user id in the context.")
+		}
+
+		//Read and validate the client payload.
+		var unequipRequest UnequipItemRequest
+		if err := DecodeRequest(payload, &unequipRequest); err != nil {
+			return "", err
+		}
+		logger.Debug("unequipRequest: %+v", unequipRequest)
+
+		//Replay the response if this request id was already handled.
+		requestLog, replay, err := BeginRequest(ctx, logger, nk, userID, "unequip_item", unequipRequest.RequestID, payload)
+		if err != nil {
+			return "", err
+		}
+		if replay != "" {
+			return replay, nil
+		}
+
+		//Get Player object.
+		player, err := LoadPlayerData(ctx, logger, nk, userID)
+		if err != nil {
+			logger.Error("Unable to load player data: %v", err)
+			return "", AsGameError(err)
+		}
+
+		//Unequip the slot.
+		err = player.UnequipItem(unequipRequest.Slot)
+		if err != nil {
+			return "", AsGameError(err)
+		}
+
+		//Limited scope response struct
+		response := struct {
+			PlayerData *Player `json:"player_data"`
+		}{
+			PlayerData: player,
+		}
+
+		//Save any changes to player object along with the response for retries, then return info to the client.
+		return CommitRequest(ctx, logger, nk, requestLog, player, response)
+	}
+}
+
+func SetLoadoutRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Get the user id from the runtime.
+		userID, err := UtilGetUserId(ctx)
+		if err != nil {
+			logger.Error("Unable to extract user id from context due to error: %v", err)
+			return "", NewGameError(CodeUnauthenticated, ReasonUnauthenticated, "No user id in the context.")
+		}
+
+		//Read and validate the client payload.
+		var loadoutRequest SetLoadoutRequest
+		if err := DecodeRequest(payload, &loadoutRequest); err != nil {
+			return "", err
+		}
+		logger.Debug("loadoutRequest: %+v", loadoutRequest)
+
+		//Replay the response if this request id was already handled.
+		requestLog, replay, err := BeginRequest(ctx, logger, nk, userID, "set_loadout", loadoutRequest.RequestID, payload)
+		if err != nil {
+			return "", err
+		}
+		if replay != "" {
+			return replay, nil
+		}
+
+		//Get Player object.
+		player, err := LoadPlayerData(ctx, logger, nk, userID)
+		if err != nil {
+			logger.Error("Unable to load player data: %v", err)
+			return "", AsGameError(err)
+		}
+
+		//Set the loadout.
+		err = player.SetLoadout(loadoutRequest.Attacks)
+		if err != nil {
+			return "", AsGameError(err)
+		}
+
+		//Limited scope response struct
+		response := struct {
+			PlayerData *Player `json:"player_data"`
+		}{
+			PlayerData: player,
+		}
+
+		//Save any changes to player object along with the response for retries, then return info to the client.
+		return CommitRequest(ctx, logger, nk, requestLog, player, response)
+	}
+}
+
+func ListAttacksRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Get the user id from the runtime.
+		userID, err := UtilGetUserId(ctx)
+		if err != nil {
+			logger.Error("Unable to extract user id from context due to error: %v", err)
+			return "", NewGameError(CodeUnauthenticated, ReasonUnauthenticated, "No user id in the context.")
+		}
+
+		//Get Player object.
+		player, err := LoadPlayerData(ctx, logger, nk, userID)
+		if err != nil {
+			logger.Error("Unable to load player data: %v", err)
+			return "", AsGameError(err)
+		}
+
+		//Limited scope response struct
+		response := struct {
+			Attacks []PlayerAttackInfo `json:"attacks"`
+			Loadout []AttackType `json:"loadout"`
+			LoadoutSize int `json:"loadout_size"`
+		}{
+			Attacks: player.ListAttacks(),
+			Loadout: player.Loadout,
+			LoadoutSize: LoadoutSize,
+		}
+
+		//Return info to the client.
+		return EncodeResponse(logger, response)
+	}
+}
+
+func ListStoreRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Get the user id from the runtime.
+		userID, err := UtilGetUserId(ctx)
+		if err != nil {
+			logger.Error("Unable to extract user id from context due to error: %v", err)
+			return "", NewGameError(CodeUnauthenticated, ReasonUnauthenticated, "No user id in the context.")
+		}
+
+		//Get Player object for the wallet.
+		player, err := LoadPlayerData(ctx, logger, nk, userID)
+		if err != nil {
+			logger.Error("Unable to load player data: %v", err)
+			return "", AsGameError(err)
+		}
+
+		//Get purchase history for the limits.
+		store, err := LoadPlayerStore(ctx, nk, userID)
+		if err != nil {
+			logger.Error("Unable to load player store data: %v", err)
+			return "", AsGameError(err)
+		}
+
+		//Limited scope response struct
+		response := struct {
+			Offers []PlayerStoreOffer `json:"offers"`
+			Currencies []Currency `json:"currency"`
+		}{
+			Offers: store.ListOffers(UserNow(userID).Unix()),
+			Currencies: player.Currencies,
+		}
+
+		//Return info to the client.
+		return EncodeResponse(logger, response)
+	}
+}
+
+func PurchaseRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Get the user id from the runtime.
+		userID, err := UtilGetUserId(ctx)
+		if err != nil {
+			logger.Error("Unable to extract user id from context due to error: %v", err)
+			return "", NewGameError(CodeUnauthenticated, ReasonUnauthenticated, "No user id in the context.")
+		}
+
+		//Read and validate the client payload.
+		var purchaseRequest PurchaseRequest
+		if err := DecodeRequest(payload, &purchaseRequest); err != nil {
+			return "", err
+		}
+		logger.Debug("purchaseRequest: %+v", purchaseRequest)
+
+		//Get Player object.
+		player, err := LoadPlayerData(ctx, logger, nk, userID)
+		if err != nil {
+			logger.Error("Unable to load player data: %v", err)
+			return "", AsGameError(err)
+		}
+
+		//Get purchase history.
+		store, err := LoadPlayerStore(ctx, nk, userID)
+		if err != nil {
+			logger.Error("Unable to load player store data: %v", err)
+			return "", AsGameError(err)
+		}
+
+		//Make the purchase.
+		receipt, replayed, err := player.Purchase(logger, store, purchaseRequest.OfferID, purchaseRequest.RequestID)
+		if err != nil {
+			return "", AsGameError(err)
+		}
+
+		//Save the player and purchase history together, replays have nothing new to save.
+		if !replayed {
+			err = SavePurchase(ctx, nk, player, store)
+			if err != nil {
+				logger.Error("Unable to save purchase: %v", err)
+				return "", AsGameError(err)
+			}
+			ProcessBattleEvents(ctx, logger, nk, player)
+		}
+
+		//Limited scope response struct
+		response := struct {
+			Receipt *StoreReceipt `json:"receipt"`
+			Replayed bool `json:"replayed"`
+			PlayerData *Player `json:"player_data"`
+		}{
+			Receipt: receipt,
+			Replayed: replayed,
+			PlayerData: player,
+		}
+
+		//Return info to the client.
+		return EncodeResponse(logger, response)
+	}
+}
+
+func ExportMyDataRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Get the user id from the runtime.
+		userID, err := UtilGetUserId(ctx)
+		if err != nil {
+			logger.Error("Unable to extract user id from context due to error: %v", err)
+			return "", NewGameError(CodeUnauthenticated, ReasonUnauthenticated, "No user id in the context.")
+		}
+
+		//Gather everything held for the player.
+		export, err := ExportPlayerData(ctx, logger, nk, userID)
+		if err != nil {
+			logger.Error("Unable to export player data: %v", err)
+			return "", AsGameError(err)
+		}
+
+		//Return info to the client.
+		return EncodeResponse(logger, export)
+	}
+}
+func GetRankingsRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Get the user id from the runtime.
+		userID, err := UtilGetUserId(ctx)
+		if err != nil {
+			logger.Error("Unable to extract user id from context due to error: %v", err)
+			return "", NewGameError(CodeUnauthenticated, ReasonUnauthenticated, "No user id in the context.")
+		}
+
+		//Read and validate the client payload.
+		var rankingsRequest GetRankingsRequest
+		if err := DecodeRequest(payload, &rankingsRequest); err != nil {
+			return "", err
+		}
+		logger.Debug("rankingsRequest: %+v", rankingsRequest)
+		limit := rankingsRequest.Limit
+		if limit == 0 {
+			limit = RankingsDefaultLimit
+		}
+
+		//Get the caller's rank and the players around them.
+		caller, rankings, err := GetRankings(ctx, nk, userID, rankingsRequest.Leaderboard, limit)
+		if err != nil {
+			logger.Error("Unable to get rankings: %v", err)
+			return "", AsGameError(err)
+		}
+
+		//Limited scope response struct
+		response := struct {
+			Leaderboard string `json:"leaderboard"`
+			Caller *Ranking `json:"caller"` //Empty until the caller has a score.
+			Rankings []*Ranking `json:"rankings"`
+		}{
+			Leaderboard: rankingsRequest.Leaderboard,
+			Caller: caller,
+			Rankings: rankings,
+		}
+
+		//Return info to the client.
+		return EncodeResponse(logger, response)
+	}
+}
+
+func GetAchievementsRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Get the user id from the runtime.
+		userID, err := UtilGetUserId(ctx)
+		if err != nil {
+			logger.Error("Unable to extract user id from context due to error: %v", err)
+			return "", NewGameError(CodeUnauthenticated, ReasonUnauthenticated, "No user id in the context.")
+		}
+
+		//Get the player's progress.
+		achievements, err := LoadPlayerAchievements(ctx, nk, userID)
+		if err != nil {
+			logger.Error("Unable to load achievements: %v", err)
+			return "", AsGameError(err)
+		}
+
+		//Limited scope response struct
+		response := struct {
+			Achievements []AchievementView `json:"achievements"`
+		}{
+			Achievements: achievements.View(),
+		}
+
+		//Return info to the client.
+		return EncodeResponse(logger, response)
+	}
+}
+
+func GetBestiaryRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Get the user id from the runtime.
+		userID, err := UtilGetUserId(ctx)
+		if err != nil {
+			logger.Error("Unable to extract user id from context due to error: %v", err)
+			return "", NewGameError(CodeUnauthenticated, ReasonUnauthenticated, "No user id in the context.")
+		}
+
+		//Get Player object.
+		player, err := LoadPlayerData(ctx, logger, nk, userID)
+		if err != nil {
+			logger.Error("Unable to load player data: %v", err)
+			return "", AsGameError(err)
+		}
+
+		BestiaryRegistry.RLock() //Read lock.
+		entryRewards := BestiaryRegistry.EntryRewards
+		completionRewards := BestiaryRegistry.CompletionRewards
+		BestiaryRegistry.RUnlock() //Release read lock.
+		_, complete := player.CodexRewards[CodexCompleteKey]
+
+		//Limited scope response struct
+		response := struct {
+			Entries []BestiaryEntry `json:"entries"`
+			Complete bool `json:"complete"`
+			EntryRewards []RewardInfo `json:"entry_rewards"`
+			CompletionRewards []RewardInfo `json:"completion_rewards"`
+		}{
+			Entries: player.Bestiary(),
+			Complete: complete,
+			EntryRewards: entryRewards,
+			CompletionRewards: completionRewards,
+		}
+
+		//Return info to the client.
+		return EncodeResponse(logger, response)
+	}
+}
+
+func GetQuestsRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Get the user id from the runtime.
+		userID, err := UtilGetUserId(ctx)
+		if err != nil {
+			logger.Error("Unable to extract user id from context due to error: %v", err)
+			return "", NewGameError(CodeUnauthenticated, ReasonUnauthenticated, "No user id in the context.")
+		}
+
+		//Get the player's quests, assigning new ones when a period ended.
+		quests, err := LoadPlayerQuests(ctx, nk, userID)
+		if err != nil {
+			logger.Error("Unable to load quests: %v", err)
+			return "", AsGameError(err)
+		}
+		now := UserNow(userID)
+		if quests.Refresh(now) {
+			wObj, err := quests.QuestStorageWrite(userID)
+			if err != nil {
+				logger.Error("Unable to save quests: %v", err)
+				return "", AsGameError(err)
+			}
+			if _, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{wObj}); err != nil {
+				logger.Error("Unable to save quests: %v", err)
+				return "", NewGameError(CodeAborted, ReasonConflict, "Quests were not saved, try again.")
+			}
+		}
+
+		QuestRegistry.RLock() //Read lock.
+		rerollCost := QuestRegistry.RerollCost
+		QuestRegistry.RUnlock() //Release read lock.
+
+		//Limited scope response struct
+		response := struct {
+			Quests []QuestView `json:"quests"`
+			RerollCost int64 `json:"reroll_cost"`
+		}{
+			Quests: quests.View(now.Unix()),
+			RerollCost: rerollCost,
+		}
+
+		//Return info to the client.
+		return EncodeResponse(logger, response)
+	}
+}
+
+func ClaimQuestRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Get the user id from the runtime.
+		userID, err := UtilGetUserId(ctx)
+		if err != nil {
+			logger.Error("Unable to extract user id from context due to error: %v", err)
+			return "", NewGameError(CodeUnauthenticated, ReasonUnauthenticated, "No user id in the context.")
+		}
+
+		//Read and validate the client payload.
+		var claimRequest QuestRequest
+		if err := DecodeRequest(payload, &claimRequest); err != nil {
+			return "", err
+		}
+		logger.Debug("claimRequest: %+v", claimRequest)
+
+		//Replay the response if this request id was already handled.
+		requestLog, replay, err := BeginRequest(ctx, logger, nk, userID, "claim_quest", claimRequest.RequestID, payload)
+		if err != nil {
+			return "", err
+		}
+		if replay != "" {
+			return replay, nil
+		}
+
+		//Get Player object and quests.
+		player, err := LoadPlayerData(ctx, logger, nk, userID)
+		if err != nil {
+			logger.Error("Unable to load player data: %v", err)
+			return "", AsGameError(err)
+		}
+		quests, err := LoadPlayerQuests(ctx, nk, userID)
+		if err != nil {
+			logger.Error("Unable to load quests: %v", err)
+			return "", AsGameError(err)
+		}
+
+		//Claim the rewards.
+		now := UserNow(userID)
+		quests.Refresh(now)
+		quest, err := player.ClaimQuest(logger, quests, claimRequest.QuestID, now.Unix())
+		if err != nil {
+			return "", AsGameError(err)
+		}
+		questWrite, err := quests.QuestStorageWrite(userID)
+		if err != nil {
+			logger.Error("Unable to save quests: %v", err)
+			return "", AsGameError(err)
+		}
+
+		//Limited scope response struct
+		response := struct {
+			Rewards []RewardInfo `json:"rewards"`
+			PlayerData *Player `json:"player_data"`
+		}{
+			Rewards: quest.Rewards,
+			PlayerData: player,
+		}
+
+		//Save the player and quests together along with the response for retries, then return info to the client.
+		return CommitRequest(ctx, logger, nk, requestLog, player, response, questWrite)
+	}
+}
+
+func RerollQuestRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Get the user id from the runtime.
+		userID, err := UtilGetUserId(ctx)
+		if err != nil {
+			logger.Error("Unable to extract user id from context due to error: %v", err)
+			return "", NewGameError(CodeUnauthenticated, ReasonUnauthenticated, "No user id in the context.")
+		}
+
+		//Read and validate the client payload.
+		var rerollRequest QuestRequest
+		if err := DecodeRequest(payload, &rerollRequest); err != nil {
+			return "", err
+		}
+		logger.Debug("rerollRequest: %+v", rerollRequest)
+
+		//Replay the response if this request id was already handled.
+		requestLog, replay, err := BeginRequest(ctx, logger, nk, userID, "reroll_quest", rerollRequest.RequestID, payload)
+		if err != nil {
+			return "", err
+		}
+		if replay != "" {
+			return replay, nil
+		}
+
+		//Get Player object and quests.
+		player, err := LoadPlayerData(ctx, logger, nk, userID)
+		if err != nil {
+			logger.Error("Unable to load player data: %v", err)
+			return "", AsGameError(err)
+		}
+		quests, err := LoadPlayerQuests(ctx, nk, userID)
+		if err != nil {
+			logger.Error("Unable to load quests: %v", err)
+			return "", AsGameError(err)
+		}
+
+		//Swap the quest, paid in gems.
+		now := UserNow(userID)
+		quests.Refresh(now)
+		if _, err := player.RerollQuest(quests, rerollRequest.QuestID, now.Unix()); err != nil {
+			return "", AsGameError(err)
+		}
+		questWrite, err := quests.QuestStorageWrite(userID)
+		if err != nil {
+			logger.Error("Unable to save quests: %v", err)
+			return "", AsGameError(err)
+		}
+
+		//Limited scope response struct
+		response := struct {
+			Quests []QuestView `json:"quests"`
+			PlayerData *Player `json:"player_data"`
+		}{
+			Quests: quests.View(now.Unix()),
+			PlayerData: player,
+		}
+
+		//Save the player and quests together along with the response for retries, then return info to the client.
+		return CommitRequest(ctx, logger, nk, requestLog, player, response, questWrite)
+	}
+}
+
+func SetClockOffsetRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Read and validate the client payload.
+		var offsetRequest SetClockOffsetRequest
+		if err := DecodeRequest(payload, &offsetRequest); err != nil {
+			return "", err
+		}
+		logger.Debug("offsetRequest: %+v", offsetRequest)
+
+		//Testers move their own clock unless a user id is given.
+		userID, err := DebugTargetUser(ctx, nk, offsetRequest.UserID)
+		if err != nil {
+			return "", err
+		}
+
+		SetClockOffset(userID, time.Duration(offsetRequest.OffsetSeconds) * time.Second)
+		logger.Info("Clock offset for %s set to %d seconds.", userID, offsetRequest.OffsetSeconds)
+
+		//Limited scope response struct
+		response := struct {
+			UserID string `json:"user_id"`
+			OffsetSeconds int64 `json:"offset_seconds"`
+			Now int64 `json:"now"` //The user's clock after the change.
+		}{
+			UserID: userID,
+			OffsetSeconds: offsetRequest.OffsetSeconds,
+			Now: UserNow(userID).Unix(),
+		}
+
+		//Return info to the client.
+		return EncodeResponse(logger, response)
+	}
+}
+
+func DebugSetHealthRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Read and validate the client payload.
+		var healthRequest DebugSetHealthRequest
+		if err := DecodeRequest(payload, &healthRequest); err != nil {
+			return "", err
+		}
+		logger.Debug("healthRequest: %+v", healthRequest)
+
+		//Testers change their own player unless a user id is given.
+		userID, err := DebugTargetUser(ctx, nk, healthRequest.UserID)
+		if err != nil {
+			return "", err
+		}
+
+		//Get Player object.
+		player, err := LoadPlayerData(ctx, logger, nk, userID)
+		if err != nil {
+			logger.Error("Unable to load player data: %v", err)
+			return "", AsGameError(err)
+		}
+
+		//Set the health.
+		player.DebugSetHealth(healthRequest.Health, healthRequest.MaxHealth)
+
+		//Limited scope response struct
+		response := struct {
+			PlayerData *Player `json:"player_data"`
+		}{
+			PlayerData: player,
+		}
+
+		//Save any changes to player object, then return info to the client.
+		return CommitRequest(ctx, logger, nk, nil, player, response)
+	}
+}
+
+func DebugGrantCurrencyRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Read and validate the client payload.
+		var grantRequest DebugGrantCurrencyRequest
+		if err := DecodeRequest(payload, &grantRequest); err != nil {
+			return "", err
+		}
+		logger.Debug("grantRequest: %+v", grantRequest)
+
+		//Testers change their own player unless a user id is given.
+		userID, err := DebugTargetUser(ctx, nk, grantRequest.UserID)
+		if err != nil {
+			return "", err
+		}
+
+		//Get Player object.
+		player, err := LoadPlayerData(ctx, logger, nk, userID)
+		if err != nil {
+			logger.Error("Unable to load player data: %v", err)
+			return "", AsGameError(err)
+		}
+
+		//Grant the currency, experience can level the player up.
+		player.GrantRewards(logger, []RewardInfo{{Type: grantRequest.Currency, Amount: grantRequest.Amount}})
+
+		//Limited scope response struct
+		response := struct {
+			PlayerData *Player `json:"player_data"`
+		}{
+			PlayerData: player,
+		}
+
+		//Save any changes to player object, then return info to the client.
+		return CommitRequest(ctx, logger, nk, nil, player, response)
+	}
+}
+
+func DebugSpawnEnemyRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Read and validate the client payload.
+		var spawnRequest DebugSpawnEnemyRequest
+		if err := DecodeRequest(payload, &spawnRequest); err != nil {
+			return "", err
+		}
+		logger.Debug("spawnRequest: %+v", spawnRequest)
+
+		//Testers change their own player unless a user id is given.
+		userID, err := DebugTargetUser(ctx, nk, spawnRequest.UserID)
+		if err != nil {
+			return "", err
+		}
+
+		//Get Player object.
+		player, err := LoadPlayerData(ctx, logger, nk, userID)
+		if err != nil {
+			logger.Error("Unable to load player data: %v", err)
+			return "", AsGameError(err)
+		}
+
+		//Replace the battle with the enemy.
+		enemyID, err := player.DebugSpawnEnemy(spawnRequest.Enemy)
+		if err != nil {
+			return "", AsGameError(err)
+		}
+
+		//Limited scope response struct
+		response := struct {
+			EnemyID string `json:"enemy_id"`
+			PlayerData *Player `json:"player_data"`
+		}{
+			EnemyID: enemyID,
+			PlayerData: player,
+		}
+
+		//Save any changes to player object, then return info to the client.
+		return CommitRequest(ctx, logger, nk, nil, player, response)
+	}
+}
+
+func DebugApplyStatusEffectRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Read and validate the client payload.
+		var effectRequest DebugApplyStatusEffectRequest
+		if err := DecodeRequest(payload, &effectRequest); err != nil {
+			return "", err
+		}
+		logger.Debug("effectRequest: %+v", effectRequest)
+
+		//Testers change their own player unless a user id is given.
+		userID, err := DebugTargetUser(ctx, nk, effectRequest.UserID)
+		if err != nil {
+			return "", err
+		}
+
+		//Get Player object.
+		player, err := LoadPlayerData(ctx, logger, nk, userID)
+		if err != nil {
+			logger.Error("Unable to load player data: %v", err)
+			return "", AsGameError(err)
+		}
+
+		//Apply the effect.
+		if err := player.DebugApplyStatusEffect(logger, effectRequest.StatusEffect, effectRequest.TargetID); err != nil {
+			return "", AsGameError(err)
+		}
+
+		//Limited scope response struct
+		response := struct {
+			PlayerData *Player `json:"player_data"`
+		}{
+			PlayerData: player,
+		}
+
+		//Save any changes to player object, then return info to the client.
+		return CommitRequest(ctx, logger, nk, nil, player, response)
+	}
+}
+
+func DebugResetPlayerRPC() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		//Read and validate the client payload.
+		var resetRequest DebugResetPlayerRequest
+		if err := DecodeRequest(payload, &resetRequest); err != nil {
+			return "", err
+		}
+		logger.Debug("resetRequest: %+v", resetRequest)
+
+		//Testers change their own player unless a user id is given.
+		userID, err := DebugTargetUser(ctx, nk, resetRequest.UserID)
+		if err != nil {
+			return "", err
+		}
+
+		//A running battle match would save its player over the reset.
+		if err := CheckNoBattleMatch(ctx, nk, userID); err != nil {
+			return "", err
+		}
+
+		//Get Player object.
+		player, err := LoadPlayerData(ctx, logger, nk, userID)
+		if err != nil {
+			logger.Error("Unable to load player data: %v", err)
+			return "", AsGameError(err)
+		}
+
+		//Start over with a new character.
+		player.DebugReset()
+
+		//Limited scope response struct
+		response := struct {
+			PlayerData *Player `json:"player_data"`
+		}{
+			PlayerData: player,
+		}
+
+		//Save the new player and delete the rest of their progress in one write, then return info to the client.
+		playerWrite, err := player.PlayerStorageWrite()
+		if err != nil {
+			logger.Error("Unable to save player data: %v", err)
+			return "", AsGameError(err)
+		}
+		data, err := EncodeResponse(logger, response)
+		if err != nil {
+			return "", err
+		}
+		acks, _, err := nk.MultiUpdate(ctx, nil, []*runtime.StorageWrite{playerWrite}, DebugResetStorageDeletes(userID), nil, false)
+		if err != nil {
+			logger.Error("Unable to reset player data: %v", err)
+			return "", NewGameError(CodeAborted, ReasonConflict, "Player data was not reset, try again.")
+		}
+		player.SetStorageVersion(acks)
+		return data, nil
+	}
+}
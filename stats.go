@@ -0,0 +1,105 @@
+package main
+
+// Damage split by what dealt it.
+type DamageStats struct {
+	Total int `json:"total"`
+	ByAttack map[AttackType]int `json:"by_attack"`
+	ByStatusEffect map[StatusEffectType]int `json:"by_status_effect"`
+}
+
+// Lifetime battle statistics, updated from the player's battle events as they happen.
+type BattleStats struct {
+	Kills map[EnemyType]int `json:"kills"` //Enemies vanquished by type.
+	TotalKills int `json:"total_kills"`
+	Deaths map[EnemyType]int `json:"deaths"` //Deaths by the enemy type that landed the last hit.
+	TotalDeaths int `json:"total_deaths"` //Includes deaths from status effects.
+	DamageDealt DamageStats `json:"damage_dealt"`
+	DamageTaken DamageStats `json:"damage_taken"`
+	Hits int `json:"hits"`
+	Misses int `json:"misses"`
+	Crits int `json:"crits"`
+	BattlesWon int `json:"battles_won"`
+	BattlesFled int `json:"battles_fled"`
+	WinStreak int `json:"win_streak"` //Battles won since the last death or flee.
+	LongestWinStreak int `json:"longest_win_streak"`
+	FastestKill int64 `json:"fastest_kill,omitempty"` //Milliseconds from an enemy spawning to its death, 0 until a timed kill.
+}
+
+// Used to setup the stats for a new player.
+func NewBattleStats() BattleStats {
+	stats := BattleStats{}
+	stats.ensureMaps()
+	return stats
+}
+
+// This function fills in the maps that are missing, saves from before the stats existed and json nulls leave them nil.
+func (s *BattleStats) ensureMaps() {
+	if s.Kills == nil {
+		s.Kills = make(map[EnemyType]int)
+	}
+	if s.Deaths == nil {
+		s.Deaths = make(map[EnemyType]int)
+	}
+	s.DamageDealt.ensureMaps()
+	s.DamageTaken.ensureMaps()
+}
+
+// This function fills in the maps that are missing.
+func (d *DamageStats) ensureMaps() {
+	if d.ByAttack == nil {
+		d.ByAttack = make(map[AttackType]int)
+	}
+	if d.ByStatusEffect == nil {
+		d.ByStatusEffect = make(map[StatusEffectType]int)
+	}
+}
+
+// This function adds damage from an attack or a status effect.
+func (d *DamageStats) Add(event BattleEvent) {
+	d.Total += event.Damage
+	if event.Attack != "" {
+		d.ByAttack[event.Attack] += event.Damage
+	}
+	if event.StatusEffect != "" {
+		d.ByStatusEffect[event.StatusEffect] += event.Damage
+	}
+}
+
+// This function updates the stats for a battle event.
+func (s *BattleStats) Record(event BattleEvent) {
+	s.ensureMaps()
+	switch event.Event {
+	case EventAttackHit:
+		s.Hits++
+		s.DamageDealt.Add(event)
+	case EventAttackMissed:
+		s.Misses++
+	case EventCrit:
+		s.Crits++
+	case EventStatusEffectDamage:
+		s.DamageDealt.Add(event)
+	case EventDamageTaken:
+		s.DamageTaken.Add(event)
+	case EventKill:
+		s.Kills[EnemyType(event.Target)]++
+		s.TotalKills++
+		if event.Value > 0 && (s.FastestKill == 0 || int64(event.Value) < s.FastestKill) {
+			s.FastestKill = int64(event.Value)
+		}
+	case EventPlayerDeath:
+		if event.Target != "" {
+			s.Deaths[EnemyType(event.Target)]++
+		}
+		s.TotalDeaths++
+		s.WinStreak = 0
+	case EventBattleWon:
+		s.BattlesWon++
+		s.WinStreak++
+		if s.WinStreak > s.LongestWinStreak {
+			s.LongestWinStreak = s.WinStreak
+		}
+	case EventBattleFled:
+		s.BattlesFled++
+		s.WinStreak = 0
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestBattleStatsFromCombat(t *testing.T) {
+	attackType := testSureHitAttack(t, 5)
+	player := NewPlayer(UtilMakeUUID(), "tester")
+	player.Loadout = []AttackType{attackType}
+	//Stats saved as null still get recorded.
+	player.BattleStats = BattleStats{}
+	first, second := UtilMakeUUID(), UtilMakeUUID()
+	player.BattleState.Enemies = map[string]*Enemy{
+		first: {Type: Zombie, Health: 5, MaxHealth: 5, SpawnedAt: 1},
+		second: {Type: Mutant, Health: 10, MaxHealth: 10},
+	}
+	if _, err := player.PlayerAttack(&testLogger{}, first, attackType); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := player.PlayerAttack(&testLogger{}, second, attackType); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := player.PlayerAttack(&testLogger{}, second, attackType); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stats := player.BattleStats
+	if stats.Kills[Zombie] != 1 || stats.Kills[Mutant] != 1 || stats.TotalKills != 2 {
+		t.Fatalf("unexpected kills: %+v", stats.Kills)
+	}
+	if stats.Hits != 3 || stats.DamageDealt.Total != 15 || stats.DamageDealt.ByAttack[attackType] != 15 {
+		t.Fatalf("unexpected hits and damage: %d %+v", stats.Hits, stats.DamageDealt)
+	}
+	if stats.FastestKill <= 0 {
+		t.Fatalf("expected a kill time for the timed enemy, got %d", stats.FastestKill)
+	}
+	if stats.BattlesWon != 1 || stats.WinStreak != 1 || stats.LongestWinStreak != 1 {
+		t.Fatalf("unexpected wins: %+v", stats)
+	}
+}
+
+func TestBattleStatsStreaks(t *testing.T) {
+	stats := NewBattleStats()
+	for _, event := range []BattleEventType{EventBattleWon, EventBattleWon, EventBattleFled, EventBattleWon} {
+		stats.Record(BattleEvent{Event: event})
+	}
+	if stats.BattlesWon != 3 || stats.BattlesFled != 1 || stats.WinStreak != 1 || stats.LongestWinStreak != 2 {
+		t.Fatalf("unexpected streaks: %+v", stats)
+	}
+	stats.Record(BattleEvent{Event: EventPlayerDeath, Target: string(Zombie)})
+	stats.Record(BattleEvent{Event: EventPlayerDeath})
+	if stats.WinStreak != 0 || stats.Deaths[Zombie] != 1 || stats.TotalDeaths != 2 {
+		t.Fatalf("unexpected deaths: %+v", stats)
+	}
+	stats.Record(BattleEvent{Event: EventDamageTaken, StatusEffect: Poison, Damage: 3})
+	stats.Record(BattleEvent{Event: EventDamageTaken, Attack: Bite, Damage: 5})
+	if stats.DamageTaken.Total != 8 || stats.DamageTaken.ByStatusEffect[Poison] != 3 || stats.DamageTaken.ByAttack[Bite] != 5 {
+		t.Fatalf("unexpected damage taken: %+v", stats.DamageTaken)
+	}
+}
+
+func TestFleeBattle(t *testing.T) {
+	player := NewPlayer(UtilMakeUUID(), "tester")
+	if err := player.FleeBattle(); err == nil {
+		t.Fatalf("expected an error without a battle")
+	}
+	player.BattleStats.WinStreak = 2
+	player.BattleState.Enemies = map[string]*Enemy{UtilMakeUUID(): {Type: Zombie, Health: 5}}
+	if err := player.FleeBattle(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(player.BattleState.Enemies) != 0 || player.BattleStats.BattlesFled != 1 || player.BattleStats.WinStreak != 0 {
+		t.Fatalf("unexpected state after fleeing: %+v %+v", player.BattleState, player.BattleStats)
+	}
+}
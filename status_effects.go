@@ -1,7 +1,6 @@
 package main
 
 import (
-	"time"
 	"sync"
 	"math"
 
@@ -33,6 +32,7 @@ type StatusEffect struct {
 	Stack StackInfo `json:"stack"` //Modifier multiplier.
 	ExpiresAt int64 `json:"expires_at"` //Timestamp of when the effect will fall off.
 	UpdatedAt int64 `json:"updated_at"` //Timestamp of when the effects were last processed.
+	AppliedBy string `json:"applied_by,omitempty"` //User id of the player that applied it, empty for enemy effects.
 }
 
 // Registry to hold all of the definitions.  Using a mutex here since the data could be live-ops driven meaning it could change after nakama init.
@@ -91,18 +91,19 @@ func InitStatusEffectsRegistry() {
 	}
 }
 
-// This function add status effects.  
-func AddStatusEffect(logger runtime.Logger, effectType StatusEffectType, ep EntityProcessor) {
+// This function add status effects, now is the unix time from the game clock.  The added effect is returned, nil when the
+// type isn't in the registry.
+func AddStatusEffect(logger runtime.Logger, effectType StatusEffectType, ep EntityProcessor, now int64) *StatusEffect {
 	//@JWK TODO: Handle stacking effects.
 	//@JWK TODO: If it's already an existing effect but doesn't stack, refresh duration and ExpiresAt..
-	timestamp := time.Now().Unix()
+	timestamp := now
 	logger.Debug("Adding status effect at: %v", timestamp)
 	StatusEffectsRegistry.RLock() //Read lock
 	defer StatusEffectsRegistry.RUnlock() //Release lock
 	effect := StatusEffectsRegistry.StatusEffects[effectType]
 	if effect.Type == "" {
 		logger.Error("Status effect type NOT found: %s", effectType)
-		return
+		return nil
 	}
 	duration := (effect.Duration * 1) //Multiplier, was used for testing to increase the time of the effect.
 	effect.Duration = duration
@@ -113,11 +114,26 @@ func AddStatusEffect(logger runtime.Logger, effectType StatusEffectType, ep Enti
 	statusEffects := ep.GetStatusEffects()
 	statusEffects = append(statusEffects, &effect)
 	ep.SetStatusEffects(statusEffects)
+	return &effect
 }
 
-// This function removes expired status effects and decrements duration to help the client anticipate fall off.
-func TickStatusEffect(logger runtime.Logger, ep EntityProcessor) {
-	timestamp := time.Now().Unix()
+// This function removes expired status effects and decrements duration to help the client anticipate fall off.  The
+// damage dealt by each effect type is returned.
+func TickStatusEffect(logger runtime.Logger, ep EntityProcessor, now int64) map[StatusEffectType]int {
+	dealt := make(map[StatusEffectType]int)
+	for _, sourceDealt := range TickStatusEffectSources(logger, ep, now) {
+		for effectType, damage := range sourceDealt {
+			dealt[effectType] += damage
+		}
+	}
+	return dealt
+}
+
+// This function ticks the status effects like TickStatusEffect, with the damage kept by the user id that applied each
+// effect so shared enemies can credit it.
+func TickStatusEffectSources(logger runtime.Logger, ep EntityProcessor, now int64) map[string]map[StatusEffectType]int {
+	dealt := make(map[string]map[StatusEffectType]int)
+	timestamp := now
 	//Check if there are any effects to process.
 	statusEffects := ep.GetStatusEffects()
 	if len(statusEffects) > 0 {
@@ -125,6 +141,7 @@ func TickStatusEffect(logger runtime.Logger, ep EntityProcessor) {
 		var processedEffects []*StatusEffect
 		//Loop over the status effects to process them.
 		for _, effect := range statusEffects {
+			updatedAt := timestamp
 			//Process effects that deal damage over time.
 			if effect.Type == Bleed || effect.Type == Poison {
 				logger.Debug("Tick status effects, processing: %+v", effect)
@@ -154,6 +171,12 @@ func TickStatusEffect(logger runtime.Logger, ep EntityProcessor) {
 					health += int(damage)
 					logger.Debug("Tick health H:%d - D:%d", health, damage)
 					ep.SetHealth(health)
+					if dealt[effect.AppliedBy] == nil {
+						dealt[effect.AppliedBy] = make(map[StatusEffectType]int)
+					}
+					dealt[effect.AppliedBy][effect.Type] -= int(damage) //Damage is negative.
+					//Only move past the whole intervals applied so frequent ticks (ex: a match loop) don't drop the partial one.
+					updatedAt = effect.UpdatedAt + intervals * effect.Interval
 				}
 			}
 			//If the effect hasn't expired then updated it, otherwise it falls off.
@@ -162,12 +185,13 @@ func TickStatusEffect(logger runtime.Logger, ep EntityProcessor) {
 				logger.Debug("Tick status effects, processing: %+v", effect)
 				//Update duraction with time delta.
 				effect.Duration = delta
-				effect.UpdatedAt = timestamp
+				effect.UpdatedAt = updatedAt
 				processedEffects = append(processedEffects, effect) //Keep the ones not expired.
 			}
 		}
 		ep.SetStatusEffects(processedEffects)
 	}
+	return dealt
 }
 
 // Interface function to get status effects.
@@ -190,3 +214,44 @@ func (e *Enemy) SetStatusEffects(statusEffects []*StatusEffect) {
 	e.StatusEffects = statusEffects
 }
 
+// This function counts how many of an effect an entity has.  Each application is its own entry until stacking is handled.
+func CountStatusEffects(ep EntityProcessor, effectType StatusEffectType) int {
+	count := 0
+	for _, effect := range ep.GetStatusEffects() {
+		if effect.Type == effectType {
+			count++
+		}
+	}
+	return count
+}
+
+// This function ticks the status effects on the player at the given time, recording the damage they deal as battle events.
+func (p *Player) TickPlayerStatusEffects(logger runtime.Logger, timestamp int64) {
+	health := p.Health
+	for effectType, damage := range TickStatusEffect(logger, p, timestamp) {
+		if damage <= 0 {
+			continue
+		}
+		p.SetBattleEvent(BattleEvent{
+			Event: EventDamageTaken,
+			StatusEffect: effectType,
+			Damage: damage,
+		})
+	}
+	p.RecordPlayerDeath(health, "")
+}
+
+// This function records the damage the player's status effects dealt to a target as battle events.
+func (p *Player) RecordStatusEffectDamage(targetID string, dealt map[StatusEffectType]int) {
+	for effectType, damage := range dealt {
+		if damage <= 0 {
+			continue
+		}
+		p.SetBattleEvent(BattleEvent{
+			Event: EventStatusEffectDamage,
+			Target: targetID,
+			StatusEffect: effectType,
+			Damage: damage,
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTickStatusEffectKeepsPartialInterval(t *testing.T) {
+	now := time.Now().Unix()
+	player := NewPlayer(UtilMakeUUID(), "tester")
+	player.Health = 50
+	player.StatusEffects = []*StatusEffect{
+		{Type: Poison, Modifier: -5, Duration: 30, Interval: 3, ExpiresAt: now + 30, UpdatedAt: now - 4},
+	}
+
+	TickStatusEffect(&testLogger{}, player, now)
+	if player.Health != 45 {
+		t.Fatalf("health = %d, want 45 after one interval", player.Health)
+	}
+	//The extra second counts towards the next interval instead of being dropped.
+	if player.StatusEffects[0].UpdatedAt != now - 1 {
+		t.Fatalf("updated at = %d, want %d", player.StatusEffects[0].UpdatedAt, now - 1)
+	}
+}
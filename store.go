@@ -0,0 +1,340 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"context"
+	"encoding/json"
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+var storeDataStorageKey = "store" //Storefront definition in the config collection.
+var PlayerStoreStorageKey = "store" //Player purchase history in the player data collection.
+
+const StoreReceiptLimit = 100 //Number of receipts kept per player for request id replays.
+
+// Information on a single storefront offer.  Contents can be a single item or a bundle of items and currencies.
+type StoreOffer struct {
+	ID string `json:"id"`
+	Name string `json:"name"`
+	Prices []Currency `json:"prices"` //Every price is debited, so an offer can cost more than one currency.
+	Contents []RewardInfo `json:"contents"` //What the player is granted.
+	PurchaseLimit int `json:"purchase_limit"` //Maximum purchases per player, 0 is unlimited.
+	StartAt int64 `json:"start_at"` //Timestamp of when the offer is available, 0 is always.
+	EndAt int64 `json:"end_at"` //Timestamp of when the offer is no longer available, 0 is never.
+}
+
+// Record of a completed purchase.
+type StoreReceipt struct {
+	RequestID string `json:"request_id"` //Client supplied id used to make purchases idempotent.
+	OfferID string `json:"offer_id"`
+	Prices []Currency `json:"prices"`
+	Contents []RewardInfo `json:"contents"`
+	PurchasedAt int64 `json:"purchased_at"`
+}
+
+// Player purchase history.
+type PlayerStore struct {
+	Purchases map[string]int `json:"purchases"` //Purchase counts by offer id.
+	Receipts []*StoreReceipt `json:"receipts"` //Most recent receipts, capped by StoreReceiptLimit.
+	version string //Storage version hash from the last read.
+}
+
+// Offer information as seen by a specific player.
+type PlayerStoreOffer struct {
+	StoreOffer
+	Remaining int `json:"remaining"` //Purchases left for the player, -1 is unlimited.
+}
+
+// Registry to hold all of the definitions.  Using a mutex here since the data could be live-ops driven meaning it could change after nakama init.
+// **NOTE: If the plan is to not update this information after nakama init then this paradigm can be change to a simple read-only map instead.
+var StoreRegistry = struct {
+	sync.RWMutex //Read/write mutex to help with concurrent access allowing mulitple readers or a single writer.
+	Offers map[string]StoreOffer
+}{
+	Offers: make(map[string]StoreOffer),
+}
+
+// This function will initialize the Store Registry.
+func InitStoreRegistry(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) error {
+	//Read from the storage engine.
+	rObj, err := nk.StorageRead(ctx, []*runtime.StorageRead{
+		{
+			Collection: configDataStorageCollection,
+			Key: storeDataStorageKey,
+		},
+	})
+	if err != nil {
+		logger.Error("Error getting store configuration data: %v", err)
+		return err
+	}
+	//Load defaults if nothing was found in storage and save them into storage.
+	if len(rObj) == 0 {
+		StoreRegistry.Lock()  //Call lock on the mutex in preparation for writing.
+		StoreRegistry.Offers["health_potion"] = StoreOffer{
+			ID: "health_potion",
+			Name: "Health Potion",
+			Prices: []Currency{{Type: Gold, Amount: 25}},
+			Contents: []RewardInfo{{Type: ItemReward, Amount: 1, ItemID: HealthPotion}},
+		}
+		StoreRegistry.Offers["antidote"] = StoreOffer{
+			ID: "antidote",
+			Name: "Antidote",
+			Prices: []Currency{{Type: Gold, Amount: 20}},
+			Contents: []RewardInfo{{Type: ItemReward, Amount: 1, ItemID: Antidote}},
+		}
+		StoreRegistry.Offers["bandage"] = StoreOffer{
+			ID: "bandage",
+			Name: "Bandage",
+			Prices: []Currency{{Type: Gold, Amount: 15}},
+			Contents: []RewardInfo{{Type: ItemReward, Amount: 1, ItemID: Bandage}},
+		}
+		StoreRegistry.Offers["starter_bundle"] = StoreOffer{
+			ID: "starter_bundle",
+			Name: "Starter Bundle",
+			Prices: []Currency{{Type: Gold, Amount: 100}, {Type: Gems, Amount: 2}},
+			Contents: []RewardInfo{
+				{Type: ItemReward, Amount: 3, ItemID: HealthPotion},
+				{Type: ItemReward, Amount: 1, ItemID: Antidote},
+				{Type: ItemReward, Amount: 1, ItemID: Bandage},
+				{Type: ItemReward, Amount: 1, ItemID: RustySword},
+			},
+			PurchaseLimit: 1,
+		}
+		StoreRegistry.Offers["lucky_charm"] = StoreOffer{
+			ID: "lucky_charm",
+			Name: "Lucky Charm",
+			Prices: []Currency{{Type: Gems, Amount: 10}},
+			Contents: []RewardInfo{{Type: ItemReward, Amount: 1, ItemID: LuckyCharm}},
+			PurchaseLimit: 1,
+		}
+		StoreRegistry.Unlock() //Don't forget to release the mutex lock.
+		return SaveStoreRegistry(nk)
+	}
+
+	var offers map[string]StoreOffer
+	if err := json.Unmarshal([]byte(rObj[0].Value), &offers); err != nil {
+		logger.Error("Failed to unmarshal store data: %v", err)
+		return err
+	}
+	StoreRegistry.Lock()  //Call lock on the mutex in preparation for writing.
+	StoreRegistry.Offers = offers
+	StoreRegistry.Unlock() //Don't forget to release the mutex lock.
+
+	return nil
+}
+
+// This function will save the Store Registry to storage.
+func SaveStoreRegistry(nk runtime.NakamaModule) error {
+	StoreRegistry.RLock() //Read lock.
+	//Json-ify the store registry in prepartion for storage.
+	data, err := json.Marshal(StoreRegistry.Offers)
+	StoreRegistry.RUnlock() //Don't forget to release the lock.
+	if err != nil {
+		return err
+	}
+	wObj := []*runtime.StorageWrite{
+		{
+			Collection: configDataStorageCollection,
+			Key: storeDataStorageKey,
+			Value: string(data),
+			PermissionRead: 1, // Owner and runtime can read.
+			PermissionWrite: 0, // No one can write save the runtime.
+		},
+	}
+	//Write to the storage engine.
+	if _, err := nk.StorageWrite(context.Background(), wObj); err != nil {
+		return fmt.Errorf("failed to write store data to storage: %v", err)
+	}
+	return nil
+}
+
+// This function checks if the offer is inside its time window.
+func (o StoreOffer) IsActive(timestamp int64) bool {
+	if o.StartAt > 0 && timestamp < o.StartAt {
+		return false
+	}
+	if o.EndAt > 0 && timestamp >= o.EndAt {
+		return false
+	}
+	return true
+}
+
+// This function gets the player purchase history from nakama storage.
+func LoadPlayerStore(ctx context.Context, nk runtime.NakamaModule, userID string) (*PlayerStore, error) {
+	//Read from the storage engine.
+	rObj, err := nk.StorageRead(ctx, []*runtime.StorageRead{
+		{
+			Collection: playerDataStorageCollection,
+			Key: PlayerStoreStorageKey,
+			UserID: userID,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	store := &PlayerStore{
+		Purchases: make(map[string]int),
+		Receipts: []*StoreReceipt{},
+	}
+	if len(rObj) == 0 {
+		store.version = "*" //Only write if no one else created it first.
+		return store, nil
+	}
+	//Unmarshal json data to store object.
+	if err = json.Unmarshal([]byte(rObj[0].Value), store); err != nil {
+		return nil, err
+	}
+	if store.Purchases == nil {
+		store.Purchases = make(map[string]int)
+	}
+	store.version = rObj[0].Version
+	return store, nil
+}
+
+// This function builds the storage write for the purchase history so it can be batched with the player data.
+func (s *PlayerStore) StoreStorageWrite(userID string) (*runtime.StorageWrite, error) {
+	//Json-ify the store struct in prepartion for storage.
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	return &runtime.StorageWrite{
+		Collection: playerDataStorageCollection,
+		Key: PlayerStoreStorageKey,
+		UserID: userID,
+		Value: string(data),
+		Version: s.version,
+		PermissionRead: 1, // Owner and runtime can read.
+		PermissionWrite: 0, // No one can write save the runtime.
+	}, nil
+}
+
+// This function looks for an earlier receipt with the same request id.
+func (s *PlayerStore) GetReceipt(requestID string) *StoreReceipt {
+	for _, receipt := range s.Receipts {
+		if receipt.RequestID == requestID {
+			return receipt
+		}
+	}
+	return nil
+}
+
+// This function lists the active offers along with how many more times the player can buy each one.
+func (s *PlayerStore) ListOffers(timestamp int64) []PlayerStoreOffer {
+	StoreRegistry.RLock() //Read lock.
+	defer StoreRegistry.RUnlock() //Don't forget to release the lock.
+	offers := []PlayerStoreOffer{}
+	for _, offer := range StoreRegistry.Offers {
+		if !offer.IsActive(timestamp) {
+			continue
+		}
+		remaining := -1
+		if offer.PurchaseLimit > 0 {
+			remaining = offer.PurchaseLimit - s.Purchases[offer.ID]
+			if remaining < 0 {
+				remaining = 0
+			}
+		}
+		offers = append(offers, PlayerStoreOffer{StoreOffer: offer, Remaining: remaining})
+	}
+	return offers
+}
+
+// This function gets the amount the player has of a currency.
+func (p *Player) GetCurrency(currencyType CurrencyType) int64 {
+	for _, currency := range p.Currencies {
+		if currency.Type == currencyType {
+			return currency.Amount
+		}
+	}
+	return 0
+}
+
+// This function validates an offer, debits the player and grants the contents.  A request id that was already used
+// returns the earlier receipt and true without charging the player again.
+func (p *Player) Purchase(logger runtime.Logger, store *PlayerStore, offerID, requestID string) (*StoreReceipt, bool, error) {
+	if requestID == "" {
+		return nil, false, NewFieldError("request_id", "A request id is required.")
+	}
+	//Replay an earlier purchase.
+	if receipt := store.GetReceipt(requestID); receipt != nil {
+		if receipt.OfferID != offerID {
+			return nil, false, NewGameError(CodeAlreadyExists, ReasonRequestIDReused, fmt.Sprintf("Request id already used for offer: %s", receipt.OfferID))
+		}
+		logger.Debug("Replaying purchase: %+v", receipt)
+		return receipt, true, nil
+	}
+
+	//Check offer.
+	StoreRegistry.RLock() //Read lock.
+	offer, exists := StoreRegistry.Offers[offerID]
+	StoreRegistry.RUnlock() //Release read lock.
+	if !exists {
+		return nil, false, NewGameError(CodeNotFound, ReasonOfferNotFound, fmt.Sprintf("Store offer not found: %s", offerID))
+	}
+	timestamp := p.Now().Unix()
+	if !offer.IsActive(timestamp) {
+		return nil, false, NewGameError(CodeFailedPrecondition, ReasonOfferUnavailable, fmt.Sprintf("Store offer not available: %s", offerID))
+	}
+	if offer.PurchaseLimit > 0 && store.Purchases[offerID] >= offer.PurchaseLimit {
+		return nil, false, NewGameError(CodeFailedPrecondition, ReasonPurchaseLimit, fmt.Sprintf("Store offer purchase limit reached: %s", offerID))
+	}
+	//Make sure the player can afford every price before debiting any of them.
+	for _, price := range offer.Prices {
+		if p.GetCurrency(price.Type) < price.Amount {
+			return nil, false, NewGameError(CodeFailedPrecondition, ReasonInsufficientFunds, fmt.Sprintf("Insufficient %s for offer: %s", price.Type, offerID))
+		}
+	}
+
+	//Debit and grant.
+	for _, price := range offer.Prices {
+		p.AddCurrency(price.Type, price.Amount * -1)
+	}
+	p.GrantRewards(logger, offer.Contents)
+
+	//Record the purchase.
+	receipt := &StoreReceipt{
+		RequestID: requestID,
+		OfferID: offerID,
+		Prices: offer.Prices,
+		Contents: offer.Contents,
+		PurchasedAt: timestamp,
+	}
+	store.Purchases[offerID]++
+	store.Receipts = append(store.Receipts, receipt)
+	if len(store.Receipts) > StoreReceiptLimit {
+		store.Receipts = store.Receipts[len(store.Receipts)-StoreReceiptLimit:]
+	}
+	return receipt, false, nil
+}
+
+// This function saves the player and purchase history in one storage write so the debit and grant land together or not at all.
+func SavePurchase(ctx context.Context, nk runtime.NakamaModule, player *Player, store *PlayerStore) error {
+	playerWrite, err := player.PlayerStorageWrite()
+	if err != nil {
+		return err
+	}
+	storeWrite, err := store.StoreStorageWrite(player.ID)
+	if err != nil {
+		return err
+	}
+	//Write to the storage engine, versions make this fail if either object changed since it was read.
+	acks, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{playerWrite, storeWrite})
+	if err != nil {
+		return NewGameError(CodeAborted, ReasonConflict, "Purchase was not saved, try again.")
+	}
+	player.SetStorageVersion(acks)
+	store.SetStorageVersion(acks, player.ID)
+	return nil
+}
+
+// This function keeps the storage version current after a write.
+func (s *PlayerStore) SetStorageVersion(acks []*api.StorageObjectAck, userID string) {
+	for _, ack := range acks {
+		if ack.Collection == playerDataStorageCollection && ack.Key == PlayerStoreStorageKey && ack.UserId == userID {
+			s.version = ack.Version
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+func testStore(t *testing.T) *testNakama {
+	t.Helper()
+	nk := newTestNakama()
+	for _, init := range []func(context.Context, runtime.Logger, runtime.NakamaModule) error{InitItemRegistry, InitStoreRegistry} {
+		if err := init(context.Background(), &testLogger{}, nk); err != nil {
+			t.Fatalf("init registry: %v", err)
+		}
+	}
+	return nk
+}
+
+func TestPurchaseInsufficientFunds(t *testing.T) {
+	nk := testStore(t)
+	player := NewPlayer(UtilMakeUUID(), "tester")
+	store, err := LoadPlayerStore(context.Background(), nk, player.ID)
+	if err != nil {
+		t.Fatalf("LoadPlayerStore: %v", err)
+	}
+	player.AddCurrency(Gems, player.GetCurrency(Gems) * -1)
+	gold := player.GetCurrency(Gold)
+
+	//The gold price is affordable but nothing is debited when the gems aren't.
+	_, _, err = player.Purchase(&testLogger{}, store, "starter_bundle", "buy-1")
+	if code, body := testErrorBody(t, err); code != CodeFailedPrecondition || body.Reason != ReasonInsufficientFunds {
+		t.Fatalf("expected insufficient funds, got %d %+v", code, body)
+	}
+	if player.GetCurrency(Gold) != gold || len(store.Receipts) != 0 || store.Purchases["starter_bundle"] != 0 {
+		t.Fatalf("failed purchase changed the player: gold %d store %+v", player.GetCurrency(Gold), store)
+	}
+}
+
+func TestPurchaseLimitAndReplay(t *testing.T) {
+	nk := testStore(t)
+	player := NewPlayer(UtilMakeUUID(), "tester")
+	player.AddCurrency(Gold, 1000)
+	player.AddCurrency(Gems, 10)
+	store, err := LoadPlayerStore(context.Background(), nk, player.ID)
+	if err != nil {
+		t.Fatalf("LoadPlayerStore: %v", err)
+	}
+	receipt, replayed, err := player.Purchase(&testLogger{}, store, "starter_bundle", "buy-1")
+	if err != nil || replayed {
+		t.Fatalf("first purchase: replayed %v: %v", replayed, err)
+	}
+	if err := SavePurchase(context.Background(), nk, player, store); err != nil {
+		t.Fatalf("SavePurchase: %v", err)
+	}
+	gold, gems := player.GetCurrency(Gold), player.GetCurrency(Gems)
+
+	//Retrying with the same request id returns the receipt without charging again.
+	replay, replayed, err := player.Purchase(&testLogger{}, store, "starter_bundle", "buy-1")
+	if err != nil || !replayed || replay != receipt {
+		t.Fatalf("expected the first receipt back, got %+v replayed %v: %v", replay, replayed, err)
+	}
+	if player.GetCurrency(Gold) != gold || player.GetCurrency(Gems) != gems || store.Purchases["starter_bundle"] != 1 {
+		t.Fatalf("replay charged the player again: gold %d gems %d", player.GetCurrency(Gold), player.GetCurrency(Gems))
+	}
+	_, _, err = player.Purchase(&testLogger{}, store, "health_potion", "buy-1")
+	if code, body := testErrorBody(t, err); code != CodeAlreadyExists || body.Reason != ReasonRequestIDReused {
+		t.Fatalf("expected a reused request id for another offer to fail, got %d %+v", code, body)
+	}
+
+	//A new request id hits the limit of one.
+	_, _, err = player.Purchase(&testLogger{}, store, "starter_bundle", "buy-2")
+	if code, body := testErrorBody(t, err); code != CodeFailedPrecondition || body.Reason != ReasonPurchaseLimit {
+		t.Fatalf("expected the purchase limit, got %d %+v", code, body)
+	}
+
+	//The history was saved with the player so a fresh load still replays.
+	loaded, err := LoadPlayerStore(context.Background(), nk, player.ID)
+	if err != nil {
+		t.Fatalf("LoadPlayerStore: %v", err)
+	}
+	if loaded.GetReceipt("buy-1") == nil || loaded.Purchases["starter_bundle"] != 1 {
+		t.Fatalf("purchase history not saved: %+v", loaded)
+	}
+}
+
+func TestSavePurchaseConflict(t *testing.T) {
+	nk := testStore(t)
+	player := NewPlayer(UtilMakeUUID(), "tester")
+	store, err := LoadPlayerStore(context.Background(), nk, player.ID)
+	if err != nil {
+		t.Fatalf("LoadPlayerStore: %v", err)
+	}
+	//Another request saves the history first, the stale store must not overwrite it.
+	other, _ := LoadPlayerStore(context.Background(), nk, player.ID)
+	if err := SavePurchase(context.Background(), nk, NewPlayer(player.ID, "tester"), other); err != nil {
+		t.Fatalf("SavePurchase: %v", err)
+	}
+	if _, _, err := player.Purchase(&testLogger{}, store, "bandage", "buy-1"); err != nil {
+		t.Fatalf("Purchase: %v", err)
+	}
+	err = SavePurchase(context.Background(), nk, player, store)
+	if code, body := testErrorBody(t, err); code != CodeAborted || body.Reason != ReasonConflict {
+		t.Fatalf("expected a conflict, got %d %+v", code, body)
+	}
+}
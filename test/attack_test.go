@@ -1,7 +0,0 @@
-package main_test
-
-import (
-	"testing"
-	"github.com/nakama-sandbox"
-)
-